@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/stringid"
@@ -40,6 +43,10 @@ const (
 	sbPIDQr  = "{" + urlSbPID + ":" + qregx + "}"
 	cnIDQr   = "{" + urlCnID + ":" + qregx + "}"
 	cnPIDQr  = "{" + urlCnPID + ":" + qregx + "}"
+	forceQr  = "{" + urlForce + ":" + qregx + "}"
+	dryRunQr = "{" + urlDryRun + ":" + qregx + "}"
+	ipamDrv  = "{" + urlIpam + ":" + regex + "}"
+	poolID   = "{" + urlPool + ":.+}" // address space and pools, slash separated
 
 	// Internal URL variable name.They can be anything as
 	// long as they do not collide with query fields.
@@ -53,6 +60,10 @@ const (
 	urlSbPID  = "sandbox-partial-id"
 	urlCnID   = "container-id"
 	urlCnPID  = "container-partial-id"
+	urlForce  = "force-flag"
+	urlDryRun = "dry-run-flag"
+	urlIpam   = "ipam-driver"
+	urlPool   = "pool-id"
 )
 
 // NewHTTPHandler creates and initialize the HTTP handler to serve the requests for libnetwork
@@ -116,6 +127,10 @@ func (h *httpHandler) initRouter() {
 			{"/sandboxes", []string{"partial-id", sbPIDQr}, procGetSandboxes},
 			{"/sandboxes", nil, procGetSandboxes},
 			{"/sandboxes/" + sbID, nil, procGetSandbox},
+			{"/reconcile", nil, procReconcile},
+			{"/ipam/" + ipamDrv, nil, procGetAddressSpaces},
+			{"/ipam/" + ipamDrv + "/pools/" + poolID, nil, procGetPool},
+			{"/ipam/" + ipamDrv + "/export", nil, procExportIpam},
 		},
 		"POST": {
 			{"/networks", nil, procCreateNetwork},
@@ -124,8 +139,17 @@ func (h *httpHandler) initRouter() {
 			{"/services", nil, procPublishService},
 			{"/services/" + epID + "/backend", nil, procAttachBackend},
 			{"/sandboxes", nil, procCreateSandbox},
+			{"/reconcile", nil, procRepair},
+			{"/ipam/" + ipamDrv + "/import", nil, procImportIpam},
+		},
+		"PUT": {
+			{"/networks/" + nwID, nil, procUpdateNetwork},
 		},
 		"DELETE": {
+			// Order matters: a dry run never deletes, even if forced
+			{"/networks/" + nwID, []string{"dry-run", dryRunQr, "force", forceQr}, procDeleteNetwork},
+			{"/networks/" + nwID, []string{"dry-run", dryRunQr}, procDeleteNetwork},
+			{"/networks/" + nwID, []string{"force", forceQr}, procDeleteNetwork},
 			{"/networks/" + nwID, nil, procDeleteNetwork},
 			{"/networks/" + nwID + "/endpoints/" + epID, nil, procDeleteEndpoint},
 			{"/networks/" + nwID + "/endpoints/" + epID + "/sandboxes/" + sbID, nil, procLeaveEndpoint},
@@ -149,6 +173,11 @@ func (h *httpHandler) initRouter() {
 			}
 		}
 	}
+
+	// The event stream is not a request/response exchange, it
+	// is served outside of the processor based handlers
+	h.r.Path("/{.*}/events").Methods("GET").HandlerFunc(h.streamEvents)
+	h.r.Path("/events").Methods("GET").HandlerFunc(h.streamEvents)
 }
 
 func makeHandler(ctrl libnetwork.NetworkController, fct processor) http.HandlerFunc {
@@ -176,6 +205,75 @@ func makeHandler(ctrl libnetwork.NetworkController, fct processor) http.HandlerF
 	}
 }
 
+// streamEvents writes the controller events matching the "type" and
+// "network" query parameters as a stream of JSON objects, flushing each
+// one as it is published, until the client goes away.
+func (h *httpHandler) streamEvents(w http.ResponseWriter, req *http.Request) {
+	filter, rsp := parseEventFilter(h.c, req)
+	if !rsp.isOK() {
+		http.Error(w, rsp.Status, rsp.StatusCode)
+		return
+	}
+
+	evCh, cancel := h.c.Subscribe(filter)
+	defer cancel()
+
+	var closeCh <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closeCh = cn.CloseNotify()
+	}
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev, ok := <-evCh:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-closeCh:
+			return
+		}
+	}
+}
+
+func parseEventFilter(c libnetwork.NetworkController, req *http.Request) (libnetwork.EventFilter, *responseStatus) {
+	var filter libnetwork.EventFilter
+
+	q := req.URL.Query()
+	for _, v := range q["type"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, libnetwork.EventType(t))
+			}
+		}
+	}
+
+	if nw := q.Get("network"); nw != "" {
+		n, rsp := findNetwork(c, nw, byName)
+		if !rsp.isOK() {
+			if n, rsp = findNetwork(c, nw, byID); !rsp.isOK() {
+				return filter, rsp
+			}
+		}
+		filter.NetworkID = n.ID()
+	}
+
+	return filter, &successResponse
+}
+
 /*****************
  Resource Builders
 ******************/
@@ -186,6 +284,9 @@ func buildNetworkResource(nw libnetwork.Network) *networkResource {
 		r.Name = nw.Name()
 		r.ID = nw.ID()
 		r.Type = nw.Type()
+		if labels := nw.Info().Labels(); len(labels) > 0 {
+			r.Labels = labels
+		}
 		epl := nw.Endpoints()
 		r.Endpoints = make([]*endpointResource, 0, len(epl))
 		for _, e := range epl {
@@ -202,6 +303,44 @@ func buildEndpointResource(ep libnetwork.Endpoint) *endpointResource {
 		r.Name = ep.Name()
 		r.ID = ep.ID()
 		r.Network = ep.Network()
+		if info := ep.Info(); info != nil {
+			if iface := info.Iface(); iface != nil {
+				if iface.Address() != nil {
+					r.Address = iface.Address().String()
+				}
+				if iface.AddressIPv6() != nil {
+					r.AddressIPv6 = iface.AddressIPv6().String()
+				}
+				if mac := iface.MacAddress(); len(mac) != 0 {
+					r.MacAddress = mac.String()
+				}
+				for _, addr := range iface.AdditionalAddresses() {
+					r.Additional = append(r.Additional, addr.String())
+				}
+			}
+			r.VirtualIPs = info.VirtualIPs()
+			if lb := info.LoadBalancer(); lb != nil {
+				r.LoadBalancer = &loadBalancer{Scheduler: lb.Scheduler, Method: lb.Method, SandboxID: lb.SandboxID}
+			}
+			if hc := info.HealthCheck(); hc != nil {
+				r.HealthCheck = &healthCheck{
+					Type:      hc.Type,
+					Port:      hc.Port,
+					Path:      hc.Path,
+					Interval:  hc.Interval.String(),
+					Timeout:   hc.Timeout.String(),
+					Threshold: hc.Threshold,
+				}
+			}
+			if hs := info.Health(); hs != nil {
+				r.Health = &healthStatus{
+					Status:        hs.Status,
+					FailingStreak: hs.FailingStreak,
+					LastCheck:     hs.LastCheck,
+					LastError:     hs.LastError,
+				}
+			}
+		}
 	}
 	return r
 }
@@ -240,6 +379,9 @@ func (sc *sandboxCreate) parseOptions() []libnetwork.SandboxOption {
 	if sc.UseExternalKey {
 		setFctList = append(setFctList, libnetwork.OptionUseExternalKey())
 	}
+	if sc.UseEmbeddedDNS {
+		setFctList = append(setFctList, libnetwork.OptionUseEmbeddedDNS())
+	}
 	if sc.DNS != nil {
 		for _, d := range sc.DNS {
 			setFctList = append(setFctList, libnetwork.OptionDNS(d))
@@ -284,6 +426,9 @@ func procCreateNetwork(c libnetwork.NetworkController, vars map[string]string, b
 	if len(create.DriverOpts) > 0 {
 		options = append(options, libnetwork.NetworkOptionDriverOpts(create.DriverOpts))
 	}
+	if len(create.Labels) > 0 {
+		options = append(options, libnetwork.NetworkOptionLabels(create.Labels))
+	}
 	nw, err := c.NewNetwork(create.NetworkType, create.Name, options...)
 	if err != nil {
 		return "", convertNetworkError(err)
@@ -373,6 +518,20 @@ func procCreateEndpoint(c libnetwork.NetworkController, vars map[string]string,
 	if ec.PortMapping != nil {
 		setFctList = append(setFctList, libnetwork.CreateOptionPortMapping(ec.PortMapping))
 	}
+	if ec.VirtualIPs != nil {
+		if errRsp := validateVirtualIPs(ec.VirtualIPs); !errRsp.isOK() {
+			return "", errRsp
+		}
+		setFctList = append(setFctList, libnetwork.CreateOptionVirtualIP(ec.VirtualIPs...))
+	}
+	addrOpts, errRsp := buildAddressOptions(ec.Address, ec.AddressIPv6, ec.MacAddress)
+	if !errRsp.isOK() {
+		return "", errRsp
+	}
+	setFctList = append(setFctList, addrOpts...)
+	for _, aa := range ec.Additional {
+		setFctList = append(setFctList, libnetwork.CreateOptionAdditionalAddress(aa.Pool, aa.Address))
+	}
 
 	ep, err := n.CreateEndpoint(ec.Name, setFctList...)
 	if err != nil {
@@ -434,6 +593,60 @@ func procGetEndpoints(c libnetwork.NetworkController, vars map[string]string, bo
 	return list, &successResponse
 }
 
+func procUpdateNetwork(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	var update networkUpdate
+
+	err := json.Unmarshal(body, &update)
+	if err != nil {
+		return nil, &responseStatus{Status: "Invalid body: " + err.Error(), StatusCode: http.StatusBadRequest}
+	}
+
+	target, by := detectNetworkTarget(vars)
+	nw, errRsp := findNetwork(c, target, by)
+	if !errRsp.isOK() {
+		return nil, errRsp
+	}
+
+	options := []libnetwork.NetworkOption{}
+	if update.Labels != nil {
+		options = append(options, libnetwork.NetworkOptionLabels(update.Labels))
+	}
+	if len(update.DriverOpts) > 0 {
+		opts := make(map[string]string)
+		for k, v := range nw.Info().DriverOptions() {
+			opts[k] = v
+		}
+		for k, v := range update.DriverOpts {
+			opts[k] = v
+		}
+		options = append(options, libnetwork.NetworkOptionDriverOpts(opts))
+	}
+	if len(update.IPv4Pools) > 0 || len(update.IPv6Pools) > 0 {
+		ipamType, v4, v6 := nw.Info().IpamConfig()
+		options = append(options, libnetwork.NetworkOptionIpam(ipamType, "",
+			append(v4, buildIpamConf(update.IPv4Pools)...), append(v6, buildIpamConf(update.IPv6Pools)...)))
+	}
+
+	if err := nw.Update(options...); err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	return nil, &successResponse
+}
+
+func buildIpamConf(pools []ipamPool) []*libnetwork.IpamConf {
+	var l []*libnetwork.IpamConf
+	for _, p := range pools {
+		l = append(l, &libnetwork.IpamConf{
+			PreferredPool: p.Pool,
+			SubPool:       p.SubPool,
+			Gateway:       p.Gateway,
+			AuxAddresses:  p.AuxAddresses,
+		})
+	}
+	return l
+}
+
 func procDeleteNetwork(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
 	target, by := detectNetworkTarget(vars)
 
@@ -442,7 +655,32 @@ func procDeleteNetwork(c libnetwork.NetworkController, vars map[string]string, b
 		return nil, errRsp
 	}
 
-	err := nw.Delete()
+	if v, ok := vars[urlDryRun]; ok {
+		dryRun, errRsp := parseQueryFlag(v)
+		if !errRsp.isOK() {
+			return nil, errRsp
+		}
+		if dryRun {
+			deps, err := nw.Dependencies()
+			if err != nil {
+				return nil, convertNetworkError(err)
+			}
+			return deps, &successResponse
+		}
+	}
+
+	var options []libnetwork.NetworkDeleteOption
+	if v, ok := vars[urlForce]; ok {
+		force, errRsp := parseQueryFlag(v)
+		if !errRsp.isOK() {
+			return nil, errRsp
+		}
+		if force {
+			options = append(options, libnetwork.NetworkDeleteOptionForce())
+		}
+	}
+
+	err := nw.Delete(options...)
 	if err != nil {
 		return nil, convertNetworkError(err)
 	}
@@ -450,6 +688,19 @@ func procDeleteNetwork(c libnetwork.NetworkController, vars map[string]string, b
 	return nil, &successResponse
 }
 
+// parseQueryFlag returns the value of a boolean query field. A field
+// present with an empty value is true.
+func parseQueryFlag(v string) (bool, *responseStatus) {
+	if v == "" {
+		return true, &successResponse
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &badQueryResponse
+	}
+	return b, &successResponse
+}
+
 /******************
  Endpoint interface
 *******************/
@@ -609,6 +860,34 @@ func procPublishService(c libnetwork.NetworkController, vars map[string]string,
 	if sp.PortMapping != nil {
 		setFctList = append(setFctList, libnetwork.CreateOptionPortMapping(sp.PortMapping))
 	}
+	if sp.VirtualIPs != nil {
+		if errRsp := validateVirtualIPs(sp.VirtualIPs); !errRsp.isOK() {
+			return "", errRsp
+		}
+		setFctList = append(setFctList, libnetwork.CreateOptionVirtualIP(sp.VirtualIPs...))
+	}
+	addrOpts, errRsp := buildAddressOptions(sp.Address, sp.AddressIPv6, sp.MacAddress)
+	if !errRsp.isOK() {
+		return "", errRsp
+	}
+	setFctList = append(setFctList, addrOpts...)
+	for _, aa := range sp.Additional {
+		setFctList = append(setFctList, libnetwork.CreateOptionAdditionalAddress(aa.Pool, aa.Address))
+	}
+	if sp.LoadBalancer != nil {
+		setFctList = append(setFctList, libnetwork.CreateOptionLoadBalancer(&libnetwork.LoadBalancer{
+			Scheduler: sp.LoadBalancer.Scheduler,
+			Method:    sp.LoadBalancer.Method,
+			SandboxID: sp.LoadBalancer.SandboxID,
+		}))
+	}
+	if sp.HealthCheck != nil {
+		hc, errRsp := buildHealthCheck(sp.HealthCheck)
+		if !errRsp.isOK() {
+			return "", errRsp
+		}
+		setFctList = append(setFctList, libnetwork.CreateOptionHealthCheck(hc))
+	}
 
 	// Pass Custom Create Endpoint Options
 	setFctList = append(setFctList, libnetwork.CreateOptionContainerID(stringid.GenerateNonCryptoID()))
@@ -763,6 +1042,88 @@ func procDeleteSandbox(c libnetwork.NetworkController, vars map[string]string, b
 	return nil, &successResponse
 }
 
+/*************
+ Maintenance
+**************/
+func procReconcile(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	return reconcile(c, false)
+}
+
+func procRepair(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	return reconcile(c, true)
+}
+
+func reconcile(c libnetwork.NetworkController, repair bool) (interface{}, *responseStatus) {
+	il, err := c.Reconcile(repair)
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	if il == nil {
+		il = []libnetwork.Inconsistency{}
+	}
+
+	return il, &successResponse
+}
+
+/******************
+ IPAM interface
+*******************/
+func procGetAddressSpaces(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	ins, err := c.IpamInspector(vars[urlIpam])
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	spaces, err := ins.AddressSpaces()
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	return spaces, &successResponse
+}
+
+func procGetPool(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	ins, err := c.IpamInspector(vars[urlIpam])
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	pool, err := ins.Pool(vars[urlPool])
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	return pool, &successResponse
+}
+
+func procExportIpam(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	exp, err := c.IpamExporter(vars[urlIpam])
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	doc, err := exp.Export()
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	return json.RawMessage(doc), &successResponse
+}
+
+func procImportIpam(c libnetwork.NetworkController, vars map[string]string, body []byte) (interface{}, *responseStatus) {
+	exp, err := c.IpamExporter(vars[urlIpam])
+	if err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	if err := exp.Import(body); err != nil {
+		return nil, convertNetworkError(err)
+	}
+
+	return nil, &successResponse
+}
+
 /***********
   Utilities
 ************/
@@ -896,6 +1257,71 @@ func findService(c libnetwork.NetworkController, svs string, svBy int) (libnetwo
 	return nil, &responseStatus{Status: "Service not found", StatusCode: http.StatusNotFound}
 }
 
+func validateVirtualIPs(vips []string) *responseStatus {
+	for _, vip := range vips {
+		if _, _, err := net.ParseCIDR(vip); err != nil {
+			return &responseStatus{Status: fmt.Sprintf("Invalid virtual ip %q: must be in CIDR notation", vip), StatusCode: http.StatusBadRequest}
+		}
+	}
+	return &successResponse
+}
+
+// buildAddressOptions validates the static addresses requested for an
+// endpoint and returns the options setting them
+func buildAddressOptions(addr, addrV6, mac string) ([]libnetwork.EndpointOption, *responseStatus) {
+	var (
+		opts       []libnetwork.EndpointOption
+		ipV4, ipV6 net.IP
+	)
+
+	if addr != "" {
+		if ipV4 = net.ParseIP(addr); ipV4 == nil || ipV4.To4() == nil {
+			return nil, &responseStatus{Status: fmt.Sprintf("Invalid IPv4 address %q", addr), StatusCode: http.StatusBadRequest}
+		}
+	}
+	if addrV6 != "" {
+		if ipV6 = net.ParseIP(addrV6); ipV6 == nil || ipV6.To4() != nil {
+			return nil, &responseStatus{Status: fmt.Sprintf("Invalid IPv6 address %q", addrV6), StatusCode: http.StatusBadRequest}
+		}
+	}
+	if ipV4 != nil || ipV6 != nil {
+		opts = append(opts, libnetwork.CreateOptionIpam(ipV4, ipV6))
+	}
+
+	if mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil || len(hw) != 6 || hw[0]&0x01 != 0 {
+			return nil, &responseStatus{Status: fmt.Sprintf("Invalid mac address %q: must be a unicast ethernet address", mac), StatusCode: http.StatusBadRequest}
+		}
+		opts = append(opts, libnetwork.CreateOptionMacAddress(hw))
+	}
+
+	return opts, &successResponse
+}
+
+func buildHealthCheck(r *healthCheck) (*libnetwork.HealthCheck, *responseStatus) {
+	hc := &libnetwork.HealthCheck{
+		Type:      r.Type,
+		Port:      r.Port,
+		Path:      r.Path,
+		Threshold: r.Threshold,
+	}
+
+	var err error
+	if r.Interval != "" {
+		if hc.Interval, err = time.ParseDuration(r.Interval); err != nil {
+			return nil, &responseStatus{Status: fmt.Sprintf("Invalid health check interval %q: %v", r.Interval, err), StatusCode: http.StatusBadRequest}
+		}
+	}
+	if r.Timeout != "" {
+		if hc.Timeout, err = time.ParseDuration(r.Timeout); err != nil {
+			return nil, &responseStatus{Status: fmt.Sprintf("Invalid health check timeout %q: %v", r.Timeout, err), StatusCode: http.StatusBadRequest}
+		}
+	}
+
+	return hc, &successResponse
+}
+
 func endpointToService(rsp *responseStatus) *responseStatus {
 	rsp.Status = strings.Replace(rsp.Status, "endpoint", "service", -1)
 	return rsp
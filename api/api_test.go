@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
@@ -16,6 +17,7 @@ import (
 	"github.com/docker/libnetwork"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/drivers/bridge"
+	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/testutils"
@@ -145,9 +147,10 @@ func TestSandboxOptionParser(t *testing.T) {
 		DNS:               dnss,
 		ExtraHosts:        ehs,
 		UseDefaultSandbox: true,
+		UseEmbeddedDNS:    true,
 	}
 
-	if len(sb.parseOptions()) != 9 {
+	if len(sb.parseOptions()) != 10 {
 		t.Fatalf("Failed to generate all libnetwork.SandboxOption methods")
 	}
 }
@@ -282,6 +285,84 @@ func TestCreateDeleteNetwork(t *testing.T) {
 
 }
 
+func TestUpdateNetwork(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nc := networkCreate{
+		Name:        "network",
+		NetworkType: bridgeNetType,
+		DriverOpts:  map[string]string{bridge.BridgeName: "abc"},
+		Labels:      map[string]string{"tier": "frontend"},
+	}
+	body, err := json.Marshal(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errRsp := procCreateNetwork(c, nil, body); errRsp != &createdResponse {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+
+	vars := map[string]string{urlNwName: "network"}
+	i, errRsp := procGetNetwork(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+	if nr := i.(*networkResource); nr.Labels["tier"] != "frontend" {
+		t.Fatalf("Expected network labels, got %v", nr.Labels)
+	}
+
+	if _, errRsp = procUpdateNetwork(c, vars, []byte("bad body")); errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected StatusBadRequest status code, got: %v", errRsp)
+	}
+
+	nu := networkUpdate{
+		Labels:     map[string]string{"tier": "backend"},
+		DriverOpts: map[string]string{netlabel.DriverMTU: "1400"},
+	}
+	body, err = json.Marshal(nu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errRsp = procUpdateNetwork(c, vars, body); errRsp != &successResponse {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+
+	nw, err := c.NetworkByName("network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nw.Info().Labels()["tier"] != "backend" {
+		t.Fatalf("Labels were not updated: %v", nw.Info().Labels())
+	}
+	opts := nw.Info().DriverOptions()
+	if opts[netlabel.DriverMTU] != "1400" || opts[bridge.BridgeName] != "abc" {
+		t.Fatalf("Driver options were not merged: %v", opts)
+	}
+
+	nu = networkUpdate{DriverOpts: map[string]string{bridge.BridgeName: "xyz"}}
+	body, err = json.Marshal(nu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errRsp = procUpdateNetwork(c, vars, body); errRsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected StatusForbidden status code, got: %v", errRsp)
+	}
+
+	vars[urlNwName] = "unknown"
+	if _, errRsp = procUpdateNetwork(c, vars, body); errRsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected StatusNotFound status code, got: %v", errRsp)
+	}
+}
+
 func TestGetNetworksAndEndpoints(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 
@@ -892,6 +973,125 @@ func TestProcPublishUnpublishService(t *testing.T) {
 	}
 }
 
+func TestPublishServiceLoadBalancer(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	c, _ := createTestNetwork(t, "network")
+	defer c.Stop()
+
+	vars := make(map[string]string)
+
+	sp := servicePublish{
+		Name:         "web",
+		Network:      "network",
+		ExposedPorts: getExposedPorts(),
+		LoadBalancer: &loadBalancer{Method: "tunnel"},
+		VirtualIPs:   []string{"10.10.10.10/32"},
+	}
+	b, err := json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp := procPublishService(c, vars, b)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %d. Got: %v", http.StatusBadRequest, errRsp)
+	}
+
+	sp.LoadBalancer = &loadBalancer{}
+	sp.VirtualIPs = nil
+	b, err = json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procPublishService(c, vars, b)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %d. Got: %v", http.StatusBadRequest, errRsp)
+	}
+
+	sp.VirtualIPs = []string{"10.10.10.10/32"}
+	b, err = json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, errRsp := procPublishService(c, vars, b)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+
+	vars[urlEpID] = i2s(si)
+	i, errRsp := procGetService(c, vars, nil)
+	if !errRsp.isOK() {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+
+	lb := i.(*endpointResource).LoadBalancer
+	if lb == nil || lb.Scheduler != "rr" || lb.Method != "dr" {
+		t.Fatalf("Unexpected load balancer configuration: %v", lb)
+	}
+}
+
+func TestPublishServiceHealthCheck(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	c, _ := createTestNetwork(t, "network")
+	defer c.Stop()
+
+	vars := make(map[string]string)
+
+	sp := servicePublish{
+		Name:         "web",
+		Network:      "network",
+		ExposedPorts: getExposedPorts(),
+		HealthCheck:  &healthCheck{Type: "http", Interval: "often"},
+	}
+	b, err := json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp := procPublishService(c, vars, b)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %d. Got: %v", http.StatusBadRequest, errRsp)
+	}
+
+	sp.HealthCheck = &healthCheck{Type: "dns"}
+	b, err = json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procPublishService(c, vars, b)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %d. Got: %v", http.StatusBadRequest, errRsp)
+	}
+
+	sp.HealthCheck = &healthCheck{Type: "http", Path: "/status", Interval: "10s"}
+	b, err = json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, errRsp := procPublishService(c, vars, b)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+
+	vars[urlEpID] = i2s(si)
+	i, errRsp := procGetService(c, vars, nil)
+	if !errRsp.isOK() {
+		t.Fatalf("Unexpected failure: %v", errRsp)
+	}
+
+	sr := i.(*endpointResource)
+	hc := sr.HealthCheck
+	if hc == nil || hc.Type != "http" || hc.Path != "/status" || hc.Interval != "10s" || hc.Timeout != "2s" || hc.Threshold != 3 {
+		t.Fatalf("Unexpected health check configuration: %v", hc)
+	}
+	if hc.Port != getExposedPorts()[0].Port {
+		t.Fatalf("Expected health check port to default to the first exposed tcp port, got %d", hc.Port)
+	}
+	if sr.Health != nil {
+		t.Fatalf("Unexpected health status for a service without backend: %v", sr.Health)
+	}
+}
+
 func TestAttachDetachBackend(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 
@@ -1259,6 +1459,221 @@ func TestCreateDeleteEndpoints(t *testing.T) {
 	}
 }
 
+func TestCreateEndpointVirtualIPs(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nc := networkCreate{Name: "vipNet", NetworkType: bridgeNetType}
+	body, err := json.Marshal(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+	_, errRsp := procCreateNetwork(c, vars, body)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	b, err := json.Marshal(endpointCreate{Name: "vipEp", VirtualIPs: []string{"10.10.10.10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars[urlNwName] = "vipNet"
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected StatusBadRequest status code, got: %v", errRsp)
+	}
+
+	vips := []string{"10.10.10.10/32", "fd00::10/128"}
+	b, err = json.Marshal(endpointCreate{Name: "vipEp", VirtualIPs: vips})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	vars[urlEpName] = "vipEp"
+	i, errRsp := procGetEndpoint(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	epr := i.(*endpointResource)
+	if len(epr.VirtualIPs) != len(vips) || epr.VirtualIPs[0] != vips[0] || epr.VirtualIPs[1] != vips[1] {
+		t.Fatalf("Unexpected virtual ips. Expected %v. Got: %v", vips, epr.VirtualIPs)
+	}
+}
+
+func TestCreateEndpointAdditionalAddresses(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nc := networkCreate{Name: "addrNet", NetworkType: bridgeNetType}
+	body, err := json.Marshal(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+	_, errRsp := procCreateNetwork(c, vars, body)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	b, err := json.Marshal(endpointCreate{Name: "addrEp", Additional: []additionalAddress{{Address: "10.10.10"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars[urlNwName] = "addrNet"
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected StatusBadRequest status code, got: %v", errRsp)
+	}
+
+	b, err = json.Marshal(endpointCreate{Name: "addrEp", Additional: []additionalAddress{{}, {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	vars[urlEpName] = "addrEp"
+	i, errRsp := procGetEndpoint(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	epr := i.(*endpointResource)
+	if epr.Address == "" || len(epr.Additional) != 2 || epr.Additional[0] == epr.Additional[1] ||
+		epr.Additional[0] == epr.Address || epr.Additional[1] == epr.Address {
+		t.Fatalf("Unexpected endpoint addresses: %s %v", epr.Address, epr.Additional)
+	}
+}
+
+func TestCreateEndpointStaticAddress(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nc := networkCreate{Name: "staticNet", NetworkType: bridgeNetType}
+	body, err := json.Marshal(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := make(map[string]string)
+	_, errRsp := procCreateNetwork(c, vars, body)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	vars[urlNwName] = "staticNet"
+
+	for _, ec := range []endpointCreate{
+		{Name: "badEp", Address: "10.10.10"},
+		{Name: "badEp", Address: "fd00::1"},
+		{Name: "badEp", AddressIPv6: "10.10.10.10"},
+		{Name: "badEp", MacAddress: "02:42:0a"},
+		{Name: "badEp", MacAddress: "01:00:5e:00:00:01"},
+	} {
+		b, err := json.Marshal(ec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, errRsp = procCreateEndpoint(c, vars, b)
+		if errRsp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected StatusBadRequest status code for %+v, got: %v", ec, errRsp)
+		}
+	}
+
+	b, err := json.Marshal(endpointCreate{Name: "dynEp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	vars[urlEpName] = "dynEp"
+	i, errRsp := procGetEndpoint(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	ip, ipNet, err := net.ParseCIDR(i.(*endpointResource).Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The address of another endpoint is in use
+	b, err = json.Marshal(endpointCreate{Name: "staticEp", Address: ip.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected StatusForbidden status code, got: %v", errRsp)
+	}
+
+	ip = types.GetIPCopy(ip)
+	ip[len(ip)-1] += 100
+	if !ipNet.Contains(ip) {
+		t.Fatalf("Test address %s out of the network pool %s", ip, ipNet)
+	}
+	mac := "02:42:0a:0a:0a:0a"
+	b, err = json.Marshal(endpointCreate{Name: "staticEp", Address: ip.String(), MacAddress: mac})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errRsp = procCreateEndpoint(c, vars, b)
+	if errRsp != &createdResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+
+	vars[urlEpName] = "staticEp"
+	i, errRsp = procGetEndpoint(c, vars, nil)
+	if errRsp != &successResponse {
+		t.Fatalf("Unexepected failure: %v", errRsp)
+	}
+	epr := i.(*endpointResource)
+	if epr.Address != (&net.IPNet{IP: ip, Mask: ipNet.Mask}).String() {
+		t.Fatalf("Unexpected endpoint address. Expected %s. Got: %s", ip, epr.Address)
+	}
+	if epr.MacAddress != mac {
+		t.Fatalf("Unexpected endpoint mac address. Expected %s. Got: %s", mac, epr.MacAddress)
+	}
+}
+
 func TestJoinLeave(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 
@@ -1814,6 +2229,197 @@ func TestHttpHandlerBadBody(t *testing.T) {
 	}
 }
 
+// streamWriter is a response writer piping the body of a streamed
+// response to the test and letting it simulate the client going away.
+type streamWriter struct {
+	*io.PipeWriter
+	statusCode int
+	flushCh    chan struct{}
+	closeCh    chan bool
+}
+
+func (f *streamWriter) Header() http.Header {
+	return make(map[string][]string, 0)
+}
+
+func (f *streamWriter) WriteHeader(c int) {
+	f.statusCode = c
+}
+
+func (f *streamWriter) Flush() {
+	select {
+	case f.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (f *streamWriter) CloseNotify() <-chan bool {
+	return f.closeCh
+}
+
+func TestStreamEvents(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	handleRequest := NewHTTPHandler(c)
+
+	rsp := newWriter()
+	req, err := http.NewRequest("GET", "/v1.19/events?network=nonexistent", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handleRequest(rsp, req)
+	if rsp.statusCode != http.StatusNotFound {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusNotFound, rsp.statusCode, rsp.body)
+	}
+
+	pr, pw := io.Pipe()
+	w := &streamWriter{PipeWriter: pw, flushCh: make(chan struct{}, 1), closeCh: make(chan bool, 1)}
+	req, err = http.NewRequest("GET", "/v1.19/events?type=network.create,network.delete", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		handleRequest(w, req)
+		close(done)
+	}()
+
+	// The stream is subscribed once the handler flushes the headers
+	<-w.flushCh
+	dec := json.NewDecoder(pr)
+	nw, err := c.NewNetwork(bridgeNetType, "eventful", libnetwork.NetworkOptionGeneric(options.Generic{
+		netlabel.GenericData: options.Generic{"BridgeName": "eventful"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nw.CreateEndpoint("ep"); err != nil {
+		t.Fatal(err)
+	}
+
+	var ev libnetwork.Event
+	if err := dec.Decode(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != libnetwork.EventNetworkCreate || ev.NetworkID != nw.ID() || ev.Time.IsZero() {
+		t.Fatalf("Unexpected event: %+v", ev)
+	}
+	if w.statusCode != http.StatusOK {
+		t.Fatalf("Expected (%d). Got (%d)", http.StatusOK, w.statusCode)
+	}
+
+	w.closeCh <- true
+	<-done
+}
+
+func TestReconcile(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	handleRequest := NewHTTPHandler(c)
+
+	for _, method := range []string{"GET", "POST"} {
+		rsp := newWriter()
+		req, err := http.NewRequest(method, "/v1.19/reconcile", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handleRequest(rsp, req)
+		if rsp.statusCode != http.StatusOK {
+			t.Fatalf("Expected (%d). Got (%d): %s", http.StatusOK, rsp.statusCode, rsp.body)
+		}
+
+		var il []libnetwork.Inconsistency
+		if err := json.Unmarshal(rsp.body, &il); err != nil {
+			t.Fatal(err)
+		}
+		if il == nil || len(il) != 0 {
+			t.Fatalf("Unexpected reconcile response: %s", rsp.body)
+		}
+	}
+}
+
+func TestForceDeleteNetwork(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	handleRequest := NewHTTPHandler(c)
+
+	nw, err := c.NewNetwork(bridgeNetType, "forceNet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nw.CreateEndpoint("forceEp"); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(query string) *localResponseWriter {
+		rsp := newWriter()
+		req, err := http.NewRequest("DELETE", "/v1.19/networks/"+nw.ID()+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handleRequest(rsp, req)
+		return rsp
+	}
+
+	for _, query := range []string{"?dry-run=", "?dry-run=true", "?force=true&dry-run=1"} {
+		rsp := do(query)
+		if rsp.statusCode != http.StatusOK {
+			t.Fatalf("Expected (%d) for %s. Got (%d): %s", http.StatusOK, query, rsp.statusCode, rsp.body)
+		}
+		var deps libnetwork.NetworkDependencies
+		if err := json.Unmarshal(rsp.body, &deps); err != nil {
+			t.Fatal(err)
+		}
+		if len(deps.Endpoints) != 1 || deps.Endpoints[0] != "forceEp" || len(deps.Sandboxes) != 0 || len(deps.Pools) != 1 {
+			t.Fatalf("Unexpected dry run response for %s: %s", query, rsp.body)
+		}
+	}
+
+	if rsp := do("?force=maybe"); rsp.statusCode != http.StatusBadRequest {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusBadRequest, rsp.statusCode, rsp.body)
+	}
+	for _, query := range []string{"", "?force=false", "?dry-run=false"} {
+		if rsp := do(query); rsp.statusCode != http.StatusForbidden {
+			t.Fatalf("Expected (%d) for %q. Got (%d): %s", http.StatusForbidden, query, rsp.statusCode, rsp.body)
+		}
+	}
+
+	// A successful delete has no response body, the status is implicit
+	if rsp := do("?force="); rsp.statusCode != 0 {
+		t.Fatalf("Unexpected failure (%d): %s", rsp.statusCode, rsp.body)
+	}
+	if _, err := c.NetworkByID(nw.ID()); err == nil {
+		t.Fatal("Network still exists after forced delete")
+	}
+}
+
 func TestEndToEnd(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 
@@ -2404,3 +3010,144 @@ func TestFieldRegex(t *testing.T) {
 		t.Fatalf("Unexpected match")
 	}
 }
+
+func TestIpamInspect(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	handleRequest := NewHTTPHandler(c)
+
+	ipamV4 := []*libnetwork.IpamConf{{PreferredPool: "10.41.0.0/24"}}
+	nw, err := c.NewNetwork(bridgeNetType, "ipamNet", libnetwork.NetworkOptionIpam("", "", ipamV4, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nw.Delete()
+	ep, err := nw.CreateEndpoint("ipamEp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Delete()
+
+	do := func(path string) *localResponseWriter {
+		rsp := newWriter()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handleRequest(rsp, req)
+		return rsp
+	}
+
+	rsp := do("/v1.19/ipam/default")
+	if rsp.statusCode != http.StatusOK {
+		t.Fatalf("Unexpected failure (%d): %s", rsp.statusCode, rsp.body)
+	}
+	var spaces []ipamapi.AddressSpaceInfo
+	if err := json.Unmarshal(rsp.body, &spaces); err != nil {
+		t.Fatal(err)
+	}
+	var poolID string
+	for _, as := range spaces {
+		for _, p := range as.Pools {
+			if p.Pool == "10.41.0.0/24" {
+				poolID = p.ID
+			}
+		}
+	}
+	if poolID == "" {
+		t.Fatalf("Pool not found in response: %s", rsp.body)
+	}
+
+	rsp = do("/v1.19/ipam/default/pools/" + poolID)
+	if rsp.statusCode != http.StatusOK {
+		t.Fatalf("Unexpected failure (%d): %s", rsp.statusCode, rsp.body)
+	}
+	var pool ipamapi.PoolInfo
+	if err := json.Unmarshal(rsp.body, &pool); err != nil {
+		t.Fatal(err)
+	}
+	// Gateway and endpoint addresses
+	if pool.ID != poolID || pool.Total != 256 || len(pool.Allocated) != 2 {
+		t.Fatalf("Unexpected pool response: %s", rsp.body)
+	}
+
+	if rsp := do("/v1.19/ipam/default/pools/LocalDefault/10.42.0.0/24"); rsp.statusCode != http.StatusNotFound {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusNotFound, rsp.statusCode, rsp.body)
+	}
+}
+
+func TestIpamExportImport(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	// Cleanup local datastore file
+	os.Remove(datastore.DefaultScopes("")[datastore.LocalScope].Client.Address)
+
+	c, err := libnetwork.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	handleRequest := NewHTTPHandler(c)
+
+	ipamV4 := []*libnetwork.IpamConf{{PreferredPool: "10.43.0.0/24"}}
+	nw, err := c.NewNetwork(bridgeNetType, "exportNet", libnetwork.NetworkOptionIpam("", "", ipamV4, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nw.Delete()
+
+	do := func(method, path string, body []byte) *localResponseWriter {
+		rsp := newWriter()
+		req, err := http.NewRequest(method, path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handleRequest(rsp, req)
+		return rsp
+	}
+
+	rsp := do("GET", "/v1.19/ipam/default/export", nil)
+	if rsp.statusCode != http.StatusOK {
+		t.Fatalf("Unexpected failure (%d): %s", rsp.statusCode, rsp.body)
+	}
+	var doc struct {
+		Version       int
+		AddressSpaces []struct {
+			Name  string
+			Pools []struct{ ID string }
+		} `json:"address_spaces"`
+	}
+	if err := json.Unmarshal(rsp.body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, as := range doc.AddressSpaces {
+		for _, p := range as.Pools {
+			found = found || p.ID == "LocalDefault/10.43.0.0/24"
+		}
+	}
+	if doc.Version != 1 || !found {
+		t.Fatalf("Unexpected export response: %s", rsp.body)
+	}
+
+	// The pools of the document are in use
+	if rsp := do("POST", "/v1.19/ipam/default/import", rsp.body); rsp.statusCode != http.StatusForbidden {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusForbidden, rsp.statusCode, rsp.body)
+	}
+	if rsp := do("POST", "/v1.19/ipam/default/import", []byte(`{"version":0}`)); rsp.statusCode != http.StatusBadRequest {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusBadRequest, rsp.statusCode, rsp.body)
+	}
+	if rsp := do("GET", "/v1.19/ipam/unknown/export", nil); rsp.statusCode != http.StatusNotFound {
+		t.Fatalf("Expected (%d). Got (%d): %s", http.StatusNotFound, rsp.statusCode, rsp.body)
+	}
+}
@@ -1,6 +1,10 @@
 package api
 
-import "github.com/docker/libnetwork/types"
+import (
+	"time"
+
+	"github.com/docker/libnetwork/types"
+)
 
 /***********
  Resources
@@ -11,14 +15,23 @@ type networkResource struct {
 	Name      string              `json:"name"`
 	ID        string              `json:"id"`
 	Type      string              `json:"type"`
+	Labels    map[string]string   `json:"labels,omitempty"`
 	Endpoints []*endpointResource `json:"endpoints"`
 }
 
 // endpointResource is the body of the "get endpoint" http response message
 type endpointResource struct {
-	Name    string `json:"name"`
-	ID      string `json:"id"`
-	Network string `json:"network"`
+	Name         string        `json:"name"`
+	ID           string        `json:"id"`
+	Network      string        `json:"network"`
+	Address      string        `json:"address,omitempty"`
+	AddressIPv6  string        `json:"address_ipv6,omitempty"`
+	MacAddress   string        `json:"mac_address,omitempty"`
+	Additional   []string      `json:"additional_addresses,omitempty"`
+	VirtualIPs   []string      `json:"virtual_ips,omitempty"`
+	LoadBalancer *loadBalancer `json:"load_balancer,omitempty"`
+	HealthCheck  *healthCheck  `json:"health_check,omitempty"`
+	Health       *healthStatus `json:"health,omitempty"`
 }
 
 // sandboxResource is the body of "get service backend" response message
@@ -37,6 +50,25 @@ type networkCreate struct {
 	Name        string            `json:"name"`
 	NetworkType string            `json:"network_type"`
 	DriverOpts  map[string]string `json:"driver_opts"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// networkUpdate is the expected body of the "update network" http request message.
+// The driver options are merged with the current ones, the labels replace them and
+// the ipam pools are added to the network.
+type networkUpdate struct {
+	Labels     map[string]string `json:"labels"`
+	DriverOpts map[string]string `json:"driver_opts"`
+	IPv4Pools  []ipamPool        `json:"ipv4_pools"`
+	IPv6Pools  []ipamPool        `json:"ipv6_pools"`
+}
+
+// ipamPool represents an address pool of a network
+type ipamPool struct {
+	Pool         string            `json:"pool"`
+	SubPool      string            `json:"sub_pool"`
+	Gateway      string            `json:"gateway"`
+	AuxAddresses map[string]string `json:"aux_addresses"`
 }
 
 // endpointCreate represents the body of the "create endpoint" http request message
@@ -44,6 +76,11 @@ type endpointCreate struct {
 	Name         string                `json:"name"`
 	ExposedPorts []types.TransportPort `json:"exposed_ports"`
 	PortMapping  []types.PortBinding   `json:"port_mapping"`
+	VirtualIPs   []string              `json:"virtual_ips"`
+	Address      string                `json:"address"`
+	AddressIPv6  string                `json:"address_ipv6"`
+	MacAddress   string                `json:"mac_address"`
+	Additional   []additionalAddress   `json:"additional_addresses"`
 }
 
 // sandboxCreate is the expected body of the "create sandbox" http request message
@@ -57,6 +94,7 @@ type sandboxCreate struct {
 	ExtraHosts        []extraHost `json:"extra_hosts"`
 	UseDefaultSandbox bool        `json:"use_default_sandbox"`
 	UseExternalKey    bool        `json:"use_external_key"`
+	UseEmbeddedDNS    bool        `json:"use_embedded_dns"`
 }
 
 // endpointJoin represents the expected body of the "join endpoint" or "leave endpoint" http request messages
@@ -70,6 +108,46 @@ type servicePublish struct {
 	Network      string                `json:"network_name"`
 	ExposedPorts []types.TransportPort `json:"exposed_ports"`
 	PortMapping  []types.PortBinding   `json:"port_mapping"`
+	VirtualIPs   []string              `json:"virtual_ips"`
+	Address      string                `json:"address"`
+	AddressIPv6  string                `json:"address_ipv6"`
+	MacAddress   string                `json:"mac_address"`
+	Additional   []additionalAddress   `json:"additional_addresses"`
+	LoadBalancer *loadBalancer         `json:"load_balancer"`
+	HealthCheck  *healthCheck          `json:"health_check"`
+}
+
+// additionalAddress represents the request of an endpoint address besides
+// the primary ones, from a network pool and/or at a given address
+type additionalAddress struct {
+	Pool    string `json:"pool"`
+	Address string `json:"address"`
+}
+
+// loadBalancer represents the load balancing configuration of a service
+type loadBalancer struct {
+	Scheduler string `json:"scheduler"`
+	Method    string `json:"method"`
+	SandboxID string `json:"sandbox_id,omitempty"`
+}
+
+// healthCheck represents the configuration of the probes run against
+// the backends of a service. Durations are in time.ParseDuration format.
+type healthCheck struct {
+	Type      string `json:"type"`
+	Port      uint16 `json:"port,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Interval  string `json:"interval,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
+}
+
+// healthStatus represents the health state of the backend of a service
+type healthStatus struct {
+	Status        string    `json:"status"`
+	FailingStreak int       `json:"failing_streak"`
+	LastCheck     time.Time `json:"last_check"`
+	LastError     string    `json:"last_error,omitempty"`
 }
 
 // extraHost represents the extra host object
@@ -27,11 +27,13 @@ var (
 	errNoBitAvailable = fmt.Errorf("no bit available")
 )
 
-// Handle contains the sequece representing the bitmask and its identifier
+// Handle contains the sequece representing the bitmask and its identifier.
+// The sequence is held by a tree indexing its blocks, so that lookups and
+// updates do not walk the whole sequence.
 type Handle struct {
 	bits       uint64
 	unselected uint64
-	head       *sequence
+	root       *node
 	app        string
 	id         string
 	dbIndex    uint64
@@ -48,10 +50,10 @@ func NewHandle(app string, ds datastore.DataStore, id string, numElements uint64
 		store:      ds,
 		bits:       numElements,
 		unselected: numElements,
-		head: &sequence{
+		root: newTree(&sequence{
 			block: 0x0,
 			count: getNumBlocks(numElements),
-		},
+		}),
 	}
 
 	if h.store == nil {
@@ -105,17 +107,85 @@ func (s *sequence) getAvailableBit(from uint64) (uint64, uint64, error) {
 	return bits / 8, bits % 8, nil
 }
 
-// GetCopy returns a copy of the linked list rooted at this node
-func (s *sequence) getCopy() *sequence {
-	n := &sequence{block: s.block, count: s.count}
-	pn := n
-	ps := s.next
-	for ps != nil {
-		pn.next = &sequence{block: ps.block, count: ps.count}
-		pn = pn.next
-		ps = ps.next
+// freeRuns returns the runs of unset bits of the sequence
+func (s *sequence) freeRuns() freeRuns {
+	bits := s.count * uint64(blockLen)
+	if s.block == 0x0 {
+		return freeRuns{bits: bits, head: bits, tail: bits, span: bits}
 	}
-	return n
+	if s.count == 0 {
+		return freeRuns{}
+	}
+
+	r := freeRuns{bits: bits}
+	leading := true
+	for bitSel := blockFirstBit; bitSel > 0; bitSel >>= 1 {
+		if s.block&bitSel != 0 {
+			leading = false
+			r.tail = 0
+			continue
+		}
+		r.tail++
+		if leading {
+			r.head++
+		}
+		if r.tail > r.span {
+			r.span = r.tail
+		}
+	}
+	// The tail of a block is followed by the head of the next one
+	if s.count > 1 && r.tail+r.head > r.span {
+		r.span = r.tail + r.head
+	}
+	return r
+}
+
+// firstFit returns the ordinal of the first size unset bits in a row of the sequence
+// from the from ordinal on, offset being the ordinal of the sequence first bit and
+// carry the number of unset bits in a row right before it, counted from the from ordinal.
+// If there is none, it returns invalidPos along with the number of unset bits in a row
+// at the end of the sequence.
+func (s *sequence) firstFit(size, from, offset, carry uint64) (uint64, uint64) {
+	end := offset + s.count*uint64(blockLen)
+	if end <= from {
+		return invalidPos, 0
+	}
+	first := offset
+	if first < from {
+		first, carry = from, 0
+	}
+
+	if s.block == 0x0 {
+		if carry+end-first >= size {
+			return first - carry, 0
+		}
+		return invalidPos, carry + end - first
+	}
+
+	// From the third block on, each block comes after the tail of an
+	// identical full range block, which makes them all alike: the first
+	// three blocks are enough to tell
+	block := (first - offset) / uint64(blockLen)
+	for i := 0; i < 3 && block < s.count; i, block = i+1, block+1 {
+		base := offset + block*uint64(blockLen)
+		for bit := uint64(0); bit < uint64(blockLen); bit++ {
+			if base+bit < first {
+				continue
+			}
+			if s.block&(blockFirstBit>>bit) != 0 {
+				carry = 0
+				continue
+			}
+			carry++
+			if carry == size {
+				return base + bit - size + 1, 0
+			}
+		}
+	}
+	if block < s.count {
+		carry = s.freeRuns().tail
+	}
+	return invalidPos, carry
 }
 
 // Equal checks if this sequence is equal to the passed one
@@ -158,7 +228,7 @@ func (s *sequence) toByteArray() ([]byte, error) {
 // fromByteArray construct the sequence from the byte array
 func (s *sequence) fromByteArray(data []byte) error {
 	l := len(data)
-	if l%12 != 0 {
+	if l == 0 || l%12 != 0 {
 		return fmt.Errorf("cannot deserialize byte sequence of lenght %d (%v)", l, data)
 	}
 
@@ -178,11 +248,12 @@ func (s *sequence) fromByteArray(data []byte) error {
 	return nil
 }
 
+// getCopy returns a copy of the handle, which shares the immutable tree
 func (h *Handle) getCopy() *Handle {
 	return &Handle{
 		bits:       h.bits,
 		unselected: h.unselected,
-		head:       h.head.getCopy(),
+		root:       h.root,
 		app:        h.app,
 		id:         h.id,
 		dbIndex:    h.dbIndex,
@@ -210,6 +281,18 @@ func (h *Handle) SetAny() (uint64, error) {
 	return h.set(0, 0, h.bits-1, true, false)
 }
 
+// SetAnyBlock atomically sets the first n consecutive unset bits in the specified range in the sequence
+// and returns the ordinal of the first one
+func (h *Handle) SetAnyBlock(n, start, end uint64) (uint64, error) {
+	if n == 0 || end < start || end >= h.bits {
+		return invalidPos, fmt.Errorf("invalid block of %d bits in range [%d, %d]", n, start, end)
+	}
+	if end-start+1 < n {
+		return invalidPos, errNoBitAvailable
+	}
+	return h.setBlock(0, n, start, end, false)
+}
+
 // Set atomically sets the corresponding bit in the sequence
 func (h *Handle) Set(ordinal uint64) error {
 	if err := h.validateOrdinal(ordinal); err != nil {
@@ -228,6 +311,18 @@ func (h *Handle) Unset(ordinal uint64) error {
 	return err
 }
 
+// UnsetBlock atomically unsets the n consecutive bits starting from the ordinal one in the sequence
+func (h *Handle) UnsetBlock(ordinal, n uint64) error {
+	if n == 0 || ordinal+n < ordinal {
+		return fmt.Errorf("invalid block of %d bits from %d", n, ordinal)
+	}
+	if err := h.validateOrdinal(ordinal + n - 1); err != nil {
+		return err
+	}
+	_, err := h.setBlock(ordinal, n, 0, 0, true)
+	return err
+}
+
 // IsSet atomically checks if the ordinal bit is set. In case ordinal
 // is outside of the bit sequence limits, false is returned.
 func (h *Handle) IsSet(ordinal uint64) bool {
@@ -235,11 +330,40 @@ func (h *Handle) IsSet(ordinal uint64) bool {
 		return false
 	}
 	h.Lock()
-	_, _, err := checkIfAvailable(h.head, ordinal)
+	_, _, err := checkIfAvailable(h.root, ordinal)
 	h.Unlock()
 	return err != nil
 }
 
+// WalkSelected calls fn with the ordinal of each set bit in the sequence,
+// in ascending order. The walk stops when fn returns true.
+func (h *Handle) WalkSelected(fn func(ordinal uint64) bool) {
+	h.Lock()
+	root := h.root
+	bits := h.bits
+	h.Unlock()
+
+	root.walk(0, func(current *node, block uint64) bool {
+		// Skip the runs of empty blocks at once
+		if current.block == 0x0 {
+			return false
+		}
+		ordinal := block * uint64(blockLen)
+		for i := uint64(0); i < current.count; i++ {
+			for bitSel, pos := blockFirstBit, uint64(0); bitSel > 0; bitSel, pos = bitSel>>1, pos+1 {
+				if current.block&bitSel == 0 || ordinal+pos >= bits {
+					continue
+				}
+				if fn(ordinal + pos) {
+					return true
+				}
+			}
+			ordinal += uint64(blockLen)
+		}
+		return false
+	})
+}
+
 // set/reset the bit
 func (h *Handle) set(ordinal, start, end uint64, any bool, release bool) (uint64, error) {
 	var (
@@ -262,13 +386,13 @@ func (h *Handle) set(ordinal, start, end uint64, any bool, release bool) (uint64
 			bytePos, bitPos = ordinalToPos(ordinal)
 		} else {
 			if any {
-				bytePos, bitPos, err = getFirstAvailable(h.head, start)
+				bytePos, bitPos, err = getFirstAvailable(h.root, start)
 				ret = posToOrdinal(bytePos, bitPos)
 				if end < ret {
 					err = errNoBitAvailable
 				}
 			} else {
-				bytePos, bitPos, err = checkIfAvailable(h.head, ordinal)
+				bytePos, bitPos, err = checkIfAvailable(h.root, ordinal)
 				ret = ordinal
 			}
 		}
@@ -281,7 +405,7 @@ func (h *Handle) set(ordinal, start, end uint64, any bool, release bool) (uint64
 		nh := h.getCopy()
 		h.Unlock()
 
-		nh.head = pushReservation(bytePos, bitPos, nh.head, release)
+		nh.root = pushReservation(bytePos, bitPos, nh.root, release)
 		if release {
 			nh.unselected++
 		} else {
@@ -301,7 +425,65 @@ func (h *Handle) set(ordinal, start, end uint64, any bool, release bool) (uint64
 		h.Lock()
 		defer h.Unlock()
 		h.unselected = nh.unselected
-		h.head = nh.head
+		h.root = nh.root
+		h.dbExists = nh.dbExists
+		h.dbIndex = nh.dbIndex
+		return ret, nil
+	}
+}
+
+// set/reset the n bits block, in a single store update
+func (h *Handle) setBlock(ordinal, n, start, end uint64, release bool) (uint64, error) {
+	var (
+		ret uint64
+		err error
+	)
+
+	for {
+		if h.store != nil {
+			if err := h.store.GetObject(datastore.Key(h.Key()...), h); err != nil && err != datastore.ErrKeyNotFound {
+				return ret, err
+			}
+		}
+
+		h.Lock()
+		// Get block position if available
+		if release {
+			ret = ordinal
+		} else {
+			ret, err = getFirstAvailableBlock(h.root, n, start, end)
+		}
+		if err != nil {
+			h.Unlock()
+			return ret, err
+		}
+
+		// Create a private copy of h and work on it
+		nh := h.getCopy()
+		h.Unlock()
+
+		var changed uint64
+		nh.root, changed = pushBlockReservation(ret, n, nh.root, release)
+		if release {
+			nh.unselected += changed
+		} else {
+			nh.unselected -= changed
+		}
+
+		// Attempt to write private copy to store
+		if err := nh.writeToStore(); err != nil {
+			if _, ok := err.(types.RetryError); !ok {
+				return ret, fmt.Errorf("internal failure while setting the bits: %v", err)
+			}
+			// Retry
+			continue
+		}
+
+		// Previous atomic push was succesfull. Save private copy to local copy
+		h.Lock()
+		defer h.Unlock()
+		h.unselected = nh.unselected
+		h.root = nh.root
 		h.dbExists = nh.dbExists
 		h.dbIndex = nh.dbIndex
 		return ret, nil
@@ -344,7 +526,7 @@ func (h *Handle) ToByteArray() ([]byte, error) {
 	ba := make([]byte, 16)
 	binary.BigEndian.PutUint64(ba[0:], h.bits)
 	binary.BigEndian.PutUint64(ba[8:], h.unselected)
-	bm, err := h.head.toByteArray()
+	bm, err := h.root.list().toByteArray()
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize head: %s", err.Error())
 	}
@@ -358,6 +540,9 @@ func (h *Handle) FromByteArray(ba []byte) error {
 	if ba == nil {
 		return fmt.Errorf("nil byte array")
 	}
+	if len(ba) < 16 {
+		return fmt.Errorf("byte array too short: %d bytes", len(ba))
+	}
 
 	nh := &sequence{}
 	err := nh.fromByteArray(ba[16:])
@@ -365,8 +550,10 @@ func (h *Handle) FromByteArray(ba []byte) error {
 		return fmt.Errorf("failed to deserialize head: %s", err.Error())
 	}
 
+	root := newTree(nh)
+
 	h.Lock()
-	h.head = nh
+	h.root = root
 	h.bits = binary.BigEndian.Uint64(ba[0:8])
 	h.unselected = binary.BigEndian.Uint64(ba[8:16])
 	h.Unlock()
@@ -390,7 +577,7 @@ func (h *Handle) String() string {
 	h.Lock()
 	defer h.Unlock()
 	return fmt.Sprintf("App: %s, ID: %s, DBIndex: 0x%x, bits: %d, unselected: %d, sequence: %s",
-		h.app, h.id, h.dbIndex, h.bits, h.unselected, h.head.toString())
+		h.app, h.id, h.dbIndex, h.bits, h.unselected, h.root.list().toString())
 }
 
 // MarshalJSON encodes Handle into json message
@@ -426,35 +613,43 @@ func (h *Handle) UnmarshalJSON(data []byte) error {
 }
 
 // getFirstAvailable looks for the first unset bit in passed mask starting from start
-func getFirstAvailable(head *sequence, start uint64) (uint64, uint64, error) {
-	// Find sequence which contains the start bit
-	byteStart, bitStart := ordinalToPos(start)
-	current, _, _, inBlockBytePos := findSequence(head, byteStart)
-
-	// Derive the this sequence offsets
-	byteOffset := byteStart - inBlockBytePos
-	bitOffset := inBlockBytePos*8 + bitStart
-
-	for current != nil {
-		if current.block != blockMAX {
-			bytePos, bitPos, err := current.getAvailableBit(bitOffset)
-			return byteOffset + bytePos, bitPos, err
+func getFirstAvailable(root *node, start uint64) (uint64, uint64, error) {
+	block, from := start/uint64(blockLen), start%uint64(blockLen)
+	for {
+		// Find the first block with unset bits from the start one
+		current, pos := root.firstFree(block, 0)
+		if current == nil {
+			return invalidPos, invalidPos, errNoBitAvailable
+		}
+		if pos != block {
+			from = 0
 		}
-		// Moving to next block: Reset bit offset.
-		bitOffset = 0
-		byteOffset += current.count * blockBytes
-		current = current.next
+		bytePos, bitPos, err := current.getAvailableBit(from)
+		if err == nil && bytePos < blockBytes {
+			return pos*blockBytes + bytePos, bitPos, nil
+		}
+		// The bits of the start block following the start one are all set
+		block, from = pos+1, 0
+	}
+}
+
+// getFirstAvailableBlock looks for the first n consecutive unset bits in passed mask
+// between start and end, and returns the ordinal of the first one
+func getFirstAvailableBlock(root *node, n, start, end uint64) (uint64, error) {
+	ordinal, _ := root.firstFit(n, start, 0, 0)
+	if ordinal == invalidPos || ordinal > end || end-ordinal+1 < n {
+		return invalidPos, errNoBitAvailable
 	}
-	return invalidPos, invalidPos, errNoBitAvailable
+	return ordinal, nil
 }
 
 // checkIfAvailable checks if the bit correspondent to the specified ordinal is unset
 // If the ordinal is beyond the sequence limits, a negative response is returned
-func checkIfAvailable(head *sequence, ordinal uint64) (uint64, uint64, error) {
+func checkIfAvailable(root *node, ordinal uint64) (uint64, uint64, error) {
 	bytePos, bitPos := ordinalToPos(ordinal)
 
 	// Find the sequence containing this byte
-	current, _, _, inBlockBytePos := findSequence(head, bytePos)
+	current, _, inBlockBytePos := findSequence(root, bytePos)
 	if current != nil {
 		// Check whether the bit corresponding to the ordinal address is unset
 		bitSel := blockFirstBit >> (inBlockBytePos*8 + bitPos)
@@ -466,59 +661,35 @@ func checkIfAvailable(head *sequence, ordinal uint64) (uint64, uint64, error) {
 	return invalidPos, invalidPos, fmt.Errorf("requested bit is not available")
 }
 
-// Given the byte position and the sequences list head, return the pointer to the
-// sequence containing the byte (current), the pointer to the previous sequence,
-// the number of blocks preceding the block containing the byte inside the current sequence.
-// If bytePos is outside of the list, function will return (nil, nil, 0, invalidPos)
-func findSequence(head *sequence, bytePos uint64) (*sequence, *sequence, uint64, uint64) {
+// Given the byte position and the sequences tree, return the pointer to the
+// node of the sequence containing the byte (current) and the number of blocks
+// preceding the block containing the byte inside the current sequence.
+// If bytePos is outside of the tree, function will return (nil, 0, invalidPos)
+func findSequence(root *node, bytePos uint64) (*node, uint64, uint64) {
 	// Find the sequence containing this byte
-	previous := head
-	current := head
-	n := bytePos
-	for current.next != nil && n >= (current.count*blockBytes) { // Nil check for less than 32 addresses masks
-		n -= (current.count * blockBytes)
-		previous = current
-		current = current.next
-	}
-
-	// If byte is outside of the list, let caller know
-	if n >= (current.count * blockBytes) {
-		return nil, nil, 0, invalidPos
+	current, start := root.find(bytePos / blockBytes)
+	if current == nil {
+		return nil, 0, invalidPos
 	}
 
 	// Find the byte position inside the block and the number of blocks
 	// preceding the block containing the byte inside this sequence
-	precBlocks := n / blockBytes
+	precBlocks := bytePos/blockBytes - start
 	inBlockBytePos := bytePos % blockBytes
 
-	return current, previous, precBlocks, inBlockBytePos
+	return current, precBlocks, inBlockBytePos
 }
 
 // PushReservation pushes the bit reservation inside the bitmask.
 // Given byte and bit positions, identify the sequence (current) which holds the block containing the affected bit.
 // Create a new block with the modified bit according to the operation (allocate/release).
-// Create a new sequence containing the new block and insert it in the proper position.
-// Remove current sequence if empty.
-// Check if new sequence can be merged with neighbour (previous/next) sequences.
-//
-//
-// Identify "current" sequence containing block:
-//                                      [prev seq] [current seq] [next seq]
-//
-// Based on block position, resulting list of sequences can be any of three forms:
-//
-//        block position                        Resulting list of sequences
-// A) block is first in current:         [prev seq] [new] [modified current seq] [next seq]
-// B) block is last in current:          [prev seq] [modified current seq] [new] [next seq]
-// C) block is in the middle of current: [prev seq] [curr pre] [new] [curr post] [next seq]
-func pushReservation(bytePos, bitPos uint64, head *sequence, release bool) *sequence {
-	// Store list's head
-	newHead := head
-
+// Cut the block out of the current sequence into a new sequence, merged with the neighbour
+// sequences if they hold the same block, and return the updated tree. The passed tree is not modified.
+func pushReservation(bytePos, bitPos uint64, root *node, release bool) *node {
 	// Find the sequence containing this byte
-	current, previous, precBlocks, inBlockBytePos := findSequence(head, bytePos)
+	current, _, inBlockBytePos := findSequence(root, bytePos)
 	if current == nil {
-		return newHead
+		return root
 	}
 
 	// Construct updated block
@@ -532,71 +703,59 @@ func pushReservation(bytePos, bitPos uint64, head *sequence, release bool) *sequ
 
 	// Quit if it was a redundant request
 	if current.block == newBlock {
-		return newHead
+		return root
 	}
 
-	// Current sequence inevitably looses one block, upadate count
-	current.count--
-
-	// Create new sequence
-	newSequence := &sequence{block: newBlock, count: 1}
+	return root.update(bytePos/blockBytes, 1, newBlock)
+}
 
-	// Insert the new sequence in the list based on block position
-	if precBlocks == 0 { // First in sequence (A)
-		newSequence.next = current
-		if current == head {
-			newHead = newSequence
-			previous = newHead
-		} else {
-			previous.next = newSequence
-		}
-		removeCurrentIfEmpty(&newHead, newSequence, current)
-		mergeSequences(previous)
-	} else if precBlocks == current.count-2 { // Last in sequence (B)
-		newSequence.next = current.next
-		current.next = newSequence
-		mergeSequences(current)
-	} else { // In between the sequence (C)
-		currPre := &sequence{block: current.block, count: precBlocks, next: newSequence}
-		currPost := current
-		currPost.count -= precBlocks
-		newSequence.next = currPost
-		if currPost == head {
-			newHead = currPre
-		} else {
-			previous.next = currPre
+// pushBlockReservation pushes the reservation of the n bits starting from the ordinal one inside the bitmask.
+// The blocks fully covered by the reservation are replaced at once, sequence by sequence.
+// It returns the updated tree along with the number of bits whose state changed. The passed tree is not modified.
+func pushBlockReservation(ordinal, n uint64, root *node, release bool) (*node, uint64) {
+	var changed uint64
+	for n > 0 {
+		pos, bitPos := ordinal/uint64(blockLen), ordinal%uint64(blockLen)
+		current, start := root.find(pos)
+		if current == nil {
+			break
 		}
-		// No merging or empty current possible here
-	}
-
-	return newHead
-}
 
-// Removes the current sequence from the list if empty, adjusting the head pointer if needed
-func removeCurrentIfEmpty(head **sequence, previous, current *sequence) {
-	if current.count == 0 {
-		if current == *head {
-			*head = current.next
+		// Construct the updated block and the number of blocks it replaces
+		var (
+			newBlock uint32
+			count    = uint64(1)
+			bits     = uint64(blockLen) - bitPos
+		)
+		if bitPos == 0 && n >= uint64(blockLen) {
+			count = start + current.count - pos
+			if count > n/uint64(blockLen) {
+				count = n / uint64(blockLen)
+			}
+			bits = count * uint64(blockLen)
+			if !release {
+				newBlock = blockMAX
+			}
 		} else {
-			previous.next = current.next
-			current = current.next
+			if bits > n {
+				bits = n
+			}
+			mask := (blockMAX >> bitPos) &^ (blockMAX >> (bitPos + bits))
+			if release {
+				newBlock = current.block &^ mask
+			} else {
+				newBlock = current.block | mask
+			}
 		}
-	}
-}
 
-// Given a pointer to a sequence, it checks if it can be merged with any following sequences
-// It stops when no more merging is possible.
-// TODO: Optimization: only attempt merge from start to end sequence, no need to scan till the end of the list
-func mergeSequences(seq *sequence) {
-	if seq != nil {
-		// Merge all what possible from seq
-		for seq.next != nil && seq.block == seq.next.block {
-			seq.count += seq.next.count
-			seq.next = seq.next.next
+		if current.block != newBlock {
+			changed += count * bitCount(current.block^newBlock)
+			root = root.update(pos, count, newBlock)
 		}
-		// Move to next
-		mergeSequences(seq.next)
+		ordinal += bits
+		n -= bits
 	}
+	return root, changed
 }
 
 func getNumBlocks(numBits uint64) uint64 {
@@ -614,3 +773,12 @@ func ordinalToPos(ordinal uint64) (uint64, uint64) {
 func posToOrdinal(bytePos, bitPos uint64) uint64 {
 	return bytePos*8 + bitPos
 }
+
+// bitCount returns the number of set bits in the block
+func bitCount(block uint32) uint64 {
+	var c uint64
+	for ; block != 0; block &= block - 1 {
+		c++
+	}
+	return c
+}
@@ -1,11 +1,41 @@
 package bitseq
 
 import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/docker/libkv/store"
+	"github.com/docker/libnetwork/datastore"
 	_ "github.com/docker/libnetwork/testutils"
 )
 
+const (
+	defaultPrefix = "/tmp/libnetwork/test/bitseq"
+)
+
+func randomLocalStore() (datastore.DataStore, error) {
+	tmp, err := ioutil.TempFile("", "libnetwork-")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating temp file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("Error closing temp file: %v", err)
+	}
+	return datastore.NewDataStore(datastore.LocalScope, &datastore.ScopeCfg{
+		Client: datastore.ScopeClientCfg{
+			Provider: "boltdb",
+			Address:  defaultPrefix + tmp.Name(),
+			Config: &store.Config{
+				Bucket:            "libnetwork",
+				ConnectionTimeout: 3 * time.Second,
+			},
+		},
+	})
+}
+
 func TestSequenceGetAvailableBit(t *testing.T) {
 	input := []struct {
 		head    *sequence
@@ -106,11 +136,11 @@ func TestSequenceEqual(t *testing.T) {
 	}
 }
 
-func TestSequenceCopy(t *testing.T) {
+func TestTreeList(t *testing.T) {
 	s := getTestSequence()
-	n := s.getCopy()
+	n := newTree(s).list()
 	if !s.equal(n) {
-		t.Fatalf("copy of s failed")
+		t.Fatalf("list of tree failed")
 	}
 	if n == s {
 		t.Fatalf("not true copy of s")
@@ -157,7 +187,7 @@ func TestGetFirstAvailable(t *testing.T) {
 	}
 
 	for n, i := range input {
-		bytePos, bitPos, _ := getFirstAvailable(i.mask, 0)
+		bytePos, bitPos, _ := getFirstAvailable(newTree(i.mask), 0)
 		if bytePos != i.bytePos || bitPos != i.bitPos {
 			t.Fatalf("Error in (%d) getFirstAvailable(). Expected (%d, %d). Got (%d, %d)", n, i.bytePos, i.bitPos, bytePos, bitPos)
 		}
@@ -192,7 +222,7 @@ func TestFindSequence(t *testing.T) {
 	}
 
 	for n, i := range input {
-		_, _, precBlocks, inBlockBytePos := findSequence(i.head, i.bytePos)
+		_, precBlocks, inBlockBytePos := findSequence(newTree(i.head), i.bytePos)
 		if precBlocks != i.precBlocks || inBlockBytePos != i.inBlockBytePos {
 			t.Fatalf("Error in (%d) findSequence(). Expected (%d, %d). Got (%d, %d)", n, i.precBlocks, i.inBlockBytePos, precBlocks, inBlockBytePos)
 		}
@@ -231,46 +261,13 @@ func TestCheckIfAvailable(t *testing.T) {
 	}
 
 	for n, i := range input {
-		bytePos, bitPos, err := checkIfAvailable(i.head, i.ordinal)
+		bytePos, bitPos, err := checkIfAvailable(newTree(i.head), i.ordinal)
 		if bytePos != i.bytePos || bitPos != i.bitPos {
 			t.Fatalf("Error in (%d) checkIfAvailable(ord:%d). Expected (%d, %d). Got (%d, %d). err: %v", n, i.ordinal, i.bytePos, i.bitPos, bytePos, bitPos, err)
 		}
 	}
 }
 
-func TestMergeSequences(t *testing.T) {
-	input := []struct {
-		original *sequence
-		merged   *sequence
-	}{
-		{&sequence{block: 0xFE000000, count: 8, next: &sequence{block: 0xFE000000, count: 2}}, &sequence{block: 0xFE000000, count: 10}},
-		{&sequence{block: 0xFFFFFFFF, count: 8, next: &sequence{block: 0xFFFFFFFF, count: 1}}, &sequence{block: 0xFFFFFFFF, count: 9}},
-		{&sequence{block: 0xFFFFFFFF, count: 1, next: &sequence{block: 0xFFFFFFFF, count: 8}}, &sequence{block: 0xFFFFFFFF, count: 9}},
-
-		{&sequence{block: 0xFFFFFFF0, count: 8, next: &sequence{block: 0xFFFFFFF0, count: 1}}, &sequence{block: 0xFFFFFFF0, count: 9}},
-		{&sequence{block: 0xFFFFFFF0, count: 1, next: &sequence{block: 0xFFFFFFF0, count: 8}}, &sequence{block: 0xFFFFFFF0, count: 9}},
-
-		{&sequence{block: 0xFE, count: 8, next: &sequence{block: 0xFE, count: 1, next: &sequence{block: 0xFE, count: 5}}}, &sequence{block: 0xFE, count: 14}},
-		{&sequence{block: 0xFE, count: 8, next: &sequence{block: 0xFE, count: 1, next: &sequence{block: 0xFE, count: 5, next: &sequence{block: 0xFF, count: 1}}}},
-			&sequence{block: 0xFE, count: 14, next: &sequence{block: 0xFF, count: 1}}},
-
-		// No merge
-		{&sequence{block: 0xFE, count: 8, next: &sequence{block: 0xF8, count: 1, next: &sequence{block: 0xFE, count: 5}}},
-			&sequence{block: 0xFE, count: 8, next: &sequence{block: 0xF8, count: 1, next: &sequence{block: 0xFE, count: 5}}}},
-
-		// No merge from head: // Merge function tries to merge from passed head. If it can't merge with next, it does not reattempt with next as head
-		{&sequence{block: 0xFE, count: 8, next: &sequence{block: 0xFF, count: 1, next: &sequence{block: 0xFF, count: 5}}},
-			&sequence{block: 0xFE, count: 8, next: &sequence{block: 0xFF, count: 6}}},
-	}
-
-	for n, i := range input {
-		mergeSequences(i.original)
-		for !i.merged.equal(i.original) {
-			t.Fatalf("Error in (%d) mergeSequences().\nExp: %s\nGot: %s,", n, i.merged.toString(), i.original.toString())
-		}
-	}
-}
-
 func TestPushReservation(t *testing.T) {
 	input := []struct {
 		mask    *sequence
@@ -355,7 +352,7 @@ func TestPushReservation(t *testing.T) {
 	}
 
 	for n, i := range input {
-		mask := pushReservation(i.bytePos, i.bitPos, i.mask, false)
+		mask := pushReservation(i.bytePos, i.bitPos, newTree(i.mask), false).list()
 		if !mask.equal(i.newMask) {
 			t.Fatalf("Error in (%d) pushReservation():\n%s + (%d,%d):\nExp: %s\nGot: %s,",
 				n, i.mask.toString(), i.bytePos, i.bitPos, i.newMask.toString(), mask.toString())
@@ -380,6 +377,13 @@ func TestSerializeDeserialize(t *testing.T) {
 	if !s.equal(r) {
 		t.Fatalf("Sequences are different: \n%v\n%v", s, r)
 	}
+
+	h := &Handle{}
+	for _, ba := range [][]byte{{}, make([]byte, 15), make([]byte, 16), make([]byte, 20)} {
+		if err := h.FromByteArray(ba); err == nil {
+			t.Fatalf("Expected failure deserializing %d bytes", len(ba))
+		}
+	}
 }
 
 func getTestSequence() *sequence {
@@ -443,7 +447,7 @@ func TestSet(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	hnd.head = getTestSequence()
+	hnd.root = newTree(getTestSequence())
 
 	firstAv := uint64(32*100 + 31)
 	last := uint64(1024*32 - 1)
@@ -523,7 +527,7 @@ func TestSetInRange(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	hnd.head = getTestSequence()
+	hnd.root = newTree(getTestSequence())
 
 	firstAv := uint64(100*blockLen + blockLen - 1)
 
@@ -635,3 +639,388 @@ func TestSetInRange(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+func TestSetInRangeLastBlockOfSequence(t *testing.T) {
+	hnd, err := NewHandle("", nil, "", 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range []uint64{0, 10, 255} {
+		if err := hnd.Set(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first available bit in the range is in the last block of an
+	// empty sequence: the reservation must land on the returned ordinal
+	o, err := hnd.SetAnyInRange(128, 255)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != 128 || !hnd.IsSet(128) || hnd.IsSet(192) {
+		t.Fatalf("Unexpected reservation for ordinal %d: %s", o, hnd)
+	}
+	if hnd.Unselected() != 252 {
+		t.Fatalf("Unexpected unselected count: %d", hnd.Unselected())
+	}
+}
+
+func TestWalkSelected(t *testing.T) {
+	hnd, err := NewHandle("", nil, "", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint64{0, 31, 32, 100, 199}
+	for _, o := range expected {
+		if err := hnd.Set(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ordinals []uint64
+	hnd.WalkSelected(func(o uint64) bool {
+		ordinals = append(ordinals, o)
+		return false
+	})
+	if len(ordinals) != len(expected) {
+		t.Fatalf("Unexpected ordinals %v, expected %v", ordinals, expected)
+	}
+	for i, o := range expected {
+		if ordinals[i] != o {
+			t.Fatalf("Unexpected ordinals %v, expected %v", ordinals, expected)
+		}
+	}
+
+	// The walk stops on request
+	ordinals = nil
+	hnd.WalkSelected(func(o uint64) bool {
+		ordinals = append(ordinals, o)
+		return o == 32
+	})
+	if len(ordinals) != 3 {
+		t.Fatalf("Unexpected ordinals after stopping the walk: %v", ordinals)
+	}
+}
+
+func TestSetUnsetFragmented(t *testing.T) {
+	numBits := uint64(64*blockLen + 10)
+	hnd, err := NewHandle("", nil, "", numBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare the handle with a plain bitmap along random operations
+	set := make([]bool, numBits)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		o := uint64(r.Int63n(int64(numBits)))
+		switch r.Intn(5) {
+		case 0:
+			err = hnd.Set(o)
+			if (err == nil) == set[o] {
+				t.Fatalf("Unexpected result setting bit %d: %v", o, err)
+			}
+			set[o] = true
+		case 1:
+			if !set[o] {
+				continue
+			}
+			if err := hnd.Unset(o); err != nil {
+				t.Fatal(err)
+			}
+			set[o] = false
+		case 2:
+			n := uint64(1 + r.Intn(100))
+			if o+n > numBits {
+				continue
+			}
+			if err := hnd.UnsetBlock(o, n); err != nil {
+				t.Fatal(err)
+			}
+			for j := o; j < o+n; j++ {
+				set[j] = false
+			}
+		case 3:
+			n := uint64(1 + r.Intn(100))
+			exp := o
+			for free := uint64(0); exp+free < numBits && free < n; {
+				if set[exp+free] {
+					exp, free = exp+free+1, 0
+					continue
+				}
+				free++
+			}
+			got, err := hnd.SetAnyBlock(n, o, numBits-1)
+			if exp+n > numBits {
+				if err == nil {
+					t.Fatalf("Expected failure for %d bits from %d. Got success with ordinal:%d", n, o, got)
+				}
+				continue
+			}
+			if err != nil || got != exp {
+				t.Fatalf("Unexpected ordinal for %d bits from %d: (%d, %v). Expected %d", n, o, got, err, exp)
+			}
+			for j := exp; j < exp+n; j++ {
+				set[j] = true
+			}
+		default:
+			exp := o
+			for exp < numBits && set[exp] {
+				exp++
+			}
+			got, err := hnd.SetAnyInRange(o, numBits-1)
+			if exp == numBits {
+				if err == nil {
+					t.Fatalf("Expected failure from %d. Got success with ordinal:%d", o, got)
+				}
+				continue
+			}
+			if err != nil || got != exp {
+				t.Fatalf("Unexpected ordinal from %d: (%d, %v). Expected %d", o, got, err, exp)
+			}
+			set[exp] = true
+		}
+	}
+
+	unselected := numBits
+	for o, isSet := range set {
+		if hnd.IsSet(uint64(o)) != isSet {
+			t.Fatalf("Unexpected state for bit %d", o)
+		}
+		if isSet {
+			unselected--
+		}
+	}
+	if hnd.Unselected() != unselected {
+		t.Fatalf("Unexpected unselected count: %d. Expected %d", hnd.Unselected(), unselected)
+	}
+
+	// Neighbour sequences are merged
+	for s := hnd.root.list(); s.next != nil; s = s.next {
+		if s.block == s.next.block || s.count == 0 {
+			t.Fatalf("Unmerged sequence: %s", hnd.root.list().toString())
+		}
+	}
+
+	// The serialized form is the one of the sequence list
+	ba, err := hnd.ToByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := hnd.root.list().toByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ba[16:]) != string(exp) {
+		t.Fatal("Unexpected serialized sequence")
+	}
+	nh := &Handle{}
+	if err := nh.FromByteArray(ba); err != nil {
+		t.Fatal(err)
+	}
+	if !nh.root.list().equal(hnd.root.list()) || nh.Unselected() != unselected {
+		t.Fatalf("Unexpected deserialized handle: %s", nh)
+	}
+}
+
+func TestSetAnyBlock(t *testing.T) {
+	numBits := uint64(256)
+	hnd, err := NewHandle("", nil, "", numBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []struct {
+		n, start, end uint64
+	}{{0, 0, 10}, {1, 10, 9}, {1, 0, numBits}} {
+		if o, err := hnd.SetAnyBlock(i.n, i.start, i.end); err == nil {
+			t.Fatalf("Expected failure for %d bits in [%d, %d]. Got success with ordinal:%d", i.n, i.start, i.end, o)
+		}
+	}
+	if err := hnd.UnsetBlock(numBits-10, 11); err == nil {
+		t.Fatal("Expected failure releasing a block past the end")
+	}
+
+	for _, o := range []uint64{0, 10, 40} {
+		if err := hnd.Set(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, i := range []struct {
+		n, ordinal uint64
+	}{{8, 1}, {8, 11}, {64, 41}, {100, 105}} {
+		o, err := hnd.SetAnyBlock(i.n, 0, numBits-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o != i.ordinal {
+			t.Fatalf("Unexpected ordinal for %d bits: %d. Expected %d", i.n, o, i.ordinal)
+		}
+		if !hnd.IsSet(o) || !hnd.IsSet(o+i.n-1) {
+			t.Fatalf("Block of %d bits from %d is not set: %s", i.n, o, hnd)
+		}
+	}
+	if hnd.Unselected() != numBits-183 {
+		t.Fatalf("Unexpected unselected count: %d", hnd.Unselected())
+	}
+
+	// The free bits are not consecutive enough
+	if o, err := hnd.SetAnyBlock(16, 0, 30); err != errNoBitAvailable {
+		t.Fatalf("Expected failure. Got (%d, %v)", o, err)
+	}
+	if o, err := hnd.SetAnyBlock(60, 0, numBits-1); err != errNoBitAvailable {
+		t.Fatalf("Expected failure. Got (%d, %v)", o, err)
+	}
+
+	// Only the set bits of the block are accounted for
+	if err := hnd.UnsetBlock(0, 40); err != nil {
+		t.Fatal(err)
+	}
+	if hnd.Unselected() != numBits-183+18 {
+		t.Fatalf("Unexpected unselected count: %d", hnd.Unselected())
+	}
+	if err := hnd.UnsetBlock(0, numBits); err != nil {
+		t.Fatal(err)
+	}
+	if hnd.Unselected() != numBits || !hnd.root.list().equal(&sequence{block: 0x0, count: numBits / uint64(blockLen)}) {
+		t.Fatalf("Unexpected sequence after releasing all bits: %s", hnd)
+	}
+
+	// Large blocks are set a sequence at a time
+	o, err := hnd.SetAnyBlock(numBits-5, 5, numBits-1)
+	if err != nil || o != 5 {
+		t.Fatalf("Unexpected result: (%d, %v)", o, err)
+	}
+	exp := &sequence{block: 0x07FFFFFF, count: 1, next: &sequence{block: blockMAX, count: numBits/uint64(blockLen) - 1}}
+	if !hnd.root.list().equal(exp) || hnd.Unselected() != 5 {
+		t.Fatalf("Unexpected sequence after setting a large block: %s", hnd)
+	}
+}
+
+func TestSetAnyBlockStore(t *testing.T) {
+	ds, err := randomLocalStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hnd, err := NewHandle("bitseq-test", ds, "block", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := hnd.SetAnyBlock(100, 10, 1023)
+	if err != nil || o != 10 {
+		t.Fatalf("Unexpected result: (%d, %v)", o, err)
+	}
+
+	// The whole block is in the store
+	nh, err := NewHandle("bitseq-test", ds, "block", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nh.IsSet(10) || !nh.IsSet(109) || nh.IsSet(110) || nh.Unselected() != 924 {
+		t.Fatalf("Unexpected handle from store: %s", nh)
+	}
+
+	if err := hnd.UnsetBlock(10, 100); err != nil {
+		t.Fatal(err)
+	}
+	o, err = nh.SetAnyBlock(1024, 0, 1023)
+	if err != nil || o != 0 {
+		t.Fatalf("Unexpected result: (%d, %v)", o, err)
+	}
+}
+
+func TestGetFirstAvailableAfterFullBlock(t *testing.T) {
+	// The bits of the start block following the start are set, and so is the next block
+	mask := newTree(&sequence{block: 0x0000FFFF, count: 1, next: &sequence{block: 0xFFFFFFFF, count: 1, next: &sequence{block: 0x0, count: 1}}})
+	bytePos, bitPos, err := getFirstAvailable(mask, 20)
+	if err != nil || bytePos != 8 || bitPos != 0 {
+		t.Fatalf("Unexpected first available bit: (%d, %d, %v)", bytePos, bitPos, err)
+	}
+}
+
+// getFragmentedHandle returns a handle whose consecutive blocks all differ
+// and have one unset bit each, the worst case for the run length encoding
+func getFragmentedHandle(b *testing.B, numBits uint64) *Handle {
+	hnd, err := NewHandle("", nil, "", numBits)
+	if err != nil {
+		b.Fatal(err)
+	}
+	head := &sequence{}
+	s := head
+	for i := uint64(0); i < getNumBlocks(numBits); i++ {
+		if i > 0 {
+			s.next = &sequence{}
+			s = s.next
+		}
+		s.block = blockMAX &^ (blockFirstBit >> (i % uint64(blockLen)))
+		s.count = 1
+	}
+	hnd.root = newTree(head)
+	hnd.unselected = getNumBlocks(numBits)
+	return hnd
+}
+
+func BenchmarkSetAny(b *testing.B) {
+	for _, numBits := range []uint64{1 << 16, 1 << 20, 1 << 24} {
+		b.Run(fmt.Sprintf("bits=%d", numBits), func(b *testing.B) {
+			hnd := getFragmentedHandle(b, numBits)
+			r := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Release the bit right away to keep the fragmentation
+				o, err := hnd.SetAnyInRange(uint64(r.Int63n(int64(numBits/2))), numBits-1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := hnd.Unset(o); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnset(b *testing.B) {
+	for _, numBits := range []uint64{1 << 16, 1 << 20, 1 << 24} {
+		b.Run(fmt.Sprintf("bits=%d", numBits), func(b *testing.B) {
+			hnd := getFragmentedHandle(b, numBits)
+			r := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				o := uint64(r.Int63n(int64(numBits)))
+				if err := hnd.Unset(o); err != nil {
+					b.Fatal(err)
+				}
+				if err := hnd.Set(o); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSetAnyBlock(b *testing.B) {
+	for _, numBits := range []uint64{1 << 16, 1 << 20, 1 << 24} {
+		b.Run(fmt.Sprintf("bits=%d", numBits), func(b *testing.B) {
+			hnd := getFragmentedHandle(b, numBits)
+			// Leave room for the blocks at the end
+			if err := hnd.UnsetBlock(numBits/2, numBits/2); err != nil {
+				b.Fatal(err)
+			}
+			r := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				o, err := hnd.SetAnyBlock(256, uint64(r.Int63n(int64(numBits/2))), numBits-1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := hnd.UnsetBlock(o, 256); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -77,7 +77,7 @@ func (h *Handle) CopyTo(o datastore.KVObject) error {
 	dstH := o.(*Handle)
 	dstH.bits = h.bits
 	dstH.unselected = h.unselected
-	dstH.head = h.head.getCopy()
+	dstH.root = h.root
 	dstH.app = h.app
 	dstH.id = h.id
 	dstH.dbIndex = h.dbIndex
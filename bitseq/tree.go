@@ -0,0 +1,301 @@
+package bitseq
+
+import (
+	"math/rand"
+)
+
+// node is a node of the treap indexing the sequences of a bitmask by block
+// position. The in-order walk of the tree gives back the sequence list, while
+// each node summarizes its subtree, so that lookups skip the subtrees which
+// do not hold the block or any unset bit they look for. The next pointer of
+// the embedded sequence is not used.
+//
+// Nodes are never modified once built: updates copy the nodes on the path
+// they change and share the rest, which makes copies of the tree free.
+type node struct {
+	sequence
+	priority uint32
+	blocks   uint64   // number of blocks in the subtree
+	free     uint64   // number of blocks with unset bits in the subtree
+	runs     freeRuns // runs of unset bits of the subtree
+	left     *node
+	right    *node
+}
+
+// freeRuns describes the runs of consecutive unset bits of a part of the bitmask
+type freeRuns struct {
+	bits uint64 // number of bits of the part
+	head uint64 // number of unset bits at the start of the part
+	tail uint64 // number of unset bits at the end of the part
+	span uint64 // longest run of unset bits in the part
+}
+
+// append returns the runs of the part followed by the passed one
+func (r freeRuns) append(o freeRuns) freeRuns {
+	a := freeRuns{bits: r.bits + o.bits, head: r.head, tail: o.tail, span: r.tail + o.head}
+	if r.head == r.bits {
+		a.head += o.head
+	}
+	if o.tail == o.bits {
+		a.tail += r.tail
+	}
+	if r.span > a.span {
+		a.span = r.span
+	}
+	if o.span > a.span {
+		a.span = o.span
+	}
+	return a
+}
+
+func newNode(block uint32, count uint64, priority uint32, left, right *node) *node {
+	n := &node{
+		sequence: sequence{block: block, count: count},
+		priority: priority,
+		left:     left,
+		right:    right,
+	}
+	n.summarize()
+	return n
+}
+
+// newTree builds the tree holding the sequences of the list, in linear time
+func newTree(head *sequence) *node {
+	// Right spine of the tree built so far
+	var spine []*node
+	for s := head; s != nil; s = s.next {
+		n := &node{sequence: sequence{block: s.block, count: s.count}, priority: rand.Uint32()}
+		for len(spine) > 0 && spine[len(spine)-1].priority < n.priority {
+			n.left = spine[len(spine)-1]
+			spine = spine[:len(spine)-1]
+		}
+		if len(spine) > 0 {
+			spine[len(spine)-1].right = n
+		}
+		spine = append(spine, n)
+	}
+	if len(spine) == 0 {
+		return nil
+	}
+	spine[0].summarizeAll()
+	return spine[0]
+}
+
+func (n *node) summarize() {
+	n.blocks = n.left.numBlocks() + n.count + n.right.numBlocks()
+	n.free = n.left.numFree() + n.right.numFree()
+	if n.block != blockMAX {
+		n.free += n.count
+	}
+	n.runs = n.left.freeRuns().append(n.sequence.freeRuns()).append(n.right.freeRuns())
+}
+
+func (n *node) summarizeAll() {
+	if n == nil {
+		return
+	}
+	n.left.summarizeAll()
+	n.right.summarizeAll()
+	n.summarize()
+}
+
+func (n *node) numBlocks() uint64 {
+	if n == nil {
+		return 0
+	}
+	return n.blocks
+}
+
+func (n *node) numFree() uint64 {
+	if n == nil {
+		return 0
+	}
+	return n.free
+}
+
+func (n *node) freeRuns() freeRuns {
+	if n == nil {
+		return freeRuns{}
+	}
+	return n.runs
+}
+
+// with returns a copy of this node with the passed children
+func (n *node) with(left, right *node) *node {
+	return newNode(n.block, n.count, n.priority, left, right)
+}
+
+// list returns the sequence list held by the tree
+func (n *node) list() *sequence {
+	var head, tail *sequence
+	n.walk(0, func(current *node, _ uint64) bool {
+		s := &sequence{block: current.block, count: current.count}
+		if tail == nil {
+			head = s
+		} else {
+			tail.next = s
+		}
+		tail = s
+		return false
+	})
+	return head
+}
+
+// walk calls fn on the nodes of the tree in order, along with the position
+// of their first block, offset being the position of the tree first block.
+// The walk stops when fn returns true, in which case true is returned.
+func (n *node) walk(offset uint64, fn func(current *node, pos uint64) bool) bool {
+	if n == nil {
+		return false
+	}
+	if n.left.walk(offset, fn) {
+		return true
+	}
+	pos := offset + n.left.numBlocks()
+	if fn(n, pos) {
+		return true
+	}
+	return n.right.walk(pos+n.count, fn)
+}
+
+// find returns the node holding the block at the passed position and the
+// position of the node first block. If the position is outside of the tree,
+// function will return (nil, invalidPos)
+func (n *node) find(pos uint64) (*node, uint64) {
+	var offset uint64
+	for n != nil {
+		start := offset + n.left.numBlocks()
+		switch {
+		case pos < start:
+			n = n.left
+		case pos < start+n.count:
+			return n, start
+		default:
+			offset = start + n.count
+			n = n.right
+		}
+	}
+	return nil, invalidPos
+}
+
+// firstFree returns the first node with unset bits holding a block at or
+// after the passed position, along with the position of its first such
+// block, offset being the position of the tree first block
+func (n *node) firstFree(from, offset uint64) (*node, uint64) {
+	if n.numFree() == 0 {
+		return nil, invalidPos
+	}
+	start := offset + n.left.numBlocks()
+	if from < start {
+		if current, pos := n.left.firstFree(from, offset); current != nil {
+			return current, pos
+		}
+		from = start
+	}
+	if n.block != blockMAX && from < start+n.count {
+		return n, from
+	}
+	return n.right.firstFree(from, start+n.count)
+}
+
+// firstFit returns the ordinal of the first size unset bits in a row of the
+// tree from the from ordinal on, offset being the ordinal of the tree first bit
+// and carry the number of unset bits in a row right before it, counted from
+// the from ordinal. If there is none, it returns invalidPos along with the
+// number of unset bits in a row at the end of the tree, to carry on with.
+func (n *node) firstFit(size, from, offset, carry uint64) (uint64, uint64) {
+	if n == nil {
+		return invalidPos, carry
+	}
+	if offset+n.runs.bits <= from {
+		return invalidPos, 0
+	}
+	// Skip the subtrees without enough unset bits in a row
+	if offset >= from && carry+n.runs.head < size && n.runs.span < size {
+		if n.runs.head == n.runs.bits {
+			return invalidPos, carry + n.runs.bits
+		}
+		return invalidPos, n.runs.tail
+	}
+
+	ordinal, carry := n.left.firstFit(size, from, offset, carry)
+	if ordinal != invalidPos {
+		return ordinal, 0
+	}
+	start := offset + n.left.numBlocks()*uint64(blockLen)
+	if ordinal, carry = n.sequence.firstFit(size, from, start, carry); ordinal != invalidPos {
+		return ordinal, 0
+	}
+	return n.right.firstFit(size, from, start+n.count*uint64(blockLen), carry)
+}
+
+func (n *node) first() *node {
+	for n != nil && n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+func (n *node) last() *node {
+	for n != nil && n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// split returns the tree holding the first k blocks of this tree and the
+// one holding the others. The sequence across the split point is cut in two.
+func (n *node) split(k uint64) (*node, *node) {
+	if k == 0 {
+		return nil, n
+	}
+	if k >= n.numBlocks() {
+		return n, nil
+	}
+	lb := n.left.numBlocks()
+	switch {
+	case k <= lb:
+		l, r := n.left.split(k)
+		return l, n.with(r, n.right)
+	case k >= lb+n.count:
+		l, r := n.right.split(k - lb - n.count)
+		return n.with(n.left, l), r
+	default:
+		c := k - lb
+		return newNode(n.block, c, n.priority, n.left, nil), newNode(n.block, n.count-c, n.priority, nil, n.right)
+	}
+}
+
+// join returns the tree holding the blocks of l followed by the ones of r
+func join(l, r *node) *node {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.priority > r.priority:
+		return l.with(l.left, join(l.right, r))
+	default:
+		return r.with(join(l, r.left), r.right)
+	}
+}
+
+// update returns the tree with the count blocks from the passed position
+// replaced by the passed block. The blocks are cut out of their sequences into
+// a sequence of their own, which is merged with the neighbour sequences
+// holding the same block.
+func (n *node) update(pos, count uint64, block uint32) *node {
+	left, right := n.split(pos)
+	_, right = right.split(count)
+
+	if last := left.last(); last != nil && last.block == block {
+		left, _ = left.split(left.numBlocks() - last.count)
+		count += last.count
+	}
+	if first := right.first(); first != nil && first.block == block {
+		_, right = right.split(first.count)
+		count += first.count
+	}
+
+	return join(join(left, newNode(block, count, rand.Uint32(), nil, nil)), right)
+}
@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/docker/docker/pkg/stringid"
 	_ "github.com/docker/libnetwork/testutils"
 )
 
@@ -26,13 +29,15 @@ func TestMain(m *testing.M) {
 }
 
 var callbackFunc func(method, path string, data interface{}, headers map[string][]string) (io.ReadCloser, http.Header, int, error)
-var mockNwJSON, mockNwListJSON, mockServiceJSON, mockServiceListJSON, mockSbJSON, mockSbListJSON []byte
+var mockNwJSON, mockNwListJSON, mockServiceJSON, mockServiceListJSON, mockSbJSON, mockSbListJSON, mockEventsJSON, mockIpamJSON, mockPoolJSON []byte
 var mockNwName = "test"
 var mockNwID = "2a3456789"
 var mockServiceName = "testSrv"
 var mockServiceID = "2a3456789"
 var mockContainerID = "2a3456789"
 var mockSandboxID = "2b3456789"
+var mockPoolID = "LocalDefault/172.21.0.0/16"
+var mockIpamExport = `{"version":1,"address_spaces":[{"name":"LocalDefault","pools":[]}]}`
 
 func setupMockHTTPCallback() {
 	var list []networkResource
@@ -53,13 +58,37 @@ func setupMockHTTPCallback() {
 	sbxList = append(sbxList, sb)
 	mockSbListJSON, _ = json.Marshal(sbxList)
 
+	for _, ev := range []eventResource{
+		{Type: "network.create", NetworkID: mockNwID},
+		{Type: "endpoint.join", NetworkID: mockNwID, EndpointID: mockServiceID, SandboxID: mockSandboxID},
+	} {
+		b, _ := json.Marshal(ev)
+		mockEventsJSON = append(mockEventsJSON, b...)
+		mockEventsJSON = append(mockEventsJSON, '\n')
+	}
+
+	pool := poolResource{ID: mockPoolID, AddressSpace: "LocalDefault", Pool: "172.21.0.0/16", RefCount: 1, Total: 65536, Free: 65533, Allocated: []string{"172.21.0.1"}}
+	mockPoolJSON, _ = json.Marshal(pool)
+	pool.Allocated = nil
+	mockIpamJSON, _ = json.Marshal([]addressSpaceResource{{Name: "LocalDefault", Scope: "local", Pools: []poolResource{pool}}})
+
 	dummyHTTPHdr := http.Header{}
 
 	callbackFunc = func(method, path string, data interface{}, headers map[string][]string) (io.ReadCloser, http.Header, int, error) {
 		var rsp string
 		switch method {
 		case "GET":
-			if strings.Contains(path, fmt.Sprintf("networks?name=%s", mockNwName)) {
+			if strings.HasPrefix(path, "/events") {
+				rsp = string(mockEventsJSON)
+			} else if path == "/reconcile" {
+				rsp = "[]"
+			} else if path == "/ipam/default" {
+				rsp = string(mockIpamJSON)
+			} else if path == "/ipam/default/pools/"+mockPoolID {
+				rsp = string(mockPoolJSON)
+			} else if path == "/ipam/default/export" {
+				rsp = mockIpamExport
+			} else if strings.Contains(path, fmt.Sprintf("networks?name=%s", mockNwName)) {
 				rsp = string(mockNwListJSON)
 			} else if strings.Contains(path, "networks?name=") {
 				rsp = "[]"
@@ -98,11 +127,24 @@ func setupMockHTTPCallback() {
 				data, _ = json.Marshal(mockServiceID)
 			} else if strings.HasSuffix(path, "backend") {
 				data, _ = json.Marshal(mockSandboxID)
+			} else if path == "/reconcile" {
+				data, _ = json.Marshal([]inconsistencyResource{
+					{Type: "endpoint_count", NetworkID: mockNwID, Detail: "network test has 1 endpoints but its endpoint count is 2", Repaired: true},
+				})
 			}
 			rsp = string(data)
 		case "PUT":
 		case "DELETE":
-			rsp = ""
+			if strings.HasSuffix(path, "networks/"+mockNwID+"?dry-run=true") {
+				data, _ := json.Marshal(networkDependencies{
+					Endpoints: []string{mockServiceName},
+					Sandboxes: []string{mockSandboxID},
+					Pools:     []string{"172.21.0.0/16"},
+				})
+				rsp = string(data)
+			} else {
+				rsp = ""
+			}
 		}
 		return nopCloser{bytes.NewBufferString(rsp)}, dummyHTTPHdr, 200, nil
 	}
@@ -163,6 +205,38 @@ func TestClientNetworkRm(t *testing.T) {
 	}
 }
 
+func TestClientNetworkRmDryRun(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cli := NewNetworkCli(&out, &errOut, callbackFunc)
+
+	if err := cli.Cmd("docker", "network", "rm", "--dry-run", mockNwName); err != nil {
+		t.Fatal(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != "Endpoint: "+mockServiceName || lines[1] != "Sandbox: "+stringid.TruncateID(mockSandboxID) || lines[2] != "Pool: 172.21.0.0/16" {
+		t.Fatalf("Unexpected dry run output %q", out.String())
+	}
+
+	if err := cli.Cmd("docker", "network", "rm", "--force", mockNwName); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestClientNetworkUpdate(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cli := NewNetworkCli(&out, &errOut, callbackFunc)
+
+	err := cli.Cmd("docker", "network", "update", "--label=tier=backend", "--opt=com.docker.network.mtu=1400", "--subnet=10.1.0.0/16", mockNwName)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = cli.Cmd("docker", "network", "update", "--label=tier", mockNwName)
+	if err == nil {
+		t.Fatalf("Passing an invalid label must fail")
+	}
+}
+
 func TestClientNetworkLs(t *testing.T) {
 	var out, errOut bytes.Buffer
 	cli := NewNetworkCli(&out, &errOut, callbackFunc)
@@ -193,6 +267,114 @@ func TestClientNetworkInfoById(t *testing.T) {
 	}
 }
 
+func TestClientEvents(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cli := NewNetworkCli(&out, &errOut, callbackFunc)
+
+	err := cli.Cmd("docker", "events", "--type=network.create,endpoint.join", "--network="+mockNwName)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events, got %q", out.String())
+	}
+	if !strings.HasSuffix(lines[1], "endpoint.join network="+mockNwID+" endpoint="+mockServiceID+" sandbox="+mockSandboxID) {
+		t.Fatalf("Unexpected event output %q", lines[1])
+	}
+}
+
+func TestClientReconcile(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cli := NewNetworkCli(&out, &errOut, callbackFunc)
+
+	if err := cli.Cmd("docker", "reconcile"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if strings.TrimSpace(out.String()) != "No inconsistency found" {
+		t.Fatalf("Unexpected reconcile output %q", out.String())
+	}
+
+	out.Reset()
+	if err := cli.Cmd("docker", "reconcile", "--repair"); err != nil {
+		t.Fatal(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "endpoint_count") || !strings.Contains(lines[1], "repaired") {
+		t.Fatalf("Unexpected reconcile output %q", out.String())
+	}
+}
+
+func TestClientIpam(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cli := NewNetworkCli(&out, &errOut, callbackFunc)
+
+	if err := cli.Cmd("docker", "ipam", "ls"); err != nil {
+		t.Fatal(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], mockPoolID) || !strings.HasSuffix(lines[1], "65533") {
+		t.Fatalf("Unexpected ipam ls output %q", out.String())
+	}
+
+	out.Reset()
+	if err := cli.Cmd("docker", "ipam", "inspect", mockPoolID); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(out.String(), "Free: 65533\n") || !strings.Contains(out.String(), "Allocated: 172.21.0.1\n") {
+		t.Fatalf("Unexpected ipam inspect output %q", out.String())
+	}
+}
+
+func TestClientIpamExportImport(t *testing.T) {
+	var out, errOut bytes.Buffer
+	var imported []byte
+	cli := NewNetworkCli(&out, &errOut, func(method, path string, data interface{}, headers map[string][]string) (io.ReadCloser, http.Header, int, error) {
+		if method == "POST" && path == "/ipam/default/import" {
+			imported, _ = json.Marshal(data)
+			return nopCloser{bytes.NewBufferString("")}, http.Header{}, 200, nil
+		}
+		return callbackFunc(method, path, data, headers)
+	})
+
+	if err := cli.Cmd("docker", "ipam", "export"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != mockIpamExport {
+		t.Fatalf("Unexpected ipam export output %q", out.String())
+	}
+
+	dir, err := ioutil.TempDir("", "ipam-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "export.json")
+
+	out.Reset()
+	if err := cli.Cmd("docker", "ipam", "export", "-o", file); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Unexpected ipam export output %q", out.String())
+	}
+
+	if err := cli.Cmd("docker", "ipam", "import", file); err != nil {
+		t.Fatal(err)
+	}
+	if string(imported) != mockIpamExport {
+		t.Fatalf("Unexpected imported document %q", imported)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Cmd("docker", "ipam", "import", file); err == nil {
+		t.Fatal("Expected import of an invalid file to fail")
+	}
+}
+
 // Docker Flag processing in flag.go uses os.Exit() frequently, even for --help
 // TODO : Handle the --help test-case in the IT when CLI is available
 /*
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	flag "github.com/docker/docker/pkg/mflag"
+	"github.com/docker/docker/pkg/stringid"
+)
+
+// CmdEvents handles the Events UI. It streams the controller events
+// until the daemon closes the connection.
+func (cli *NetworkCli) CmdEvents(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "events", "", "Streams the network events of the daemon", false)
+	flType := cmd.String([]string{"t", "-type"}, "", "Comma separated list of event types to stream")
+	flNetwork := cmd.String([]string{"-network"}, "", "Only stream the events of this network")
+	cmd.Require(flag.Exact, 0)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	v := url.Values{}
+	if *flType != "" {
+		v.Set("type", *flType)
+	}
+	if *flNetwork != "" {
+		v.Set("network", *flNetwork)
+	}
+	path := "/events"
+	if q := v.Encode(); q != "" {
+		path += "?" + q
+	}
+
+	stream, _, _, err := cli.call("GET", path, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	dec := json.NewDecoder(stream)
+	for {
+		var ev eventResource
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		fmt.Fprintln(cli.out, formatEvent(&ev))
+	}
+}
+
+func formatEvent(ev *eventResource) string {
+	fields := []string{ev.Time.Format(time.RFC3339Nano), ev.Type}
+	if ev.NetworkID != "" {
+		fields = append(fields, "network="+stringid.TruncateID(ev.NetworkID))
+	}
+	if ev.EndpointID != "" {
+		fields = append(fields, "endpoint="+stringid.TruncateID(ev.EndpointID))
+	}
+	if ev.SandboxID != "" {
+		fields = append(fields, "sandbox="+stringid.TruncateID(ev.SandboxID))
+	}
+	if ev.Address != "" {
+		fields = append(fields, "address="+ev.Address)
+	}
+	return strings.Join(fields, " ")
+}
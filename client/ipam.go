@@ -0,0 +1,175 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+
+	flag "github.com/docker/docker/pkg/mflag"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/libnetwork/ipamapi"
+)
+
+var (
+	ipamCommands = []command{
+		{"ls", "List the address spaces and pools of an ipam driver"},
+		{"inspect", "Display the usage and the allocated addresses of a pool"},
+		{"export", "Export the address spaces of an ipam driver"},
+		{"import", "Import address spaces exported from an ipam driver"},
+	}
+)
+
+// CmdIpam handles the root Ipam UI
+func (cli *NetworkCli) CmdIpam(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "ipam", "COMMAND [OPTIONS] [arg...]", ipamUsage(chain), false)
+	cmd.Require(flag.Min, 1)
+	err := cmd.ParseFlags(args, true)
+	if err == nil {
+		cmd.Usage()
+		return fmt.Errorf("invalid command : %v", args)
+	}
+	return err
+}
+
+// CmdIpamLs handles Ipam List UI
+func (cli *NetworkCli) CmdIpamLs(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "ls", "", "Lists the address spaces and the pools in use of an ipam driver", false)
+	flDriver := cmd.String([]string{"d", "-driver"}, ipamapi.DefaultIPAM, "Ipam driver to inspect")
+	cmd.Require(flag.Exact, 0)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	obj, _, err := readBody(cli.call("GET", "/ipam/"+*flDriver, nil, nil))
+	if err != nil {
+		return err
+	}
+
+	var asl []addressSpaceResource
+	if err := json.Unmarshal(obj, &asl); err != nil {
+		return err
+	}
+
+	wr := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	fmt.Fprintln(wr, "ADDRESS SPACE\tSCOPE\tPOOL ID\tREFS\tTOTAL\tFREE")
+	for _, as := range asl {
+		for _, p := range as.Pools {
+			fmt.Fprintf(wr, "%s\t%s\t%s\t%d\t%d\t%d\n", as.Name, as.Scope, p.ID, p.RefCount, p.Total, p.Free)
+		}
+	}
+	wr.Flush()
+	return nil
+}
+
+// CmdIpamInspect handles Ipam Inspect UI
+func (cli *NetworkCli) CmdIpamInspect(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "inspect", "POOL-ID", "Displays the usage and the allocated addresses of a pool", false)
+	flDriver := cmd.String([]string{"d", "-driver"}, ipamapi.DefaultIPAM, "Ipam driver owning the pool")
+	cmd.Require(flag.Exact, 1)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	obj, _, err := readBody(cli.call("GET", "/ipam/"+*flDriver+"/pools/"+cmd.Arg(0), nil, nil))
+	if err != nil {
+		return err
+	}
+
+	var p poolResource
+	if err := json.Unmarshal(obj, &p); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cli.out, "Pool ID: %s\n", p.ID)
+	fmt.Fprintf(cli.out, "Address Space: %s\n", p.AddressSpace)
+	fmt.Fprintf(cli.out, "Pool: %s\n", p.Pool)
+	if p.SubPool != "" {
+		fmt.Fprintf(cli.out, "Sub Pool: %s\n", p.SubPool)
+	}
+	fmt.Fprintf(cli.out, "References: %d\n", p.RefCount)
+	fmt.Fprintf(cli.out, "Total: %d\n", p.Total)
+	fmt.Fprintf(cli.out, "Free: %d\n", p.Free)
+	for _, a := range p.Allocated {
+		fmt.Fprintf(cli.out, "Allocated: %s\n", a)
+	}
+	for _, a := range p.Quarantined {
+		fmt.Fprintf(cli.out, "Quarantined: %s\n", a)
+	}
+	if len(p.Leases) == 0 {
+		return nil
+	}
+
+	wr := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	fmt.Fprintln(wr, "ADDRESS\tENDPOINT\tCONTAINER\tRENEWED\tEXPIRES")
+	for _, l := range p.Leases {
+		expires := "never"
+		if l.TTL > 0 {
+			expires = l.Renewed.Add(l.TTL).Format(time.RFC3339)
+		}
+		fmt.Fprintf(wr, "%s\t%s\t%s\t%s\t%s\n", l.Address, stringid.TruncateID(l.EndpointID),
+			stringid.TruncateID(l.ContainerID), l.Renewed.Format(time.RFC3339), expires)
+	}
+	wr.Flush()
+	return nil
+}
+
+// CmdIpamExport handles Ipam Export UI
+func (cli *NetworkCli) CmdIpamExport(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "export", "", "Exports the address spaces, pools and allocated addresses of an ipam driver", false)
+	flDriver := cmd.String([]string{"d", "-driver"}, ipamapi.DefaultIPAM, "Ipam driver to export")
+	flOutput := cmd.String([]string{"o", "-output"}, "", "Write to a file instead of the standard output")
+	cmd.Require(flag.Exact, 0)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	obj, _, err := readBody(cli.call("GET", "/ipam/"+*flDriver+"/export", nil, nil))
+	if err != nil {
+		return err
+	}
+
+	if *flOutput != "" {
+		return ioutil.WriteFile(*flOutput, obj, 0600)
+	}
+
+	_, err = cli.out.Write(obj)
+	return err
+}
+
+// CmdIpamImport handles Ipam Import UI
+func (cli *NetworkCli) CmdIpamImport(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "import", "FILE", "Imports the address spaces exported from an ipam driver", false)
+	flDriver := cmd.String([]string{"d", "-driver"}, ipamapi.DefaultIPAM, "Ipam driver to import into")
+	cmd.Require(flag.Exact, 1)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	doc, err := ioutil.ReadFile(cmd.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !json.Valid(doc) {
+		return fmt.Errorf("invalid ipam export file %s", cmd.Arg(0))
+	}
+
+	_, _, err = readBody(cli.call("POST", "/ipam/"+*flDriver+"/import", json.RawMessage(doc), nil))
+	return err
+}
+
+func ipamUsage(chain string) string {
+	help := "Commands:\n"
+
+	for _, cmd := range ipamCommands {
+		help += fmt.Sprintf("  %-25.25s%s\n", cmd.name, cmd.description)
+	}
+
+	help += fmt.Sprintf("\nRun '%s ipam COMMAND --help' for more information on a command.", chain)
+	return help
+}
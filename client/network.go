@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"text/tabwriter"
 
 	flag "github.com/docker/docker/pkg/mflag"
@@ -20,6 +22,7 @@ var (
 	networkCommands = []command{
 		{"create", "Create a network"},
 		{"rm", "Remove a network"},
+		{"update", "Update a network"},
 		{"ls", "List all networks"},
 		{"info", "Display information of a network"},
 	}
@@ -66,6 +69,8 @@ func (cli *NetworkCli) CmdNetworkCreate(chain string, args ...string) error {
 // CmdNetworkRm handles Network Delete UI
 func (cli *NetworkCli) CmdNetworkRm(chain string, args ...string) error {
 	cmd := cli.Subcmd(chain, "rm", "NETWORK", "Deletes a network", false)
+	flForce := cmd.Bool([]string{"f", "-force"}, false, "Remove the endpoints from their sandboxes and delete them with the network")
+	flDryRun := cmd.Bool([]string{"-dry-run"}, false, "List the endpoints, sandboxes and pools a forced delete affects, without deleting")
 	cmd.Require(flag.Exact, 1)
 	err := cmd.ParseFlags(args, true)
 	if err != nil {
@@ -75,13 +80,85 @@ func (cli *NetworkCli) CmdNetworkRm(chain string, args ...string) error {
 	if err != nil {
 		return err
 	}
-	_, _, err = readBody(cli.call("DELETE", "/networks/"+id, nil, nil))
+
+	if *flDryRun {
+		obj, _, err := readBody(cli.call("DELETE", "/networks/"+id+"?dry-run=true", nil, nil))
+		if err != nil {
+			return err
+		}
+		deps := &networkDependencies{}
+		if err := json.NewDecoder(bytes.NewReader(obj)).Decode(deps); err != nil {
+			return err
+		}
+		for _, ep := range deps.Endpoints {
+			fmt.Fprintf(cli.out, "Endpoint: %s\n", ep)
+		}
+		for _, sb := range deps.Sandboxes {
+			fmt.Fprintf(cli.out, "Sandbox: %s\n", stringid.TruncateID(sb))
+		}
+		for _, p := range deps.Pools {
+			fmt.Fprintf(cli.out, "Pool: %s\n", p)
+		}
+		return nil
+	}
+
+	path := "/networks/" + id
+	if *flForce {
+		path += "?force=true"
+	}
+	_, _, err = readBody(cli.call("DELETE", path, nil, nil))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// CmdNetworkUpdate handles Network Update UI
+func (cli *NetworkCli) CmdNetworkUpdate(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "update", "NETWORK", "Updates the labels, driver options and address pools of a network", false)
+	flLabels := cmd.String([]string{"-label"}, "", "Comma separated KEY=VALUE list of labels replacing the network ones")
+	flOpts := cmd.String([]string{"o", "-opt"}, "", "Comma separated KEY=VALUE list of driver options to change")
+	flSubnets := cmd.String([]string{"-subnet"}, "", "Comma separated list of address pools, in CIDR notation, to add to the network")
+	cmd.Require(flag.Exact, 1)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	id, err := lookupNetworkID(cli, cmd.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	nu := networkUpdate{}
+	if *flLabels != "" {
+		if nu.Labels, err = parseKeyValues(*flLabels); err != nil {
+			return err
+		}
+	}
+	if *flOpts != "" {
+		if nu.DriverOpts, err = parseKeyValues(*flOpts); err != nil {
+			return err
+		}
+	}
+	if *flSubnets != "" {
+		for _, s := range strings.Split(*flSubnets, ",") {
+			ip, _, err := net.ParseCIDR(s)
+			if err != nil {
+				return fmt.Errorf("invalid subnet %s: %v", s, err)
+			}
+			if ip.To4() != nil {
+				nu.IPv4Pools = append(nu.IPv4Pools, ipamPool{Pool: s})
+			} else {
+				nu.IPv6Pools = append(nu.IPv6Pools, ipamPool{Pool: s})
+			}
+		}
+	}
+
+	_, _, err = readBody(cli.call("PUT", "/networks/"+id, nu, nil))
+	return err
+}
+
 // CmdNetworkLs handles Network List UI
 func (cli *NetworkCli) CmdNetworkLs(chain string, args ...string) error {
 	cmd := cli.Subcmd(chain, "ls", "", "Lists all the networks created by the user", false)
@@ -160,6 +237,9 @@ func (cli *NetworkCli) CmdNetworkInfo(chain string, args ...string) error {
 	fmt.Fprintf(cli.out, "Network Id: %s\n", networkResource.ID)
 	fmt.Fprintf(cli.out, "Name: %s\n", networkResource.Name)
 	fmt.Fprintf(cli.out, "Type: %s\n", networkResource.Type)
+	for k, v := range networkResource.Labels {
+		fmt.Fprintf(cli.out, "Label: %s=%s\n", k, v)
+	}
 	if networkResource.Services != nil {
 		for _, serviceResource := range networkResource.Services {
 			fmt.Fprintf(cli.out, "  Service Id: %s\n", serviceResource.ID)
@@ -170,6 +250,18 @@ func (cli *NetworkCli) CmdNetworkInfo(chain string, args ...string) error {
 	return nil
 }
 
+func parseKeyValues(list string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, kv := range strings.Split(list, ",") {
+		p := strings.SplitN(kv, "=", 2)
+		if len(p) != 2 || p[0] == "" {
+			return nil, fmt.Errorf("invalid KEY=VALUE pair %q", kv)
+		}
+		m[p[0]] = p[1]
+	}
+	return m, nil
+}
+
 // Helper function to predict if a string is a name or id or partial-id
 // This provides a best-effort mechanism to identify a id with the help of GET Filter APIs
 // Being a UI, its most likely that name will be used by the user, which is used to lookup
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	flag "github.com/docker/docker/pkg/mflag"
+)
+
+// CmdReconcile handles the Reconcile UI. It reports the inconsistencies
+// found in the daemon state and optionally repairs them.
+func (cli *NetworkCli) CmdReconcile(chain string, args ...string) error {
+	cmd := cli.Subcmd(chain, "reconcile", "", "Checks the consistency of the networks, endpoints, sandboxes and ipam state", false)
+	repair := cmd.Bool([]string{"-repair"}, false, "Repair the inconsistencies found")
+	cmd.Require(flag.Exact, 0)
+	err := cmd.ParseFlags(args, true)
+	if err != nil {
+		return err
+	}
+
+	method := "GET"
+	if *repair {
+		method = "POST"
+	}
+
+	obj, _, err := readBody(cli.call(method, "/reconcile", nil, nil))
+	if err != nil {
+		return err
+	}
+
+	var il []inconsistencyResource
+	if err := json.Unmarshal(obj, &il); err != nil {
+		return err
+	}
+
+	if len(il) == 0 {
+		fmt.Fprintln(cli.out, "No inconsistency found")
+		return nil
+	}
+
+	wr := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	fmt.Fprintln(wr, "TYPE\tSTATUS\tDETAIL")
+	for _, i := range il {
+		status := "found"
+		if i.Repaired {
+			status = "repaired"
+		} else if i.Error != "" {
+			status = "failed: " + i.Error
+		}
+		fmt.Fprintf(wr, "%s\t%s\t%s\n", i.Type, status, i.Detail)
+	}
+	wr.Flush()
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	flag "github.com/docker/docker/pkg/mflag"
 	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/libnetwork/types"
 )
 
 var (
@@ -162,6 +163,22 @@ func parseServiceName(name string) (string, string) {
 // CmdServicePublish handles service create UI
 func (cli *NetworkCli) CmdServicePublish(chain string, args ...string) error {
 	cmd := cli.Subcmd(chain, "publish", "SERVICE[.NETWORK]", "Publish a new service on a network", false)
+	flVips := cmd.String([]string{"-vip"}, "", "Comma separated virtual ips, in CIDR notation, to bind to the backends loopback device")
+	flIP := cmd.String([]string{"-ip"}, "", "IPv4 address of the service endpoint")
+	flIPv6 := cmd.String([]string{"-ipv6"}, "", "IPv6 address of the service endpoint")
+	flMac := cmd.String([]string{"-mac"}, "", "MAC address of the service endpoint")
+	flAddrs := cmd.String([]string{"-addr"}, "", "Comma separated additional addresses of the service endpoint, each an IP address or a network pool in CIDR notation")
+	flExpose := cmd.String([]string{"-expose"}, "", "Comma separated PROTO/PORT list of ports exposed by the service")
+	flLB := cmd.Bool([]string{"-lb"}, false, "Load balance the traffic to the virtual ips across the service backends")
+	flLBScheduler := cmd.String([]string{"-lb-scheduler"}, "rr", "Scheduler used to load balance the traffic")
+	flLBMethod := cmd.String([]string{"-lb-method"}, "dr", "Forwarding method (dr or nat) used to load balance the traffic")
+	flLBSandbox := cmd.String([]string{"-lb-sandbox"}, "", "Sandbox to program the load balancer in, the host if empty")
+	flHealth := cmd.String([]string{"-health"}, "", "Health check type (tcp, http or icmp) run against the service backends")
+	flHealthPort := cmd.Int([]string{"-health-port"}, 0, "Port probed by tcp and http health checks")
+	flHealthPath := cmd.String([]string{"-health-path"}, "", "Request path of http health checks")
+	flHealthInterval := cmd.String([]string{"-health-interval"}, "", "Time between two health checks")
+	flHealthTimeout := cmd.String([]string{"-health-timeout"}, "", "Time after which a health check is considered failed")
+	flHealthThreshold := cmd.Int([]string{"-health-threshold"}, 0, "Consecutive health check results needed to change the backend state")
 	cmd.Require(flag.Exact, 1)
 	err := cmd.ParseFlags(args, true)
 	if err != nil {
@@ -169,7 +186,41 @@ func (cli *NetworkCli) CmdServicePublish(chain string, args ...string) error {
 	}
 
 	sn, nn := parseServiceName(cmd.Arg(0))
-	sc := serviceCreate{Name: sn, Network: nn}
+	sc := serviceCreate{Name: sn, Network: nn, Address: *flIP, AddressIPv6: *flIPv6, MacAddress: *flMac}
+	if *flVips != "" {
+		sc.VirtualIPs = strings.Split(*flVips, ",")
+	}
+	if *flAddrs != "" {
+		for _, s := range strings.Split(*flAddrs, ",") {
+			if strings.Contains(s, "/") {
+				sc.Additional = append(sc.Additional, additionalAddress{Pool: s})
+			} else {
+				sc.Additional = append(sc.Additional, additionalAddress{Address: s})
+			}
+		}
+	}
+	if *flExpose != "" {
+		for _, s := range strings.Split(*flExpose, ",") {
+			var tp types.TransportPort
+			if err := tp.FromString(s); err != nil {
+				return err
+			}
+			sc.ExposedPorts = append(sc.ExposedPorts, tp)
+		}
+	}
+	if *flLB {
+		sc.LoadBalancer = &loadBalancer{Scheduler: *flLBScheduler, Method: *flLBMethod, SandboxID: *flLBSandbox}
+	}
+	if *flHealth != "" {
+		sc.HealthCheck = &healthCheck{
+			Type:      *flHealth,
+			Port:      uint16(*flHealthPort),
+			Path:      *flHealthPath,
+			Interval:  *flHealthInterval,
+			Timeout:   *flHealthTimeout,
+			Threshold: *flHealthThreshold,
+		}
+	}
 	obj, _, err := readBody(cli.call("POST", "/services", sc, nil))
 	if err != nil {
 		return err
@@ -313,6 +364,33 @@ func (cli *NetworkCli) CmdServiceInfo(chain string, args ...string) error {
 	fmt.Fprintf(cli.out, "Service Id: %s\n", sr.ID)
 	fmt.Fprintf(cli.out, "\tName: %s\n", sr.Name)
 	fmt.Fprintf(cli.out, "\tNetwork: %s\n", sr.Network)
+	if sr.Address != "" {
+		fmt.Fprintf(cli.out, "\tAddress: %s\n", sr.Address)
+	}
+	if sr.AddressIPv6 != "" {
+		fmt.Fprintf(cli.out, "\tIPv6 Address: %s\n", sr.AddressIPv6)
+	}
+	if sr.MacAddress != "" {
+		fmt.Fprintf(cli.out, "\tMAC Address: %s\n", sr.MacAddress)
+	}
+	if len(sr.Additional) > 0 {
+		fmt.Fprintf(cli.out, "\tAdditional Addresses: %s\n", strings.Join(sr.Additional, ", "))
+	}
+	if len(sr.VirtualIPs) > 0 {
+		fmt.Fprintf(cli.out, "\tVirtual IPs: %s\n", strings.Join(sr.VirtualIPs, ", "))
+	}
+	if lb := sr.LoadBalancer; lb != nil {
+		fmt.Fprintf(cli.out, "\tLoad Balancer: scheduler %s, method %s\n", lb.Scheduler, lb.Method)
+	}
+	if hc := sr.HealthCheck; hc != nil {
+		fmt.Fprintf(cli.out, "\tHealth Check: %s every %s, timeout %s, threshold %d\n", hc.Type, hc.Interval, hc.Timeout, hc.Threshold)
+	}
+	if hs := sr.Health; hs != nil {
+		fmt.Fprintf(cli.out, "\tHealth: %s\n", hs.Status)
+		if hs.LastError != "" {
+			fmt.Fprintf(cli.out, "\tLast Health Check Error: %s\n", hs.LastError)
+		}
+	}
 
 	return nil
 }
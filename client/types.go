@@ -1,6 +1,10 @@
 package client
 
-import "github.com/docker/libnetwork/types"
+import (
+	"time"
+
+	"github.com/docker/libnetwork/types"
+)
 
 /***********
  Resources
@@ -11,14 +15,23 @@ type networkResource struct {
 	Name     string             `json:"name"`
 	ID       string             `json:"id"`
 	Type     string             `json:"type"`
+	Labels   map[string]string  `json:"labels,omitempty"`
 	Services []*serviceResource `json:"services"`
 }
 
 // serviceResource is the body of the "get service" http response message
 type serviceResource struct {
-	Name    string `json:"name"`
-	ID      string `json:"id"`
-	Network string `json:"network"`
+	Name         string        `json:"name"`
+	ID           string        `json:"id"`
+	Network      string        `json:"network"`
+	Address      string        `json:"address,omitempty"`
+	AddressIPv6  string        `json:"address_ipv6,omitempty"`
+	MacAddress   string        `json:"mac_address,omitempty"`
+	Additional   []string      `json:"additional_addresses,omitempty"`
+	VirtualIPs   []string      `json:"virtual_ips,omitempty"`
+	LoadBalancer *loadBalancer `json:"load_balancer,omitempty"`
+	HealthCheck  *healthCheck  `json:"health_check,omitempty"`
+	Health       *healthStatus `json:"health,omitempty"`
 }
 
 // SandboxResource is the body of "get service backend" response message
@@ -28,6 +41,70 @@ type SandboxResource struct {
 	ContainerID string `json:"container_id"`
 }
 
+// eventResource is an entry of the "get events" http response stream
+type eventResource struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	NetworkID  string    `json:"network_id,omitempty"`
+	EndpointID string    `json:"endpoint_id,omitempty"`
+	SandboxID  string    `json:"sandbox_id,omitempty"`
+	Address    string    `json:"address,omitempty"`
+}
+
+// inconsistencyResource is an entry of the "reconcile" http response message
+type inconsistencyResource struct {
+	Type       string `json:"type"`
+	NetworkID  string `json:"network_id,omitempty"`
+	EndpointID string `json:"endpoint_id,omitempty"`
+	SandboxID  string `json:"sandbox_id,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Detail     string `json:"detail"`
+	Repaired   bool   `json:"repaired"`
+	Error      string `json:"error,omitempty"`
+}
+
+// networkDependencies is the body of the "delete network" dry run http
+// response message
+type networkDependencies struct {
+	Endpoints []string `json:"endpoints"`
+	Sandboxes []string `json:"sandboxes"`
+	Pools     []string `json:"pools"`
+}
+
+// addressSpaceResource is the body of the "get address spaces" http response
+// message
+type addressSpaceResource struct {
+	Name  string         `json:"name"`
+	Scope string         `json:"scope"`
+	Pools []poolResource `json:"pools"`
+}
+
+// poolResource is the body of the "get pool" http response message
+type poolResource struct {
+	ID           string          `json:"id"`
+	AddressSpace string          `json:"address_space"`
+	Pool         string          `json:"pool"`
+	SubPool      string          `json:"sub_pool,omitempty"`
+	RefCount     int             `json:"ref_count"`
+	Total        uint64          `json:"total"`
+	Free         uint64          `json:"free"`
+	Allocated    []string        `json:"allocated,omitempty"`
+	Leases       []leaseResource `json:"leases,omitempty"`
+	Quarantined  []string        `json:"quarantined,omitempty"`
+}
+
+// leaseResource is the lease of an address in the "get pool" http response
+// message
+type leaseResource struct {
+	Address     string        `json:"address"`
+	PoolID      string        `json:"pool_id"`
+	EndpointID  string        `json:"endpoint_id,omitempty"`
+	ContainerID string        `json:"container_id,omitempty"`
+	Created     time.Time     `json:"created"`
+	Renewed     time.Time     `json:"renewed"`
+	TTL         time.Duration `json:"ttl,omitempty"`
+}
+
 /***********
   Body types
   ************/
@@ -39,12 +116,64 @@ type networkCreate struct {
 	DriverOpts  []string `json:"driver_opts"`
 }
 
+// networkUpdate is the expected body of the "update network" http request message
+type networkUpdate struct {
+	Labels     map[string]string `json:"labels,omitempty"`
+	DriverOpts map[string]string `json:"driver_opts,omitempty"`
+	IPv4Pools  []ipamPool        `json:"ipv4_pools,omitempty"`
+	IPv6Pools  []ipamPool        `json:"ipv6_pools,omitempty"`
+}
+
+// ipamPool represents an address pool of a network
+type ipamPool struct {
+	Pool string `json:"pool"`
+}
+
 // serviceCreate represents the body of the "publish service" http request message
 type serviceCreate struct {
 	Name         string                `json:"name"`
 	Network      string                `json:"network_name"`
 	ExposedPorts []types.TransportPort `json:"exposed_ports"`
 	PortMapping  []types.PortBinding   `json:"port_mapping"`
+	VirtualIPs   []string              `json:"virtual_ips"`
+	Address      string                `json:"address,omitempty"`
+	AddressIPv6  string                `json:"address_ipv6,omitempty"`
+	MacAddress   string                `json:"mac_address,omitempty"`
+	Additional   []additionalAddress   `json:"additional_addresses,omitempty"`
+	LoadBalancer *loadBalancer         `json:"load_balancer,omitempty"`
+	HealthCheck  *healthCheck          `json:"health_check,omitempty"`
+}
+
+// additionalAddress represents the request of an endpoint address besides
+// the primary ones, from a network pool and/or at a given address
+type additionalAddress struct {
+	Pool    string `json:"pool"`
+	Address string `json:"address"`
+}
+
+// loadBalancer represents the load balancing configuration of a service
+type loadBalancer struct {
+	Scheduler string `json:"scheduler"`
+	Method    string `json:"method"`
+	SandboxID string `json:"sandbox_id,omitempty"`
+}
+
+// healthCheck represents the configuration of the probes run against
+// the backends of a service
+type healthCheck struct {
+	Type      string `json:"type"`
+	Port      uint16 `json:"port,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Interval  string `json:"interval,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
+}
+
+// healthStatus represents the health state of the backend of a service
+type healthStatus struct {
+	Status        string `json:"status"`
+	FailingStreak int    `json:"failing_streak"`
+	LastError     string `json:"last_error,omitempty"`
 }
 
 // serviceAttach represents the expected body of the "attach/detach sandbox to/from service" http request messages
@@ -62,6 +191,7 @@ type SandboxCreate struct {
 	DNS               []string    `json:"dns"`
 	ExtraHosts        []extraHost `json:"extra_hosts"`
 	UseDefaultSandbox bool        `json:"use_default_sandbox"`
+	UseEmbeddedDNS    bool        `json:"use_embedded_dns"`
 }
 
 // extraHost represents the extra host object
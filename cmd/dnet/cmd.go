@@ -34,6 +34,9 @@ var (
 	dnetCommands = []cli.Command{
 		createDockerCommand("service"),
 		createDockerCommand("network"),
+		createDockerCommand("events"),
+		createDockerCommand("reconcile"),
+		createDockerCommand("ipam"),
 		{
 			Name:        "container",
 			Usage:       "Container management commands",
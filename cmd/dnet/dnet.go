@@ -31,6 +31,7 @@ import (
 	"github.com/docker/libnetwork/driverapi"
 	ovs "github.com/docker/libnetwork/drivers/ovs"
 	"github.com/docker/libnetwork/ipamutils"
+	"github.com/docker/libnetwork/metrics"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/types"
@@ -98,6 +99,10 @@ func processConfig(cfg *config.Config) []config.Option {
 		options = append(options, config.OptionLabels(cfg.Daemon.Labels))
 	}
 
+	for as, pools := range cfg.Daemon.DefaultAddressPools {
+		options = append(options, config.OptionDefaultAddressPools(as, pools))
+	}
+
 	if dcfg, ok := cfg.Scopes[datastore.GlobalScope]; ok && dcfg.IsValid() {
 		options = append(options, config.OptionKVProvider(dcfg.Client.Provider))
 		options = append(options, config.OptionKVProviderURL(dcfg.Client.Address))
@@ -256,6 +261,19 @@ func (d *dnetConnection) dnetDaemon(cfgFile string) error {
 	post.Methods("GET", "PUT", "POST", "DELETE").HandlerFunc(httpHandler)
 	post = r.PathPrefix("/sandboxes").Subrouter()
 	post.Methods("GET", "PUT", "POST", "DELETE").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/{.*}/events").Subrouter()
+	post.Methods("GET").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/events").Subrouter()
+	post.Methods("GET").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/{.*}/reconcile").Subrouter()
+	post.Methods("GET", "POST").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/reconcile").Subrouter()
+	post.Methods("GET", "POST").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/{.*}/ipam").Subrouter()
+	post.Methods("GET").HandlerFunc(httpHandler)
+	post = r.PathPrefix("/ipam").Subrouter()
+	post.Methods("GET").HandlerFunc(httpHandler)
+	r.Path("/metrics").Methods("GET").Handler(metrics.Handler())
 
 	handleSignals(controller)
 	setupDumpStackTrap()
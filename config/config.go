@@ -27,6 +27,17 @@ type DaemonCfg struct {
 	DefaultDriver  string
 	Labels         []string
 	DriverCfg      map[string]interface{}
+	LiveRestore    bool
+	// DefaultAddressPools are the base networks the pools requested with
+	// no preferred pool are picked from, per ipam address space
+	DefaultAddressPools map[string][]*AddressPoolCfg
+}
+
+// AddressPoolCfg represents a base network which is split in address pools
+// of the given prefix length
+type AddressPoolCfg struct {
+	Base string
+	Size int
 }
 
 // ClusterCfg represents cluster configuration
@@ -88,6 +99,29 @@ func OptionDriverConfig(networkType string, config map[string]interface{}) Optio
 	}
 }
 
+// OptionLiveRestore function returns an option setter for restoring, on
+// startup, the sandboxes left running by a previous instance of the daemon
+// instead of tearing them down
+func OptionLiveRestore(enable bool) Option {
+	return func(c *Config) {
+		log.Debugf("Option LiveRestore: %v", enable)
+		c.Daemon.LiveRestore = enable
+	}
+}
+
+// OptionDefaultAddressPools function returns an option setter for the base
+// networks the default address pools of the ipam address space are carved
+// out of
+func OptionDefaultAddressPools(addressSpace string, pools []*AddressPoolCfg) Option {
+	return func(c *Config) {
+		log.Debugf("Option DefaultAddressPools: %s", addressSpace)
+		if c.Daemon.DefaultAddressPools == nil {
+			c.Daemon.DefaultAddressPools = make(map[string][]*AddressPoolCfg)
+		}
+		c.Daemon.DefaultAddressPools[addressSpace] = pools
+	}
+}
+
 // OptionLabels function returns an option setter for labels
 func OptionLabels(labels []string) Option {
 	return func(c *Config) {
@@ -25,6 +25,38 @@ func TestConfig(t *testing.T) {
 	}
 }
 
+func TestDefaultAddressPools(t *testing.T) {
+	f, err := ioutil.TempFile("", "libnetwork.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`[daemon]
+  [[daemon.DefaultAddressPools.LocalDefault]]
+    Base = "100.64.0.0/16"
+    Size = 24
+  [[daemon.DefaultAddressPools.LocalDefault]]
+    Base = "100.65.0.0/16"
+    Size = 26
+`)
+	f.Close()
+
+	cfg, err := ParseConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pools := cfg.Daemon.DefaultAddressPools["LocalDefault"]
+	if len(pools) != 2 || pools[0].Base != "100.64.0.0/16" || pools[0].Size != 24 || pools[1].Base != "100.65.0.0/16" || pools[1].Size != 26 {
+		t.Fatalf("Unexpected default address pools: %v", cfg.Daemon.DefaultAddressPools)
+	}
+
+	c := &Config{}
+	OptionDefaultAddressPools("GlobalDefault", []*AddressPoolCfg{{Base: "100.66.0.0/16", Size: 24}})(c)
+	if pools := c.Daemon.DefaultAddressPools["GlobalDefault"]; len(pools) != 1 || pools[0].Base != "100.66.0.0/16" {
+		t.Fatalf("Unexpected default address pools: %v", c.Daemon.DefaultAddressPools)
+	}
+}
+
 func TestOptionsLabels(t *testing.T) {
 	c := &Config{}
 	l := []string{
@@ -49,6 +49,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/discovery"
@@ -59,6 +60,7 @@ import (
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/hostdiscovery"
 	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/ipamutils"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/osl"
 	"github.com/docker/libnetwork/types"
@@ -108,6 +110,18 @@ type NetworkController interface {
 
 	// Rlease IP Address when remove container(this method is used only be ovs driver)
 	ReleaseIPAddress(id, ip string) error
+
+	// Subscribe returns a channel of the events matching the filter and a function to cancel the subscription
+	Subscribe(filter EventFilter) (<-chan Event, func())
+
+	// Reconcile reports the inconsistencies between the networks, endpoints, sandboxes and ipam state in store, repairing them if requested
+	Reconcile(repair bool) ([]Inconsistency, error)
+
+	// IpamInspector returns the interface exposing the database of the named ipam driver, if the driver supports it
+	IpamInspector(name string) (ipamapi.Inspector, error)
+
+	// IpamExporter returns the interface exporting and importing the database of the named ipam driver, if the driver supports it
+	IpamExporter(name string) (ipamapi.Exporter, error)
 }
 
 // NetworkWalker is a client provided function which will be used to walk the Networks.
@@ -145,10 +159,19 @@ type controller struct {
 	extKeyListener net.Listener
 	watchCh        chan *endpoint
 	unWatchCh      chan *endpoint
-	svcDb          map[string]svcMap
+	svcDb          map[string]*svcInfo
 	nmap           map[string]*netWatch
 	defOsSbox      osl.Sandbox
 	sboxOnce       sync.Once
+	lbServices     map[string]*lbService
+	lbLock         sync.Mutex
+	healthCheckers map[string]*healthChecker
+	healthLock     sync.Mutex
+	subscribers    map[*subscriber]struct{}
+	eventLock      sync.Mutex
+	// ipamResize keeps the expansion pools of the networks from being
+	// released while endpoints are created
+	ipamResize sync.RWMutex
 	sync.Mutex
 }
 
@@ -169,12 +192,15 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 	cfg.LoadDefaultScopes(cfg.Daemon.DataDir)
 
 	c := &controller{
-		id:          stringid.GenerateRandomID(),
-		cfg:         cfg,
-		sandboxes:   sandboxTable{},
-		drivers:     driverTable{},
-		ipamDrivers: ipamTable{},
-		svcDb:       make(map[string]svcMap),
+		id:             stringid.GenerateRandomID(),
+		cfg:            cfg,
+		sandboxes:      sandboxTable{},
+		drivers:        driverTable{},
+		ipamDrivers:    ipamTable{},
+		svcDb:          make(map[string]*svcInfo),
+		lbServices:     make(map[string]*lbService),
+		healthCheckers: make(map[string]*healthChecker),
+		subscribers:    make(map[*subscriber]struct{}),
 	}
 
 	// Here we just use local store
@@ -199,16 +225,70 @@ func New(cfgOptions ...config.Option) (NetworkController, error) {
 		return nil, err
 	}
 
-	c.sandboxCleanup()
+	if err := c.configureDefaultPools(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Daemon.LiveRestore {
+		c.sandboxRestore()
+	} else {
+		c.sandboxCleanup()
+	}
 	c.cleanupLocalEndpoints()
 
 	if err := c.startExternalKeyListener(); err != nil {
 		return nil, err
 	}
 
+	c.trackMetrics()
+
 	return c, nil
 }
 
+// predefinedPoolsSetter is implemented by the ipam drivers whose predefined
+// address pools can be configured.
+type predefinedPoolsSetter interface {
+	SetPredefinedPools(addressSpace string, pools []*net.IPNet) error
+}
+
+// configureDefaultPools sets the default address pools of the built-in ipam
+// driver from the configured base networks
+func (c *controller) configureDefaultPools() error {
+	if len(c.cfg.Daemon.DefaultAddressPools) == 0 {
+		return nil
+	}
+
+	d, err := c.getIpamDriver(ipamapi.DefaultIPAM)
+	if err != nil {
+		return err
+	}
+	ps, ok := unwrapIpam(d).(predefinedPoolsSetter)
+	if !ok {
+		return fmt.Errorf("ipam driver %s does not support configuring its default address pools", ipamapi.DefaultIPAM)
+	}
+
+	for as, cfgs := range c.cfg.Daemon.DefaultAddressPools {
+		var pools []*net.IPNet
+		for _, pc := range cfgs {
+			_, base, err := net.ParseCIDR(pc.Base)
+			if err != nil {
+				return types.BadRequestErrorf("invalid base network %q of the default address pools of %s: %v", pc.Base, as, err)
+			}
+			l, err := ipamutils.SplitNetwork(base, pc.Size)
+			if err != nil {
+				return types.BadRequestErrorf("invalid default address pools of %s: %v", as, err)
+			}
+			pools = append(pools, l...)
+		}
+		if err := ps.SetPredefinedPools(as, pools); err != nil {
+			return err
+		}
+		log.Debugf("Default address pools of %s set to %d networks", as, len(pools))
+	}
+
+	return nil
+}
+
 func (c *controller) ID() string {
 	return c.id
 }
@@ -299,7 +379,7 @@ func (c *controller) RegisterDriver(networkType string, driver driverapi.Driver,
 		c.Unlock()
 		return driverapi.ErrActiveRegistration(networkType)
 	}
-	dData := &driverData{driver, capability}
+	dData := &driverData{&meteredDriver{Driver: driver, name: networkType}, capability}
 	c.drivers[networkType] = dData
 	hd := c.discovery
 	c.Unlock()
@@ -327,7 +407,7 @@ func (c *controller) RegisterIpamDriver(name string, driver ipamapi.Ipam) error
 		return fmt.Errorf("ipam driver %s failed to return default address spaces: %v", name, err)
 	}
 	c.Lock()
-	c.ipamDrivers[name] = &ipamData{driver: driver, defaultLocalAddressSpace: locAS, defaultGlobalAddressSpace: glbAS}
+	c.ipamDrivers[name] = &ipamData{driver: &meteredIpam{Ipam: driver, name: name}, defaultLocalAddressSpace: locAS, defaultGlobalAddressSpace: glbAS}
 	c.Unlock()
 
 	return nil
@@ -336,6 +416,13 @@ func (c *controller) RegisterIpamDriver(name string, driver ipamapi.Ipam) error
 // NewNetwork creates a new network of the specified network type. The options
 // are network specific and modeled in a generic way.
 func (c *controller) NewNetwork(networkType, name string, options ...NetworkOption) (Network, error) {
+	start := time.Now()
+	n, err := c.newNetwork(networkType, name, options...)
+	observeOp("network_create", networkType, start, err)
+	return n, err
+}
+
+func (c *controller) newNetwork(networkType, name string, options ...NetworkOption) (Network, error) {
 	if !config.IsValidName(name) {
 		return nil, ErrInvalidName(name)
 	}
@@ -354,12 +441,20 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 
 	network.processOptions(options...)
 
+	if _, err := network.leaseTTL(); err != nil {
+		return nil, err
+	}
+
 	// Make sure we have a driver available for this network type
 	// before we allocate anything.
 	if _, err := network.driver(); err != nil {
 		return nil, err
 	}
 
+	if err := network.validateAutoExpand(); err != nil {
+		return nil, err
+	}
+
 	err := network.ipamAllocate()
 	if err != nil {
 		return nil, err
@@ -397,6 +492,8 @@ func (c *controller) NewNetwork(networkType, name string, options ...NetworkOpti
 		return nil, err
 	}
 
+	c.publish(Event{Type: EventNetworkCreate, NetworkID: network.id})
+
 	return network, nil
 }
 
@@ -475,6 +572,13 @@ func (c *controller) NetworkByID(id string) (Network, error) {
 
 // NewSandbox creates a new sandbox for the passed container id
 func (c *controller) NewSandbox(containerID string, options ...SandboxOption) (Sandbox, error) {
+	start := time.Now()
+	sb, err := c.newSandbox(containerID, options...)
+	observeOp("sandbox_create", "", start, err)
+	return sb, err
+}
+
+func (c *controller) newSandbox(containerID string, options ...SandboxOption) (Sandbox, error) {
 	var err error
 
 	if containerID == "" {
@@ -560,6 +664,8 @@ func (c *controller) NewSandbox(containerID string, options ...SandboxOption) (S
 		return nil, fmt.Errorf("updating the store state of sandbox failed: %v", err)
 	}
 
+	c.publish(Event{Type: EventSandboxCreate, SandboxID: sb.id})
+
 	return sb, nil
 }
 
@@ -697,7 +803,37 @@ func (c *controller) getIpamDriver(name string) (ipamapi.Ipam, error) {
 	return id.driver, nil
 }
 
+func (c *controller) IpamInspector(name string) (ipamapi.Inspector, error) {
+	d, err := c.getIpamDriver(name)
+	if err != nil {
+		return nil, types.NotFoundErrorf("ipam driver %s not found: %v", name, err)
+	}
+	ins, ok := unwrapIpam(d).(ipamapi.Inspector)
+	if !ok {
+		return nil, types.NotImplementedErrorf("ipam driver %s does not support inspection", name)
+	}
+
+	return ins, nil
+}
+
+func (c *controller) IpamExporter(name string) (ipamapi.Exporter, error) {
+	d, err := c.getIpamDriver(name)
+	if err != nil {
+		return nil, types.NotFoundErrorf("ipam driver %s not found: %v", name, err)
+	}
+	exp, ok := unwrapIpam(d).(ipamapi.Exporter)
+	if !ok {
+		return nil, types.NotImplementedErrorf("ipam driver %s does not support export", name)
+	}
+
+	return exp, nil
+}
+
 func (c *controller) Stop() {
+	c.untrackMetrics()
+	c.stopHealthChecks()
+	c.closeSubscribers()
+	c.stopResolvers()
 	c.closeStores()
 	c.stopExternalKeyListener()
 	osl.GC()
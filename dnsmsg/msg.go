@@ -0,0 +1,390 @@
+// Package dnsmsg implements the subset of the DNS wire format (RFC 1035)
+// needed to answer queries for the container names and to relay the
+// other queries to the external name servers.
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resource record types
+const (
+	TypeA    uint16 = 1
+	TypePTR  uint16 = 12
+	TypeAAAA uint16 = 28
+	TypeSRV  uint16 = 33
+)
+
+// ClassINET is the Internet class
+const ClassINET uint16 = 1
+
+// OpcodeQuery is the standard query operation code
+const OpcodeQuery uint8 = 0
+
+// Response codes
+const (
+	RcodeSuccess        uint8 = 0
+	RcodeFormatError    uint8 = 1
+	RcodeServerFailure  uint8 = 2
+	RcodeNameError      uint8 = 3
+	RcodeNotImplemented uint8 = 4
+	RcodeRefused        uint8 = 5
+)
+
+const (
+	headerLen = 12
+	// maxNameLen is the maximum length of a name in wire format
+	maxNameLen = 255
+	// maxPointers bounds the compression pointers followed in a name
+	maxPointers = 16
+)
+
+var (
+	// ErrShortMessage is returned when a message ends before its content
+	ErrShortMessage = errors.New("dns message too short")
+	// ErrInvalidName is returned for names which cannot be encoded or decoded
+	ErrInvalidName = errors.New("invalid dns name")
+)
+
+// Header is the header of a DNS message
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	Rcode              uint8
+}
+
+// Question is an entry of the question section of a DNS message
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// RR is a resource record. Data is the record data in wire format, as
+// built by the NewXXX functions.
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// Msg is a DNS message. The authority and additional sections are not
+// decoded.
+type Msg struct {
+	Header
+	Questions []Question
+	Answers   []RR
+}
+
+// NewA returns an A record mapping name to the IPv4 address ip
+func NewA(name string, ip net.IP, ttl uint32) RR {
+	return RR{Name: name, Type: TypeA, Class: ClassINET, TTL: ttl, Data: []byte(ip.To4())}
+}
+
+// NewAAAA returns an AAAA record mapping name to the IPv6 address ip
+func NewAAAA(name string, ip net.IP, ttl uint32) RR {
+	return RR{Name: name, Type: TypeAAAA, Class: ClassINET, TTL: ttl, Data: []byte(ip.To16())}
+}
+
+// NewPTR returns a PTR record pointing name to target
+func NewPTR(name, target string, ttl uint32) (RR, error) {
+	data, err := appendName(nil, target)
+	if err != nil {
+		return RR{}, err
+	}
+	return RR{Name: name, Type: TypePTR, Class: ClassINET, TTL: ttl, Data: data}, nil
+}
+
+// NewSRV returns a SRV record for the service name, provided by the
+// target host on port
+func NewSRV(name string, priority, weight, port uint16, target string, ttl uint32) (RR, error) {
+	data := make([]byte, 6)
+	binary.BigEndian.PutUint16(data[0:], priority)
+	binary.BigEndian.PutUint16(data[2:], weight)
+	binary.BigEndian.PutUint16(data[4:], port)
+	data, err := appendName(data, target)
+	if err != nil {
+		return RR{}, err
+	}
+	return RR{Name: name, Type: TypeSRV, Class: ClassINET, TTL: ttl, Data: data}, nil
+}
+
+// Reply returns a response to the query m, carrying its id, flags and
+// question, with the passed response code
+func (m *Msg) Reply(rcode uint8) *Msg {
+	r := &Msg{
+		Header: Header{
+			ID:                 m.ID,
+			Response:           true,
+			Opcode:             m.Opcode,
+			RecursionDesired:   m.RecursionDesired,
+			RecursionAvailable: true,
+			Rcode:              rcode,
+		},
+	}
+	r.Questions = append(r.Questions, m.Questions...)
+	return r
+}
+
+// Pack returns the wire format of the message
+func (m *Msg) Pack() ([]byte, error) {
+	b := make([]byte, headerLen, 512)
+
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	flags |= uint16(m.Rcode & 0xf)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, q.Type)
+		b = appendUint16(b, q.Class)
+	}
+
+	for _, rr := range m.Answers {
+		if b, err = appendName(b, rr.Name); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, rr.Type)
+		b = appendUint16(b, rr.Class)
+		b = appendUint16(b, uint16(rr.TTL>>16))
+		b = appendUint16(b, uint16(rr.TTL))
+		b = appendUint16(b, uint16(len(rr.Data)))
+		b = append(b, rr.Data...)
+	}
+
+	return b, nil
+}
+
+// Unpack decodes the header, question and answer sections of the message
+// in wire format b
+func (m *Msg) Unpack(b []byte) error {
+	if len(b) < headerLen {
+		return ErrShortMessage
+	}
+
+	m.ID = binary.BigEndian.Uint16(b[0:])
+	flags := binary.BigEndian.Uint16(b[2:])
+	m.Response = flags&(1<<15) != 0
+	m.Opcode = uint8(flags>>11) & 0xf
+	m.Authoritative = flags&(1<<10) != 0
+	m.Truncated = flags&(1<<9) != 0
+	m.RecursionDesired = flags&(1<<8) != 0
+	m.RecursionAvailable = flags&(1<<7) != 0
+	m.Rcode = uint8(flags) & 0xf
+
+	qdCount := int(binary.BigEndian.Uint16(b[4:]))
+	anCount := int(binary.BigEndian.Uint16(b[6:]))
+
+	m.Questions = nil
+	m.Answers = nil
+
+	off := headerLen
+	for i := 0; i < qdCount; i++ {
+		var (
+			q   Question
+			err error
+		)
+		if q.Name, off, err = readName(b, off); err != nil {
+			return err
+		}
+		if off+4 > len(b) {
+			return ErrShortMessage
+		}
+		q.Type = binary.BigEndian.Uint16(b[off:])
+		q.Class = binary.BigEndian.Uint16(b[off+2:])
+		off += 4
+		m.Questions = append(m.Questions, q)
+	}
+
+	for i := 0; i < anCount; i++ {
+		var (
+			rr  RR
+			err error
+		)
+		if rr.Name, off, err = readName(b, off); err != nil {
+			return err
+		}
+		if off+10 > len(b) {
+			return ErrShortMessage
+		}
+		rr.Type = binary.BigEndian.Uint16(b[off:])
+		rr.Class = binary.BigEndian.Uint16(b[off+2:])
+		rr.TTL = binary.BigEndian.Uint32(b[off+4:])
+		dLen := int(binary.BigEndian.Uint16(b[off+8:]))
+		off += 10
+		if off+dLen > len(b) {
+			return ErrShortMessage
+		}
+		rr.Data = append([]byte(nil), b[off:off+dLen]...)
+		off += dLen
+		m.Answers = append(m.Answers, rr)
+	}
+
+	return nil
+}
+
+// ReverseAddr returns the name used in the PTR queries for ip
+func ReverseAddr(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	const hexDigit = "0123456789abcdef"
+	ip6 := ip.To16()
+	b := make([]byte, 0, len(ip6)*4+len("ip6.arpa."))
+	for i := len(ip6) - 1; i >= 0; i-- {
+		b = append(b, hexDigit[ip6[i]&0xf], '.', hexDigit[ip6[i]>>4], '.')
+	}
+	return string(append(b, "ip6.arpa."...))
+}
+
+// ParseReverseAddr returns the address a PTR query name refers to, or nil
+// if name is not a reverse lookup name
+func ParseReverseAddr(name string) net.IP {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if strings.HasSuffix(name, ".in-addr.arpa") {
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != 4 {
+			return nil
+		}
+		ip := make(net.IP, net.IPv4len)
+		for i, l := range labels {
+			v, err := strconv.ParseUint(l, 10, 8)
+			if err != nil {
+				return nil
+			}
+			ip[3-i] = byte(v)
+		}
+		return net.IPv4(ip[0], ip[1], ip[2], ip[3])
+	}
+
+	if strings.HasSuffix(name, ".ip6.arpa") {
+		labels := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(labels) != 2*net.IPv6len {
+			return nil
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, l := range labels {
+			v, err := strconv.ParseUint(l, 16, 4)
+			if err != nil || len(l) != 1 {
+				return nil
+			}
+			pos := net.IPv6len - 1 - i/2
+			if i%2 == 0 {
+				ip[pos] |= byte(v)
+			} else {
+				ip[pos] |= byte(v) << 4
+			}
+		}
+		return ip
+	}
+
+	return nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// appendName appends the uncompressed wire format of name to b
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name)+2 > maxNameLen {
+		return nil, ErrInvalidName
+	}
+
+	if name != "" {
+		for _, l := range strings.Split(name, ".") {
+			if len(l) == 0 || len(l) > 63 {
+				return nil, ErrInvalidName
+			}
+			b = append(b, byte(len(l)))
+			b = append(b, l...)
+		}
+	}
+
+	return append(b, 0), nil
+}
+
+// readName decodes the possibly compressed name at offset off of message
+// b. It returns the fully qualified name and the offset past it.
+func readName(b []byte, off int) (string, int, error) {
+	var (
+		labels   []string
+		next     = -1
+		pointers int
+		nameLen  int
+	)
+
+	for {
+		if off >= len(b) {
+			return "", 0, ErrShortMessage
+		}
+		c := int(b[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				return strings.Join(labels, ".") + ".", next, nil
+			}
+			if off+1+c > len(b) {
+				return "", 0, ErrShortMessage
+			}
+			if nameLen += c + 1; nameLen > maxNameLen {
+				return "", 0, ErrInvalidName
+			}
+			labels = append(labels, string(b[off+1:off+1+c]))
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, ErrShortMessage
+			}
+			if pointers++; pointers > maxPointers {
+				return "", 0, ErrInvalidName
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = (c&0x3f)<<8 | int(b[off+1])
+		default:
+			return "", 0, ErrInvalidName
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+	q := &Msg{
+		Header:    Header{ID: 0xbeef, Opcode: OpcodeQuery, RecursionDesired: true},
+		Questions: []Question{{Name: "web.mynet.", Type: TypeA, Class: ClassINET}},
+	}
+
+	b, err := q.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rq Msg
+	if err := rq.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if rq.ID != 0xbeef || rq.Response || !rq.RecursionDesired || len(rq.Questions) != 1 || rq.Questions[0] != q.Questions[0] {
+		t.Fatalf("Unexpected query after unpack: %+v", rq)
+	}
+
+	r := rq.Reply(RcodeSuccess)
+	r.Answers = append(r.Answers, NewA("web.mynet.", net.ParseIP("10.0.0.2"), 600))
+	ptr, err := NewPTR("2.0.0.10.in-addr.arpa.", "web.mynet.", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Answers = append(r.Answers, ptr)
+
+	if b, err = r.Pack(); err != nil {
+		t.Fatal(err)
+	}
+
+	var rr Msg
+	if err := rr.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if rr.ID != 0xbeef || !rr.Response || !rr.RecursionAvailable || rr.Rcode != RcodeSuccess || len(rr.Questions) != 1 || len(rr.Answers) != 2 {
+		t.Fatalf("Unexpected response after unpack: %+v", rr)
+	}
+	if a := rr.Answers[0]; a.Name != "web.mynet." || a.Type != TypeA || a.TTL != 600 || !net.IP(a.Data).Equal(net.ParseIP("10.0.0.2")) {
+		t.Fatalf("Unexpected A record: %+v", a)
+	}
+	if target, _, err := readName(rr.Answers[1].Data, 0); err != nil || target != "web.mynet." {
+		t.Fatalf("Unexpected PTR record target %q: %v", target, err)
+	}
+}
+
+func TestNewSRV(t *testing.T) {
+	rr, err := NewSRV("_80._tcp.web.mynet.", 1, 2, 80, "web.mynet.", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Type != TypeSRV || !bytes.Equal(rr.Data[:6], []byte{0, 1, 0, 2, 0, 80}) {
+		t.Fatalf("Unexpected SRV record: %+v", rr)
+	}
+	if target, _, err := readName(rr.Data, 6); err != nil || target != "web.mynet." {
+		t.Fatalf("Unexpected SRV record target %q: %v", target, err)
+	}
+
+	if _, err := NewSRV("_80._tcp.web.mynet.", 0, 0, 80, "web..mynet.", 600); err == nil {
+		t.Fatal("Expected failure on an invalid target")
+	}
+}
+
+func TestUnpackCompressed(t *testing.T) {
+	// A response whose answer name points to the question name
+	b := []byte{
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0, 1, 0, 1,
+		0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 93, 184, 216, 34,
+	}
+
+	var m Msg
+	if err := m.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Answers) != 1 || m.Answers[0].Name != "www.example.com." || !bytes.Equal(m.Answers[0].Data, []byte{93, 184, 216, 34}) {
+		t.Fatalf("Unexpected answers: %+v", m.Answers)
+	}
+
+	// A pointer loop must not hang the decoder
+	loop := append(b[:headerLen:headerLen], 0xc0, headerLen, 0, 1, 0, 1)
+	if err := m.Unpack(loop); err == nil {
+		t.Fatal("Expected failure on a compression pointer loop")
+	}
+
+	if err := m.Unpack(b[:20]); err == nil {
+		t.Fatal("Expected failure on a truncated message")
+	}
+}
+
+func TestReverseAddr(t *testing.T) {
+	for _, ip := range []string{"10.0.0.2", "fd00::1:2"} {
+		name := ReverseAddr(net.ParseIP(ip))
+		if rip := ParseReverseAddr(name); !rip.Equal(net.ParseIP(ip)) {
+			t.Fatalf("Reverse name %s of %s parsed to %v", name, ip, rip)
+		}
+	}
+
+	if name := ReverseAddr(net.ParseIP("10.0.0.2")); name != "2.0.0.10.in-addr.arpa." {
+		t.Fatalf("Unexpected reverse name %s", name)
+	}
+
+	for _, name := range []string{"web.mynet.", "1.2.3.in-addr.arpa.", "300.0.0.10.in-addr.arpa.", "1.ip6.arpa."} {
+		if ip := ParseReverseAddr(name); ip != nil {
+			t.Fatalf("Unexpected address %v for %s", ip, name)
+		}
+	}
+}
@@ -16,6 +16,12 @@ type Driver interface {
 	// the network id.
 	DeleteNetwork(nid string) error
 
+	// UpdateNetwork invokes the driver method to apply the new network
+	// specific config and ip-addressing data to an existing network. The
+	// driver must reject any change to the options it does not allow to
+	// be modified once the network is created.
+	UpdateNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []IPAMData) error
+
 	// CreateEndpoint invokes the driver method to create an endpoint
 	// passing the network id, endpoint id endpoint information and driver
 	// specific config. The endpoint information can be either consumed by
@@ -36,6 +42,13 @@ type Driver interface {
 	// Leave method is invoked when a Sandbox detaches from an endpoint.
 	Leave(nid, eid string) error
 
+	// RestoreEndpoint invokes the driver method to rebuild its state for an
+	// endpoint created, and joined to the sandbox identified by sboxKey, by
+	// a previous instance of the daemon. The endpoint interface, handed out
+	// as srcName on join, is still plumbed in the sandbox and must be left
+	// untouched.
+	RestoreEndpoint(nid, eid string, sboxKey string, ifInfo InterfaceInfo, srcName string, options map[string]interface{}) error
+
 	// DiscoverNew is a notification for a new discovery event, Example:a new node joining a cluster
 	DiscoverNew(dType DiscoveryType, data interface{}) error
 
@@ -113,6 +126,11 @@ type DriverCallback interface {
 // Capability represents the high level capabilities of the drivers which libnetwork can make use of
 type Capability struct {
 	DataScope string
+	// PoolExpansion tells whether the driver takes address pools added to
+	// or removed from a network which has endpoints. Libnetwork passes the
+	// new ip-addressing data with nil options to UpdateNetwork, and only
+	// expands the pools of the networks of such drivers.
+	PoolExpansion bool
 }
 
 // DiscoveryType represents the type of discovery element the DiscoverNew function is invoked on
@@ -6,6 +6,7 @@ import (
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/ipamapi"
 	builtinIpam "github.com/docker/libnetwork/ipams/builtin"
+	dhcpIpam "github.com/docker/libnetwork/ipams/dhcp"
 	remoteIpam "github.com/docker/libnetwork/ipams/remote"
 	"github.com/docker/libnetwork/netlabel"
 )
@@ -68,6 +69,7 @@ func makeDriverConfig(c *controller, ntype string) map[string]interface{} {
 func initIpams(ic ipamapi.Callback, lDs, gDs interface{}) error {
 	for _, fn := range [](func(ipamapi.Callback, interface{}, interface{}) error){
 		builtinIpam.Init,
+		dhcpIpam.Init,
 		remoteIpam.Init,
 	} {
 		if err := fn(ic, lDs, gDs); err != nil {
@@ -170,6 +170,32 @@ func (c *networkConfiguration) Validate() error {
 	return nil
 }
 
+// validateUpdate checks that the updated configuration o only differs
+// from this one in the options which can be changed on a live network.
+func (c *networkConfiguration) validateUpdate(o *networkConfiguration) error {
+	var changed string
+	switch {
+	case o.BridgeName != "" && o.BridgeName != c.BridgeName:
+		changed = "bridge name"
+	case o.DefaultBridge != c.DefaultBridge:
+		changed = "default bridge"
+	case o.EnableIPv6 != c.EnableIPv6:
+		changed = "ipv6 enablement"
+	case o.EnableIPMasquerade != c.EnableIPMasquerade:
+		changed = "ip masquerading"
+	case !o.DefaultBindingIP.Equal(c.DefaultBindingIP):
+		changed = "default binding ip"
+	case !types.CompareIPNet(o.AddressIPv4, c.AddressIPv4) || !types.CompareIPNet(o.AddressIPv6, c.AddressIPv6):
+		changed = "bridge address"
+	case !o.DefaultGatewayIPv4.Equal(c.DefaultGatewayIPv4) || !o.DefaultGatewayIPv6.Equal(c.DefaultGatewayIPv6):
+		changed = "default gateway"
+	default:
+		return nil
+	}
+
+	return types.ForbiddenErrorf("the %s of bridge network %s cannot be changed", changed, c.ID)
+}
+
 // Conflicts check if two NetworkConfiguration objects overlap
 func (c *networkConfiguration) Conflicts(o *networkConfiguration) error {
 	if o == nil {
@@ -547,6 +573,57 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 	return d.storeUpdate(config)
 }
 
+// UpdateNetwork applies the changes to the options the bridge driver allows
+// modifying on a live network: the MTU, which is inherited by the endpoints
+// created from now on, and the inter container communication.
+func (d *driver) UpdateNetwork(id string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	defer osl.InitOSContext()()
+
+	network, err := d.getNetwork(id)
+	if err != nil {
+		return err
+	}
+
+	config, err := parseNetworkOptions(id, option)
+	if err != nil {
+		return err
+	}
+
+	if err = config.processIPAM(id, ipV4Data, ipV6Data); err != nil {
+		return err
+	}
+
+	network.Lock()
+	cur := network.config
+	bridgeIface := network.bridge
+	network.Unlock()
+
+	if err = cur.validateUpdate(config); err != nil {
+		return err
+	}
+
+	if config.EnableICC != cur.EnableICC && d.config.EnableIPTables {
+		if err = setIcc(cur.BridgeName, config.EnableICC, true); err != nil {
+			return err
+		}
+		if !config.EnableICC {
+			if err = setupBridgeNetFiltering(cur, bridgeIface); err != nil {
+				return err
+			}
+		}
+	}
+
+	upd := *cur
+	upd.Mtu = config.Mtu
+	upd.EnableICC = config.EnableICC
+
+	network.Lock()
+	network.config = &upd
+	network.Unlock()
+
+	return d.storeUpdate(&upd)
+}
+
 func (d *driver) createNetwork(config *networkConfiguration) error {
 	var err error
 
@@ -1179,6 +1256,59 @@ func (d *driver) Leave(nid, eid string) error {
 	return nil
 }
 
+// RestoreEndpoint rebuilds the endpoint whose veth pair is still plumbed
+// in the bridge and in the sandbox, and programs again its port mappings.
+// The links to the other containers are not restored.
+func (d *driver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, epOptions map[string]interface{}) error {
+	defer osl.InitOSContext()()
+
+	if ifInfo == nil {
+		return errors.New("invalid interface info passed")
+	}
+
+	network, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := network.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep != nil {
+		return driverapi.ErrEndpointExists(eid)
+	}
+
+	epConfig, err := parseEndpointOptions(epOptions)
+	if err != nil {
+		return err
+	}
+
+	endpoint := &bridgeEndpoint{
+		id:         eid,
+		srcName:    srcName,
+		addr:       ifInfo.Address(),
+		addrv6:     ifInfo.AddressIPv6(),
+		macAddress: ifInfo.MacAddress(),
+		config:     epConfig,
+	}
+
+	network.Lock()
+	config := network.config
+	network.Unlock()
+
+	endpoint.portMapping, err = network.allocatePorts(epConfig, endpoint, config.DefaultBindingIP, d.config.EnableUserlandProxy)
+	if err != nil {
+		return err
+	}
+
+	network.Lock()
+	network.endpoints[eid] = endpoint
+	network.Unlock()
+
+	return nil
+}
+
 func (d *driver) link(network *bridgeNetwork, endpoint *bridgeEndpoint, options map[string]interface{}, enable bool) error {
 	var (
 		cc  *containerConfiguration
@@ -238,6 +238,65 @@ func TestCreateFail(t *testing.T) {
 	}
 }
 
+func TestUpdateNetwork(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+
+	if err := d.configure(nil); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	labels := map[string]string{
+		BridgeName: "dummy0",
+		EnableICC:  "true",
+	}
+	netOption := map[string]interface{}{netlabel.GenericData: labels}
+
+	ipdList := getIPv4Data(t)
+	if err := d.CreateNetwork("dummy", netOption, ipdList, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	labels = map[string]string{
+		BridgeName:         "dummy0",
+		EnableICC:          "false",
+		netlabel.DriverMTU: "1400",
+	}
+	netOption = map[string]interface{}{netlabel.GenericData: labels}
+	if err := d.UpdateNetwork("dummy", netOption, ipdList, nil); err != nil {
+		t.Fatalf("Failed to update bridge: %v", err)
+	}
+
+	nw := d.networks["dummy"]
+	if nw.config.EnableICC || nw.config.Mtu != 1400 {
+		t.Fatalf("Update not applied to the network configuration: %+v", nw.config)
+	}
+
+	te := newTestEndpoint(ipdList[0].Pool, 10)
+	if err := d.CreateEndpoint("dummy", "ep1", te.Interface(), nil); err != nil {
+		t.Fatal(err)
+	}
+	sbox, err := netlink.LinkByName(nw.endpoints["ep1"].srcName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sbox.Attrs().MTU != 1400 {
+		t.Fatalf("Expected endpoint to inherit the updated MTU, got %d", sbox.Attrs().MTU)
+	}
+
+	labels[BridgeName] = "dummy1"
+	if err := d.UpdateNetwork("dummy", netOption, ipdList, nil); err == nil {
+		t.Fatal("Expected failure when changing the bridge name")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type changing the bridge name: %v", err)
+	}
+
+	labels[BridgeName] = "dummy0"
+	if err := d.UpdateNetwork("dummy", netOption, append(ipdList, getIPv4Data(t)...), nil); err == nil {
+		t.Fatal("Expected failure when adding a subnet to a bridge network")
+	}
+}
+
 func TestCreateMultipleNetworks(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 	d := newDriver()
@@ -539,6 +598,65 @@ func TestCreateLinkWithOptions(t *testing.T) {
 	}
 }
 
+func TestRestoreEndpoint(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	d := newDriver()
+
+	if err := d.configure(nil); err != nil {
+		t.Fatalf("Failed to setup driver config: %v", err)
+	}
+
+	netconfig := &networkConfiguration{BridgeName: DefaultBridgeName}
+	netOptions := make(map[string]interface{})
+	netOptions[netlabel.GenericData] = netconfig
+
+	ipdList := getIPv4Data(t)
+	if err := d.CreateNetwork("net1", netOptions, ipdList, nil); err != nil {
+		t.Fatalf("Failed to create bridge: %v", err)
+	}
+
+	te := newTestEndpoint(ipdList[0].Pool, 11)
+	if err := d.CreateEndpoint("net1", "ep", te.Interface(), nil); err != nil {
+		t.Fatalf("Failed to create an endpoint: %v", err)
+	}
+
+	if err := d.Join("net1", "ep", "sbox", te, nil); err != nil {
+		t.Fatalf("Failed to join the endpoint: %v", err)
+	}
+
+	// Drop the endpoint state as a daemon restart would
+	n := d.networks["net1"]
+	delete(n.endpoints, "ep")
+
+	if err := d.RestoreEndpoint("net1", "ep", "sbox", te.Interface(), te.iface.srcName, nil); err != nil {
+		t.Fatalf("Failed to restore the endpoint: %v", err)
+	}
+
+	ep, ok := n.endpoints["ep"]
+	if !ok {
+		t.Fatal("Restored endpoint not found in the network")
+	}
+	if ep.srcName != te.iface.srcName || !types.CompareIPNet(ep.addr, te.iface.addr) || !bytes.Equal(ep.macAddress, te.iface.mac) {
+		t.Fatalf("Unexpected restored endpoint %+v", ep)
+	}
+
+	if err := d.RestoreEndpoint("net1", "ep", "sbox", te.Interface(), te.iface.srcName, nil); err == nil {
+		t.Fatal("Expected failure restoring an existing endpoint")
+	}
+
+	if err := d.Leave("net1", "ep"); err != nil {
+		t.Fatalf("Failed to leave the restored endpoint: %v", err)
+	}
+
+	if err := d.DeleteEndpoint("net1", "ep"); err != nil {
+		t.Fatalf("Failed to delete the restored endpoint: %v", err)
+	}
+
+	if _, err := netlink.LinkByName(te.iface.srcName); err == nil {
+		t.Fatal("Restored endpoint interface was not deleted")
+	}
+}
+
 func getExposedPorts() []types.TransportPort {
 	return []types.TransportPort{
 		types.TransportPort{Proto: types.TCP, Port: uint16(5000)},
@@ -40,6 +40,10 @@ func (d *driver) DeleteNetwork(nid string) error {
 	return types.ForbiddenErrorf("network of type \"%s\" cannot be deleted", networkType)
 }
 
+func (d *driver) UpdateNetwork(nid string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	return types.ForbiddenErrorf("network of type \"%s\" cannot be updated", networkType)
+}
+
 func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, epOptions map[string]interface{}) error {
 	return nil
 }
@@ -62,6 +66,10 @@ func (d *driver) Leave(nid, eid string) error {
 	return nil
 }
 
+func (d *driver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	return nil
+}
+
 func (d *driver) Type() string {
 	return networkType
 }
@@ -136,3 +136,9 @@ func (d *driver) Leave(nid, eid string) error {
 
 	return nil
 }
+
+// RestoreEndpoint is not supported: the vxlan plumbing of the network
+// sandbox is not rebuilt from an existing namespace.
+func (d *driver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	return types.NotImplementedErrorf("endpoint restore is not supported by the %s driver", networkType)
+}
@@ -87,6 +87,71 @@ func (d *driver) CreateNetwork(id string, option map[string]interface{}, ipV4Dat
 	return nil
 }
 
+// UpdateNetwork adds the subnets of the additional address pools to the
+// network and removes the ones of the pools libnetwork released, which must
+// not have endpoints. As for the initial subnets, the vxlan ids of the added
+// ones are allocated when the first endpoint on the subnet joins, while the
+// ones of the removed subnets are released.
+func (d *driver) UpdateNetwork(id string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	n := d.network(id)
+	if n == nil {
+		return types.NotFoundErrorf("could not find network with id %s", id)
+	}
+
+	n.Lock()
+	subnets := make([]*subnet, 0, len(ipV4Data))
+	for _, ipd := range ipV4Data {
+		var s *subnet
+		for _, cur := range n.subnets {
+			if types.CompareIPNet(cur.subnetIP, ipd.Pool) {
+				s = cur
+				break
+			}
+		}
+		if s == nil {
+			s = &subnet{
+				subnetIP: ipd.Pool,
+				gwIP:     ipd.Gateway,
+				once:     &sync.Once{},
+			}
+		}
+		subnets = append(subnets, s)
+	}
+
+	var removed []*subnet
+	for _, cur := range n.subnets {
+		found := false
+		for _, s := range subnets {
+			if s == cur {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		for _, ep := range n.endpoints {
+			if cur.subnetIP.Contains(ep.addr.IP) {
+				n.Unlock()
+				return types.ForbiddenErrorf("subnet %s of network %s is in use and cannot be removed", cur.subnetIP, id)
+			}
+		}
+		removed = append(removed, cur)
+	}
+	n.subnets = subnets
+	n.Unlock()
+
+	if err := n.writeToStore(); err != nil {
+		return fmt.Errorf("failed to update data store for network %v: %v", n.id, err)
+	}
+
+	for _, s := range removed {
+		n.releaseSubnet(s)
+	}
+
+	return nil
+}
+
 /* func (d *driver) createNetworkfromStore(nid string) (*network, error) {
 	n := &network{
 		id:        nid,
@@ -183,6 +248,32 @@ func (n *network) destroySandbox() {
 	}
 }
 
+// releaseSubnet removes the bridge and vxlan interfaces of the subnet from
+// the network sandbox, if the subnet had joined endpoints, and releases its
+// vxlan id
+func (n *network) releaseSubnet(s *subnet) {
+	n.Lock()
+	brName, vxlanName := s.brName, s.vxlanName
+	s.brName, s.vxlanName = "", ""
+	n.Unlock()
+
+	if sbox := n.sandbox(); sbox != nil && vxlanName != "" {
+		for _, iface := range sbox.Info().Interfaces() {
+			if iface.SrcName() == brName || iface.SrcName() == vxlanName {
+				iface.Remove()
+			}
+		}
+		if err := deleteVxlan(vxlanName); err != nil {
+			logrus.Warnf("could not delete vxlan interface of subnet %s: %v", s.subnetIP, err)
+		}
+	}
+
+	if vni := n.vxlanID(s); vni != 0 {
+		n.driver.vxlanIdm.Release(uint64(vni))
+		n.setVxlanID(s, 0)
+	}
+}
+
 func (n *network) initSubnetSandbox(s *subnet) error {
 	// create a bridge and vxlan device for this subnet and move it to the sandbox
 	brName, err := netutils.GenerateIfaceName("bridge", 7)
@@ -1,12 +1,17 @@
 package overlay
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/docker/libkv/store"
 	"github.com/docker/libnetwork/driverapi"
-	_ "github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
 )
 
 type driverTester struct {
@@ -132,3 +137,161 @@ func TestOverlayType(t *testing.T) {
 			dt.d.Type())
 	}
 }
+
+type testEndpoint struct {
+	addr *net.IPNet
+	mac  net.HardwareAddr
+}
+
+func (te *testEndpoint) MacAddress() net.HardwareAddr {
+	return te.mac
+}
+
+func (te *testEndpoint) Address() *net.IPNet {
+	return te.addr
+}
+
+func (te *testEndpoint) AddressIPv6() *net.IPNet {
+	return nil
+}
+
+func (te *testEndpoint) SetMacAddress(mac net.HardwareAddr) error {
+	te.mac = mac
+	return nil
+}
+
+func (te *testEndpoint) SetIPAddress(address *net.IPNet) error {
+	te.addr = address
+	return nil
+}
+
+func (te *testEndpoint) SetVlanID(vlanID uint) error {
+	return nil
+}
+
+func (te *testEndpoint) SetNetworkName(networkName string) error {
+	return nil
+}
+
+func (te *testEndpoint) InterfaceName() driverapi.InterfaceNameInfo {
+	return te
+}
+
+func (te *testEndpoint) SetNames(srcName, dstPrefix string) error {
+	return nil
+}
+
+func (te *testEndpoint) SetGateway(gw net.IP) error {
+	return nil
+}
+
+func (te *testEndpoint) SetGatewayIPv6(gw6 net.IP) error {
+	return nil
+}
+
+func (te *testEndpoint) AddStaticRoute(destination *net.IPNet, routeType int, nextHop net.IP) error {
+	return nil
+}
+
+func TestOverlayPoolExpansion(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	tmp, err := ioutil.TempFile("", "overlay-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	dt := &driverTester{t: t}
+	config := map[string]interface{}{
+		netlabel.GlobalKVProvider:       "boltdb",
+		netlabel.GlobalKVProviderURL:    tmp.Name(),
+		netlabel.GlobalKVProviderConfig: &store.Config{Bucket: "overlay"},
+	}
+	if err := Init(dt, config); err != nil {
+		t.Fatal(err)
+	}
+	d := dt.d
+
+	pool1, _ := types.ParseCIDR("10.50.0.0/24")
+	gw1, _ := types.ParseCIDR("10.50.0.1/24")
+	pool2, _ := types.ParseCIDR("10.51.0.0/24")
+	gw2, _ := types.ParseCIDR("10.51.0.1/24")
+	ipd1 := driverapi.IPAMData{Pool: pool1, Gateway: gw1}
+	ipd2 := driverapi.IPAMData{Pool: pool2, Gateway: gw2}
+
+	nid := "overlaynet"
+	if err := d.CreateNetwork(nid, nil, []driverapi.IPAMData{ipd1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer d.DeleteNetwork(nid)
+
+	if err := d.UpdateNetwork(nid, nil, []driverapi.IPAMData{ipd1, ipd2}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	addr1, _ := types.ParseCIDR("10.50.0.2/24")
+	addr2, _ := types.ParseCIDR("10.51.0.2/24")
+	ep1 := &testEndpoint{addr: addr1}
+	ep2 := &testEndpoint{addr: addr2}
+	if err := d.CreateEndpoint(nid, "ep1", ep1, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer d.DeleteEndpoint(nid, "ep1")
+	if err := d.CreateEndpoint(nid, "ep2", ep2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Join(nid, "ep1", "", ep1, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Leave(nid, "ep1")
+	if err := d.Join(nid, "ep2", "", ep2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	n := d.network(nid)
+	s2 := n.getSubnetforIP(addr2)
+	vni := n.vxlanID(s2)
+	if vni == 0 {
+		t.Fatal("No vxlan id was allocated to the added subnet")
+	}
+
+	if err := d.UpdateNetwork(nid, nil, []driverapi.IPAMData{ipd1}, nil); err == nil {
+		t.Fatal("Expected failure on the removal of a subnet with endpoints")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	if err := d.Leave(nid, "ep2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteEndpoint(nid, "ep2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdateNetwork(nid, nil, []driverapi.IPAMData{ipd1}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n.getSubnetforIP(addr2) != nil {
+		t.Fatal("The removed subnet is still in the network")
+	}
+	if sn := d.getNetworkFromStore(nid); sn == nil || len(sn.subnets) != 1 {
+		t.Fatalf("Unexpected network in store after the subnet removal: %v", sn)
+	}
+	if err := d.vxlanIdm.GetSpecificID(uint64(vni)); err != nil {
+		t.Fatalf("The vxlan id %d of the removed subnet was not released: %v", vni, err)
+	}
+	d.vxlanIdm.Release(uint64(vni))
+
+	// The subnet plumbing of the remaining endpoint is untouched
+	for _, iface := range n.sandbox().Info().Interfaces() {
+		if iface.SrcName() == s2.vxlanName {
+			t.Fatalf("The vxlan interface of the removed subnet is still in the network sandbox")
+		}
+	}
+	if s1 := n.getSubnetforIP(addr1); s1.vxlanName == "" || n.vxlanID(s1) == 0 {
+		t.Fatal("The subnet of the remaining endpoint was torn down")
+	}
+}
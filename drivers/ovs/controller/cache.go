@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/stringid"
+)
+
+// prefetchOwnerPrefix is prepended to the owner id used for addresses
+// which are requested ahead of time and not yet bound to a container.
+const prefetchOwnerPrefix = "prefetch-"
+
+// Lease represents an address handed out by the network controller.
+type Lease struct {
+	// NetworkName is the controller network the address belongs to.
+	NetworkName string `json:"nw_name"`
+	// ContainerID is the container the address is bound to. It is
+	// empty for pre-fetched addresses not yet handed out.
+	ContainerID string `json:"container_id"`
+	// Owner is the id the address was requested with from the
+	// controller. It differs from ContainerID for addresses which
+	// came out of the pre-fetch pool.
+	Owner string `json:"owner"`
+	FixIP string `json:"fix_ip"`
+	SegID int    `json:"seg_id"`
+}
+
+// Prefetched returns true if the lease is not bound to any container.
+func (l *Lease) Prefetched() bool {
+	return l.ContainerID == ""
+}
+
+func (l *Lease) response() *RequestIPResponse {
+	return &RequestIPResponse{
+		ContainerID: l.ContainerID,
+		FixIP:       l.FixIP,
+		SegID:       l.SegID,
+	}
+}
+
+// LeaseStore persists the leases held by the client so that
+// they can be restored after a daemon restart.
+type LeaseStore interface {
+	// PutLease creates or updates the lease in the store.
+	PutLease(l *Lease) error
+	// DeleteLease removes the lease from the store.
+	DeleteLease(l *Lease) error
+}
+
+// leaseCache holds the addresses bound to containers, keyed by network
+// name and container id, and the per network pools of pre-fetched addresses.
+type leaseCache struct {
+	leases    map[string]*Lease
+	pools     map[string][]*Lease
+	refilling map[string]bool
+	store     LeaseStore
+	sync.Mutex
+}
+
+func newLeaseCache() *leaseCache {
+	return &leaseCache{
+		leases:    make(map[string]*Lease),
+		pools:     make(map[string][]*Lease),
+		refilling: make(map[string]bool),
+	}
+}
+
+func leaseKey(networkName, containerID string) string {
+	return networkName + "/" + containerID
+}
+
+func (lc *leaseCache) get(networkName, containerID string) *Lease {
+	lc.Lock()
+	defer lc.Unlock()
+
+	return lc.leases[leaseKey(networkName, containerID)]
+}
+
+// find returns the lease bound to the container with the passed address.
+func (lc *leaseCache) find(containerID, ip string) *Lease {
+	lc.Lock()
+	defer lc.Unlock()
+
+	for _, l := range lc.leases {
+		if l.ContainerID == containerID && l.FixIP == ip {
+			return l
+		}
+	}
+
+	return nil
+}
+
+func (lc *leaseCache) add(l *Lease) {
+	lc.Lock()
+	if l.Prefetched() {
+		lc.pools[l.NetworkName] = append(lc.pools[l.NetworkName], l)
+	} else {
+		lc.leases[leaseKey(l.NetworkName, l.ContainerID)] = l
+	}
+	store := lc.store
+	lc.Unlock()
+
+	if store != nil {
+		if err := store.PutLease(l); err != nil {
+			logrus.Warnf("failed to persist lease %s for container %s on network %s: %v", l.FixIP, l.ContainerID, l.NetworkName, err)
+		}
+	}
+}
+
+func (lc *leaseCache) remove(l *Lease) {
+	lc.Lock()
+	delete(lc.leases, leaseKey(l.NetworkName, l.ContainerID))
+	store := lc.store
+	lc.Unlock()
+
+	if store != nil {
+		if err := store.DeleteLease(l); err != nil {
+			logrus.Warnf("failed to remove lease %s for container %s on network %s from store: %v", l.FixIP, l.ContainerID, l.NetworkName, err)
+		}
+	}
+}
+
+// bind takes an address out of the network's pre-fetch pool and binds
+// it to the container. It returns nil if the pool is empty.
+func (lc *leaseCache) bind(networkName, containerID string) *Lease {
+	lc.Lock()
+	pool := lc.pools[networkName]
+	if len(pool) == 0 {
+		lc.Unlock()
+		return nil
+	}
+	l := pool[0]
+	lc.pools[networkName] = pool[1:]
+	store := lc.store
+	lc.Unlock()
+
+	if store != nil {
+		if err := store.DeleteLease(l); err != nil {
+			logrus.Warnf("failed to remove pre-fetched lease %s on network %s from store: %v", l.FixIP, networkName, err)
+		}
+	}
+
+	bound := *l
+	bound.ContainerID = containerID
+	lc.add(&bound)
+
+	return &bound
+}
+
+func (lc *leaseCache) poolSize(networkName string) int {
+	lc.Lock()
+	defer lc.Unlock()
+
+	return len(lc.pools[networkName])
+}
+
+// SetLeaseStore sets the store the client persists its leases to.
+func (c *Client) SetLeaseStore(store LeaseStore) {
+	c.cache.Lock()
+	c.cache.store = store
+	c.cache.Unlock()
+}
+
+// SetPrefetchSize sets the number of addresses the client keeps requested
+// ahead of time for each network it serves. Zero disables pre-fetching.
+func (c *Client) SetPrefetchSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	c.cache.Lock()
+	c.prefetchSize = size
+	c.cache.Unlock()
+}
+
+// RestoreLeases loads previously persisted leases into the client cache
+// without writing them back to the lease store.
+func (c *Client) RestoreLeases(leases []*Lease) {
+	c.cache.Lock()
+	defer c.cache.Unlock()
+
+	for _, l := range leases {
+		if l.Prefetched() {
+			c.cache.pools[l.NetworkName] = append(c.cache.pools[l.NetworkName], l)
+			continue
+		}
+		c.cache.leases[leaseKey(l.NetworkName, l.ContainerID)] = l
+	}
+}
+
+// Leases returns a copy of the leases bound to containers.
+func (c *Client) Leases() []Lease {
+	c.cache.Lock()
+	defer c.cache.Unlock()
+
+	ls := make([]Lease, 0, len(c.cache.leases))
+	for _, l := range c.cache.leases {
+		ls = append(ls, *l)
+	}
+	return ls
+}
+
+// refill tops up the network's pre-fetch pool up to the configured size.
+func (c *Client) refill(networkName string) {
+	c.cache.Lock()
+	size := c.prefetchSize
+	if size == 0 || c.cache.refilling[networkName] {
+		c.cache.Unlock()
+		return
+	}
+	c.cache.refilling[networkName] = true
+	c.cache.Unlock()
+
+	defer func() {
+		c.cache.Lock()
+		delete(c.cache.refilling, networkName)
+		c.cache.Unlock()
+	}()
+
+	for c.cache.poolSize(networkName) < size {
+		owner := prefetchOwnerPrefix + stringid.GenerateRandomID()
+		resp, err := c.requestIP(networkName, owner)
+		if err != nil {
+			logrus.Warnf("failed to pre-fetch address on network %s: %v", networkName, err)
+			return
+		}
+		c.cache.add(&Lease{
+			NetworkName: networkName,
+			Owner:       owner,
+			FixIP:       resp.FixIP,
+			SegID:       resp.SegID,
+		})
+	}
+}
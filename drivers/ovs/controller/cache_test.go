@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIPAM is a minimal controller backend serving the address
+// request and release actions.
+type fakeIPAM struct {
+	next      int
+	requests  int
+	allocated map[string]string // ip -> owner
+	sync.Mutex
+}
+
+func (f *fakeIPAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch r.URL.Path {
+	case base_path + api_version + "/" + request_ip_action:
+		req := &RequestIPRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		f.requests++
+		f.next++
+		ip := fmt.Sprintf("10.0.0.%d/24", f.next)
+		f.allocated[ip] = req.ContainerID
+		json.NewEncoder(w).Encode(&RequestIPResponse{ContainerID: req.ContainerID, FixIP: ip, SegID: defaultVLANTag})
+	case base_path + api_version + "/" + release_ip_action:
+		req := &ReleaseIPRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		if f.allocated[req.FixIP] != req.ContainerID {
+			json.NewEncoder(w).Encode(&StandardResponse{Result: 1, ErrMsg: "container id mismatch"})
+			return
+		}
+		delete(f.allocated, req.FixIP)
+		json.NewEncoder(w).Encode(&StandardResponse{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeIPAM) stats() (int, int) {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests, len(f.allocated)
+}
+
+func newFakeIPAMClient(t *testing.T) (*Client, *fakeIPAM, func()) {
+	f := &fakeIPAM{allocated: make(map[string]string)}
+	srv := httptest.NewServer(f)
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return c, f, srv.Close
+}
+
+type memLeaseStore struct {
+	leases map[string]Lease
+	sync.Mutex
+}
+
+func (m *memLeaseStore) PutLease(l *Lease) error {
+	m.Lock()
+	m.leases[l.NetworkName+"/"+l.Owner] = *l
+	m.Unlock()
+	return nil
+}
+
+func (m *memLeaseStore) DeleteLease(l *Lease) error {
+	m.Lock()
+	delete(m.leases, l.NetworkName+"/"+l.Owner)
+	m.Unlock()
+	return nil
+}
+
+func TestRequestIPSticky(t *testing.T) {
+	c, f, done := newFakeIPAMClient(t)
+	defer done()
+
+	store := &memLeaseStore{leases: make(map[string]Lease)}
+	c.SetLeaseStore(store)
+
+	resp, err := c.RequestIP("default", containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := c.RequestIP("default", containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.FixIP != resp.FixIP || again.SegID != resp.SegID {
+		t.Fatalf("expected sticky lease %s/%d, got %s/%d", resp.FixIP, resp.SegID, again.FixIP, again.SegID)
+	}
+	if reqs, _ := f.stats(); reqs != 1 {
+		t.Fatalf("expected a single controller round trip, got %d", reqs)
+	}
+	if len(store.leases) != 1 {
+		t.Fatalf("expected lease to be persisted, got %v", store.leases)
+	}
+
+	other, err := c.RequestIP("other", containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.FixIP == resp.FixIP {
+		t.Fatalf("lease on a different network must not be shared")
+	}
+
+	if err := c.ReleaseIP(containerID, resp.FixIP); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Leases()) != 1 {
+		t.Fatalf("expected one lease left after release, got %v", c.Leases())
+	}
+
+	fresh, err := c.RequestIP("default", containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.FixIP == resp.FixIP {
+		t.Fatalf("released lease must not be reused from the cache")
+	}
+}
+
+func TestRequestIPPrefetch(t *testing.T) {
+	c, f, done := newFakeIPAMClient(t)
+	defer done()
+
+	c.SetPrefetchSize(2)
+
+	if _, err := c.RequestIP("default", "c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitPool := func(size int) {
+		for i := 0; i < 100 && c.cache.poolSize("default") < size; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := c.cache.poolSize("default"); got != size {
+			t.Fatalf("expected pre-fetch pool of %d, got %d", size, got)
+		}
+	}
+	waitPool(2)
+
+	reqs, _ := f.stats()
+	resp, err := c.RequestIP("default", "c2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContainerID != "c2" {
+		t.Fatalf("expected address bound to c2, got %s", resp.ContainerID)
+	}
+	waitPool(2)
+	if after, _ := f.stats(); after != reqs+1 {
+		t.Fatalf("expected only the refill round trip, got %d requests", after-reqs)
+	}
+
+	// A pre-fetched address must be released with the id it was requested with
+	if err := c.ReleaseIP("c2", resp.FixIP); err != nil {
+		t.Fatal(err)
+	}
+	if _, allocated := f.stats(); allocated != 3 {
+		t.Fatalf("expected 3 addresses still allocated, got %d", allocated)
+	}
+}
@@ -25,6 +25,13 @@ const (
 type Client struct {
 	Url string
 	*http.Client
+
+	// cache keeps the addresses handed out to containers so that a
+	// restarted container gets its previous address back.
+	cache *leaseCache
+	// prefetchSize is the number of addresses requested ahead of
+	// time for each network. It is guarded by the cache lock.
+	prefetchSize int
 }
 
 func NewClient(url string) (*Client, error) {
@@ -35,6 +42,7 @@ func NewClient(url string) (*Client, error) {
 	return &Client{
 		Url:    url,
 		Client: http.DefaultClient,
+		cache:  newLeaseCache(),
 	}, nil
 }
 
@@ -88,8 +96,41 @@ func (c *Client) ListNetworks(name string) error {
 	return nil
 }
 
+// RequestIP returns an address for the container on the passed network.
+// The address previously handed out to the same container is returned if
+// still held, otherwise one is taken from the pre-fetch pool or requested
+// from the controller.
 func (c *Client) RequestIP(nid, cid string) (*RequestIPResponse, error) {
-	req := NewRequestIPRequest(getHostIP(), cid, nid)
+	if l := c.cache.get(nid, cid); l != nil {
+		return l.response(), nil
+	}
+
+	defer func() {
+		go c.refill(nid)
+	}()
+
+	if l := c.cache.bind(nid, cid); l != nil {
+		return l.response(), nil
+	}
+
+	resp, err := c.requestIP(nid, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.add(&Lease{
+		NetworkName: nid,
+		ContainerID: cid,
+		Owner:       cid,
+		FixIP:       resp.FixIP,
+		SegID:       resp.SegID,
+	})
+
+	return resp, nil
+}
+
+func (c *Client) requestIP(nid, owner string) (*RequestIPResponse, error) {
+	req := NewRequestIPRequest(getHostIP(), owner, nid)
 	b, _ := json.Marshal(req)
 	returnedObj := &RequestIPResponse{}
 	err := c.sendRequest(request_ip_action, "POST", b, returnedObj)
@@ -100,14 +141,26 @@ func (c *Client) RequestIP(nid, cid string) (*RequestIPResponse, error) {
 	return returnedObj, nil
 }
 
+// ReleaseIP returns the container's address to the controller and
+// drops the corresponding lease.
 func (c *Client) ReleaseIP(cid, ip string) error {
-	req := NewReleaseIPRequest(cid, ip)
+	owner := cid
+	l := c.cache.find(cid, ip)
+	if l != nil {
+		owner = l.Owner
+	}
+
+	req := NewReleaseIPRequest(owner, ip)
 	b, _ := json.Marshal(req)
 	returnedObj := &StandardResponse{}
 	err := c.sendRequest(release_ip_action, "POST", b, returnedObj)
 	if err != nil {
 		return err
 	}
+
+	if l != nil {
+		c.cache.remove(l)
+	}
 	return nil
 }
 
@@ -6,4 +6,10 @@ const (
 
 	// DefaultBridge label
 	DefaultBridge = "com.docker.network.ovs.default_bridge"
+
+	// IngressPolicingRate label, in kbps, for the traffic sent by the containers
+	IngressPolicingRate = "com.docker.network.ovs.ingress_policing_rate"
+
+	// IngressPolicingBurst label, in kb, for the traffic sent by the containers
+	IngressPolicingBurst = "com.docker.network.ovs.ingress_policing_burst"
 )
@@ -43,6 +43,9 @@ type configuration struct {
 	OvsHost              string
 	OvsPort              int
 	NetworkControllerUrl string
+	// IPPrefetchSize is the number of addresses requested from the
+	// network controller ahead of time for each network.
+	IPPrefetchSize int
 }
 
 // networkConfiguration for network specific configuration
@@ -51,8 +54,12 @@ type networkConfiguration struct {
 	BridgeName    string
 	Mtu           int
 	DefaultBridge bool
-	dbIndex       uint64
-	dbExists      bool
+	// IngressPolicingRate and IngressPolicingBurst limit the traffic
+	// sent by the containers, in kbps and kb. Zero disables the limit.
+	IngressPolicingRate  int
+	IngressPolicingBurst int
+	dbIndex              uint64
+	dbExists             bool
 }
 
 // endpointConfiguration represents the user specified configuration.
@@ -164,6 +171,7 @@ func (d *driver) configure(option map[string]interface{}) error {
 	if err != nil {
 		return err
 	}
+	client.SetPrefetchSize(config.IPPrefetchSize)
 	d.client = client
 
 	err = d.initStore(option)
@@ -188,6 +196,14 @@ func (c *networkConfiguration) fromLabels(labels map[string]string) error {
 			if c.DefaultBridge, err = strconv.ParseBool(value); err != nil {
 				return parseErr(label, value, err.Error())
 			}
+		case IngressPolicingRate:
+			if c.IngressPolicingRate, err = strconv.Atoi(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
+		case IngressPolicingBurst:
+			if c.IngressPolicingBurst, err = strconv.Atoi(value); err != nil {
+				return parseErr(label, value, err.Error())
+			}
 		}
 	}
 
@@ -205,6 +221,10 @@ func (c *networkConfiguration) validate() error {
 		return ErrInvalidMtu(c.Mtu)
 	}
 
+	if c.IngressPolicingRate < 0 || c.IngressPolicingBurst < 0 {
+		return types.BadRequestErrorf("invalid ingress policing rate %d or burst %d", c.IngressPolicingRate, c.IngressPolicingBurst)
+	}
+
 	return nil
 }
 
@@ -308,6 +328,54 @@ func (d *driver) CreateNetwork(nid string, option map[string]interface{}, ipV4Da
 	return d.storeUpdate(config)
 }
 
+// UpdateNetwork applies the changes to the options the ovs driver allows
+// modifying on a live network: the ingress policing of the endpoint ports
+// and the MTU, which is inherited by the endpoints created from now on.
+func (d *driver) UpdateNetwork(nid string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	config, err := parseNetworkOptions(nid, option)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	cur := n.config
+	ports := make([]string, 0, len(n.endpoints))
+	for _, ep := range n.endpoints {
+		if ep.dstName != "" {
+			ports = append(ports, ep.dstName)
+		}
+	}
+	n.Unlock()
+
+	if (config.BridgeName != "" && config.BridgeName != cur.BridgeName) || config.DefaultBridge != cur.DefaultBridge {
+		return types.ForbiddenErrorf("the bridge of ovs network %s cannot be changed", nid)
+	}
+
+	if config.IngressPolicingRate != cur.IngressPolicingRate || config.IngressPolicingBurst != cur.IngressPolicingBurst {
+		for _, port := range ports {
+			if err := d.ovsdber.SetIngressPolicing(port, config.IngressPolicingRate, config.IngressPolicingBurst); err != nil {
+				return fmt.Errorf("failed to set ingress policing on port %s: %v", port, err)
+			}
+		}
+	}
+
+	upd := *cur
+	upd.Mtu = config.Mtu
+	upd.IngressPolicingRate = config.IngressPolicingRate
+	upd.IngressPolicingBurst = config.IngressPolicingBurst
+
+	n.Lock()
+	n.config = &upd
+	n.Unlock()
+
+	return d.storeUpdate(&upd)
+}
+
 func (d *driver) createNetwork(config *networkConfiguration) error {
 	var err error
 
@@ -572,6 +640,13 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 		return fmt.Errorf("adding interface %s to ovs bridge %s failed: %v", hostIfName, config.BridgeName, err)
 	}
 
+	if config.IngressPolicingRate != 0 {
+		if err = d.ovsdber.SetIngressPolicing(hostIfName, config.IngressPolicingRate, config.IngressPolicingBurst); err != nil {
+			d.removeFromBridge(hostIfName, config.BridgeName)
+			return fmt.Errorf("failed to set ingress policing on port %s: %v", hostIfName, err)
+		}
+	}
+
 	// Create the sandbox side pipe interface
 	endpoint.dstName = hostIfName
 	endpoint.srcName = containerIfName
@@ -614,6 +689,12 @@ func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo,
 		return fmt.Errorf("could not set link up for host interface %s: %v", hostIfName, err)
 	}
 
+	// Persist the host side interface name, needed to restore the endpoint
+	if err = d.storeUpdate(&endpointState{NetworkID: nid, ID: eid, HostIfName: hostIfName}); err != nil {
+		d.removeFromBridge(hostIfName, config.BridgeName)
+		return err
+	}
+
 	return nil
 }
 
@@ -681,6 +762,10 @@ func (d *driver) DeleteEndpoint(nid, eid string) error {
 		netlink.LinkDel(link)
 	}
 
+	if err := d.storeDelete(&endpointState{NetworkID: nid, ID: eid}); err != nil {
+		logrus.Warnf("Failed to delete state of ovs endpoint %s from store: %v", eid, err)
+	}
+
 	return nil
 }
 
@@ -779,6 +864,59 @@ func (d *driver) Leave(nid, eid string) error {
 	return nil
 }
 
+// RestoreEndpoint rebuilds the endpoint whose veth pair is still plumbed
+// in the ovs bridge and in the sandbox. The host side interface name is
+// taken from the endpoint state persisted by CreateEndpoint.
+func (d *driver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	defer osl.InitOSContext()()
+
+	if ifInfo == nil {
+		return errors.New("invalid interface info passed")
+	}
+
+	network, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := network.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep != nil {
+		return driverapi.ErrEndpointExists(eid)
+	}
+
+	epConfig, err := parseEndpointOptions(options)
+	if err != nil {
+		return err
+	}
+
+	es, err := d.getEndpointState(nid, eid)
+	if err != nil {
+		return err
+	}
+
+	if _, err := netlink.LinkByName(es.HostIfName); err != nil {
+		return types.NotFoundErrorf("host side interface %s of endpoint %s is gone: %v", es.HostIfName, eid, err)
+	}
+
+	endpoint := &ovsEndpoint{
+		id:         eid,
+		addr:       ifInfo.Address(),
+		macAddress: ifInfo.MacAddress(),
+		config:     epConfig,
+		srcName:    srcName,
+		dstName:    es.HostIfName,
+	}
+
+	network.Lock()
+	network.endpoints[eid] = endpoint
+	network.Unlock()
+
+	return nil
+}
+
 func (d *driver) Type() string {
 	return networkType
 }
@@ -7,10 +7,15 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/libkv/store"
 	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/drivers/ovs/controller"
 	"github.com/docker/libnetwork/netlabel"
 )
 
-const ovsPrefix = "ovs"
+const (
+	ovsPrefix         = "ovs"
+	ovsLeasePrefix    = "ovs_lease"
+	ovsEndpointPrefix = "ovs_endpoint"
+)
 
 func (d *driver) initStore(option map[string]interface{}) error {
 	var err error
@@ -36,7 +41,11 @@ func (d *driver) initStore(option map[string]interface{}) error {
 			return fmt.Errorf("ovs driver failed to initialize data store: %v", err)
 		}
 
-		return d.populateNetworks()
+		if err = d.populateNetworks(); err != nil {
+			return err
+		}
+
+		return d.populateLeases()
 	}
 
 	return nil
@@ -63,6 +72,62 @@ func (d *driver) populateNetworks() error {
 	return nil
 }
 
+func (d *driver) populateLeases() error {
+	kvol, err := d.store.List(datastore.Key(ovsLeasePrefix), &leaseState{})
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return fmt.Errorf("failed to get ovs address leases from store: %v", err)
+	}
+
+	if d.client == nil {
+		return nil
+	}
+
+	var leases []*controller.Lease
+	for _, kvo := range kvol {
+		leases = append(leases, &kvo.(*leaseState).Lease)
+	}
+	d.client.RestoreLeases(leases)
+	d.client.SetLeaseStore(d)
+
+	return nil
+}
+
+// PutLease persists an address lease handed out by the network controller.
+func (d *driver) PutLease(l *controller.Lease) error {
+	ls := &leaseState{Lease: *l}
+	if err := d.store.GetObject(datastore.Key(ls.Key()...), ls); err != nil && err != datastore.ErrKeyNotFound {
+		return err
+	}
+	ls.Lease = *l
+	return d.storeUpdate(ls)
+}
+
+// DeleteLease removes an address lease from the store.
+func (d *driver) DeleteLease(l *controller.Lease) error {
+	ls := &leaseState{Lease: *l}
+	if err := d.store.GetObject(datastore.Key(ls.Key()...), ls); err != nil {
+		if err == datastore.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+	return d.storeDelete(ls)
+}
+
+// getEndpointState returns the persisted state of the endpoint.
+func (d *driver) getEndpointState(nid, eid string) (*endpointState, error) {
+	if d.store == nil {
+		return nil, fmt.Errorf("ovs data store not initialized, state of endpoint %s is not available", eid)
+	}
+
+	es := &endpointState{NetworkID: nid, ID: eid}
+	if err := d.store.GetObject(datastore.Key(es.Key()...), es); err != nil {
+		return nil, fmt.Errorf("failed to get state of endpoint %s from store: %v", eid, err)
+	}
+
+	return es, nil
+}
+
 func (d *driver) storeUpdate(kvObject datastore.KVObject) error {
 	if d.store == nil {
 		logrus.Warnf("ovs data store not initialized. kv object %s is not add to store", datastore.Key(kvObject.Key()...))
@@ -146,3 +211,122 @@ func (ncfg *networkConfiguration) CopyTo(o datastore.KVObject) error {
 func (ncfg *networkConfiguration) DataScope() string {
 	return datastore.LocalScope
 }
+
+// leaseState is the store representation of a controller address lease.
+type leaseState struct {
+	controller.Lease
+	dbIndex  uint64
+	dbExists bool
+}
+
+func (ls *leaseState) Key() []string {
+	return []string{ovsLeasePrefix, ls.NetworkName, ls.Owner}
+}
+
+func (ls *leaseState) KeyPrefix() []string {
+	return []string{ovsLeasePrefix}
+}
+
+func (ls *leaseState) Value() []byte {
+	b, err := json.Marshal(ls.Lease)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (ls *leaseState) SetValue(value []byte) error {
+	return json.Unmarshal(value, &ls.Lease)
+}
+
+func (ls *leaseState) Index() uint64 {
+	return ls.dbIndex
+}
+
+func (ls *leaseState) SetIndex(index uint64) {
+	ls.dbIndex = index
+	ls.dbExists = true
+}
+
+func (ls *leaseState) Exists() bool {
+	return ls.dbExists
+}
+
+func (ls *leaseState) Skip() bool {
+	return false
+}
+
+func (ls *leaseState) New() datastore.KVObject {
+	return &leaseState{}
+}
+
+func (ls *leaseState) CopyTo(o datastore.KVObject) error {
+	dstLs := o.(*leaseState)
+	*dstLs = *ls
+	return nil
+}
+
+func (ls *leaseState) DataScope() string {
+	return datastore.LocalScope
+}
+
+// endpointState is the store representation of an endpoint, holding what
+// is needed to restore it which libnetwork does not know about.
+type endpointState struct {
+	NetworkID  string
+	ID         string
+	HostIfName string
+	dbIndex    uint64
+	dbExists   bool
+}
+
+func (es *endpointState) Key() []string {
+	return []string{ovsEndpointPrefix, es.NetworkID, es.ID}
+}
+
+func (es *endpointState) KeyPrefix() []string {
+	return []string{ovsEndpointPrefix}
+}
+
+func (es *endpointState) Value() []byte {
+	b, err := json.Marshal(es)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (es *endpointState) SetValue(value []byte) error {
+	return json.Unmarshal(value, es)
+}
+
+func (es *endpointState) Index() uint64 {
+	return es.dbIndex
+}
+
+func (es *endpointState) SetIndex(index uint64) {
+	es.dbIndex = index
+	es.dbExists = true
+}
+
+func (es *endpointState) Exists() bool {
+	return es.dbExists
+}
+
+func (es *endpointState) Skip() bool {
+	return false
+}
+
+func (es *endpointState) New() datastore.KVObject {
+	return &endpointState{}
+}
+
+func (es *endpointState) CopyTo(o datastore.KVObject) error {
+	dstEs := o.(*endpointState)
+	*dstEs = *es
+	return nil
+}
+
+func (es *endpointState) DataScope() string {
+	return datastore.LocalScope
+}
@@ -166,6 +166,25 @@ func (ovsdber *OvsdbDriver) AddVxLanPort(bridgeName, portName string, peerAddr s
 	return ovsdber.performOvsdbOps(operations)
 }
 
+// SetIngressPolicing limits the rate, in kbps, and the burst, in kb, of the
+// traffic the port's interface receives. A zero rate disables policing.
+func (ovsdber *OvsdbDriver) SetIngressPolicing(portName string, rate, burst int) error {
+	intf := make(map[string]interface{})
+	intf["ingress_policing_rate"] = rate
+	intf["ingress_policing_burst"] = burst
+
+	condition := libovsdb.NewCondition("name", "==", portName)
+	updateOp := libovsdb.Operation{
+		Op:    UpdateOp,
+		Table: InterfaceTable,
+		Row:   intf,
+		Where: []interface{}{condition},
+	}
+
+	operations := []libovsdb.Operation{updateOp}
+	return ovsdber.performOvsdbOps(operations)
+}
+
 // portExists checks whether the port exists
 func (ovsdber *OvsdbDriver) portExists(portName string) (bool, error) {
 	condition := libovsdb.NewCondition("name", "==", portName)
@@ -22,6 +22,7 @@ const (
 	DeleteOp = "delete"
 	SelectOp = "select"
 	MutateOp = "mutate"
+	UpdateOp = "update"
 )
 
 var (
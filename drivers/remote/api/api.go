@@ -23,7 +23,8 @@ func (r *Response) GetError() string {
 // GetCapabilityResponse is the response of GetCapability request
 type GetCapabilityResponse struct {
 	Response
-	Scope string
+	Scope         string
+	PoolExpansion bool
 }
 
 // CreateNetworkRequest requests a new network.
@@ -44,6 +45,25 @@ type CreateNetworkResponse struct {
 	Response
 }
 
+// UpdateNetworkRequest requests a network to be updated with new options
+// or additional ip-addressing data.
+type UpdateNetworkRequest struct {
+	// The ID of the network to update.
+	NetworkID string
+
+	// A free form map->object interface for communication of options.
+	Options map[string]interface{}
+
+	// The IPAM data of the network, including the additional pools.
+	IPv4Data []driverapi.IPAMData
+	IPv6Data []driverapi.IPAMData
+}
+
+// UpdateNetworkResponse is the response to the UpdateNetworkRequest.
+type UpdateNetworkResponse struct {
+	Response
+}
+
 // DeleteNetworkRequest is the request to delete an existing network.
 type DeleteNetworkRequest struct {
 	// The ID of the network to delete.
@@ -151,6 +171,22 @@ type LeaveResponse struct {
 	Response
 }
 
+// RestoreEndpointRequest describes the API for restoring the state of an
+// endpoint joined to a sandbox before the daemon restarted.
+type RestoreEndpointRequest struct {
+	NetworkID     string
+	EndpointID    string
+	SandboxKey    string
+	Interface     *EndpointInterface
+	InterfaceName *InterfaceName
+	Options       map[string]interface{}
+}
+
+// RestoreEndpointResponse is the answer to RestoreEndpointRequest.
+type RestoreEndpointResponse struct {
+	Response
+}
+
 // DiscoveryNotification represents a discovery notification
 type DiscoveryNotification struct {
 	DiscoveryType driverapi.DiscoveryType
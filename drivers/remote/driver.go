@@ -50,7 +50,7 @@ func (d *driver) getCapabilities() (*driverapi.Capability, error) {
 		return nil, err
 	}
 
-	c := &driverapi.Capability{}
+	c := &driverapi.Capability{PoolExpansion: capResp.PoolExpansion}
 	switch capResp.Scope {
 	case "global":
 		c.DataScope = datastore.GlobalScope
@@ -92,6 +92,16 @@ func (d *driver) CreateNetwork(id string, options map[string]interface{}, ipV4Da
 	return d.call("CreateNetwork", create, &api.CreateNetworkResponse{})
 }
 
+func (d *driver) UpdateNetwork(id string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	update := &api.UpdateNetworkRequest{
+		NetworkID: id,
+		Options:   options,
+		IPv4Data:  ipV4Data,
+		IPv6Data:  ipV6Data,
+	}
+	return d.call("UpdateNetwork", update, &api.UpdateNetworkResponse{})
+}
+
 func (d *driver) DeleteNetwork(nid string) error {
 	delete := &api.DeleteNetworkRequest{NetworkID: nid}
 	return d.call("DeleteNetwork", delete, &api.DeleteNetworkResponse{})
@@ -243,6 +253,31 @@ func (d *driver) Leave(nid, eid string) error {
 	return d.call("Leave", leave, &api.LeaveResponse{})
 }
 
+func (d *driver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	reqIface := &api.EndpointInterface{}
+	if ifInfo != nil {
+		if ifInfo.Address() != nil {
+			reqIface.Address = ifInfo.Address().String()
+		}
+		if ifInfo.AddressIPv6() != nil {
+			reqIface.AddressIPv6 = ifInfo.AddressIPv6().String()
+		}
+		if ifInfo.MacAddress() != nil {
+			reqIface.MacAddress = ifInfo.MacAddress().String()
+		}
+	}
+
+	restore := &api.RestoreEndpointRequest{
+		NetworkID:     nid,
+		EndpointID:    eid,
+		SandboxKey:    sboxKey,
+		Interface:     reqIface,
+		InterfaceName: &api.InterfaceName{SrcName: srcName},
+		Options:       options,
+	}
+	return d.call("RestoreEndpoint", restore, &api.RestoreEndpointResponse{})
+}
+
 func (d *driver) Type() string {
 	return d.networkType
 }
@@ -313,6 +313,12 @@ func TestRemoteDriver(t *testing.T) {
 		}
 		return map[string]interface{}{}
 	})
+	handle(t, mux, "UpdateNetwork", func(msg map[string]interface{}) interface{} {
+		if nid, ok := msg["NetworkID"]; !ok || nid != networkID {
+			t.Fatal("Network ID missing or does not match that created")
+		}
+		return map[string]interface{}{}
+	})
 	handle(t, mux, "DeleteNetwork", func(msg map[string]interface{}) interface{} {
 		if nid, ok := msg["NetworkID"]; !ok || nid != networkID {
 			t.Fatal("Network ID missing or does not match that created")
@@ -354,6 +360,15 @@ func TestRemoteDriver(t *testing.T) {
 	handle(t, mux, "Leave", func(msg map[string]interface{}) interface{} {
 		return map[string]string{}
 	})
+	handle(t, mux, "RestoreEndpoint", func(msg map[string]interface{}) interface{} {
+		if key, ok := msg["SandboxKey"]; !ok || key != "sandbox-key" {
+			t.Fatal("Sandbox key missing or does not match that joined")
+		}
+		if name, ok := msg["InterfaceName"].(map[string]interface{}); !ok || name["SrcName"] != ep.src {
+			t.Fatalf("Unexpected interface name %v", msg["InterfaceName"])
+		}
+		return map[string]string{}
+	})
 	handle(t, mux, "DeleteEndpoint", func(msg map[string]interface{}) interface{} {
 		return map[string]interface{}{}
 	})
@@ -395,6 +410,11 @@ func TestRemoteDriver(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	err = d.UpdateNetwork(netID, map[string]interface{}{"foo": "fooValue"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	endID := "dummy-endpoint"
 	err = d.CreateEndpoint(netID, endID, ep, map[string]interface{}{})
 	if err != nil {
@@ -409,6 +429,9 @@ func TestRemoteDriver(t *testing.T) {
 	if _, err = d.EndpointOperInfo(netID, endID); err != nil {
 		t.Fatal(err)
 	}
+	if err = d.RestoreEndpoint(netID, endID, "sandbox-key", ep, ep.src, nil); err != nil {
+		t.Fatal(err)
+	}
 	if err = d.Leave(netID, endID); err != nil {
 		t.Fatal(err)
 	}
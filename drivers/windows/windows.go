@@ -27,6 +27,10 @@ func (d *driver) DeleteNetwork(nid string) error {
 	return nil
 }
 
+func (d *driver) UpdateNetwork(nid string, option map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	return nil
+}
+
 func (d *driver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, epOptions map[string]interface{}) error {
 	return nil
 }
@@ -49,6 +53,10 @@ func (d *driver) Leave(nid, eid string) error {
 	return nil
 }
 
+func (d *driver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	return nil
+}
+
 func (d *driver) Type() string {
 	return networkType
 }
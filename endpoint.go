@@ -7,6 +7,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/datastore"
@@ -58,11 +59,18 @@ type endpoint struct {
 	sandboxID     string
 	exposedPorts  []types.TransportPort
 	anonymous     bool
+	aliases       []string
+	joinAliases   []string
+	addrRequests  []addressRequest
+	prefAddress   net.IP
+	prefAddressV6 net.IP
 	generic       map[string]interface{}
 	joinLeaveDone chan struct{}
 	dbIndex       uint64
 	dbExists      bool
-	vip           string // used for LVS DR
+	vips          []string // used for LVS DR
+	lb            *LoadBalancer
+	hc            *HealthCheck
 	sync.Mutex
 }
 
@@ -79,7 +87,25 @@ func (ep *endpoint) MarshalJSON() ([]byte, error) {
 		epMap["generic"] = ep.generic
 	}
 	epMap["sandbox"] = ep.sandboxID
+	if ep.joinInfo != nil {
+		epMap["joinInfo"] = ep.joinInfo
+	}
 	epMap["anonymous"] = ep.anonymous
+	if len(ep.aliases) > 0 {
+		epMap["aliases"] = ep.aliases
+	}
+	if len(ep.joinAliases) > 0 {
+		epMap["join_aliases"] = ep.joinAliases
+	}
+	if len(ep.vips) > 0 {
+		epMap["vips"] = ep.vips
+	}
+	if ep.lb != nil {
+		epMap["lb"] = ep.lb
+	}
+	if ep.hc != nil {
+		epMap["health_check"] = ep.hc
+	}
 	return json.Marshal(epMap)
 }
 
@@ -105,6 +131,36 @@ func (ep *endpoint) UnmarshalJSON(b []byte) (err error) {
 	cb, _ := json.Marshal(epMap["sandbox"])
 	json.Unmarshal(cb, &ep.sandboxID)
 
+	if v, ok := epMap["joinInfo"]; ok {
+		jb, _ := json.Marshal(v)
+		json.Unmarshal(jb, &ep.joinInfo)
+	}
+
+	if v, ok := epMap["aliases"]; ok {
+		ab, _ := json.Marshal(v)
+		json.Unmarshal(ab, &ep.aliases)
+	}
+
+	if v, ok := epMap["join_aliases"]; ok {
+		ab, _ := json.Marshal(v)
+		json.Unmarshal(ab, &ep.joinAliases)
+	}
+
+	if v, ok := epMap["vips"]; ok {
+		vb, _ := json.Marshal(v)
+		json.Unmarshal(vb, &ep.vips)
+	}
+
+	if v, ok := epMap["lb"]; ok {
+		lb, _ := json.Marshal(v)
+		json.Unmarshal(lb, &ep.lb)
+	}
+
+	if v, ok := epMap["health_check"]; ok {
+		hb, _ := json.Marshal(v)
+		json.Unmarshal(hb, &ep.hc)
+	}
+
 	if v, ok := epMap["generic"]; ok {
 		ep.generic = v.(map[string]interface{})
 
@@ -152,6 +208,19 @@ func (ep *endpoint) UnmarshalJSON(b []byte) (err error) {
 			ep.generic[netlabel.ExposedPorts] = tplist
 
 		}
+
+		if opt, ok := ep.generic[netlabel.MacAddress]; ok {
+			var mac net.HardwareAddr
+			bytes, err := json.Marshal(opt)
+			if err == nil {
+				err = json.Unmarshal(bytes, &mac)
+			}
+			if err != nil {
+				log.Error(err)
+			} else {
+				ep.generic[netlabel.MacAddress] = mac
+			}
+		}
 	}
 
 	if v, ok := epMap["anonymous"]; ok {
@@ -181,9 +250,33 @@ func (ep *endpoint) CopyTo(o datastore.KVObject) error {
 		ep.iface.CopyTo(dstEp.iface)
 	}
 
+	if ep.joinInfo != nil {
+		dstEp.joinInfo = &endpointJoinInfo{}
+		ep.joinInfo.CopyTo(dstEp.joinInfo)
+	}
+
 	dstEp.exposedPorts = make([]types.TransportPort, len(ep.exposedPorts))
 	copy(dstEp.exposedPorts, ep.exposedPorts)
 
+	dstEp.aliases = make([]string, len(ep.aliases))
+	copy(dstEp.aliases, ep.aliases)
+
+	dstEp.joinAliases = make([]string, len(ep.joinAliases))
+	copy(dstEp.joinAliases, ep.joinAliases)
+
+	dstEp.vips = make([]string, len(ep.vips))
+	copy(dstEp.vips, ep.vips)
+
+	if ep.lb != nil {
+		lb := *ep.lb
+		dstEp.lb = &lb
+	}
+
+	if ep.hc != nil {
+		hc := *ep.hc
+		dstEp.hc = &hc
+	}
+
 	dstEp.generic = options.Generic{}
 	for k, v := range ep.generic {
 		dstEp.generic[k] = v
@@ -322,7 +415,10 @@ func (ep *endpoint) Join(sbox Sandbox, options ...EndpointOption) error {
 	sb.joinLeaveStart()
 	defer sb.joinLeaveEnd()
 
-	return ep.sbJoin(sbox, options...)
+	start := time.Now()
+	err := ep.sbJoin(sbox, options...)
+	observeOp("endpoint_join", ep.getNetwork().Type(), start, err)
+	return err
 }
 
 func (ep *endpoint) sbJoin(sbox Sandbox, options ...EndpointOption) error {
@@ -429,10 +525,68 @@ func (ep *endpoint) sbJoin(sbox Sandbox, options ...EndpointOption) error {
 		return err
 	}
 
+	if err = network.getController().addServiceBackend(ep); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			network.getController().rmServiceBackend(ep)
+		}
+	}()
+
+	network.getController().startHealthCheck(ep)
+	defer func() {
+		if err != nil {
+			network.getController().stopHealthCheck(ep)
+		}
+	}()
+
 	if sb.needDefaultGW() {
-		return sb.setupDefaultGW(ep)
+		if err := sb.setupDefaultGW(ep); err != nil {
+			return err
+		}
+	} else if err := sb.clearDefaultGW(); err != nil {
+		return err
 	}
-	return sb.clearDefaultGW()
+
+	ep.renewLeases(sb.ContainerID())
+
+	network.getController().publish(Event{Type: EventEndpointJoin, NetworkID: nid, EndpointID: epid, SandboxID: sbox.ID()})
+
+	return nil
+}
+
+// sbRestore re-registers with its driver the endpoint a previous instance
+// of the daemon joined to the sandbox, and attaches it back to the sandbox.
+func (ep *endpoint) sbRestore(sb *sandbox) error {
+	ep.Lock()
+	sandboxID := ep.sandboxID
+	srcName := ""
+	if ep.iface != nil {
+		srcName = ep.iface.srcName
+	}
+	generic := ep.generic
+	ep.Unlock()
+
+	if sandboxID != sb.ID() {
+		return fmt.Errorf("endpoint %s is attached to sandbox %q instead of %s", ep.Name(), sandboxID, sb.ID())
+	}
+
+	n := ep.getNetwork()
+	driver, err := n.driver()
+	if err != nil {
+		return fmt.Errorf("failed to restore endpoint %s: %v", ep.Name(), err)
+	}
+
+	if err := driver.RestoreEndpoint(n.ID(), ep.ID(), sb.Key(), ep.Interface(), srcName, generic); err != nil {
+		return fmt.Errorf("failed to restore endpoint %s: %v", ep.Name(), err)
+	}
+
+	sb.Lock()
+	heap.Push(&sb.endpoints, ep)
+	sb.Unlock()
+
+	return nil
 }
 
 func (ep *endpoint) rename(name string) error {
@@ -500,7 +654,10 @@ func (ep *endpoint) Leave(sbox Sandbox, options ...EndpointOption) error {
 	sb.joinLeaveStart()
 	defer sb.joinLeaveEnd()
 
-	return ep.sbLeave(sbox, options...)
+	start := time.Now()
+	err := ep.sbLeave(sbox, options...)
+	observeOp("endpoint_leave", ep.getNetwork().Type(), start, err)
+	return err
 }
 
 func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
@@ -540,6 +697,8 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 	ep.Lock()
 	ep.sandboxID = ""
 	ep.network = n
+	joinAliases := ep.joinAliases
+	ep.joinAliases = nil
 	ep.Unlock()
 
 	if err := d.Leave(n.id, ep.id); err != nil {
@@ -548,6 +707,9 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 		}
 	}
 
+	n.getController().stopHealthCheck(ep)
+	n.getController().rmServiceBackend(ep)
+
 	if err := sb.clearNetworkResources(ep); err != nil {
 		log.Warnf("Could not cleanup network resources on container %s disconnect: %v", ep.name, err)
 	}
@@ -563,6 +725,13 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 
 	sb.deleteHostsEntries(n.getSvcRecords(ep))
 
+	// The aliases passed on join go away with the container
+	n.getController().deleteSvcNames(ep, joinAliases)
+
+	ep.renewLeases("")
+
+	n.getController().publish(Event{Type: EventEndpointLeave, NetworkID: n.ID(), EndpointID: ep.ID(), SandboxID: sbox.ID()})
+
 	if sb.needDefaultGW() {
 		ep := sb.getEPwithoutGateway()
 		if ep == nil {
@@ -574,6 +743,13 @@ func (ep *endpoint) sbLeave(sbox Sandbox, options ...EndpointOption) error {
 }
 
 func (ep *endpoint) Delete() error {
+	start := time.Now()
+	err := ep.delete()
+	observeOp("endpoint_delete", ep.getNetwork().Type(), start, err)
+	return err
+}
+
+func (ep *endpoint) delete() error {
 	var err error
 	n, err := ep.getNetworkFromStore()
 	if err != nil {
@@ -626,6 +802,9 @@ func (ep *endpoint) Delete() error {
 	}
 
 	ep.releaseAddress()
+	n.shrinkIpam()
+
+	n.getController().publish(Event{Type: EventEndpointDelete, NetworkID: n.ID(), EndpointID: epid})
 
 	return nil
 }
@@ -745,6 +924,24 @@ func CreateOptionVlanTag(vlantag uint) EndpointOption {
 	}
 }
 
+// CreateOptionIpam function returns an option setter for the IPv4 and
+// IPv6 addresses the endpoint interface requests. A nil address lets the
+// ipam driver pick one.
+func CreateOptionIpam(ipV4, ipV6 net.IP) EndpointOption {
+	return func(ep *endpoint) {
+		ep.prefAddress = types.GetIPCopy(ipV4)
+		ep.prefAddressV6 = types.GetIPCopy(ipV6)
+	}
+}
+
+// CreateOptionMacAddress function returns an option setter for the mac
+// address of the endpoint interface, passed to the driver as generic data
+func CreateOptionMacAddress(mac net.HardwareAddr) EndpointOption {
+	return func(ep *endpoint) {
+		ep.generic[netlabel.MacAddress] = types.GetMacCopy(mac)
+	}
+}
+
 // CreateOptionContainerID function returns an option setter for setting
 // the container id
 func CreateOptionContainerID(id string) EndpointOption {
@@ -753,14 +950,101 @@ func CreateOptionContainerID(id string) EndpointOption {
 	}
 }
 
-// CreateOptionVirtualIP function returns an option setter for setting
-// the endpoint virtual ip
-func CreateOptionVirtualIP(vip string) EndpointOption {
+// CreateOptionVirtualIP function returns an option setter for adding
+// virtual ips, in CIDR notation, to be bound to the loopback device of
+// the sandbox the endpoint joins
+func CreateOptionVirtualIP(vips ...string) EndpointOption {
 	return func(ep *endpoint) {
-		ep.vip = vip
+		for _, vip := range vips {
+			if !ep.hasVirtualIP(vip) {
+				ep.vips = append(ep.vips, vip)
+			}
+		}
 	}
 }
 
+// addressRequest is an additional address the endpoint requests at
+// creation: a specific address, any address of a network pool, or both.
+type addressRequest struct {
+	pool    string
+	address string
+}
+
+// CreateOptionAdditionalAddress function returns an option setter for
+// requesting an address for the endpoint interface besides the primary
+// ones. pool, in CIDR notation, selects the network pool to allocate it
+// from, address the preferred address. Either can be empty; when both are,
+// any IPv4 address of the network is allocated.
+func CreateOptionAdditionalAddress(pool, address string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.addrRequests = append(ep.addrRequests, addressRequest{pool: pool, address: address})
+	}
+}
+
+// CreateOptionAlias function returns an option setter for additional names
+// the endpoint is resolved by on its network
+func CreateOptionAlias(names ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.aliases = appendAliases(ep.aliases, names)
+	}
+}
+
+// JoinOptionAlias function returns an option setter for additional names
+// the endpoint is resolved by on its network for the duration of the join,
+// to be passed to the endpoint.Join() method.
+func JoinOptionAlias(names ...string) EndpointOption {
+	return func(ep *endpoint) {
+		ep.joinAliases = appendAliases(ep.joinAliases, names)
+	}
+}
+
+func appendAliases(aliases, names []string) []string {
+	for _, name := range names {
+		if name != "" && !hasAlias(aliases, name) {
+			aliases = append(aliases, name)
+		}
+	}
+	return aliases
+}
+
+func hasAlias(aliases []string, name string) bool {
+	for _, a := range aliases {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameAliases tells whether the two endpoints are resolved by the same
+// names
+func sameAliases(a, b *endpoint) bool {
+	an, bn := a.svcNames(), b.svcNames()
+	if len(an) != len(bn) {
+		return false
+	}
+	for i := range an {
+		if an[i] != bn[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// svcNames returns the names the endpoint is resolved by on its network.
+// Anonymous endpoints are only resolved by their aliases.
+func (ep *endpoint) svcNames() []string {
+	ep.Lock()
+	defer ep.Unlock()
+
+	var names []string
+	if !ep.anonymous {
+		names = append(names, ep.name)
+	}
+	names = appendAliases(names, ep.aliases)
+	return appendAliases(names, ep.joinAliases)
+}
+
 // JoinOptionPriority function returns an option setter for priority option to
 // be passed to the endpoint.Join() method.
 func JoinOptionPriority(ep Endpoint, prio int) EndpointOption {
@@ -807,7 +1091,17 @@ func (ep *endpoint) assignAddress(assignIPv4, assignIPv6 bool) error {
 	}
 
 	if assignIPv6 {
-		err = ep.assignAddressVersion(6, ipam)
+		if err = ep.assignAddressVersion(6, ipam); err != nil && assignIPv4 {
+			// Do not leak the IPv4 address, the caller only releases
+			// the addresses of the endpoints created successfully
+			if rerr := ipam.ReleaseAddress(ep.iface.v4PoolID, ep.iface.addr.IP); rerr != nil {
+				log.Warnf("Failed to release ip address %s of endpoint %s (%s): %v", ep.iface.addr.IP, ep.Name(), ep.ID(), rerr)
+			}
+			ep.Lock()
+			ep.iface.addr = nil
+			ep.iface.v4PoolID = ""
+			ep.Unlock()
+		}
 	}
 
 	return err
@@ -817,6 +1111,7 @@ func (ep *endpoint) assignAddressVersion(ipVer int, ipam ipamapi.Ipam) error {
 	var (
 		poolID  *string
 		address **net.IPNet
+		prefIP  net.IP
 	)
 
 	n := ep.getNetwork()
@@ -824,37 +1119,145 @@ func (ep *endpoint) assignAddressVersion(ipVer int, ipam ipamapi.Ipam) error {
 	case 4:
 		poolID = &ep.iface.v4PoolID
 		address = &ep.iface.addr
+		prefIP = ep.prefAddress
 	case 6:
 		poolID = &ep.iface.v6PoolID
 		address = &ep.iface.addrv6
+		prefIP = ep.prefAddressV6
 	default:
 		return types.InternalErrorf("incorrect ip version number passed: %d", ipVer)
 	}
+	if *address != nil {
+		prefIP = (*address).IP
+	}
 
 	ipInfo := n.getIPInfo(ipVer)
 
 	// ipv6 address is not mandatory
-	if len(ipInfo) == 0 && ipVer == 6 {
+	if len(ipInfo) == 0 && ipVer == 6 && prefIP == nil {
 		return nil
 	}
 
-	for _, d := range ipInfo {
-		var prefIP net.IP
-		if *address != nil {
-			prefIP = (*address).IP
+	for {
+		for _, d := range ipInfo {
+			if prefIP != nil && !d.Pool.Contains(prefIP) {
+				continue
+			}
+			addr, _, err := ipam.RequestAddress(d.PoolID, prefIP, ep.addressOptions())
+			if err == nil {
+				ep.Lock()
+				*address = addr
+				*poolID = d.PoolID
+				ep.Unlock()
+				n.getController().publish(Event{Type: EventIPAMAllocate, NetworkID: n.ID(), EndpointID: ep.ID(), Address: addr.String()})
+				return nil
+			}
+			if err != ipamapi.ErrNoAvailableIPs {
+				return addressRequestError(n, prefIP, err)
+			}
+		}
+		if prefIP != nil {
+			return types.BadRequestErrorf("requested address %s does not belong to any IPv%d pool of network %s", prefIP, ipVer, n.Name())
+		}
+
+		// All the pools are full, add one if the network auto expands
+		added, err := n.expandIpam(ipVer, ipam, n.getIPInfo(ipVer))
+		if err != nil {
+			log.Warnf("Failed to expand the IPv%d pools of network %s (%s): %v", ipVer, n.Name(), n.ID(), err)
 		}
-		addr, _, err := ipam.RequestAddress(d.PoolID, prefIP, nil)
+		if len(added) == 0 {
+			break
+		}
+		ipInfo = added
+	}
+	return fmt.Errorf("no available IPv%d addresses on this network's address pools: %s (%s)", ipVer, n.Name(), n.ID())
+}
+
+// addressRequestError turns the ipam errors on the request of a specific
+// address into ones telling the caller what is wrong with it
+func addressRequestError(n *network, ip net.IP, err error) error {
+	if ip == nil {
+		return err
+	}
+	switch err {
+	case ipamapi.ErrIPAlreadyAllocated:
+		return types.ForbiddenErrorf("address %s is already in use on network %s", ip, n.Name())
+	case ipamapi.ErrIPOutOfRange:
+		return types.BadRequestErrorf("address %s is out of the allocatable range of network %s", ip, n.Name())
+	}
+	return err
+}
+
+// assignAdditionalAddresses allocates the additional addresses the
+// endpoint requested at creation
+func (ep *endpoint) assignAdditionalAddresses() error {
+	n := ep.getNetwork()
+	if len(ep.addrRequests) == 0 || n.Type() == "host" || n.Type() == "null" || n.Type() == "ovs" {
+		return nil
+	}
+
+	ipam, err := n.getController().getIpamDriver(n.ipamType)
+	if err != nil {
+		return err
+	}
+
+	for _, req := range ep.addrRequests {
+		var (
+			ipVer  = 4
+			prefIP net.IP
+			pool   *net.IPNet
+		)
+		if req.address != "" {
+			if prefIP = net.ParseIP(req.address); prefIP == nil {
+				return types.BadRequestErrorf("invalid additional address %q", req.address)
+			}
+		}
+		if req.pool != "" {
+			if _, pool, err = net.ParseCIDR(req.pool); err != nil {
+				return types.BadRequestErrorf("invalid additional address pool %q: %v", req.pool, err)
+			}
+			if prefIP != nil && !pool.Contains(prefIP) {
+				return types.BadRequestErrorf("additional address %s is not in pool %s", prefIP, pool)
+			}
+		}
+		if (prefIP != nil && prefIP.To4() == nil) || (pool != nil && pool.IP.To4() == nil) {
+			ipVer = 6
+		}
+
+		if err := ep.assignAdditionalAddress(ipVer, pool, prefIP, ipam); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ep *endpoint) assignAdditionalAddress(ipVer int, pool *net.IPNet, prefIP net.IP, ipam ipamapi.Ipam) error {
+	n := ep.getNetwork()
+
+	matched := false
+	for _, d := range n.getIPInfo(ipVer) {
+		if (pool != nil && !types.CompareIPNet(d.Pool, pool)) || (prefIP != nil && !d.Pool.Contains(prefIP)) {
+			continue
+		}
+		matched = true
+
+		addr, _, err := ipam.RequestAddress(d.PoolID, prefIP, ep.addressOptions())
 		if err == nil {
 			ep.Lock()
-			*address = addr
-			*poolID = d.PoolID
+			ep.iface.extraAddrs = append(ep.iface.extraAddrs, &extraAddress{addr: addr, poolID: d.PoolID})
 			ep.Unlock()
+			n.getController().publish(Event{Type: EventIPAMAllocate, NetworkID: n.ID(), EndpointID: ep.ID(), Address: addr.String()})
 			return nil
 		}
 		if err != ipamapi.ErrNoAvailableIPs {
-			return err
+			return addressRequestError(n, prefIP, err)
 		}
 	}
+
+	if !matched {
+		return types.BadRequestErrorf("no pool of network %s matches the additional address request", n.Name())
+	}
 	return fmt.Errorf("no available IPv%d addresses on this network's address pools: %s (%s)", ipVer, n.Name(), n.ID())
 }
 
@@ -873,10 +1276,93 @@ func (ep *endpoint) releaseAddress() {
 	}
 	if err := ipam.ReleaseAddress(ep.iface.v4PoolID, ep.iface.addr.IP); err != nil {
 		log.Warnf("Failed to release ip address %s on delete of endpoint %s (%s): %v", ep.iface.addr.IP, ep.Name(), ep.ID(), err)
+	} else {
+		n.getController().publish(Event{Type: EventIPAMRelease, NetworkID: n.ID(), EndpointID: ep.ID(), Address: ep.iface.addr.String()})
 	}
 	if ep.iface.addrv6 != nil && ep.iface.addrv6.IP.IsGlobalUnicast() {
 		if err := ipam.ReleaseAddress(ep.iface.v6PoolID, ep.iface.addrv6.IP); err != nil {
 			log.Warnf("Failed to release ip address %s on delete of endpoint %s (%s): %v", ep.iface.addrv6.IP, ep.Name(), ep.ID(), err)
+		} else {
+			n.getController().publish(Event{Type: EventIPAMRelease, NetworkID: n.ID(), EndpointID: ep.ID(), Address: ep.iface.addrv6.String()})
+		}
+	}
+	for _, ea := range ep.iface.extraAddrs {
+		if err := ipam.ReleaseAddress(ea.poolID, ea.addr.IP); err != nil {
+			log.Warnf("Failed to release ip address %s on delete of endpoint %s (%s): %v", ea.addr.IP, ep.Name(), ep.ID(), err)
+		} else {
+			n.getController().publish(Event{Type: EventIPAMRelease, NetworkID: n.ID(), EndpointID: ep.ID(), Address: ea.addr.String()})
+		}
+	}
+}
+
+// leaseOptions returns the address request options recording the endpoint
+// and the passed container as the owners of the endpoint addresses
+func (ep *endpoint) leaseOptions(containerID string) map[string]string {
+	opts := map[string]string{
+		netlabel.EndpointID:  ep.ID(),
+		netlabel.ContainerID: containerID,
+	}
+	if ttl, err := ep.getNetwork().leaseTTL(); err == nil && ttl > 0 {
+		opts[netlabel.IpamLeaseTTL] = ttl.String()
+	}
+	return opts
+}
+
+// addressOptions returns the options of the endpoint address requests: the
+// lease options, along with the endpoint mac address when it is already
+// known, which IPv6 addresses may derive from
+func (ep *endpoint) addressOptions() map[string]string {
+	opts := ep.leaseOptions("")
+
+	ep.Lock()
+	mac := ep.iface.mac
+	if m, ok := ep.generic[netlabel.MacAddress].(net.HardwareAddr); ok && mac == nil {
+		mac = m
+	}
+	ep.Unlock()
+
+	if mac != nil {
+		opts[netlabel.MacAddress] = mac.String()
+	}
+	return opts
+}
+
+// renewLeases renews the leases of the endpoint addresses, if the ipam
+// driver of the network keeps leases, recording the passed container as
+// their owner.
+func (ep *endpoint) renewLeases(containerID string) {
+	n := ep.getNetwork()
+	if n.Type() == "host" || n.Type() == "null" || n.Type() == "ovs" {
+		return
+	}
+
+	ipam, err := n.getController().getIpamDriver(n.ipamType)
+	if err != nil {
+		log.Warnf("Failed to retrieve ipam driver to renew the address leases of endpoint %s (%s): %v", ep.Name(), ep.ID(), err)
+		return
+	}
+	leaser, ok := unwrapIpam(ipam).(ipamapi.Leaser)
+	if !ok {
+		return
+	}
+
+	ep.Lock()
+	addrs := make(map[*net.IPNet]string)
+	if ep.iface.addr != nil && ep.iface.v4PoolID != "" {
+		addrs[ep.iface.addr] = ep.iface.v4PoolID
+	}
+	if ep.iface.addrv6 != nil && ep.iface.v6PoolID != "" {
+		addrs[ep.iface.addrv6] = ep.iface.v6PoolID
+	}
+	for _, ea := range ep.iface.extraAddrs {
+		addrs[ea.addr] = ea.poolID
+	}
+	ep.Unlock()
+
+	opts := ep.leaseOptions(containerID)
+	for addr, poolID := range addrs {
+		if _, err := leaser.RenewLease(poolID, addr.IP, opts); err != nil && err != ipamapi.ErrLeaseNotFound {
+			log.Warnf("Failed to renew the lease of address %s of endpoint %s (%s): %v", addr.IP, ep.Name(), ep.ID(), err)
 		}
 	}
 }
@@ -896,6 +1382,15 @@ func (c *controller) cleanupLocalEndpoints() {
 		}
 
 		for _, ep := range epl {
+			// Keep the endpoints of the sandboxes restored on startup
+			c.Lock()
+			sb, ok := c.sandboxes[ep.sandboxID]
+			restored := ok && !sb.isStub
+			c.Unlock()
+			if restored {
+				continue
+			}
+
 			if err := ep.Delete(); err != nil {
 				log.Warnf("Could not delete local endpoint %s during endpoint cleanup: %v", ep.name, err)
 			}
@@ -153,6 +153,28 @@ retry:
 	return nil
 }
 
+// setEndpointCnt overwrites the endpoint count of the network, regardless
+// of the value currently in store
+func (ec *endpointCnt) setEndpointCnt(cnt uint64) error {
+	store := ec.n.getController().getStore(ec.DataScope())
+	if store == nil {
+		return fmt.Errorf("store not found for scope %s on endpoint count set", ec.DataScope())
+	}
+
+	for {
+		ec.Lock()
+		ec.Count = cnt
+		ec.Unlock()
+
+		if err := ec.n.getController().updateToStore(ec); err == nil || err != datastore.ErrKeyModified {
+			return err
+		}
+		if err := store.GetObject(datastore.Key(ec.Key()...), ec); err != nil {
+			return fmt.Errorf("could not update the kvobject to latest on endpoint count set: %v", err)
+		}
+	}
+}
+
 func (ec *endpointCnt) IncEndpointCnt() error {
 	return ec.atomicIncDecEpCnt(true)
 }
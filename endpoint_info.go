@@ -28,6 +28,22 @@ type EndpointInfo interface {
 
 	// Sandbox returns the attached sandbox if there, nil otherwise.
 	Sandbox() Sandbox
+
+	// VirtualIPs returns the virtual ips bound to the loopback device
+	// of the sandbox when the endpoint joins it.
+	VirtualIPs() []string
+
+	// LoadBalancer returns the load balancer configuration of the
+	// service, nil if its traffic is not load balanced.
+	LoadBalancer() *LoadBalancer
+
+	// HealthCheck returns the health check configuration of the
+	// service, nil if its backends are not probed.
+	HealthCheck() *HealthCheck
+
+	// Health returns the health status of the backend attached to the
+	// service, nil if it is not being probed.
+	Health() *HealthStatus
 }
 
 // InterfaceInfo provides an interface to retrieve interface addresses and vlan tag bound to the endpoint.
@@ -41,6 +57,10 @@ type InterfaceInfo interface {
 	// AddressIPv6 returns the IPv6 address assigned to the endpoint.
 	AddressIPv6() *net.IPNet
 
+	// AdditionalAddresses returns the IPv4 and IPv6 addresses assigned
+	// to the endpoint besides the primary ones.
+	AdditionalAddresses() []*net.IPNet
+
 	// VlanID returns the vlan tag assigned to the endpoint.
 	VlanID() uint
 
@@ -49,19 +69,46 @@ type InterfaceInfo interface {
 }
 
 type endpointInterface struct {
-	mac       net.HardwareAddr
-	addr      *net.IPNet
-	addrv6    *net.IPNet
-	srcName   string
-	dstPrefix string
-	routes    []*net.IPNet
-	v4PoolID  string
-	v6PoolID  string
+	mac        net.HardwareAddr
+	addr       *net.IPNet
+	addrv6     *net.IPNet
+	srcName    string
+	dstPrefix  string
+	routes     []*net.IPNet
+	v4PoolID   string
+	v6PoolID   string
+	extraAddrs []*extraAddress
 
 	vlanID      uint
 	networkName string
 }
 
+// extraAddress is an address of the endpoint interface besides its primary
+// ones, along with the pool it was allocated from
+type extraAddress struct {
+	addr   *net.IPNet
+	poolID string
+}
+
+func (ea *extraAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"addr": ea.addr.String(), "poolID": ea.poolID})
+}
+
+func (ea *extraAddress) UnmarshalJSON(b []byte) error {
+	var (
+		err   error
+		eaMap map[string]string
+	)
+	if err = json.Unmarshal(b, &eaMap); err != nil {
+		return err
+	}
+	if ea.addr, err = types.ParseCIDR(eaMap["addr"]); err != nil {
+		return types.InternalErrorf("failed to decode endpoint interface additional address after json unmarshal: %v", err)
+	}
+	ea.poolID = eaMap["poolID"]
+	return nil
+}
+
 func (epi *endpointInterface) MarshalJSON() ([]byte, error) {
 	epMap := make(map[string]interface{})
 	if epi.mac != nil {
@@ -82,6 +129,9 @@ func (epi *endpointInterface) MarshalJSON() ([]byte, error) {
 	epMap["routes"] = routes
 	epMap["v4PoolID"] = epi.v4PoolID
 	epMap["v6PoolID"] = epi.v6PoolID
+	if len(epi.extraAddrs) > 0 {
+		epMap["extraAddrs"] = epi.extraAddrs
+	}
 	epMap["vlanID"] = epi.vlanID
 	epMap["networkName"] = epi.networkName
 	return json.Marshal(epMap)
@@ -128,7 +178,16 @@ func (epi *endpointInterface) UnmarshalJSON(b []byte) error {
 	epi.v4PoolID = epMap["v4PoolID"].(string)
 	epi.v6PoolID = epMap["v6PoolID"].(string)
 
-	epi.vlanID = epMap["vlanID"].(uint)
+	if v, ok := epMap["extraAddrs"]; ok {
+		eb, _ := json.Marshal(v)
+		if err := json.Unmarshal(eb, &epi.extraAddrs); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := epMap["vlanID"]; ok {
+		epi.vlanID = uint(v.(float64))
+	}
 	epi.networkName = epMap["networkName"].(string)
 
 	return nil
@@ -145,6 +204,10 @@ func (epi *endpointInterface) CopyTo(dstEpi *endpointInterface) error {
 	dstEpi.v4PoolID = epi.v4PoolID
 	dstEpi.v6PoolID = epi.v6PoolID
 
+	for _, ea := range epi.extraAddrs {
+		dstEpi.extraAddrs = append(dstEpi.extraAddrs, &extraAddress{addr: types.GetIPNetCopy(ea.addr), poolID: ea.poolID})
+	}
+
 	for _, route := range epi.routes {
 		dstEpi.routes = append(dstEpi.routes, types.GetIPNetCopy(route))
 	}
@@ -158,6 +221,49 @@ type endpointJoinInfo struct {
 	StaticRoutes []*types.StaticRoute
 }
 
+func (epj *endpointJoinInfo) MarshalJSON() ([]byte, error) {
+	epMap := make(map[string]interface{})
+	if epj.gw != nil {
+		epMap["gw"] = epj.gw.String()
+	}
+	if epj.gw6 != nil {
+		epMap["gw6"] = epj.gw6.String()
+	}
+	epMap["StaticRoutes"] = epj.StaticRoutes
+	return json.Marshal(epMap)
+}
+
+func (epj *endpointJoinInfo) UnmarshalJSON(b []byte) error {
+	var epMap map[string]interface{}
+	if err := json.Unmarshal(b, &epMap); err != nil {
+		return err
+	}
+	if v, ok := epMap["gw"]; ok {
+		epj.gw = net.ParseIP(v.(string))
+	}
+	if v, ok := epMap["gw6"]; ok {
+		epj.gw6 = net.ParseIP(v.(string))
+	}
+
+	rb, _ := json.Marshal(epMap["StaticRoutes"])
+	var routes []*types.StaticRoute
+	json.Unmarshal(rb, &routes)
+	epj.StaticRoutes = routes
+
+	return nil
+}
+
+func (epj *endpointJoinInfo) CopyTo(dstEpj *endpointJoinInfo) error {
+	dstEpj.gw = types.GetIPCopy(epj.gw)
+	dstEpj.gw6 = types.GetIPCopy(epj.gw6)
+
+	for _, route := range epj.StaticRoutes {
+		dstEpj.StaticRoutes = append(dstEpj.StaticRoutes, route.GetCopy())
+	}
+
+	return nil
+}
+
 func (ep *endpoint) Info() EndpointInfo {
 	log.Debugf("ep Info get called")
 	log.Debugf("ep info before get from store")
@@ -280,6 +386,14 @@ func (epi *endpointInterface) AddressIPv6() *net.IPNet {
 	return types.GetIPNetCopy(epi.addrv6)
 }
 
+func (epi *endpointInterface) AdditionalAddresses() []*net.IPNet {
+	addrs := make([]*net.IPNet, 0, len(epi.extraAddrs))
+	for _, ea := range epi.extraAddrs {
+		addrs = append(addrs, types.GetIPNetCopy(ea.addr))
+	}
+	return addrs
+}
+
 func (epi *endpointInterface) VlanID() uint {
 	return epi.vlanID
 }
@@ -341,6 +455,60 @@ func (ep *endpoint) Sandbox() Sandbox {
 	return cnt
 }
 
+func (ep *endpoint) VirtualIPs() []string {
+	ep.Lock()
+	defer ep.Unlock()
+
+	vips := make([]string, len(ep.vips))
+	copy(vips, ep.vips)
+
+	return vips
+}
+
+func (ep *endpoint) LoadBalancer() *LoadBalancer {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.lb == nil {
+		return nil
+	}
+
+	lb := *ep.lb
+	return &lb
+}
+
+func (ep *endpoint) HealthCheck() *HealthCheck {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.hc == nil {
+		return nil
+	}
+
+	hc := *ep.hc
+	return &hc
+}
+
+func (ep *endpoint) Health() *HealthStatus {
+	n := ep.getNetwork()
+	if n == nil {
+		return nil
+	}
+
+	return n.getController().backendHealth(ep.ID())
+}
+
+// hasVirtualIP checks whether the virtual ip is already configured
+// on the endpoint. Must be called with the endpoint lock held.
+func (ep *endpoint) hasVirtualIP(vip string) bool {
+	for _, v := range ep.vips {
+		if v == vip {
+			return true
+		}
+	}
+	return false
+}
+
 func (ep *endpoint) Gateway() net.IP {
 	ep.Lock()
 	defer ep.Unlock()
@@ -144,9 +144,19 @@ func Delete(path string, recs []Record) error {
 		return err
 	}
 
-	regexpStr := fmt.Sprintf("\\S*\\t%s\\n", regexp.QuoteMeta(recs[0].Hosts))
+	// Records with an IP only match the entries for that IP, so that
+	// the entries other hosts have under the same name are retained
+	pattern := func(r Record) string {
+		ip := "\\S*"
+		if r.IP != "" {
+			ip = regexp.QuoteMeta(r.IP)
+		}
+		return fmt.Sprintf("^%s\\t%s\\n", ip, regexp.QuoteMeta(r.Hosts))
+	}
+
+	regexpStr := "(?m)" + pattern(recs[0])
 	for _, r := range recs[1:] {
-		regexpStr = regexpStr + "|" + fmt.Sprintf("\\S*\\t%s\\n", regexp.QuoteMeta(r.Hosts))
+		regexpStr = regexpStr + "|" + pattern(r)
 	}
 
 	var re = regexp.MustCompile(regexpStr)
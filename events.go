@@ -0,0 +1,141 @@
+package libnetwork
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// EventType identifies the kind of change an Event reports.
+type EventType string
+
+const (
+	// EventNetworkCreate is published when a network is created
+	EventNetworkCreate EventType = "network.create"
+	// EventNetworkUpdate is published when a network is updated
+	EventNetworkUpdate EventType = "network.update"
+	// EventNetworkDelete is published when a network is deleted
+	EventNetworkDelete EventType = "network.delete"
+	// EventEndpointCreate is published when an endpoint is created
+	EventEndpointCreate EventType = "endpoint.create"
+	// EventEndpointDelete is published when an endpoint is deleted
+	EventEndpointDelete EventType = "endpoint.delete"
+	// EventEndpointJoin is published when an endpoint joins a sandbox
+	EventEndpointJoin EventType = "endpoint.join"
+	// EventEndpointLeave is published when an endpoint leaves a sandbox
+	EventEndpointLeave EventType = "endpoint.leave"
+	// EventSandboxCreate is published when a sandbox is created
+	EventSandboxCreate EventType = "sandbox.create"
+	// EventSandboxDelete is published when a sandbox is deleted
+	EventSandboxDelete EventType = "sandbox.delete"
+	// EventIPAMAllocate is published when an endpoint address is allocated
+	EventIPAMAllocate EventType = "ipam.allocate"
+	// EventIPAMRelease is published when an endpoint address is released
+	EventIPAMRelease EventType = "ipam.release"
+)
+
+// eventQueueSize is the number of events buffered for each subscriber.
+// Events published while the buffer is full are dropped.
+const eventQueueSize = 64
+
+// Event describes a change in the state managed by the controller.
+// Only the ids relevant to the event type are set.
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	NetworkID  string    `json:"network_id,omitempty"`
+	EndpointID string    `json:"endpoint_id,omitempty"`
+	SandboxID  string    `json:"sandbox_id,omitempty"`
+	// Address is the allocated or released address, for ipam events
+	Address string `json:"address,omitempty"`
+}
+
+// EventFilter selects the events delivered to a subscriber. Empty
+// fields match all events.
+type EventFilter struct {
+	Types     []EventType
+	NetworkID string
+}
+
+func (f *EventFilter) match(ev *Event) bool {
+	if f.NetworkID != "" && f.NetworkID != ev.NetworkID {
+		return false
+	}
+
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	for _, t := range f.Types {
+		if t == ev.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+type subscriber struct {
+	filter EventFilter
+	ch     chan Event
+}
+
+// Subscribe returns a channel delivering the events matching the filter
+// along with a function cancelling the subscription. The channel is closed
+// once the subscription is cancelled or the controller is stopped.
+func (c *controller) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	s := &subscriber{
+		filter: filter,
+		ch:     make(chan Event, eventQueueSize),
+	}
+
+	c.eventLock.Lock()
+	if c.subscribers == nil {
+		c.subscribers = make(map[*subscriber]struct{})
+	}
+	c.subscribers[s] = struct{}{}
+	c.eventLock.Unlock()
+
+	cancel := func() {
+		c.eventLock.Lock()
+		defer c.eventLock.Unlock()
+		if _, ok := c.subscribers[s]; ok {
+			delete(c.subscribers, s)
+			close(s.ch)
+		}
+	}
+
+	return s.ch, cancel
+}
+
+// publish delivers the event to the matching subscribers without blocking.
+func (c *controller) publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	c.eventLock.Lock()
+	defer c.eventLock.Unlock()
+
+	for s := range c.subscribers {
+		if !s.filter.match(&ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			log.Warnf("Dropping %s event, subscriber queue is full", ev.Type)
+		}
+	}
+}
+
+// closeSubscribers cancels all the subscriptions.
+func (c *controller) closeSubscribers() {
+	c.eventLock.Lock()
+	defer c.eventLock.Unlock()
+
+	for s := range c.subscribers {
+		close(s.ch)
+	}
+	c.subscribers = nil
+}
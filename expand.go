@@ -0,0 +1,275 @@
+package libnetwork
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+)
+
+// autoExpand returns whether the network gets an additional address pool
+// when it runs out of addresses, as set with the netlabel.IpamAutoExpand
+// label.
+func (n *network) autoExpand() (bool, error) {
+	n.Lock()
+	v, ok := n.labels[netlabel.IpamAutoExpand]
+	n.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, types.BadRequestErrorf("invalid %s label value %q on network %s", netlabel.IpamAutoExpand, v, n.Name())
+	}
+	return on, nil
+}
+
+// validateAutoExpand checks the netlabel.IpamAutoExpand label of the
+// network, which can only be set on the networks whose driver takes
+// additional address pools
+func (n *network) validateAutoExpand() error {
+	on, err := n.autoExpand()
+	if err != nil || !on {
+		return err
+	}
+	if !n.driverCapability().PoolExpansion {
+		return types.ForbiddenErrorf("%s driver of network %s does not support the %s label", n.Type(), n.Name(), netlabel.IpamAutoExpand)
+	}
+	return nil
+}
+
+// expandIpam adds an address pool of the ip version to the network, whose
+// pools in tried ran out of addresses, and returns the pools to try next.
+// These are the pools another endpoint creation added in the meantime, if
+// any. Nothing is returned if the network does not auto expand.
+func (n *network) expandIpam(ipVer int, ipam ipamapi.Ipam, tried []*IpamInfo) ([]*IpamInfo, error) {
+	if on, err := n.autoExpand(); err != nil || !on {
+		return nil, err
+	}
+	if !n.driverCapability().PoolExpansion {
+		return nil, nil
+	}
+
+	c := n.getController()
+	for {
+		cur, err := c.getNetworkFromStore(n.ID())
+		if err != nil {
+			return nil, err
+		}
+
+		if added := poolsExcept(cur.getIPInfo(ipVer), tried); len(added) > 0 {
+			n.refreshIPInfo(cur)
+			return added, nil
+		}
+
+		log.Debugf("Expanding the IPv%d pools of network %s (%s)", ipVer, cur.Name(), cur.ID())
+
+		d, err := cur.ipamAllocatePool(ipam, cur.expansionConf(ipVer), ipVer)
+		if err != nil {
+			return nil, err
+		}
+		d.Expansion = true
+
+		cur.setIPInfo(ipVer, append(cur.getIPInfo(ipVer), d))
+		if err = cur.updateIPAMData(); err != nil {
+			cur.ipamReleaseExpansion(ipam, d)
+			return nil, err
+		}
+
+		if err = c.updateToStore(cur); err != nil {
+			cur.setIPInfo(ipVer, poolsExcept(cur.getIPInfo(ipVer), []*IpamInfo{d}))
+			if e := cur.updateIPAMData(); e != nil {
+				log.Warnf("Failed to rollback the expansion of network %s (%s): %v", cur.Name(), cur.ID(), e)
+			}
+			cur.ipamReleaseExpansion(ipam, d)
+			if err == datastore.ErrKeyModified {
+				continue
+			}
+			return nil, err
+		}
+
+		n.refreshIPInfo(cur)
+		c.publish(Event{Type: EventNetworkUpdate, NetworkID: cur.ID()})
+
+		return []*IpamInfo{d}, nil
+	}
+}
+
+// shrinkIpam releases the expansion pools of the network which no endpoint
+// has an address from anymore.
+func (n *network) shrinkIpam() {
+	expanded := false
+	for _, d := range append(n.getIPInfo(4), n.getIPInfo(6)...) {
+		expanded = expanded || d.Expansion
+	}
+	if !expanded {
+		return
+	}
+
+	if !n.driverCapability().PoolExpansion {
+		return
+	}
+
+	c := n.getController()
+	ipam, err := c.getIpamDriver(n.ipamType)
+	if err != nil {
+		log.Warnf("Failed to retrieve ipam driver to shrink network %s (%s): %v", n.Name(), n.ID(), err)
+		return
+	}
+
+	// Wait for the endpoint creations which may be using the pools
+	c.ipamResize.Lock()
+	defer c.ipamResize.Unlock()
+
+	for {
+		cur, err := c.getNetworkFromStore(n.ID())
+		if err != nil {
+			log.Warnf("Failed to shrink network %s (%s): %v", n.Name(), n.ID(), err)
+			return
+		}
+
+		eps, err := cur.getEndpointsFromStore()
+		if err != nil {
+			log.Warnf("Failed to shrink network %s (%s): %v", n.Name(), n.ID(), err)
+			return
+		}
+		inUse := make(map[string]bool)
+		for _, ep := range eps {
+			ep.Lock()
+			inUse[ep.iface.v4PoolID] = true
+			inUse[ep.iface.v6PoolID] = true
+			for _, ea := range ep.iface.extraAddrs {
+				inUse[ea.poolID] = true
+			}
+			ep.Unlock()
+		}
+
+		var unused []*IpamInfo
+		for _, ipVer := range []int{4, 6} {
+			var keep []*IpamInfo
+			for _, d := range cur.getIPInfo(ipVer) {
+				if d.Expansion && !inUse[d.PoolID] {
+					unused = append(unused, d)
+					continue
+				}
+				keep = append(keep, d)
+			}
+			cur.setIPInfo(ipVer, keep)
+		}
+		if len(unused) == 0 {
+			return
+		}
+
+		log.Debugf("Shrinking the pools of network %s (%s)", cur.Name(), cur.ID())
+
+		if err := cur.updateIPAMData(); err != nil {
+			log.Warnf("Failed to shrink network %s (%s): %v", cur.Name(), cur.ID(), err)
+			return
+		}
+
+		if err := c.updateToStore(cur); err != nil {
+			if e := n.updateIPAMData(); e != nil {
+				log.Warnf("Failed to rollback the shrinking of network %s (%s): %v", cur.Name(), cur.ID(), e)
+			}
+			if err == datastore.ErrKeyModified {
+				continue
+			}
+			log.Warnf("Failed to shrink network %s (%s): %v", cur.Name(), cur.ID(), err)
+			return
+		}
+
+		for _, d := range unused {
+			cur.ipamReleaseExpansion(ipam, d)
+		}
+		n.refreshIPInfo(cur)
+		c.publish(Event{Type: EventNetworkUpdate, NetworkID: cur.ID()})
+
+		return
+	}
+}
+
+// expansionConf returns the configuration of the pools added to the network
+// for the ip version. They are requested with the options of its first pool.
+func (n *network) expansionConf(ipVer int) *IpamConf {
+	n.Lock()
+	defer n.Unlock()
+
+	cfgList := n.ipamV4Config
+	if ipVer == 6 {
+		cfgList = n.ipamV6Config
+	}
+
+	cfg := &IpamConf{}
+	if len(cfgList) > 0 && cfgList[0].Options != nil {
+		cfg.Options = make(map[string]string, len(cfgList[0].Options))
+		for k, v := range cfgList[0].Options {
+			cfg.Options[k] = v
+		}
+	}
+	return cfg
+}
+
+// updateIPAMData passes the ip-addressing data of the network to its driver
+func (n *network) updateIPAMData() error {
+	d, err := n.driver()
+	if err != nil {
+		return err
+	}
+	return d.UpdateNetwork(n.ID(), nil, n.getIPData(4), n.getIPData(6))
+}
+
+func (n *network) setIPInfo(ipVer int, info []*IpamInfo) {
+	n.Lock()
+	defer n.Unlock()
+
+	if ipVer == 6 {
+		n.ipamV6Info = info
+		return
+	}
+	n.ipamV4Info = info
+}
+
+// refreshIPInfo replaces the pools of the network with the ones of the
+// network from store
+func (n *network) refreshIPInfo(from *network) {
+	v4, v6 := from.getIPInfo(4), from.getIPInfo(6)
+
+	n.Lock()
+	n.ipamV4Info = v4
+	n.ipamV6Info = v6
+	n.Unlock()
+}
+
+// ipamReleaseExpansion releases the expansion pool and its gateway
+func (n *network) ipamReleaseExpansion(ipam ipamapi.Ipam, d *IpamInfo) {
+	if d.Gateway != nil {
+		if err := ipam.ReleaseAddress(d.PoolID, d.Gateway.IP); err != nil {
+			log.Warnf("Failed to release gateway ip address %s of expansion pool %s of network %s (%s): %v", d.Gateway.IP, d.PoolID, n.Name(), n.ID(), err)
+		}
+	}
+	if err := ipam.ReleasePool(d.PoolID); err != nil {
+		log.Warnf("Failed to release expansion pool %s of network %s (%s): %v", d.PoolID, n.Name(), n.ID(), err)
+	}
+}
+
+// poolsExcept returns the pools of info which are not in excl
+func poolsExcept(info, excl []*IpamInfo) []*IpamInfo {
+	var l []*IpamInfo
+	for _, d := range info {
+		found := false
+		for _, t := range excl {
+			if t.PoolID == d.PoolID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l = append(l, d)
+		}
+	}
+	return l
+}
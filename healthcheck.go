@@ -0,0 +1,506 @@
+package libnetwork
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	// HealthCheckTCP probes the backend by opening a TCP connection.
+	HealthCheckTCP = "tcp"
+
+	// HealthCheckHTTP probes the backend with an HTTP GET request. Any
+	// 2xx or 3xx response status is considered healthy.
+	HealthCheckHTTP = "http"
+
+	// HealthCheckICMP probes the backend with an ICMP echo request.
+	HealthCheckICMP = "icmp"
+)
+
+const (
+	// HealthUnknown is the state of a backend which has not been
+	// probed enough times to be considered healthy or unhealthy.
+	HealthUnknown = "unknown"
+
+	// Healthy is the state of a backend passing its health check.
+	Healthy = "healthy"
+
+	// Unhealthy is the state of a backend failing its health check.
+	// Unhealthy backends are removed from the load balancer and from
+	// the service records until they recover.
+	Unhealthy = "unhealthy"
+)
+
+const (
+	defaultHealthInterval  = 5 * time.Second
+	defaultHealthTimeout   = 2 * time.Second
+	defaultHealthThreshold = 3
+)
+
+// HealthCheck holds the configuration of the probes verifying that the
+// backends attached to a service are alive.
+type HealthCheck struct {
+	// Type is the probe type, one of "tcp", "http" or "icmp".
+	Type string `json:"type"`
+	// Port is the port probed by tcp and http checks. It defaults
+	// to the first tcp port exposed by the service.
+	Port uint16 `json:"port,omitempty"`
+	// Path is the request path of http checks.
+	Path string `json:"path,omitempty"`
+	// Interval is the time between two probes.
+	Interval time.Duration `json:"interval"`
+	// Timeout is the time after which a probe is considered failed.
+	Timeout time.Duration `json:"timeout"`
+	// Threshold is the number of consecutive probe results needed to
+	// flip the state of a backend.
+	Threshold int `json:"threshold"`
+}
+
+// HealthStatus is the health state of a service backend.
+type HealthStatus struct {
+	Status        string    `json:"status"`
+	FailingStreak int       `json:"failing_streak"`
+	LastCheck     time.Time `json:"last_check"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+func (hc *HealthCheck) validate(exposedPorts []types.TransportPort) error {
+	switch hc.Type {
+	case HealthCheckTCP, HealthCheckHTTP:
+		if hc.Port == 0 {
+			for _, p := range exposedPorts {
+				if p.Proto == types.TCP {
+					hc.Port = p.Port
+					break
+				}
+			}
+		}
+		if hc.Port == 0 {
+			return types.BadRequestErrorf("%s health check requires a port", hc.Type)
+		}
+	case HealthCheckICMP:
+	default:
+		return types.BadRequestErrorf("unsupported health check type %q", hc.Type)
+	}
+
+	if hc.Type == HealthCheckHTTP && hc.Path == "" {
+		hc.Path = "/"
+	}
+
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.Threshold < 0 {
+		return types.BadRequestErrorf("health check interval, timeout and threshold must not be negative")
+	}
+	if hc.Interval == 0 {
+		hc.Interval = defaultHealthInterval
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = defaultHealthTimeout
+	}
+	if hc.Threshold == 0 {
+		hc.Threshold = defaultHealthThreshold
+	}
+	if hc.Timeout > hc.Interval {
+		return types.BadRequestErrorf("health check timeout %s exceeds the interval %s", hc.Timeout, hc.Interval)
+	}
+
+	return nil
+}
+
+// CreateOptionHealthCheck function returns an option setter for probing
+// the backends attached to the service
+func CreateOptionHealthCheck(hc *HealthCheck) EndpointOption {
+	return func(ep *endpoint) {
+		if hc == nil {
+			ep.hc = nil
+			return
+		}
+		cp := *hc
+		ep.hc = &cp
+	}
+}
+
+// validateHealthCheck checks the health check configuration of the
+// endpoint, if any, filling in the defaults.
+func (ep *endpoint) validateHealthCheck() error {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.hc == nil {
+		return nil
+	}
+
+	return ep.hc.validate(ep.exposedPorts)
+}
+
+// healthChecker periodically probes the backend attached to a service.
+type healthChecker struct {
+	ep        *endpoint
+	hc        HealthCheck
+	sandboxID string
+	status    HealthStatus
+	successes int
+	stopCh    chan struct{}
+	sync.Mutex
+}
+
+// startHealthCheck starts probing the endpoint which just joined a
+// sandbox, if it has a health check configured.
+func (c *controller) startHealthCheck(ep *endpoint) {
+	ep.Lock()
+	hc := ep.hc
+	lb := ep.lb
+	epid := ep.id
+	ep.Unlock()
+
+	if hc == nil {
+		return
+	}
+
+	h := &healthChecker{
+		ep:     ep,
+		hc:     *hc,
+		status: HealthStatus{Status: HealthUnknown},
+		stopCh: make(chan struct{}),
+	}
+	// Probe from the namespace the load balancer lives in
+	if lb != nil {
+		h.sandboxID = lb.SandboxID
+	}
+
+	c.healthLock.Lock()
+	if old, ok := c.healthCheckers[epid]; ok {
+		old.stop()
+	}
+	c.healthCheckers[epid] = h
+	c.healthLock.Unlock()
+
+	go c.healthCheckLoop(h)
+}
+
+// stopHealthCheck stops probing the endpoint. An endpoint which was
+// unhealthy gets its service records back, they are managed by the
+// endpoint lifecycle from now on.
+func (c *controller) stopHealthCheck(ep *endpoint) {
+	c.healthLock.Lock()
+	h, ok := c.healthCheckers[ep.ID()]
+	if ok {
+		delete(c.healthCheckers, ep.ID())
+	}
+	c.healthLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// Stopping under the lock makes sure an ongoing probe does not
+	// bring the backend back once it left
+	h.Lock()
+	close(h.stopCh)
+	unhealthy := h.status.Status == Unhealthy
+	h.Unlock()
+
+	if unhealthy {
+		c.updateBackendSvcRecord(h.ep, true)
+	}
+}
+
+// stop stops the probing of the backend
+func (h *healthChecker) stop() {
+	h.Lock()
+	close(h.stopCh)
+	h.Unlock()
+}
+
+func (c *controller) stopHealthChecks() {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+
+	for id, h := range c.healthCheckers {
+		h.stop()
+		delete(c.healthCheckers, id)
+	}
+}
+
+// backendHealth returns the health status of the endpoint, nil if it
+// is not being probed.
+func (c *controller) backendHealth(epid string) *HealthStatus {
+	c.healthLock.Lock()
+	h, ok := c.healthCheckers[epid]
+	c.healthLock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	st := h.status
+	return &st
+}
+
+func (c *controller) healthCheckLoop(h *healthChecker) {
+	ticker := time.NewTicker(h.hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.runHealthCheck(h)
+
+		select {
+		case <-h.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *controller) runHealthCheck(h *healthChecker) {
+	err := c.probe(h)
+
+	h.Lock()
+	prev := h.status.Status
+	h.status.LastCheck = time.Now()
+	if err != nil {
+		h.successes = 0
+		h.status.FailingStreak++
+		h.status.LastError = err.Error()
+		if prev != Unhealthy && h.status.FailingStreak >= h.hc.Threshold {
+			h.status.Status = Unhealthy
+		}
+	} else {
+		h.successes++
+		h.status.FailingStreak = 0
+		h.status.LastError = ""
+		if prev == HealthUnknown || (prev == Unhealthy && h.successes >= h.hc.Threshold) {
+			h.status.Status = Healthy
+		}
+	}
+	status := h.status.Status
+
+	// The membership is updated under the lock, for the backend not to be
+	// added back after leaving the service while being probed
+	defer h.Unlock()
+
+	if status == prev {
+		return
+	}
+
+	select {
+	case <-h.stopCh:
+		return
+	default:
+	}
+
+	log.Infof("Backend %s of service %s is %s", h.ep.ID(), h.ep.Name(), status)
+
+	switch {
+	case status == Unhealthy:
+		c.rmServiceBackend(h.ep)
+		c.updateBackendSvcRecord(h.ep, false)
+	case prev == Unhealthy:
+		if err := c.addServiceBackend(h.ep); err != nil {
+			log.Warnf("Failed to add recovered backend %s back to the load balancer: %v", h.ep.ID(), err)
+		}
+		c.updateBackendSvcRecord(h.ep, true)
+	}
+}
+
+// updateBackendSvcRecord adds or removes the service records of the
+// backend in the local sandboxes of its network.
+func (c *controller) updateBackendSvcRecord(ep *endpoint, isAdd bool) {
+	n := ep.getNetwork()
+	if n == nil {
+		return
+	}
+
+	c.Lock()
+	nw, ok := c.nmap[n.ID()]
+	c.Unlock()
+	if !ok {
+		return
+	}
+
+	n.updateSvcRecord(ep, c.getLocalEps(nw), isAdd)
+}
+
+func (c *controller) probe(h *healthChecker) error {
+	ep := h.ep
+	ep.Lock()
+	var addr net.IP
+	if ep.iface != nil {
+		if ep.iface.addr != nil {
+			addr = ep.iface.addr.IP
+		} else if ep.iface.addrv6 != nil {
+			addr = ep.iface.addrv6.IP
+		}
+	}
+	ep.Unlock()
+
+	if addr == nil {
+		return fmt.Errorf("backend has no address")
+	}
+
+	switch h.hc.Type {
+	case HealthCheckTCP:
+		conn, err := c.healthDial(h, addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case HealthCheckHTTP:
+		return c.probeHTTP(h, addr)
+	case HealthCheckICMP:
+		return c.probeICMP(h, addr)
+	}
+
+	return fmt.Errorf("unsupported health check type %q", h.hc.Type)
+}
+
+// healthDial opens a TCP connection to the backend from the probing
+// namespace. The socket stays bound to that namespace once created.
+func (c *controller) healthDial(h *healthChecker, addr net.IP) (net.Conn, error) {
+	var conn net.Conn
+	err := c.lbInvoke(h.sandboxID, func() error {
+		var err error
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(addr.String(), strconv.Itoa(int(h.hc.Port))), h.hc.Timeout)
+		return err
+	})
+	return conn, err
+}
+
+func (c *controller) probeHTTP(h *healthChecker, addr net.IP) error {
+	conn, err := c.healthDial(h, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(h.hc.Timeout))
+
+	host := net.JoinHostPort(addr.String(), strconv.Itoa(int(h.hc.Port)))
+	req, err := http.NewRequest("GET", "http://"+host+h.hc.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Close = true
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected http status %s", resp.Status)
+	}
+
+	return nil
+}
+
+const (
+	icmpEchoRequest   = 8
+	icmpEchoReply     = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func (c *controller) probeICMP(h *healthChecker, addr net.IP) error {
+	var conn net.PacketConn
+	err := c.lbInvoke(h.sandboxID, func() error {
+		var err error
+		conn, err = newICMPConn(addr)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return icmpEcho(conn, addr, h.hc.Timeout)
+}
+
+// icmpEcho sends an echo request to addr over the raw ICMP socket and
+// waits for the matching reply.
+func icmpEcho(conn net.PacketConn, addr net.IP, timeout time.Duration) error {
+	v4 := addr.To4() != nil
+
+	id := uint16(time.Now().UnixNano())
+	msg := make([]byte, 16)
+	msg[0] = icmpv6EchoRequest
+	if v4 {
+		msg[0] = icmpEchoRequest
+	}
+	binary.BigEndian.PutUint16(msg[4:6], id)
+	binary.BigEndian.PutUint16(msg[6:8], 1)
+	copy(msg[8:], "libnet-h")
+	if v4 {
+		// The kernel computes the checksum of ICMPv6 messages
+		binary.BigEndian.PutUint16(msg[2:4], icmpChecksum(msg))
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.WriteTo(msg, &net.IPAddr{IP: addr}); err != nil {
+		return err
+	}
+
+	b := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+
+		reply := b[:n]
+		if v4 && len(reply) > 0 && reply[0]>>4 == 4 {
+			// IPv4 raw sockets deliver the IP header as well
+			hl := int(reply[0]&0x0f) * 4
+			if hl > len(reply) {
+				continue
+			}
+			reply = reply[hl:]
+		}
+
+		if len(reply) < 8 {
+			continue
+		}
+		if ipa, ok := from.(*net.IPAddr); ok && !ipa.IP.Equal(addr) {
+			continue
+		}
+		if (v4 && reply[0] != icmpEchoReply) || (!v4 && reply[0] != icmpv6EchoReply) {
+			continue
+		}
+		if binary.BigEndian.Uint16(reply[4:6]) != id {
+			continue
+		}
+
+		return nil
+	}
+}
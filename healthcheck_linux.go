@@ -0,0 +1,26 @@
+package libnetwork
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// newICMPConn opens a raw ICMP socket, in the current network
+// namespace, suitable to send echo requests to addr.
+func newICMPConn(addr net.IP) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	if addr.To4() == nil {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_RAW, proto)
+	if err != nil {
+		return nil, err
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+
+	return net.FilePacketConn(f)
+}
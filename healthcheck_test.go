@@ -0,0 +1,133 @@
+package libnetwork
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+func setupLoopback(t *testing.T) {
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netlink.LinkSetUp(lo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealthCheckValidate(t *testing.T) {
+	hc := &HealthCheck{Type: "udp"}
+	if err := hc.validate(nil); err == nil {
+		t.Fatal("Expected failure for unsupported health check type")
+	}
+
+	hc = &HealthCheck{Type: HealthCheckTCP}
+	if err := hc.validate([]types.TransportPort{{Proto: types.UDP, Port: 53}}); err == nil {
+		t.Fatal("Expected failure for tcp health check without a tcp port")
+	}
+
+	hc = &HealthCheck{Type: HealthCheckHTTP}
+	if err := hc.validate([]types.TransportPort{{Proto: types.TCP, Port: 8080}}); err != nil {
+		t.Fatal(err)
+	}
+	if hc.Port != 8080 || hc.Path != "/" || hc.Interval != defaultHealthInterval ||
+		hc.Timeout != defaultHealthTimeout || hc.Threshold != defaultHealthThreshold {
+		t.Fatalf("Unexpected defaults: %+v", hc)
+	}
+
+	hc = &HealthCheck{Type: HealthCheckICMP, Interval: time.Second, Timeout: 2 * time.Second}
+	if err := hc.validate(nil); err == nil {
+		t.Fatal("Expected failure for timeout exceeding the interval")
+	}
+}
+
+func newTestHealthChecker(hc HealthCheck, addr net.IP) (*controller, *healthChecker) {
+	c := &controller{
+		lbServices:     make(map[string]*lbService),
+		healthCheckers: make(map[string]*healthChecker),
+	}
+	ep := &endpoint{
+		id:    "backend",
+		name:  "backend",
+		iface: &endpointInterface{addr: &net.IPNet{IP: addr, Mask: net.CIDRMask(32, 32)}},
+	}
+	h := &healthChecker{
+		ep:     ep,
+		hc:     hc,
+		status: HealthStatus{Status: HealthUnknown},
+		stopCh: make(chan struct{}),
+	}
+	return c, h
+}
+
+func TestHealthCheckTransitions(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	setupLoopback(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ping" {
+			http.NotFound(w, r)
+		}
+	}))
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	hc := HealthCheck{Type: HealthCheckHTTP, Port: uint16(p), Path: "/ping", Interval: time.Second, Timeout: time.Second, Threshold: 2}
+	c, h := newTestHealthChecker(hc, net.ParseIP(host))
+
+	c.runHealthCheck(h)
+	if h.status.Status != Healthy {
+		t.Fatalf("Expected backend to be healthy after the first successful probe, got %+v", h.status)
+	}
+
+	h.hc.Path = "/missing"
+	c.runHealthCheck(h)
+	if h.status.Status != Healthy || h.status.FailingStreak != 1 {
+		t.Fatalf("Expected backend to stay healthy below the threshold, got %+v", h.status)
+	}
+	c.runHealthCheck(h)
+	if h.status.Status != Unhealthy {
+		t.Fatalf("Expected backend to be unhealthy, got %+v", h.status)
+	}
+
+	h.hc.Path = "/ping"
+	c.runHealthCheck(h)
+	if h.status.Status != Unhealthy {
+		t.Fatalf("Expected backend to stay unhealthy below the threshold, got %+v", h.status)
+	}
+	c.runHealthCheck(h)
+	if h.status.Status != Healthy || h.status.FailingStreak != 0 {
+		t.Fatalf("Expected backend to recover, got %+v", h.status)
+	}
+
+	srv.Close()
+
+	h.hc.Type = HealthCheckTCP
+	c.runHealthCheck(h)
+	if h.status.LastError == "" {
+		t.Fatalf("Expected tcp probe to fail once the server is gone")
+	}
+}
+
+func TestHealthCheckICMP(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+	setupLoopback(t)
+
+	hc := HealthCheck{Type: HealthCheckICMP, Interval: time.Second, Timeout: time.Second, Threshold: 1}
+	c, h := newTestHealthChecker(hc, net.ParseIP("127.0.0.1"))
+
+	if err := c.probe(h); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package libnetwork
+
+import (
+	"net"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func newICMPConn(addr net.IP) (net.PacketConn, error) {
+	return nil, types.NotImplementedErrorf("icmp health checks are not supported on this platform")
+}
@@ -41,6 +41,15 @@ func (i *Idm) GetID() (uint64, error) {
 	return i.start + ordinal, err
 }
 
+// GetIDBlock returns the first id of the first n consecutive available ids in the set
+func (i *Idm) GetIDBlock(n uint64) (uint64, error) {
+	if i.handle == nil {
+		return 0, fmt.Errorf("ID set is not initialized")
+	}
+	ordinal, err := i.handle.SetAnyBlock(n, 0, i.end-i.start)
+	return i.start + ordinal, err
+}
+
 // GetSpecificID tries to reserve the specified id
 func (i *Idm) GetSpecificID(id uint64) error {
 	if i.handle == nil {
@@ -58,3 +67,8 @@ func (i *Idm) GetSpecificID(id uint64) error {
 func (i *Idm) Release(id uint64) {
 	i.handle.Unset(id - i.start)
 }
+
+// ReleaseBlock releases the n consecutive ids starting from the specified one
+func (i *Idm) ReleaseBlock(id, n uint64) {
+	i.handle.UnsetBlock(id-i.start, n)
+}
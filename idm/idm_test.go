@@ -107,4 +107,53 @@ func TestUninitialized(t *testing.T) {
 	if err := i.GetSpecificID(44); err == nil {
 		t.Fatalf("Expected failure but succeeded")
 	}
+
+	if _, err := i.GetIDBlock(2); err == nil {
+		t.Fatalf("Expected failure but succeeded")
+	}
+}
+
+func TestAllocateBlock(t *testing.T) {
+	i, err := New(nil, "myids", 100, 199)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.GetSpecificID(104); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := i.GetIDBlock(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != 105 {
+		t.Fatalf("Unexpected first id returned: %d", o)
+	}
+
+	o, err = i.GetIDBlock(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != 100 {
+		t.Fatalf("Unexpected first id returned: %d", o)
+	}
+
+	if o, err = i.GetIDBlock(90); err == nil {
+		t.Fatalf("Expected failure but succeeded: %d", o)
+	}
+
+	i.ReleaseBlock(105, 10)
+
+	o, err = i.GetIDBlock(90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != 105 {
+		t.Fatalf("Unexpected first id returned: %d", o)
+	}
+
+	if o, err = i.GetIDBlock(6); err == nil {
+		t.Fatalf("Expected failure but succeeded: %d", o)
+	}
 }
@@ -3,13 +3,16 @@ package ipam
 import (
 	"fmt"
 	"net"
+	"sort"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/bitseq"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/ipamutils"
+	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/types"
 )
 
@@ -22,6 +25,7 @@ const (
 	// datastore keyes for ipam objects
 	dsConfigKey = "ipam/" + ipamapi.DefaultIPAM + "/config"
 	dsDataKey   = "ipam/" + ipamapi.DefaultIPAM + "/data"
+	dsLeaseKey  = "ipam/" + ipamapi.DefaultIPAM + "/lease"
 )
 
 // Allocator provides per address space ipv4/ipv6 book keeping
@@ -32,6 +36,10 @@ type Allocator struct {
 	// stores        []datastore.Datastore
 	// Allocated addresses in each address space's subnet
 	addresses map[SubnetKey]*bitseq.Handle
+	// Next ordinal to hand out in each pool with the serial allocation
+	// policy. It is not persisted: after a restart, allocation starts over
+	// from the lowest address of the pool.
+	serial map[SubnetKey]uint64
 	sync.Mutex
 }
 
@@ -47,6 +55,7 @@ func NewAllocator(lcDs, glDs datastore.DataStore) (*Allocator, error) {
 
 	// Initialize bitseq map
 	a.addresses = make(map[SubnetKey]*bitseq.Handle)
+	a.serial = make(map[SubnetKey]uint64)
 
 	// Initialize address spaces
 	a.addrSpaces = make(map[string]*addrSpace)
@@ -128,6 +137,16 @@ func (a *Allocator) RequestPool(addressSpace, pool, subPool string, options map[
 	if err != nil {
 		return "", nil, nil, types.InternalErrorf("failed to parse pool request for address space %q pool %q subpool %q: %v", addressSpace, pool, subPool, err)
 	}
+	pol, err := parsePoolOptions(options)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if pol.v6Mode != "" {
+		// The interface identifiers are 64 bits long
+		if ones, bits := nw.Mask.Size(); bits != 128 || ones > 64 {
+			return "", nil, nil, types.BadRequestErrorf("IPv6 address mode %s requires an IPv6 pool of prefix length 64 or shorter: %s", pol.v6Mode, nw)
+		}
+	}
 
 retry:
 	if err := a.refresh(addressSpace); err != nil {
@@ -139,7 +158,7 @@ retry:
 		return "", nil, nil, err
 	}
 
-	insert, err := aSpace.updatePoolDBOnAdd(*k, nw, ipr)
+	insert, err := aSpace.updatePoolDBOnAdd(*k, nw, ipr, pol)
 	if err != nil {
 		return "", nil, nil, err
 	}
@@ -185,6 +204,14 @@ retry:
 		goto retry
 	}
 
+	aSpace.Lock()
+	if _, ok := aSpace.subnets[k]; !ok {
+		a.Lock()
+		delete(a.serial, k)
+		a.Unlock()
+	}
+	aSpace.Unlock()
+
 	return remove()
 }
 
@@ -234,6 +261,45 @@ func (a *Allocator) parsePoolRequest(addressSpace, pool, subPool string, v6 bool
 	return &SubnetKey{AddressSpace: addressSpace, Subnet: nw.String(), ChildSubnet: subPool}, nw, ipr, nil
 }
 
+// parsePoolOptions returns the allocation policy set in the pool request
+// options. The policy of a pool is set by the request which creates it.
+func parsePoolOptions(options map[string]string) (poolPolicy, error) {
+	var pol poolPolicy
+
+	switch v := options[netlabel.IpamAllocationPolicy]; v {
+	case "", ipamapi.AllocLowest:
+	case ipamapi.AllocSerial:
+		pol.serial = true
+	default:
+		return pol, types.BadRequestErrorf("invalid address allocation policy: %s", v)
+	}
+
+	if v, ok := options[netlabel.IpamQuarantine]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return pol, types.BadRequestErrorf("invalid address quarantine: %s", v)
+		}
+		pol.quarantine = d
+	}
+
+	switch v := options[netlabel.IpamIPv6AddressMode]; v {
+	case "":
+	case ipamapi.IPv6EUI64:
+		pol.v6Mode = v
+	case ipamapi.IPv6StablePrivacy:
+		// The secret is kept by the pool the request creates, if any
+		secret, err := newStableSecret()
+		if err != nil {
+			return pol, types.InternalErrorf("failed to generate stable privacy secret: %v", err)
+		}
+		pol.v6Mode, pol.secret = v, secret
+	default:
+		return pol, types.BadRequestErrorf("invalid IPv6 address mode: %s", v)
+	}
+
+	return pol, nil
+}
+
 func (a *Allocator) insertBitMask(key SubnetKey, pool *net.IPNet) error {
 	//log.Debugf("Inserting bitmask (%s, %s)", key.String(), pool.String())
 
@@ -243,13 +309,7 @@ func (a *Allocator) insertBitMask(key SubnetKey, pool *net.IPNet) error {
 	}
 
 	ipVer := getAddressVersion(pool.IP)
-	ones, bits := pool.Mask.Size()
-	numAddresses := uint64(1 << uint(bits-ones))
-
-	// Allow /64 subnet
-	if ipVer == v6 && numAddresses == 0 {
-		numAddresses--
-	}
+	numAddresses := bitmaskSize(pool)
 
 	// Generate the new address masks. AddressMask content may come from datastore
 	h, err := bitseq.NewHandle(dsDataKey, store, key.String(), numAddresses)
@@ -272,6 +332,20 @@ func (a *Allocator) insertBitMask(key SubnetKey, pool *net.IPNet) error {
 	return nil
 }
 
+// bitmaskSize returns the number of addresses tracked by the bitmask of
+// the master pool
+func bitmaskSize(pool *net.IPNet) uint64 {
+	ones, bits := pool.Mask.Size()
+	numAddresses := uint64(1 << uint(bits-ones))
+
+	// Allow /64 subnet
+	if getAddressVersion(pool.IP) == v6 && numAddresses == 0 {
+		numAddresses--
+	}
+
+	return numAddresses
+}
+
 func (a *Allocator) retrieveBitmask(k SubnetKey, n *net.IPNet) (*bitseq.Handle, error) {
 	a.Lock()
 	bm, ok := a.addresses[k]
@@ -288,6 +362,20 @@ func (a *Allocator) retrieveBitmask(k SubnetKey, n *net.IPNet) (*bitseq.Handle,
 	return bm, nil
 }
 
+// SetPredefinedPools replaces the predefined pools of the address space,
+// which the pools requested with no preferred pool are picked from
+func (a *Allocator) SetPredefinedPools(as string, pools []*net.IPNet) error {
+	a.Lock()
+	defer a.Unlock()
+
+	if _, ok := a.predefined[as]; !ok {
+		return types.NotFoundErrorf("cannot find address space %s to set its predefined pools", as)
+	}
+	a.predefined[as] = pools
+
+	return nil
+}
+
 func (a *Allocator) getPredefineds(as string) []*net.IPNet {
 	a.Lock()
 	defer a.Unlock()
@@ -369,6 +457,7 @@ func (a *Allocator) RequestAddress(poolID string, prefAddress net.IP, opts map[s
 		return nil, nil, ipamapi.ErrIPOutOfRange
 	}
 
+	pk, serial, quarantine, derive := k, p.Serial, p.Quarantine, p.V6Mode != "" && prefAddress == nil
 	c := p
 	for c.Range != nil {
 		k = c.ParentKey
@@ -381,10 +470,60 @@ func (a *Allocator) RequestAddress(poolID string, prefAddress net.IP, opts map[s
 		return nil, nil, fmt.Errorf("could not find bitmask in datastore for %s on address %v request from pool %s: %v",
 			k.String(), prefAddress, poolID, err)
 	}
-	ip, err := a.getAddress(p.Pool, bm, prefAddress, p.Range)
+	l, err := newLease(poolID, opts)
 	if err != nil {
 		return nil, nil, err
 	}
+	if quarantine > 0 {
+		if _, err := a.purgeQuarantine(k, bm, c.Pool); err != nil {
+			log.Warnf("Failed to purge the expired quarantined addresses of pool %s: %v", k.String(), err)
+		}
+	}
+
+	var from uint64
+	if serial && prefAddress == nil {
+		a.Lock()
+		from = a.serial[pk]
+		a.Unlock()
+	}
+
+	var ip net.IP
+	if derive {
+		ip = deriveAddress(p, bm, opts)
+		derive = ip != nil
+	}
+	if ip == nil {
+		ip, err = a.getAddress(p.Pool, bm, prefAddress, p.Range, from)
+		switch err {
+		case ipamapi.ErrIPAlreadyAllocated:
+			// The preferred address may only be held in quarantine
+			ip, err = a.claimQuarantined(k, p.Pool, prefAddress)
+		case ipamapi.ErrNoAvailableIPs:
+			if n, e := a.purgeQuarantine(k, bm, c.Pool); e == nil && n > 0 {
+				ip, err = a.getAddress(p.Pool, bm, prefAddress, p.Range, from)
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	h, err := types.GetHostPartIP(ip, p.Pool.Mask)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to allocate address %s: %v", ip, err)
+	}
+	ordinal := ipToUint64(h)
+
+	if err := a.recordLease(k, ip, l); err != nil {
+		bm.Unset(ordinal)
+		return nil, nil, fmt.Errorf("failed to record the lease of address %s: %v", ip, err)
+	}
+
+	if serial && prefAddress == nil && !derive {
+		a.Lock()
+		a.serial[pk] = ordinal + 1
+		a.Unlock()
+	}
 
 	return &net.IPNet{IP: ip, Mask: p.Pool.Mask}, nil, nil
 }
@@ -431,6 +570,7 @@ func (a *Allocator) ReleaseAddress(poolID string, address net.IP) error {
 	aSpace.Unlock()
 
 	mask := p.Pool.Mask
+	quarantine := p.Quarantine
 
 	h, err := types.GetHostPartIP(address, mask)
 	if err != nil {
@@ -443,10 +583,30 @@ func (a *Allocator) ReleaseAddress(poolID string, address net.IP) error {
 			k.String(), address, poolID, err)
 	}
 
-	return bm.Unset(ipToUint64(h))
+	if quarantine > 0 {
+		// The address stays allocated until the quarantine ends
+		err := a.quarantineAddress(k, address, poolID, quarantine)
+		if err == nil {
+			return nil
+		}
+		log.Warnf("Failed to quarantine released address %s, releasing it now: %v", address, err)
+	}
+
+	if err := bm.Unset(ipToUint64(h)); err != nil {
+		return err
+	}
+
+	if err := a.dropLease(k, address); err != nil {
+		log.Warnf("Failed to remove the lease of released address %s: %v", address, err)
+	}
+
+	return nil
 }
 
-func (a *Allocator) getAddress(nw *net.IPNet, bitmask *bitseq.Handle, prefAddress net.IP, ipr *AddressRange) (net.IP, error) {
+// getAddress allocates the preferred address, or else the lowest free one
+// in the range. When from is not zero, the search starts at that ordinal
+// and wraps around to the start of the range.
+func (a *Allocator) getAddress(nw *net.IPNet, bitmask *bitseq.Handle, prefAddress net.IP, ipr *AddressRange, from uint64) (net.IP, error) {
 	var (
 		ordinal uint64
 		err     error
@@ -455,19 +615,29 @@ func (a *Allocator) getAddress(nw *net.IPNet, bitmask *bitseq.Handle, prefAddres
 
 	base = types.GetIPNetCopy(nw)
 
-	if bitmask.Unselected() <= 0 {
-		return nil, ipamapi.ErrNoAvailableIPs
-	}
-	if ipr == nil && prefAddress == nil {
-		ordinal, err = bitmask.SetAny()
-	} else if prefAddress != nil {
+	if prefAddress != nil {
 		hostPart, e := types.GetHostPartIP(prefAddress, base.Mask)
 		if e != nil {
 			return nil, fmt.Errorf("failed to allocate preferred address %s: %v", prefAddress.String(), e)
 		}
 		ordinal = ipToUint64(types.GetMinimalIP(hostPart))
-		err = bitmask.Set(ordinal)
-	} else {
+		if err = bitmask.Set(ordinal); err != nil {
+			return nil, ipamapi.ErrIPAlreadyAllocated
+		}
+		return generateAddress(ordinal, base), nil
+	}
+
+	if bitmask.Unselected() <= 0 {
+		return nil, ipamapi.ErrNoAvailableIPs
+	}
+	switch {
+	case from > 0 && ipr == nil:
+		ordinal, err = setAnyFrom(bitmask, from, 0, bitmask.Bits()-1)
+	case from > 0:
+		ordinal, err = setAnyFrom(bitmask, from, ipr.Start, ipr.End)
+	case ipr == nil:
+		ordinal, err = bitmask.SetAny()
+	default:
 		ordinal, err = bitmask.SetAnyInRange(ipr.Start, ipr.End)
 	}
 	if err != nil {
@@ -478,6 +648,222 @@ func (a *Allocator) getAddress(nw *net.IPNet, bitmask *bitseq.Handle, prefAddres
 	return generateAddress(ordinal, base), nil
 }
 
+// setAnyFrom sets the first unset bit of the [start, end] range at or
+// after from, wrapping around to start when there is none
+func setAnyFrom(bitmask *bitseq.Handle, from, start, end uint64) (uint64, error) {
+	if from <= start || from > end {
+		return setAnyInRange(bitmask, start, end)
+	}
+	if ordinal, err := setAnyInRange(bitmask, from, end); err == nil {
+		return ordinal, nil
+	}
+	return setAnyInRange(bitmask, start, from-1)
+}
+
+// setAnyInRange is bitseq SetAnyInRange which also accepts a one bit range
+func setAnyInRange(bitmask *bitseq.Handle, start, end uint64) (uint64, error) {
+	if start == end {
+		return start, bitmask.Set(start)
+	}
+	return bitmask.SetAnyInRange(start, end)
+}
+
+// AllocatedAddresses returns the addresses currently allocated in the
+// bitmask backing the specified pool ID. For a sub pool, these are the
+// addresses allocated in its whole master pool. The network and broadcast
+// addresses, which are never handed out, are not reported.
+func (a *Allocator) AllocatedAddresses(poolID string) ([]net.IP, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return nil, types.BadRequestErrorf("invalid pool id: %s", poolID)
+	}
+
+	if err := a.refresh(k.AddressSpace); err != nil {
+		return nil, err
+	}
+
+	aSpace, err := a.getAddrSpace(k.AddressSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	aSpace.Lock()
+	p, ok := aSpace.subnets[k]
+	if !ok {
+		aSpace.Unlock()
+		return nil, types.NotFoundErrorf("cannot find address pool for poolID:%s", poolID)
+	}
+
+	c := p
+	for c.Range != nil {
+		k = c.ParentKey
+		c = aSpace.subnets[k]
+	}
+	aSpace.Unlock()
+
+	bm, err := a.retrieveBitmask(k, c.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("could not find bitmask in datastore for %s on allocated addresses request from pool %s: %v",
+			k.String(), poolID, err)
+	}
+
+	q, err := a.quarantinedAddresses(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return excludeAddresses(allocatedAddresses(bm, c.Pool), q), nil
+}
+
+// allocatedAddresses returns the addresses selected in the bitmask bm
+// backing pool, but the network and broadcast ones
+func allocatedAddresses(bm *bitseq.Handle, pool *net.IPNet) []net.IP {
+	last := bm.Bits() - 1
+	if getAddressVersion(pool.IP) == v6 {
+		// The broadcast ordinal is only reserved in IPv4 pools
+		last = bm.Bits()
+	}
+
+	var ips []net.IP
+	bm.WalkSelected(func(ordinal uint64) bool {
+		if ordinal != 0 && ordinal != last {
+			ips = append(ips, generateAddress(ordinal, pool))
+		}
+		return false
+	})
+
+	return ips
+}
+
+// AddressSpaces returns the address spaces of the allocator, along with the
+// pools in use in each of them
+func (a *Allocator) AddressSpaces() ([]ipamapi.AddressSpaceInfo, error) {
+	a.Lock()
+	names := make([]string, 0, len(a.addrSpaces))
+	for as := range a.addrSpaces {
+		names = append(names, as)
+	}
+	a.Unlock()
+	sort.Strings(names)
+
+	list := make([]ipamapi.AddressSpaceInfo, 0, len(names))
+	for _, as := range names {
+		if err := a.refresh(as); err != nil {
+			return nil, err
+		}
+		aSpace, err := a.getAddrSpace(as)
+		if err != nil {
+			return nil, err
+		}
+
+		aSpace.Lock()
+		keys := make([]SubnetKey, 0, len(aSpace.subnets))
+		for k := range aSpace.subnets {
+			keys = append(keys, k)
+		}
+		aSpace.Unlock()
+		sort.Sort(subnetKeys(keys))
+
+		info := ipamapi.AddressSpaceInfo{Name: as, Scope: aSpace.scope, Pools: make([]ipamapi.PoolInfo, 0, len(keys))}
+		for _, k := range keys {
+			p, err := a.poolInfo(aSpace, k, false)
+			if err != nil {
+				return nil, err
+			}
+			info.Pools = append(info.Pools, *p)
+		}
+		list = append(list, info)
+	}
+
+	return list, nil
+}
+
+// Pool returns the description of the pool identified by the passed id,
+// including the addresses allocated in it
+func (a *Allocator) Pool(poolID string) (*ipamapi.PoolInfo, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return nil, types.BadRequestErrorf("invalid pool id: %s", poolID)
+	}
+
+	if err := a.refresh(k.AddressSpace); err != nil {
+		return nil, err
+	}
+
+	aSpace, err := a.getAddrSpace(k.AddressSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.poolInfo(aSpace, k, true)
+}
+
+func (a *Allocator) poolInfo(aSpace *addrSpace, k SubnetKey, withAddresses bool) (*ipamapi.PoolInfo, error) {
+	aSpace.Lock()
+	p, ok := aSpace.subnets[k]
+	if !ok {
+		aSpace.Unlock()
+		return nil, types.NotFoundErrorf("cannot find address pool for poolID:%s", k.String())
+	}
+	info := &ipamapi.PoolInfo{
+		ID:           k.String(),
+		AddressSpace: k.AddressSpace,
+		Pool:         k.Subnet,
+		SubPool:      k.ChildSubnet,
+		RefCount:     p.RefCount,
+	}
+
+	mk, c := k, p
+	for c != nil && c.Range != nil {
+		mk = c.ParentKey
+		c = aSpace.subnets[mk]
+	}
+	aSpace.Unlock()
+	if c == nil {
+		return nil, types.InternalErrorf("cannot find master pool %s of pool %s", mk.String(), k.String())
+	}
+
+	bm, err := a.retrieveBitmask(mk, c.Pool)
+	if err != nil {
+		return nil, err
+	}
+	info.Total = bm.Bits()
+	info.Free = bm.Unselected()
+	if withAddresses {
+		ll, err := a.getLeases(mk)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range ll {
+			if l.until != nil {
+				info.Quarantined = append(info.Quarantined, l.Address)
+				continue
+			}
+			info.Leases = append(info.Leases, l.Lease)
+		}
+		sort.Sort(leasesByAddress(info.Leases))
+		sort.Sort(ipsByValue(info.Quarantined))
+		info.Allocated = excludeAddresses(allocatedAddresses(bm, c.Pool), info.Quarantined)
+	}
+
+	return info, nil
+}
+
+// subnetKeys sorts the pool keys by address space, pool and sub pool
+type subnetKeys []SubnetKey
+
+func (s subnetKeys) Len() int      { return len(s) }
+func (s subnetKeys) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s subnetKeys) Less(i, j int) bool {
+	if s[i].AddressSpace != s[j].AddressSpace {
+		return s[i].AddressSpace < s[j].AddressSpace
+	}
+	if s[i].Subnet != s[j].Subnet {
+		return s[i].Subnet < s[j].Subnet
+	}
+	return s[i].ChildSubnet < s[j].ChildSubnet
+}
+
 // DumpDatabase dumps the internal info
 func (a *Allocator) DumpDatabase() string {
 	a.Lock()
@@ -14,6 +14,7 @@ import (
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/ipamapi"
 	"github.com/docker/libnetwork/ipamutils"
+	"github.com/docker/libnetwork/netlabel"
 	_ "github.com/docker/libnetwork/testutils"
 	"github.com/docker/libnetwork/types"
 )
@@ -129,10 +130,14 @@ func TestPoolDataMarshal(t *testing.T) {
 	}
 
 	p := &PoolData{
-		ParentKey: SubnetKey{AddressSpace: "Blue", Subnet: "172.28.0.0/16"},
-		Pool:      nw,
-		Range:     &AddressRange{Sub: &net.IPNet{IP: net.IP{172, 28, 20, 0}, Mask: net.IPMask{255, 255, 255, 0}}, Start: 0, End: 255},
-		RefCount:  4,
+		ParentKey:    SubnetKey{AddressSpace: "Blue", Subnet: "172.28.0.0/16"},
+		Pool:         nw,
+		Range:        &AddressRange{Sub: &net.IPNet{IP: net.IP{172, 28, 20, 0}, Mask: net.IPMask{255, 255, 255, 0}}, Start: 0, End: 255},
+		RefCount:     4,
+		Serial:       true,
+		Quarantine:   30 * time.Second,
+		V6Mode:       ipamapi.IPv6StablePrivacy,
+		StableSecret: []byte{1, 2, 3},
 	}
 
 	ba, err := json.Marshal(p)
@@ -147,7 +152,8 @@ func TestPoolDataMarshal(t *testing.T) {
 
 	if p.ParentKey != q.ParentKey || !types.CompareIPNet(p.Range.Sub, q.Range.Sub) ||
 		p.Range.Start != q.Range.Start || p.Range.End != q.Range.End || p.RefCount != q.RefCount ||
-		!types.CompareIPNet(p.Pool, q.Pool) {
+		!types.CompareIPNet(p.Pool, q.Pool) || p.Serial != q.Serial || p.Quarantine != q.Quarantine ||
+		p.V6Mode != q.V6Mode || string(p.StableSecret) != string(q.StableSecret) {
 		t.Fatalf("\n%#v\n%#v", p, &q)
 	}
 
@@ -502,6 +508,38 @@ func TestPredefinedPool(t *testing.T) {
 	}
 }
 
+func TestSetPredefinedPools(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, base, _ := net.ParseCIDR("100.64.0.0/25")
+	pools, err := ipamutils.SplitNetwork(base, 26)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetPredefinedPools("blue", pools); err == nil {
+		t.Fatal("Expected failure for an unknown address space")
+	}
+	if err := a.SetPredefinedPools(localAddressSpace, pools); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{"100.64.0.0/26", "100.64.0.64/26"} {
+		_, nw, _, err := a.RequestPool(localAddressSpace, "", "", nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nw.String() != exp {
+			t.Fatalf("Expected pool %s, got %s", exp, nw)
+		}
+	}
+	if _, _, _, err := a.RequestPool(localAddressSpace, "", "", nil, false); err == nil {
+		t.Fatal("Expected failure once the predefined pools are used up")
+	}
+}
+
 func TestRemoveSubnet(t *testing.T) {
 	a, err := getAllocator()
 	if err != nil {
@@ -570,9 +608,519 @@ func TestGetSameAddress(t *testing.T) {
 	}
 
 	_, _, err = a.RequestAddress(pid, ip, nil)
-	if err == nil {
+	if err != ipamapi.ErrIPAlreadyAllocated {
+		t.Fatalf("Unexpected error on the request of an allocated address: %v", err)
+	}
+
+	_, _, err = a.RequestAddress(pid, net.ParseIP("192.168.101.1"), nil)
+	if err != ipamapi.ErrIPOutOfRange {
+		t.Fatalf("Unexpected error on the request of an address out of the pool: %v", err)
+	}
+}
+
+func TestAllocatedAddresses(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "10.30.0.0/24", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"10.30.0.1", "10.30.0.200"} {
+		if _, _, err := a.RequestAddress(pid, net.ParseIP(ip), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ips, err := a.AllocatedAddresses(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.ParseIP("10.30.0.1")) || !ips[1].Equal(net.ParseIP("10.30.0.200")) {
+		t.Fatalf("Unexpected allocated addresses: %v", ips)
+	}
+
+	if _, err := a.AllocatedAddresses("LocalDefault/10.40.0.0/24"); err == nil {
+		t.Fatal("Expected failure for an unknown pool")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ ipamapi.Inspector = a
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "10.41.0.0/24", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spid, _, _, err := a.RequestPool(localAddressSpace, "10.41.0.0/24", "10.41.0.64/26", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.RequestAddress(pid, net.ParseIP("10.41.0.10"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.RequestAddress(spid, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spaces, err := a.AddressSpaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pools []ipamapi.PoolInfo
+	for _, as := range spaces {
+		if as.Name == localAddressSpace {
+			pools = as.Pools
+		}
+	}
+	if len(pools) != 2 {
+		t.Fatalf("Unexpected pools: %+v", spaces)
+	}
+	// The sub pool holds a reference on its master pool
+	p, sp := pools[0], pools[1]
+	if p.ID != pid || p.Pool != "10.41.0.0/24" || p.SubPool != "" || p.RefCount != 2 || p.Total != 256 || p.Free != 252 || p.Allocated != nil {
+		t.Fatalf("Unexpected pool: %+v", p)
+	}
+	if sp.ID != spid || sp.Pool != "10.41.0.0/24" || sp.SubPool != "10.41.0.64/26" || sp.RefCount != 1 || sp.Total != 256 || sp.Free != 252 {
+		t.Fatalf("Unexpected sub pool: %+v", sp)
+	}
+
+	sp2, err := a.Pool(spid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sp2.Allocated) != 2 || !sp2.Allocated[0].Equal(net.ParseIP("10.41.0.10")) || !sp2.Allocated[1].Equal(net.ParseIP("10.41.0.64")) {
+		t.Fatalf("Unexpected allocated addresses: %v", sp2.Allocated)
+	}
+
+	if _, err := a.Pool("LocalDefault/10.42.0.0/24"); err == nil {
+		t.Fatal("Expected failure for an unknown pool")
+	}
+}
+
+func TestLeases(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ ipamapi.Leaser = a
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "10.42.0.0/24", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.IpamLeaseTTL: "soon"}); err == nil {
+		t.Fatal("Expected failure for an invalid lease ttl")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	ip1, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1", netlabel.IpamLeaseTTL: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip2, _, err := a.RequestAddress(pid, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip1.IP.Equal(net.ParseIP("10.42.0.1")) {
+		t.Fatalf("The failed request leaked an address, got %v", ip1)
+	}
+
+	ll, err := a.Leases(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ll) != 2 || !ll[0].Address.Equal(ip1.IP) || ll[0].EndpointID != "ep1" || ll[0].TTL != time.Hour || ll[0].Created.IsZero() ||
+		!ll[1].Address.Equal(ip2.IP) || ll[1].EndpointID != "" || ll[1].TTL != 0 {
+		t.Fatalf("Unexpected leases: %+v", ll)
+	}
+
+	if err := a.ReleaseExpiredLease(pid, ip1.IP); err != ipamapi.ErrLeaseNotExpired {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrLeaseNotExpired, err)
+	}
+	if err := a.ReleaseExpiredLease(pid, ip2.IP); err != ipamapi.ErrLeaseNotExpired {
+		t.Fatalf("A lease with no ttl must never expire, got %v", err)
+	}
+
+	l, err := a.RenewLease(pid, ip1.IP, map[string]string{netlabel.ContainerID: "c1", netlabel.IpamLeaseTTL: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.EndpointID != "ep1" || l.ContainerID != "c1" || l.TTL != time.Millisecond || !l.Renewed.After(ll[0].Renewed) {
+		t.Fatalf("Unexpected renewed lease: %+v", l)
+	}
+	if _, err := a.RenewLease(pid, net.ParseIP("10.42.0.100"), nil); err != ipamapi.ErrLeaseNotFound {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrLeaseNotFound, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err := a.ReleaseExpiredLease(pid, ip1.IP); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReleaseAddress(pid, ip2.IP); err != nil {
+		t.Fatal(err)
+	}
+
+	if ll, err = a.Leases(pid); err != nil || len(ll) != 0 {
+		t.Fatalf("Unexpected leases left (%v): %+v", err, ll)
+	}
+	if ips, err := a.AllocatedAddresses(pid); err != nil || len(ips) != 0 {
+		t.Fatalf("Unexpected addresses left (%v): %v", err, ips)
+	}
+
+	// The leases go away with their pool
+	if _, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReleasePool(pid); err != nil {
+		t.Fatal(err)
+	}
+	if pid, _, _, err = a.RequestPool(localAddressSpace, "10.42.0.0/24", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if ll, err = a.Leases(pid); err != nil || len(ll) != 0 {
+		t.Fatalf("Unexpected leases left (%v): %+v", err, ll)
+	}
+}
+
+func TestSerialAllocation(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := a.RequestPool(localAddressSpace, "10.43.0.0/29", "", map[string]string{netlabel.IpamAllocationPolicy: "random"}, false); err == nil {
+		t.Fatal("Expected failure for an invalid allocation policy")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "10.43.0.0/29", "", map[string]string{netlabel.IpamAllocationPolicy: ipamapi.AllocSerial}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		ip, _, err := a.RequestAddress(pid, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := net.IPv4(10, 43, 0, byte(i)); !ip.IP.Equal(exp) {
+			t.Fatalf("Expected %v, got %v", exp, ip.IP)
+		}
+	}
+
+	// A released address is not handed out again until the search wraps
+	if err := a.ReleaseAddress(pid, net.ParseIP("10.43.0.2")); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"10.43.0.4", "10.43.0.5", "10.43.0.6", "10.43.0.2"} {
+		ip, _, err := a.RequestAddress(pid, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ip.IP.Equal(net.ParseIP(exp)) {
+			t.Fatalf("Expected %s, got %v", exp, ip.IP)
+		}
+	}
+	if _, _, err := a.RequestAddress(pid, nil, nil); err != ipamapi.ErrNoAvailableIPs {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrNoAvailableIPs, err)
+	}
+}
+
+func TestAddressQuarantine(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := a.RequestPool(localAddressSpace, "10.44.0.0/29", "", map[string]string{netlabel.IpamQuarantine: "-1s"}, false); err == nil {
+		t.Fatal("Expected failure for an invalid quarantine")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "10.44.0.0/29", "", map[string]string{netlabel.IpamQuarantine: "50ms"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip1, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReleaseAddress(pid, ip1.IP); err != nil {
+		t.Fatal(err)
+	}
+
+	ip2, _, err := a.RequestAddress(pid, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip2.IP.Equal(ip1.IP) {
+		t.Fatalf("Quarantined address %v was handed out again", ip1.IP)
+	}
+
+	info, err := a.Pool(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Quarantined) != 1 || !info.Quarantined[0].Equal(ip1.IP) ||
+		len(info.Allocated) != 1 || !info.Allocated[0].Equal(ip2.IP) || len(info.Leases) != 1 {
+		t.Fatalf("Unexpected pool info: %+v", info)
+	}
+	if ips, err := a.AllocatedAddresses(pid); err != nil || len(ips) != 1 || !ips[0].Equal(ip2.IP) {
+		t.Fatalf("Unexpected allocated addresses (%v): %v", err, ips)
+	}
+	if _, err := a.RenewLease(pid, ip1.IP, nil); err != ipamapi.ErrLeaseNotFound {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrLeaseNotFound, err)
+	}
+
+	// An explicit request claims the address back
+	ip, _, err := a.RequestAddress(pid, ip1.IP, map[string]string{netlabel.EndpointID: "ep3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.IP.Equal(ip1.IP) {
+		t.Fatalf("Expected %v, got %v", ip1.IP, ip.IP)
+	}
+	if _, _, err := a.RequestAddress(pid, ip1.IP, nil); err != ipamapi.ErrIPAlreadyAllocated {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrIPAlreadyAllocated, err)
+	}
+	ll, err := a.Leases(pid)
+	if err != nil || len(ll) != 2 || ll[0].EndpointID != "ep3" {
+		t.Fatalf("Unexpected leases (%v): %+v", err, ll)
+	}
+
+	// Once the quarantine is over, the address is free again
+	if err := a.ReleaseAddress(pid, ip1.IP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	ip, _, err = a.RequestAddress(pid, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.IP.Equal(ip1.IP) {
+		t.Fatalf("Expected %v, got %v", ip1.IP, ip.IP)
+	}
+	if info, err = a.Pool(pid); err != nil || len(info.Quarantined) != 0 {
+		t.Fatalf("Unexpected quarantined addresses (%v): %v", err, info)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "10.45.0.0/24", "", map[string]string{netlabel.IpamQuarantine: "1h"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spid, _, _, err := a.RequestPool(localAddressSpace, "10.45.0.0/24", "10.45.0.128/25", nil, false)
+	if err != nil {
 		t.Fatal(err)
 	}
+	ip1, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1", netlabel.IpamLeaseTTL: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip2, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.RequestAddress(spid, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReleaseAddress(pid, ip2.IP); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := a.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Import(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{pid, spid} {
+		exp, err := a.Pool(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := b.Pool(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eb, _ := json.Marshal(exp)
+		gb, _ := json.Marshal(got)
+		if string(eb) != string(gb) {
+			t.Fatalf("Imported pool differs:\n%s\n%s", eb, gb)
+		}
+	}
+	if ll, err := b.Leases(pid); err != nil || len(ll) != 1 || ll[0].EndpointID != "ep1" || ll[0].TTL != time.Hour {
+		t.Fatalf("Unexpected imported leases (%v): %+v", err, ll)
+	}
+
+	// The imported addresses are not handed out again
+	ip, _, err := b.RequestAddress(pid, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.IP.Equal(ip1.IP) || ip.IP.Equal(ip2.IP) {
+		t.Fatalf("Imported address %v was handed out again", ip.IP)
+	}
+	if err := b.ReleasePool(spid); err != nil {
+		t.Fatal(err)
+	}
+
+	// Conflicting pools are not imported
+	if err := b.Import(doc); err == nil {
+		t.Fatal("Expected failure importing existing pools")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+	c, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := c.RequestPool(localAddressSpace, "10.45.0.0/16", "", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Import(doc); err == nil {
+		t.Fatal("Expected failure importing overlapping pools")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+	if _, err := c.Pool(spid); err == nil {
+		t.Fatal("Expected no pool to be imported")
+	}
+
+	for _, bad := range []string{
+		`{"version":2,"address_spaces":[]}`,
+		`{"version":1,"address_spaces":[{"name":"LocalDefault","pools":[{"id":"LocalDefault/10.46.0.0/24","data":{"Pool":"10.46.0.0/24"},"bitmask":"AAAA"}]}]}`,
+		`{"version":1,"address_spaces":[{"name":"LocalDefault","pools":[{"id":"LocalDefault/10.46.0.0/24/10.46.0.0/25","data":{"Pool":"10.46.0.0/25","Range":{"Sub":"10.46.0.0/25","Start":0,"End":127}}}]}]}`,
+		`not json`,
+	} {
+		if err := c.Import([]byte(bad)); err == nil {
+			t.Fatalf("Expected failure importing %s", bad)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type importing %s: %v", bad, err)
+		}
+	}
+}
+
+func TestIPv6AddressModes(t *testing.T) {
+	a, err := getAllocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		pool, mode string
+		v6         bool
+	}{
+		{"10.46.0.0/24", ipamapi.IPv6EUI64, false},
+		{"fd00:46::/80", ipamapi.IPv6EUI64, true},
+		{"fd00:46::/64", "random", true},
+	} {
+		if _, _, _, err := a.RequestPool(localAddressSpace, tc.pool, "", map[string]string{netlabel.IpamIPv6AddressMode: tc.mode}, tc.v6); err == nil {
+			t.Fatalf("Expected failure for %+v", tc)
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type for %+v: %v", tc, err)
+		}
+	}
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "fd00:46::/64", "", map[string]string{netlabel.IpamIPv6AddressMode: ipamapi.IPv6EUI64}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := map[string]string{netlabel.EndpointID: "ep1", netlabel.MacAddress: "02:42:ac:11:00:02"}
+	ip, _, err := a.RequestAddress(pid, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "fd00:46::42:acff:fe11:2/64" {
+		t.Fatalf("Unexpected EUI-64 address %s", ip)
+	}
+	// Collisions and endpoints with no mac address fall back on the bitmask
+	for _, exp := range []string{"fd00:46::1/64", "fd00:46::2/64"} {
+		if ip, _, err = a.RequestAddress(pid, nil, opts); err != nil {
+			t.Fatal(err)
+		}
+		if ip.String() != exp {
+			t.Fatalf("Expected %s, got %s", exp, ip)
+		}
+		delete(opts, netlabel.MacAddress)
+	}
+
+	pid, _, _, err = a.RequestPool(localAddressSpace, "fd00:47::/64", "", map[string]string{netlabel.IpamIPv6AddressMode: ipamapi.IPv6StablePrivacy}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip1, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip2, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip1.Contains(ip2.IP) || ip1.IP.Equal(ip2.IP) || ipToUint64(ip1.IP) < 1<<16 || ipToUint64(ip2.IP) < 1<<16 {
+		t.Fatalf("Unexpected stable privacy addresses %s and %s", ip1, ip2)
+	}
+	// A second address of the same endpoint gets the next identifier
+	ip3, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip3.IP.Equal(ip1.IP) || ipToUint64(ip3.IP) < 1<<16 {
+		t.Fatalf("Unexpected stable privacy address %s", ip3)
+	}
+
+	// The address of the endpoint is stable
+	if err := a.ReleaseAddress(pid, ip1.IP); err != nil {
+		t.Fatal(err)
+	}
+	ip, _, err = a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.IP.Equal(ip1.IP) {
+		t.Fatalf("Expected %s, got %s", ip1, ip)
+	}
+
+	// Including across allocators sharing the store
+	b, err := NewAllocator(a.getStore(localAddressSpace), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ReleaseAddress(pid, ip2.IP); err != nil {
+		t.Fatal(err)
+	}
+	ip, _, err = b.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.IP.Equal(ip2.IP) {
+		t.Fatalf("Expected %s, got %s", ip2, ip)
+	}
 }
 
 func TestGetAddressSubPoolEqualPool(t *testing.T) {
@@ -926,7 +1474,7 @@ func assertGetAddress(t *testing.T, subnet string) {
 	start := time.Now()
 	run := 0
 	for err != ipamapi.ErrNoAvailableIPs {
-		_, err = a.getAddress(sub, bm, nil, nil)
+		_, err = a.getAddress(sub, bm, nil, nil, 0)
 		run++
 	}
 	if printTime {
@@ -0,0 +1,374 @@
+package ipam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/bitseq"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/types"
+)
+
+// exportVersion is the version of the documents produced by Export. Import
+// rejects the documents of any other version.
+const exportVersion = 1
+
+// exportDoc is the document Export produces and Import consumes
+type exportDoc struct {
+	Version       int                    `json:"version"`
+	AddressSpaces []exportedAddressSpace `json:"address_spaces"`
+}
+
+type exportedAddressSpace struct {
+	Name  string         `json:"name"`
+	Pools []exportedPool `json:"pools"`
+}
+
+// exportedPool carries the configuration of a pool. The bitmask and the
+// leases are only carried by master pools, which sub pools share them with.
+type exportedPool struct {
+	ID      string          `json:"id"`
+	Data    *PoolData       `json:"data"`
+	Bitmask []byte          `json:"bitmask,omitempty"`
+	Leases  []exportedLease `json:"leases,omitempty"`
+}
+
+type exportedLease struct {
+	ipamapi.Lease
+	QuarantinedUntil *time.Time `json:"quarantined_until,omitempty"`
+}
+
+// importedPool is a validated pool of an imported document
+type importedPool struct {
+	key     SubnetKey
+	data    *PoolData
+	bitmask []byte
+	leases  []exportedLease
+}
+
+// Export returns the address spaces of the allocator, along with their
+// pools, bitmasks and leases, as a versioned JSON document
+func (a *Allocator) Export() ([]byte, error) {
+	a.Lock()
+	names := make([]string, 0, len(a.addrSpaces))
+	for as := range a.addrSpaces {
+		names = append(names, as)
+	}
+	a.Unlock()
+	sort.Strings(names)
+
+	doc := exportDoc{Version: exportVersion, AddressSpaces: make([]exportedAddressSpace, 0, len(names))}
+	for _, as := range names {
+		if err := a.refresh(as); err != nil {
+			return nil, err
+		}
+		aSpace, err := a.getAddrSpace(as)
+		if err != nil {
+			return nil, err
+		}
+
+		aSpace.Lock()
+		keys := make([]SubnetKey, 0, len(aSpace.subnets))
+		pools := make(map[SubnetKey]*PoolData, len(aSpace.subnets))
+		for k, p := range aSpace.subnets {
+			keys = append(keys, k)
+			pools[k] = &PoolData{}
+			p.CopyTo(pools[k])
+		}
+		aSpace.Unlock()
+		sort.Sort(subnetKeys(keys))
+
+		eas := exportedAddressSpace{Name: as, Pools: make([]exportedPool, 0, len(keys))}
+		for _, k := range keys {
+			ep, err := a.exportPool(k, pools[k])
+			if err != nil {
+				return nil, err
+			}
+			eas.Pools = append(eas.Pools, *ep)
+		}
+		doc.AddressSpaces = append(doc.AddressSpaces, eas)
+	}
+
+	return json.Marshal(doc)
+}
+
+func (a *Allocator) exportPool(k SubnetKey, p *PoolData) (*exportedPool, error) {
+	ep := &exportedPool{ID: k.String(), Data: p}
+	if p.Range != nil {
+		return ep, nil
+	}
+
+	bm, err := a.retrieveBitmask(k, p.Pool)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Bitmask, err = bm.ToByteArray(); err != nil {
+		return nil, fmt.Errorf("could not export bitmask of pool %s: %v", k.String(), err)
+	}
+
+	ll, err := a.getLeases(k)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range ll {
+		ep.Leases = append(ep.Leases, exportedLease{Lease: l.Lease, QuarantinedUntil: l.until})
+	}
+	sort.Sort(exportedLeasesByAddress(ep.Leases))
+
+	return ep, nil
+}
+
+// Import adds the address spaces content of a document produced by Export
+// to the allocator. The pools of the document must neither exist nor
+// overlap with the pools of the allocator: nothing is imported otherwise.
+func (a *Allocator) Import(data []byte) error {
+	var doc exportDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return types.BadRequestErrorf("invalid ipam export document: %v", err)
+	}
+	if doc.Version != exportVersion {
+		return types.BadRequestErrorf("unsupported ipam export document version %d", doc.Version)
+	}
+
+	spaces := make(map[string][]*importedPool, len(doc.AddressSpaces))
+	for _, eas := range doc.AddressSpaces {
+		if _, ok := spaces[eas.Name]; ok {
+			return types.BadRequestErrorf("duplicate address space %s in ipam export document", eas.Name)
+		}
+		if a.getStore(eas.Name) == nil {
+			return types.NotFoundErrorf("cannot find address space %s", eas.Name)
+		}
+		pools, err := parseExportedPools(eas)
+		if err != nil {
+			return err
+		}
+		spaces[eas.Name] = pools
+	}
+
+	// Check for conflicts in all the address spaces before importing any
+	for as, pools := range spaces {
+		if err := a.refresh(as); err != nil {
+			return err
+		}
+		aSpace, err := a.getAddrSpace(as)
+		if err != nil {
+			return err
+		}
+		aSpace.Lock()
+		err = aSpace.checkImport(pools)
+		aSpace.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	for as, pools := range spaces {
+		if err := a.importPools(as, pools); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseExportedPools validates the pools of the exported address space
+func parseExportedPools(eas exportedAddressSpace) ([]*importedPool, error) {
+	var (
+		pools   []*importedPool
+		masters = make(map[SubnetKey]*PoolData)
+		seen    = make(map[SubnetKey]bool)
+	)
+
+	for _, ep := range eas.Pools {
+		k := SubnetKey{}
+		if err := k.FromString(ep.ID); err != nil || k.AddressSpace != eas.Name {
+			return nil, types.BadRequestErrorf("invalid pool id %s in address space %s", ep.ID, eas.Name)
+		}
+		if seen[k] {
+			return nil, types.BadRequestErrorf("duplicate pool %s in ipam export document", ep.ID)
+		}
+		seen[k] = true
+		if ep.Data == nil || ep.Data.Pool == nil || (k.ChildSubnet == "") != (ep.Data.Range == nil) {
+			return nil, types.BadRequestErrorf("invalid configuration of pool %s", ep.ID)
+		}
+
+		if ep.Data.Range != nil {
+			pools = append(pools, &importedPool{key: k, data: ep.Data})
+			continue
+		}
+
+		if ep.Data.Pool.String() != k.Subnet {
+			return nil, types.BadRequestErrorf("invalid configuration of pool %s", ep.ID)
+		}
+		if ep.Bitmask == nil {
+			return nil, types.BadRequestErrorf("missing bitmask of pool %s", ep.ID)
+		}
+		h := &bitseq.Handle{}
+		if err := h.FromByteArray(ep.Bitmask); err != nil || h.Bits() != bitmaskSize(ep.Data.Pool) {
+			return nil, types.BadRequestErrorf("invalid bitmask of pool %s", ep.ID)
+		}
+		for _, l := range ep.Leases {
+			if !ep.Data.Pool.Contains(l.Address) {
+				return nil, types.BadRequestErrorf("lease of address %s out of pool %s", l.Address, ep.ID)
+			}
+		}
+		masters[k] = ep.Data
+		pools = append(pools, &importedPool{key: k, data: ep.Data, bitmask: ep.Bitmask, leases: ep.Leases})
+	}
+
+	for _, p := range pools {
+		if p.data.Range == nil {
+			continue
+		}
+		if _, ok := masters[p.data.ParentKey]; !ok || p.data.ParentKey.Subnet != p.key.Subnet {
+			return nil, types.BadRequestErrorf("missing master pool of pool %s", p.key.String())
+		}
+	}
+
+	for k, p := range masters {
+		for ko, o := range masters {
+			if ko != k && (p.Pool.Contains(o.Pool.IP) || o.Pool.Contains(p.Pool.IP)) {
+				return nil, types.BadRequestErrorf("overlapping pools %s and %s in ipam export document", k.String(), ko.String())
+			}
+		}
+	}
+
+	return pools, nil
+}
+
+// checkImport returns an error if the imported pools already exist in the
+// address space or overlap with its pools. Caller must hold the lock.
+func (aSpace *addrSpace) checkImport(pools []*importedPool) error {
+	for _, p := range pools {
+		if _, ok := aSpace.subnets[p.key]; ok {
+			return types.ForbiddenErrorf("pool %s already exists", p.key.String())
+		}
+		if p.data.Range == nil && aSpace.contains(p.key.AddressSpace, p.data.Pool) {
+			return types.ForbiddenErrorf("pool %s overlaps with an existing pool", p.key.String())
+		}
+	}
+	return nil
+}
+
+// importPools writes the bitmasks and the leases of the imported pools to
+// the store, then adds the pools to the address space
+func (a *Allocator) importPools(as string, pools []*importedPool) error {
+	handles := make(map[SubnetKey]*bitseq.Handle)
+	for _, p := range pools {
+		if p.data.Range != nil {
+			continue
+		}
+		h, err := a.importPoolData(p)
+		if err != nil {
+			a.discardImport(handles)
+			return err
+		}
+		handles[p.key] = h
+	}
+
+retry:
+	if err := a.refresh(as); err != nil {
+		a.discardImport(handles)
+		return err
+	}
+
+	aSpace, err := a.getAddrSpace(as)
+	if err != nil {
+		a.discardImport(handles)
+		return err
+	}
+
+	aSpace.Lock()
+	if err := aSpace.checkImport(pools); err != nil {
+		aSpace.Unlock()
+		a.discardImport(handles)
+		return err
+	}
+	for _, p := range pools {
+		d := &PoolData{}
+		p.data.CopyTo(d)
+		aSpace.subnets[p.key] = d
+	}
+	aSpace.Unlock()
+
+	if err := a.writeToStore(aSpace); err != nil {
+		if _, ok := err.(types.RetryError); !ok {
+			a.discardImport(handles)
+			return types.InternalErrorf("import of address space %s failed because of %s", as, err.Error())
+		}
+		goto retry
+	}
+
+	a.Lock()
+	for k, h := range handles {
+		a.addresses[k] = h
+	}
+	a.Unlock()
+
+	return nil
+}
+
+// importPoolData writes the bitmask and the leases of the imported master
+// pool to the store
+func (a *Allocator) importPoolData(p *importedPool) (*bitseq.Handle, error) {
+	store := a.getStore(p.key.AddressSpace)
+	if store == nil {
+		return nil, fmt.Errorf("could not find store for address space %s while importing pool %s", p.key.AddressSpace, p.key.String())
+	}
+
+	h, err := bitseq.NewHandle(dsDataKey, store, p.key.String(), bitmaskSize(p.data.Pool))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.FromByteArray(p.bitmask); err != nil {
+		return nil, err
+	}
+	if err := store.PutObjectAtomic(h); err != nil {
+		return nil, fmt.Errorf("could not write bitmask of pool %s: %v", p.key.String(), err)
+	}
+
+	for _, el := range p.leases {
+		l, err := a.getLease(p.key, el.Address)
+		if err != nil {
+			h.Destroy()
+			return nil, err
+		}
+		if l == nil {
+			l = &lease{pool: p.key.String(), ds: store}
+		}
+		l.Lease = el.Lease
+		l.until = el.QuarantinedUntil
+		if err := store.PutObjectAtomic(l); err != nil {
+			h.Destroy()
+			a.deleteLeases(p.key)
+			return nil, fmt.Errorf("could not write lease of address %s: %v", el.Address, err)
+		}
+	}
+
+	return h, nil
+}
+
+// discardImport removes the imported bitmasks and leases from the store
+func (a *Allocator) discardImport(handles map[SubnetKey]*bitseq.Handle) {
+	for k, h := range handles {
+		if err := a.deleteLeases(k); err != nil {
+			log.Warnf("Failed to remove imported leases of pool %s: %v", k.String(), err)
+		}
+		if err := h.Destroy(); err != nil {
+			log.Warnf("Failed to remove imported bitmask of pool %s: %v", k.String(), err)
+		}
+	}
+}
+
+// exportedLeasesByAddress sorts the exported leases by address
+type exportedLeasesByAddress []exportedLease
+
+func (s exportedLeasesByAddress) Len() int      { return len(s) }
+func (s exportedLeasesByAddress) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s exportedLeasesByAddress) Less(i, j int) bool {
+	return bytes.Compare(s[i].Address.To16(), s[j].Address.To16()) < 0
+}
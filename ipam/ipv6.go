@@ -0,0 +1,99 @@
+package ipam
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+
+	"github.com/docker/libnetwork/bitseq"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+)
+
+const (
+	// Number of stable privacy interface identifiers tried, as for the
+	// IDGEN_RETRIES of RFC 7217, before falling back on the bitmask
+	stableRetries = 3
+	// Size of the stable privacy secret key, 128 bits as RFC 7217 advises
+	stableSecretLen = 16
+	// First of the reserved subnet anycast interface identifiers (RFC 2526)
+	reservedAnycastID = 0xfdffffffffffff80
+)
+
+// newStableSecret returns a random secret key for the stable privacy
+// interface identifiers of a pool
+func newStableSecret() ([]byte, error) {
+	b := make([]byte, stableSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// deriveAddress sets the bit of the address of the IPv6 pool whose
+// interface identifier derives from the endpoint, as the pool address mode
+// sets it. It returns nil when there is no such address or when it is not
+// free, for the caller to fall back on the bitmask allocation.
+func deriveAddress(p *PoolData, bm *bitseq.Handle, opts map[string]string) net.IP {
+	var ids []uint64
+	switch p.V6Mode {
+	case ipamapi.IPv6EUI64:
+		if id, ok := eui64ID(opts[netlabel.MacAddress]); ok {
+			ids = append(ids, id)
+		}
+	case ipamapi.IPv6StablePrivacy:
+		if eid := opts[netlabel.EndpointID]; eid != "" {
+			for counter := 0; counter < stableRetries; counter++ {
+				ids = append(ids, stableID(p.Pool, eid, counter, p.StableSecret))
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if id == 0 || id >= reservedAnycastID || id >= bm.Bits() {
+			continue
+		}
+		if p.Range != nil && (id < p.Range.Start || id > p.Range.End) {
+			continue
+		}
+		if err := bm.Set(id); err == nil {
+			return generateAddress(id, p.Pool)
+		}
+	}
+
+	return nil
+}
+
+// eui64ID returns the modified EUI-64 interface identifier of the mac
+// address (RFC 4291, appendix A)
+func eui64ID(mac string) (uint64, bool) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return 0, false
+	}
+
+	var id []byte
+	switch len(hw) {
+	case 6:
+		id = []byte{hw[0], hw[1], hw[2], 0xff, 0xfe, hw[3], hw[4], hw[5]}
+	case 8:
+		id = []byte(hw)
+	default:
+		return 0, false
+	}
+	id[0] ^= 0x02
+
+	return binary.BigEndian.Uint64(id), true
+}
+
+// stableID returns the stable privacy interface identifier of the endpoint
+// in the pool (RFC 7217), for the given duplicate address counter
+func stableID(pool *net.IPNet, eid string, counter int, secret []byte) uint64 {
+	h := sha256.New()
+	h.Write(pool.IP.To16()[:8])
+	h.Write([]byte(eid))
+	h.Write([]byte{byte(counter)})
+	h.Write(secret)
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8])
+}
@@ -0,0 +1,398 @@
+package ipam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+)
+
+// lease is the store object of the lease of an address allocated in a
+// master pool. Sub pools store their leases under their master pool, the
+// same way they share its bitmask. A released address in quarantine keeps
+// a lease, with the time the quarantine ends.
+type lease struct {
+	ipamapi.Lease
+	pool     string
+	until    *time.Time
+	dbIndex  uint64
+	dbExists bool
+	ds       datastore.DataStore
+	sync.Mutex
+}
+
+// Key provides the Key to be used in KV Store
+func (l *lease) Key() []string {
+	l.Lock()
+	defer l.Unlock()
+	return []string{dsLeaseKey, l.pool, l.Address.String()}
+}
+
+// KeyPrefix returns the immediate parent key that can be used for tree walk
+func (l *lease) KeyPrefix() []string {
+	l.Lock()
+	defer l.Unlock()
+	return []string{dsLeaseKey, l.pool}
+}
+
+// Value marshals the data to be stored in the KV store
+func (l *lease) Value() []byte {
+	l.Lock()
+	defer l.Unlock()
+	b, err := json.Marshal(struct {
+		Pool             string
+		Lease            ipamapi.Lease
+		QuarantinedUntil *time.Time `json:",omitempty"`
+	}{l.pool, l.Lease, l.until})
+	if err != nil {
+		log.Warnf("Failed to marshal ipam lease: %v", err)
+		return nil
+	}
+	return b
+}
+
+// SetValue unmarshalls the data from the KV store.
+func (l *lease) SetValue(value []byte) error {
+	var t struct {
+		Pool             string
+		Lease            ipamapi.Lease
+		QuarantinedUntil *time.Time
+	}
+	if err := json.Unmarshal(value, &t); err != nil {
+		return err
+	}
+	l.Lock()
+	l.pool = t.Pool
+	l.Lease = t.Lease
+	l.until = t.QuarantinedUntil
+	l.Unlock()
+	return nil
+}
+
+// Index returns the latest DB Index as seen by this object
+func (l *lease) Index() uint64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.dbIndex
+}
+
+// SetIndex method allows the datastore to store the latest DB Index into this object
+func (l *lease) SetIndex(index uint64) {
+	l.Lock()
+	l.dbIndex = index
+	l.dbExists = true
+	l.Unlock()
+}
+
+// Exists method is true if this object has been stored in the DB.
+func (l *lease) Exists() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.dbExists
+}
+
+// Skip provides a way for a KV Object to avoid persisting it in the KV Store
+func (l *lease) Skip() bool {
+	return false
+}
+
+// DataScope method returns the storage scope of the datastore
+func (l *lease) DataScope() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.ds.Scope()
+}
+
+// New method returns a lease based on the receiver one
+func (l *lease) New() datastore.KVObject {
+	l.Lock()
+	defer l.Unlock()
+	return &lease{pool: l.pool, ds: l.ds}
+}
+
+// CopyTo deep copies the lease into the passed destination object
+func (l *lease) CopyTo(o datastore.KVObject) error {
+	l.Lock()
+	defer l.Unlock()
+
+	dstL := o.(*lease)
+	dstL.Lease = l.Lease
+	dstL.Address = types.GetIPCopy(l.Address)
+	dstL.pool = l.pool
+	dstL.until = nil
+	if l.until != nil {
+		until := *l.until
+		dstL.until = &until
+	}
+	dstL.ds = l.ds
+	dstL.dbIndex = l.dbIndex
+	dstL.dbExists = l.dbExists
+
+	return nil
+}
+
+// getLease returns the lease of the address allocated in the master pool,
+// or nil if there is none
+func (a *Allocator) getLease(k SubnetKey, ip net.IP) (*lease, error) {
+	store := a.getStore(k.AddressSpace)
+	if store == nil {
+		return nil, fmt.Errorf("could not find store for address space %s while getting lease", k.AddressSpace)
+	}
+
+	l := &lease{pool: k.String(), ds: store}
+	l.Address = ip
+	if err := store.GetObject(datastore.Key(l.Key()...), l); err != nil {
+		if err == datastore.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get lease of address %s from store: %v", ip, err)
+	}
+
+	return l, nil
+}
+
+func (a *Allocator) getLeases(k SubnetKey) ([]*lease, error) {
+	store := a.getStore(k.AddressSpace)
+	if store == nil {
+		return nil, fmt.Errorf("could not find store for address space %s while getting leases", k.AddressSpace)
+	}
+
+	tmp := &lease{pool: k.String(), ds: store}
+	kvol, err := store.List(datastore.Key(tmp.KeyPrefix()...), tmp)
+	if err != nil && err != datastore.ErrKeyNotFound {
+		return nil, fmt.Errorf("could not get leases of pool %s from store: %v", k.String(), err)
+	}
+
+	ll := make([]*lease, 0, len(kvol))
+	for _, kvo := range kvol {
+		ll = append(ll, kvo.(*lease))
+	}
+
+	return ll, nil
+}
+
+// updateLease applies the update to the lease of the address and writes it
+// back, retrying when the lease was modified concurrently. The update
+// returns whether the lease must be deleted instead.
+func (a *Allocator) updateLease(k SubnetKey, ip net.IP, update func(l *lease) (bool, error)) error {
+	for {
+		l, err := a.getLease(k, ip)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return ipamapi.ErrLeaseNotFound
+		}
+
+		remove, err := update(l)
+		if err != nil {
+			return err
+		}
+
+		if remove {
+			err = l.ds.DeleteObjectAtomic(l)
+		} else {
+			err = l.ds.PutObjectAtomic(l)
+		}
+
+		if err != datastore.ErrKeyModified {
+			return err
+		}
+	}
+}
+
+func (a *Allocator) deleteLeases(k SubnetKey) error {
+	ll, err := a.getLeases(k)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range ll {
+		if err := l.ds.DeleteObjectAtomic(l); err != nil && err != datastore.ErrKeyNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newLease builds the lease of an address from the RequestAddress options
+func newLease(poolID string, opts map[string]string) (*ipamapi.Lease, error) {
+	now := time.Now().UTC()
+	l := &ipamapi.Lease{PoolID: poolID, Created: now, Renewed: now}
+	if err := setLeaseOptions(l, opts); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func setLeaseOptions(l *ipamapi.Lease, opts map[string]string) error {
+	if v, ok := opts[netlabel.IpamLeaseTTL]; ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			return types.BadRequestErrorf("invalid lease ttl: %s", v)
+		}
+		l.TTL = ttl
+	}
+	if v, ok := opts[netlabel.EndpointID]; ok {
+		l.EndpointID = v
+	}
+	if v, ok := opts[netlabel.ContainerID]; ok {
+		l.ContainerID = v
+	}
+	return nil
+}
+
+func (a *Allocator) recordLease(k SubnetKey, ip net.IP, il *ipamapi.Lease) error {
+	store := a.getStore(k.AddressSpace)
+	if store == nil {
+		return fmt.Errorf("could not find store for address space %s while recording lease", k.AddressSpace)
+	}
+
+	l := &lease{Lease: *il, pool: k.String(), ds: store}
+	l.Address = types.GetIPCopy(ip)
+
+	// A lease left over by a release which failed to remove it is replaced
+	if old, err := a.getLease(k, ip); err == nil && old != nil {
+		l.dbIndex = old.Index()
+		l.dbExists = true
+	}
+
+	return store.PutObjectAtomic(l)
+}
+
+func (a *Allocator) dropLease(k SubnetKey, ip net.IP) error {
+	err := a.updateLease(k, ip, func(l *lease) (bool, error) {
+		return true, nil
+	})
+	if err == ipamapi.ErrLeaseNotFound {
+		return nil
+	}
+	return err
+}
+
+// masterKey returns the key of the master pool of the passed pool, whose
+// bitmask and lease set the pool uses
+func (a *Allocator) masterKey(poolID string) (SubnetKey, error) {
+	k := SubnetKey{}
+	if err := k.FromString(poolID); err != nil {
+		return k, types.BadRequestErrorf("invalid pool id: %s", poolID)
+	}
+
+	if err := a.refresh(k.AddressSpace); err != nil {
+		return k, err
+	}
+
+	aSpace, err := a.getAddrSpace(k.AddressSpace)
+	if err != nil {
+		return k, err
+	}
+
+	aSpace.Lock()
+	defer aSpace.Unlock()
+	p, ok := aSpace.subnets[k]
+	if !ok {
+		return k, types.NotFoundErrorf("cannot find address pool for poolID:%s", poolID)
+	}
+	for p.Range != nil {
+		k = p.ParentKey
+		if p, ok = aSpace.subnets[k]; !ok {
+			return k, types.InternalErrorf("cannot find master pool of pool %s", poolID)
+		}
+	}
+
+	return k, nil
+}
+
+// Leases returns the leases of the addresses allocated in the pool
+func (a *Allocator) Leases(poolID string) ([]ipamapi.Lease, error) {
+	k, err := a.masterKey(poolID)
+	if err != nil {
+		return nil, err
+	}
+
+	ll, err := a.getLeases(k)
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []ipamapi.Lease
+	for _, l := range ll {
+		if l.PoolID == poolID && l.until == nil {
+			leases = append(leases, l.Lease)
+		}
+	}
+	sort.Sort(leasesByAddress(leases))
+
+	return leases, nil
+}
+
+// RenewLease restarts the ttl of the lease of the address. The owner and
+// ttl options present in opts replace the ones of the lease.
+func (a *Allocator) RenewLease(poolID string, address net.IP, opts map[string]string) (*ipamapi.Lease, error) {
+	k, err := a.masterKey(poolID)
+	if err != nil {
+		return nil, err
+	}
+
+	var renewed ipamapi.Lease
+	err = a.updateLease(k, address, func(l *lease) (bool, error) {
+		if l.PoolID != poolID || l.until != nil {
+			return false, ipamapi.ErrLeaseNotFound
+		}
+		if err := setLeaseOptions(&l.Lease, opts); err != nil {
+			return false, err
+		}
+		l.Renewed = time.Now().UTC()
+		renewed = l.Lease
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &renewed, nil
+}
+
+// ReleaseExpiredLease releases the address if its lease is expired. The
+// lease is removed with an atomic store update before the address is
+// released, so that a concurrent renewal makes the reclaim fail.
+func (a *Allocator) ReleaseExpiredLease(poolID string, address net.IP) error {
+	k, err := a.masterKey(poolID)
+	if err != nil {
+		return err
+	}
+
+	err = a.updateLease(k, address, func(l *lease) (bool, error) {
+		if l.PoolID != poolID || l.until != nil {
+			return false, ipamapi.ErrLeaseNotFound
+		}
+		if !l.Expired(time.Now()) {
+			return false, ipamapi.ErrLeaseNotExpired
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.ReleaseAddress(poolID, address)
+}
+
+// leasesByAddress sorts the leases by address
+type leasesByAddress []ipamapi.Lease
+
+func (l leasesByAddress) Len() int      { return len(l) }
+func (l leasesByAddress) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l leasesByAddress) Less(i, j int) bool {
+	return bytes.Compare(l[i].Address.To16(), l[j].Address.To16()) < 0
+}
@@ -0,0 +1,145 @@
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/docker/libnetwork/bitseq"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/types"
+)
+
+// quarantineAddress keeps the released address out of allocation for the
+// duration, by turning its lease into a quarantine one
+func (a *Allocator) quarantineAddress(k SubnetKey, ip net.IP, poolID string, d time.Duration) error {
+	until := time.Now().UTC().Add(d)
+
+	err := a.updateLease(k, ip, func(l *lease) (bool, error) {
+		l.Lease = ipamapi.Lease{Address: l.Address, PoolID: poolID}
+		l.until = &until
+		return false, nil
+	})
+	if err != ipamapi.ErrLeaseNotFound {
+		return err
+	}
+
+	store := a.getStore(k.AddressSpace)
+	if store == nil {
+		return fmt.Errorf("could not find store for address space %s while quarantining address %s", k.AddressSpace, ip)
+	}
+
+	l := &lease{pool: k.String(), until: &until, ds: store}
+	l.Address = types.GetIPCopy(ip)
+	l.PoolID = poolID
+
+	return store.PutObjectAtomic(l)
+}
+
+// purgeQuarantine releases the addresses of the master pool whose
+// quarantine is over and returns how many were released
+func (a *Allocator) purgeQuarantine(k SubnetKey, bm *bitseq.Handle, pool *net.IPNet) (int, error) {
+	ll, err := a.getLeases(k)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	n := 0
+	for _, l := range ll {
+		if l.until == nil || now.Before(*l.until) {
+			continue
+		}
+		h, err := types.GetHostPartIP(l.Address, pool.Mask)
+		if err != nil {
+			return n, fmt.Errorf("failed to release quarantined address %s: %v", l.Address, err)
+		}
+		if err := l.ds.DeleteObjectAtomic(l); err != nil {
+			// Purged or claimed concurrently
+			if err == datastore.ErrKeyModified || err == datastore.ErrKeyNotFound {
+				continue
+			}
+			return n, err
+		}
+		if err := bm.Unset(ipToUint64(h)); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// claimQuarantined hands out the quarantined address to an explicit
+// request for it, regardless of the quarantine end
+func (a *Allocator) claimQuarantined(k SubnetKey, nw *net.IPNet, ip net.IP) (net.IP, error) {
+	err := a.updateLease(k, ip, func(l *lease) (bool, error) {
+		if l.until == nil {
+			return false, ipamapi.ErrIPAlreadyAllocated
+		}
+		return true, nil
+	})
+	if err == ipamapi.ErrLeaseNotFound {
+		return nil, ipamapi.ErrIPAlreadyAllocated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := types.GetHostPartIP(ip, nw.Mask)
+	if err != nil {
+		return nil, err
+	}
+
+	return generateAddress(ipToUint64(types.GetMinimalIP(h)), types.GetIPNetCopy(nw)), nil
+}
+
+// quarantinedAddresses returns the addresses of the master pool which are
+// in quarantine
+func (a *Allocator) quarantinedAddresses(k SubnetKey) ([]net.IP, error) {
+	ll, err := a.getLeases(k)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, l := range ll {
+		if l.until != nil {
+			ips = append(ips, l.Address)
+		}
+	}
+
+	return ips, nil
+}
+
+// excludeAddresses returns the addresses in ips which are not in excl
+func excludeAddresses(ips, excl []net.IP) []net.IP {
+	if len(excl) == 0 {
+		return ips
+	}
+
+	set := make(map[string]bool, len(excl))
+	for _, ip := range excl {
+		set[ip.String()] = true
+	}
+
+	res := ips[:0]
+	for _, ip := range ips {
+		if !set[ip.String()] {
+			res = append(res, ip)
+		}
+	}
+
+	return res
+}
+
+// ipsByValue sorts the addresses by value
+type ipsByValue []net.IP
+
+func (s ipsByValue) Len() int      { return len(s) }
+func (s ipsByValue) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s ipsByValue) Less(i, j int) bool {
+	return bytes.Compare(s[i].To16(), s[j].To16()) < 0
+}
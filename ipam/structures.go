@@ -6,6 +6,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/ipamapi"
@@ -25,6 +26,25 @@ type PoolData struct {
 	Pool      *net.IPNet
 	Range     *AddressRange `json:",omitempty"`
 	RefCount  int
+	// Serial tells whether the addresses are handed out serially instead
+	// of lowest first
+	Serial bool `json:",omitempty"`
+	// Quarantine is the time a released address is kept out of allocation
+	Quarantine time.Duration `json:",omitempty"`
+	// V6Mode is the way the interface identifiers of the addresses of an
+	// IPv6 pool are derived, if they are
+	V6Mode string `json:",omitempty"`
+	// StableSecret is the secret key the stable privacy interface
+	// identifiers are hashed with
+	StableSecret []byte `json:",omitempty"`
+}
+
+// poolPolicy holds the allocation policy requested for a pool
+type poolPolicy struct {
+	serial     bool
+	quarantine time.Duration
+	v6Mode     string
+	secret     []byte
 }
 
 // addrSpace contains the pool configurations for the address space
@@ -106,8 +126,8 @@ func (s *SubnetKey) FromString(str string) error {
 
 // String returns the string form of the PoolData object
 func (p *PoolData) String() string {
-	return fmt.Sprintf("ParentKey: %s, Pool: %s, Range: %s, RefCount: %d",
-		p.ParentKey.String(), p.Pool.String(), p.Range, p.RefCount)
+	return fmt.Sprintf("ParentKey: %s, Pool: %s, Range: %s, RefCount: %d, Serial: %t, Quarantine: %s, V6Mode: %s",
+		p.ParentKey.String(), p.Pool.String(), p.Range, p.RefCount, p.Serial, p.Quarantine, p.V6Mode)
 }
 
 // MarshalJSON returns the JSON encoding of the PoolData object
@@ -122,6 +142,18 @@ func (p *PoolData) MarshalJSON() ([]byte, error) {
 	if p.Range != nil {
 		m["Range"] = p.Range
 	}
+	if p.Serial {
+		m["Serial"] = p.Serial
+	}
+	if p.Quarantine != 0 {
+		m["Quarantine"] = p.Quarantine
+	}
+	if p.V6Mode != "" {
+		m["V6Mode"] = p.V6Mode
+	}
+	if p.StableSecret != nil {
+		m["StableSecret"] = p.StableSecret
+	}
 	return json.Marshal(m)
 }
 
@@ -130,10 +162,14 @@ func (p *PoolData) UnmarshalJSON(data []byte) error {
 	var (
 		err error
 		t   struct {
-			ParentKey SubnetKey
-			Pool      string
-			Range     *AddressRange `json:",omitempty"`
-			RefCount  int
+			ParentKey    SubnetKey
+			Pool         string
+			Range        *AddressRange `json:",omitempty"`
+			RefCount     int
+			Serial       bool
+			Quarantine   time.Duration
+			V6Mode       string
+			StableSecret []byte
 		}
 	)
 
@@ -144,6 +180,10 @@ func (p *PoolData) UnmarshalJSON(data []byte) error {
 	p.ParentKey = t.ParentKey
 	p.Range = t.Range
 	p.RefCount = t.RefCount
+	p.Serial = t.Serial
+	p.Quarantine = t.Quarantine
+	p.V6Mode = t.V6Mode
+	p.StableSecret = t.StableSecret
 	if t.Pool != "" {
 		if p.Pool, err = types.ParseCIDR(t.Pool); err != nil {
 			return err
@@ -220,6 +260,13 @@ func (p *PoolData) CopyTo(dstP *PoolData) error {
 	}
 
 	dstP.RefCount = p.RefCount
+	dstP.Serial = p.Serial
+	dstP.Quarantine = p.Quarantine
+	dstP.V6Mode = p.V6Mode
+	dstP.StableSecret = nil
+	if p.StableSecret != nil {
+		dstP.StableSecret = append([]byte(nil), p.StableSecret...)
+	}
 	return nil
 }
 
@@ -257,7 +304,7 @@ func (aSpace *addrSpace) New() datastore.KVObject {
 	}
 }
 
-func (aSpace *addrSpace) updatePoolDBOnAdd(k SubnetKey, nw *net.IPNet, ipr *AddressRange) (func() error, error) {
+func (aSpace *addrSpace) updatePoolDBOnAdd(k SubnetKey, nw *net.IPNet, ipr *AddressRange, pol poolPolicy) (func() error, error) {
 	aSpace.Lock()
 	defer aSpace.Unlock()
 
@@ -273,16 +320,20 @@ func (aSpace *addrSpace) updatePoolDBOnAdd(k SubnetKey, nw *net.IPNet, ipr *Addr
 			return nil, ipamapi.ErrPoolOverlap
 		}
 		// This is a new master pool, add it along with corresponding bitmask
-		aSpace.subnets[k] = &PoolData{Pool: nw, RefCount: 1}
+		aSpace.subnets[k] = &PoolData{Pool: nw, RefCount: 1, Serial: pol.serial, Quarantine: pol.quarantine, V6Mode: pol.v6Mode, StableSecret: pol.secret}
 		return func() error { return aSpace.alloc.insertBitMask(k, nw) }, nil
 	}
 
 	// This is a new non-master pool
 	p := &PoolData{
-		ParentKey: SubnetKey{AddressSpace: k.AddressSpace, Subnet: k.Subnet},
-		Pool:      nw,
-		Range:     ipr,
-		RefCount:  1,
+		ParentKey:    SubnetKey{AddressSpace: k.AddressSpace, Subnet: k.Subnet},
+		Pool:         nw,
+		Range:        ipr,
+		RefCount:     1,
+		Serial:       pol.serial,
+		Quarantine:   pol.quarantine,
+		V6Mode:       pol.v6Mode,
+		StableSecret: pol.secret,
 	}
 	aSpace.subnets[k] = p
 
@@ -319,6 +370,9 @@ func (aSpace *addrSpace) updatePoolDBOnRemoval(k SubnetKey) (func() error, error
 					if err != nil {
 						return fmt.Errorf("could not find bitmask in datastore for pool %s removal: %v", k.String(), err)
 					}
+					if err := aSpace.alloc.deleteLeases(k); err != nil {
+						return fmt.Errorf("could not remove leases of pool %s: %v", k.String(), err)
+					}
 					return bm.Destroy()
 				}, nil
 			}
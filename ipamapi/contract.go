@@ -4,6 +4,7 @@ package ipamapi
 import (
 	"errors"
 	"net"
+	"time"
 )
 
 /********************
@@ -15,6 +16,19 @@ const (
 	DefaultIPAM = "default"
 	// PluginEndpointType represents the Endpoint Type used by Plugin system
 	PluginEndpointType = "IpamDriver"
+	// AllocLowest is the allocation policy handing out the lowest free
+	// address of a pool. It is the default one.
+	AllocLowest = "lowest"
+	// AllocSerial is the allocation policy handing out the first free
+	// address following the last one allocated in a pool
+	AllocSerial = "serial"
+	// IPv6EUI64 is the IPv6 address mode deriving the interface identifier
+	// of an address from the endpoint mac address
+	IPv6EUI64 = "eui64"
+	// IPv6StablePrivacy is the IPv6 address mode deriving the interface
+	// identifier of an address from a hash of the endpoint and a secret of
+	// the pool (RFC 7217)
+	IPv6StablePrivacy = "stable-privacy"
 )
 
 // Callback provides a Callback interface for registering an IPAM instance into LibNetwork
@@ -45,6 +59,8 @@ var (
 	ErrIPOutOfRange             = errors.New("Requested address is out of range")
 	ErrPoolOverlap              = errors.New("Pool overlaps with other one on this address space")
 	ErrBadPool                  = errors.New("Address space does not contain specified address pool")
+	ErrLeaseNotFound            = errors.New("Address lease not found")
+	ErrLeaseNotExpired          = errors.New("Address lease has not expired")
 )
 
 /*******************************
@@ -70,3 +86,87 @@ type Ipam interface {
 	// Release the address from the specified pool ID
 	ReleaseAddress(string, net.IP) error
 }
+
+// Inspector is implemented by the ipam drivers which can expose the content
+// of their database. It is optional: the callers must check for it with a
+// type assertion.
+type Inspector interface {
+	// AddressSpaces returns the address spaces of the driver, along with
+	// the pools in use in each of them
+	AddressSpaces() ([]AddressSpaceInfo, error)
+	// Pool returns the description of the pool identified by the passed
+	// id, including the addresses allocated in it
+	Pool(poolID string) (*PoolInfo, error)
+}
+
+// Exporter is implemented by the ipam drivers which can move the content of
+// their database between hosts or stores. It is optional: the callers must
+// check for it with a type assertion.
+type Exporter interface {
+	// Export returns the content of the driver database as a versioned
+	// document
+	Export() ([]byte, error)
+	// Import adds the content of a document produced by Export to the
+	// driver database. It fails with no change if the imported pools
+	// conflict with the pools in use.
+	Import(data []byte) error
+}
+
+// AddressSpaceInfo describes an address space and the pools in use in it
+type AddressSpaceInfo struct {
+	Name  string     `json:"name"`
+	Scope string     `json:"scope"`
+	Pools []PoolInfo `json:"pools"`
+}
+
+// PoolInfo describes a pool in use. Total and Free count the addresses of
+// the bitmask backing the pool, which a sub pool shares with its master
+// pool. Total includes the network and broadcast addresses, which are never
+// handed out. Leases is only set by the drivers implementing Leaser.
+// Quarantined lists the released addresses which cannot be allocated yet:
+// they are neither free nor part of Allocated.
+type PoolInfo struct {
+	ID           string   `json:"id"`
+	AddressSpace string   `json:"address_space"`
+	Pool         string   `json:"pool"`
+	SubPool      string   `json:"sub_pool,omitempty"`
+	RefCount     int      `json:"ref_count"`
+	Total        uint64   `json:"total"`
+	Free         uint64   `json:"free"`
+	Allocated    []net.IP `json:"allocated,omitempty"`
+	Leases       []Lease  `json:"leases,omitempty"`
+	Quarantined  []net.IP `json:"quarantined,omitempty"`
+}
+
+// Leaser is implemented by the ipam drivers which record who owns the
+// addresses they allocate and until when. The owner and the ttl of a lease
+// are passed in the RequestAddress options (netlabel.EndpointID,
+// netlabel.ContainerID, netlabel.IpamLeaseTTL). It is optional: the callers
+// must check for it with a type assertion.
+type Leaser interface {
+	// Leases returns the leases of the addresses allocated in the pool
+	Leases(poolID string) ([]Lease, error)
+	// RenewLease restarts the ttl of the lease of the address. The options
+	// present in opts replace the owner and the ttl of the lease.
+	RenewLease(poolID string, address net.IP, opts map[string]string) (*Lease, error)
+	// ReleaseExpiredLease releases the address only if its lease is still
+	// expired, so that an address renewed in the meantime is not reclaimed
+	ReleaseExpiredLease(poolID string, address net.IP) error
+}
+
+// Lease records the allocation of an address. A lease with no ttl never
+// expires.
+type Lease struct {
+	Address     net.IP        `json:"address"`
+	PoolID      string        `json:"pool_id"`
+	EndpointID  string        `json:"endpoint_id,omitempty"`
+	ContainerID string        `json:"container_id,omitempty"`
+	Created     time.Time     `json:"created"`
+	Renewed     time.Time     `json:"renewed"`
+	TTL         time.Duration `json:"ttl,omitempty"`
+}
+
+// Expired tells whether the lease ttl elapsed at the passed time
+func (l *Lease) Expired(now time.Time) bool {
+	return l.TTL > 0 && now.After(l.Renewed.Add(l.TTL))
+}
@@ -0,0 +1,200 @@
+package dhcp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/types"
+)
+
+var (
+	// Time to wait for a reply before sending a request again
+	exchangeTimeout = 2 * time.Second
+	// Number of times a request is sent before giving up
+	exchangeAttempts = 3
+)
+
+// client exchanges the DHCP messages of all the pools of the driver over a
+// single UDP socket. Replies are dispatched to the pending transactions by
+// transaction id.
+type client struct {
+	addr    string
+	conn    *net.UDPConn
+	pending map[uint32]chan *packet
+	sync.Mutex
+}
+
+func newClient(addr string) *client {
+	return &client{addr: addr, pending: make(map[uint32]chan *packet)}
+}
+
+// open binds the socket of the client, if not already bound
+func (c *client) open() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conn != nil {
+		return nil
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp4", c.addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return types.InternalErrorf("failed to bind dhcp client socket on %s: %v", c.addr, err)
+	}
+	c.conn = conn
+	go c.read(conn)
+
+	return nil
+}
+
+func (c *client) close() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *client) read(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// Closed
+			return
+		}
+		p, err := parsePacket(buf[:n])
+		if err != nil {
+			log.Debugf("Discarding invalid dhcp packet: %v", err)
+			continue
+		}
+		if p.op != bootReply {
+			continue
+		}
+
+		c.Lock()
+		ch, ok := c.pending[p.xid]
+		c.Unlock()
+		if !ok {
+			continue
+		}
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// exchange sends the request to the server until a reply the accept
+// function agrees with is received
+func (c *client) exchange(server *net.UDPAddr, req *packet, accept func(*packet) bool) (*packet, error) {
+	ch := make(chan *packet, 4)
+
+	c.Lock()
+	conn := c.conn
+	c.pending[req.xid] = ch
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.pending, req.xid)
+		c.Unlock()
+	}()
+
+	if conn == nil {
+		return nil, types.InternalErrorf("dhcp client socket is not bound")
+	}
+
+	b := req.marshal()
+	for i := 0; i < exchangeAttempts; i++ {
+		if _, err := conn.WriteToUDP(b, server); err != nil {
+			return nil, types.InternalErrorf("failed to send dhcp request to %s: %v", server, err)
+		}
+
+		timer := time.NewTimer(exchangeTimeout)
+	wait:
+		for {
+			select {
+			case rsp := <-ch:
+				if accept(rsp) {
+					timer.Stop()
+					return rsp, nil
+				}
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+
+	return nil, types.TimeoutErrorf("no reply from dhcp server %s", server)
+}
+
+// send sends the message to the server, which does not reply to it
+func (c *client) send(server *net.UDPAddr, req *packet) error {
+	c.Lock()
+	conn := c.conn
+	c.Unlock()
+
+	if conn == nil {
+		return types.InternalErrorf("dhcp client socket is not bound")
+	}
+	if _, err := conn.WriteToUDP(req.marshal(), server); err != nil {
+		return types.InternalErrorf("failed to send dhcp message to %s: %v", server, err)
+	}
+	return nil
+}
+
+// request builds a message of the client, asking for the parameters the
+// driver needs
+func request(msgType byte, clientID []byte) *packet {
+	p := newPacket(msgType, newXid(), hardwareAddr(clientID))
+	p.flags = flagBroadcast
+	p.options[optClientID] = append([]byte{0}, clientID...)
+	p.options[optParamRequest] = []byte{optSubnetMask, optRouter, optLeaseTime, optRenewalTime, optRebindTime}
+	return p
+}
+
+// reply returns a function accepting the replies of the passed types to
+// the request
+func reply(req *packet, msgTypes ...byte) func(*packet) bool {
+	return func(p *packet) bool {
+		if p.chaddr.String() != req.chaddr.String() {
+			return false
+		}
+		for _, t := range msgTypes {
+			if p.msgType() == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// hardwareAddr derives a locally administered unicast mac address from the
+// client id, so that the servers keying their leases on the hardware
+// address tell the clients apart
+func hardwareAddr(clientID []byte) net.HardwareAddr {
+	sum := sha256.Sum256(clientID)
+	hw := net.HardwareAddr(sum[:6])
+	hw[0] = (hw[0] | 0x02) &^ 0x01
+	return hw
+}
+
+func newXid() uint32 {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return uint32(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint32(b)
+}
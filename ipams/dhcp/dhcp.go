@@ -0,0 +1,457 @@
+// Package dhcp provides an ipam driver handing out the addresses leased by
+// the dhcp server of the segment the network is attached to. The server is
+// reached from the host: the driver acts as the dhcp client of every
+// endpoint, renewing their leases in the background.
+package dhcp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+)
+
+// DriverName is the name the dhcp ipam driver registers with
+const DriverName = "dhcp"
+
+const (
+	localAddressSpace  = "LocalDHCP"
+	globalAddressSpace = "GlobalDHCP"
+	serverPort         = 67
+	clientAddr         = ":68"
+)
+
+// lease is an address leased from the dhcp server of a pool
+type lease struct {
+	ip       net.IP
+	clientID []byte
+	server   net.IP
+	expiry   time.Time
+	renewal  time.Duration
+	timer    *time.Timer
+}
+
+// pool is a subnet served by a dhcp server. The addresses requested with
+// no endpoint, like the gateway, are reserved without a lease.
+type pool struct {
+	addressSpace string
+	nw           *net.IPNet
+	server       *net.UDPAddr
+	refCount     int
+	leases       map[string]*lease
+	reserved     map[string]bool
+}
+
+type allocator struct {
+	client *client
+	pools  map[string]*pool
+	sync.Mutex
+}
+
+// Init registers the dhcp ipam driver with libnetwork
+func Init(ic ipamapi.Callback, l, g interface{}) error {
+	return ic.RegisterIpamDriver(DriverName, newAllocator(clientAddr))
+}
+
+func newAllocator(addr string) *allocator {
+	return &allocator{client: newClient(addr), pools: make(map[string]*pool)}
+}
+
+// GetDefaultAddressSpaces returns the local and global default address spaces
+func (a *allocator) GetDefaultAddressSpaces() (string, string, error) {
+	return localAddressSpace, globalAddressSpace, nil
+}
+
+// RequestPool returns the pool served by the dhcp server set with the
+// netlabel.IpamDhcpServer option, which defaults to the broadcast address
+func (a *allocator) RequestPool(addressSpace, poolStr, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error) {
+	log.Debugf("RequestPool(%s, %s, %s, %v, %t)", addressSpace, poolStr, subPool, options, v6)
+	if v6 {
+		return "", nil, nil, types.NotImplementedErrorf("dhcp ipam driver does not support IPv6 pools")
+	}
+	if poolStr == "" {
+		return "", nil, nil, types.BadRequestErrorf("dhcp ipam driver requires the pool served by the dhcp server")
+	}
+	if subPool != "" {
+		return "", nil, nil, types.BadRequestErrorf("dhcp ipam driver does not support sub pools")
+	}
+	_, nw, err := net.ParseCIDR(poolStr)
+	if err != nil || nw.IP.To4() == nil {
+		return "", nil, nil, types.BadRequestErrorf("invalid dhcp pool: %s", poolStr)
+	}
+	server, err := parseServer(options[netlabel.IpamDhcpServer])
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	id := addressSpace + "/" + nw.String()
+
+	a.Lock()
+	defer a.Unlock()
+
+	if p, ok := a.pools[id]; ok {
+		if p.server.String() != server.String() {
+			return "", nil, nil, types.ForbiddenErrorf("pool %s is already served by dhcp server %s", id, p.server)
+		}
+		p.refCount++
+		return id, types.GetIPNetCopy(p.nw), nil, nil
+	}
+
+	for _, p := range a.pools {
+		if p.addressSpace == addressSpace && (p.nw.Contains(nw.IP) || nw.Contains(p.nw.IP)) {
+			return "", nil, nil, ipamapi.ErrPoolOverlap
+		}
+	}
+
+	if len(a.pools) == 0 {
+		if err := a.client.open(); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	a.pools[id] = &pool{
+		addressSpace: addressSpace,
+		nw:           nw,
+		server:       server,
+		refCount:     1,
+		leases:       make(map[string]*lease),
+		reserved:     make(map[string]bool),
+	}
+
+	return id, types.GetIPNetCopy(nw), nil, nil
+}
+
+// ReleasePool releases the pool, along with the leases of its addresses
+// once it has no more users
+func (a *allocator) ReleasePool(poolID string) error {
+	log.Debugf("ReleasePool(%s)", poolID)
+
+	a.Lock()
+	p, ok := a.pools[poolID]
+	if !ok {
+		a.Unlock()
+		return ipamapi.ErrBadPool
+	}
+	p.refCount--
+	if p.refCount > 0 {
+		a.Unlock()
+		return nil
+	}
+	delete(a.pools, poolID)
+	leases := make([]*lease, 0, len(p.leases))
+	for _, l := range p.leases {
+		if l.timer != nil {
+			l.timer.Stop()
+		}
+		leases = append(leases, l)
+	}
+	a.Unlock()
+
+	for _, l := range leases {
+		if err := a.release(p, l); err != nil {
+			log.Warnf("Failed to release the lease of address %s of pool %s: %v", l.ip, poolID, err)
+		}
+	}
+
+	a.Lock()
+	if len(a.pools) == 0 {
+		a.client.close()
+	}
+	a.Unlock()
+
+	return nil
+}
+
+// RequestAddress leases an address from the dhcp server of the pool, for a
+// client id derived from the netlabel.EndpointID option. Without endpoint,
+// the address is reserved with no lease: the preferred address if any, the
+// router advertised by the server otherwise.
+func (a *allocator) RequestAddress(poolID string, prefAddress net.IP, opts map[string]string) (*net.IPNet, map[string]string, error) {
+	log.Debugf("RequestAddress(%s, %v, %v)", poolID, prefAddress, opts)
+
+	a.Lock()
+	p, ok := a.pools[poolID]
+	a.Unlock()
+	if !ok {
+		return nil, nil, ipamapi.ErrBadPool
+	}
+	if prefAddress != nil && !p.nw.Contains(prefAddress) {
+		return nil, nil, ipamapi.ErrIPOutOfRange
+	}
+
+	var (
+		ip  net.IP
+		err error
+	)
+	if eid := opts[netlabel.EndpointID]; eid != "" {
+		ip, err = a.leaseAddress(poolID, p, eid, prefAddress)
+	} else {
+		ip, err = a.reserveAddress(poolID, p, prefAddress)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &net.IPNet{IP: ip, Mask: p.nw.Mask}, nil, nil
+}
+
+// ReleaseAddress releases the address, sending a DHCPRELEASE for its lease
+func (a *allocator) ReleaseAddress(poolID string, address net.IP) error {
+	log.Debugf("ReleaseAddress(%s, %v)", poolID, address)
+
+	a.Lock()
+	p, ok := a.pools[poolID]
+	if !ok {
+		a.Unlock()
+		return ipamapi.ErrBadPool
+	}
+	key := address.String()
+	if p.reserved[key] {
+		delete(p.reserved, key)
+		a.Unlock()
+		return nil
+	}
+	l, ok := p.leases[key]
+	if !ok {
+		a.Unlock()
+		return nil
+	}
+	delete(p.leases, key)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	a.Unlock()
+
+	return a.release(p, l)
+}
+
+func (a *allocator) reserveAddress(poolID string, p *pool, ip net.IP) (net.IP, error) {
+	if ip == nil {
+		var err error
+		if ip, err = a.router(p); err != nil {
+			return nil, err
+		}
+	}
+	ip = ip.To4()
+
+	a.Lock()
+	defer a.Unlock()
+
+	if _, ok := a.pools[poolID]; !ok {
+		return nil, ipamapi.ErrBadPool
+	}
+	key := ip.String()
+	if _, ok := p.leases[key]; ok || p.reserved[key] {
+		return nil, ipamapi.ErrIPAlreadyAllocated
+	}
+	p.reserved[key] = true
+
+	return ip, nil
+}
+
+func (a *allocator) leaseAddress(poolID string, p *pool, eid string, prefAddress net.IP) (net.IP, error) {
+	a.Lock()
+	clientID := p.clientID(eid)
+	a.Unlock()
+
+	l, err := a.acquire(p, clientID, prefAddress)
+	if err != nil {
+		return nil, err
+	}
+	if !p.nw.Contains(l.ip) {
+		a.release(p, l)
+		return nil, types.InternalErrorf("dhcp server %s leased address %s out of pool %s", p.server, l.ip, p.nw)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	key := l.ip.String()
+	if _, ok := a.pools[poolID]; !ok {
+		go a.release(p, l)
+		return nil, ipamapi.ErrBadPool
+	}
+	if _, ok := p.leases[key]; ok || p.reserved[key] {
+		go a.release(p, l)
+		return nil, ipamapi.ErrIPAlreadyAllocated
+	}
+	p.leases[key] = l
+	a.scheduleRenewal(poolID, p, l, l.renewal)
+
+	return l.ip, nil
+}
+
+// acquire runs the DHCPDISCOVER/DHCPREQUEST exchange for the client id
+func (a *allocator) acquire(p *pool, clientID []byte, prefAddress net.IP) (*lease, error) {
+	disc := request(msgDiscover, clientID)
+	if prefAddress != nil {
+		disc.setIP(optRequestedIP, prefAddress)
+	}
+	offer, err := a.client.exchange(p.server, disc, reply(disc, msgOffer))
+	if err != nil {
+		return nil, err
+	}
+	if prefAddress != nil && !offer.yiaddr.Equal(prefAddress) {
+		return nil, ipamapi.ErrIPAlreadyAllocated
+	}
+	serverID := offer.ip(optServerID)
+	if serverID == nil {
+		return nil, types.InternalErrorf("dhcp server %s sent an offer without server identifier", p.server)
+	}
+
+	req := request(msgRequest, clientID)
+	req.xid = disc.xid
+	req.setIP(optRequestedIP, offer.yiaddr)
+	req.setIP(optServerID, serverID)
+	ack, err := a.client.exchange(p.server, req, reply(req, msgAck, msgNak))
+	if err != nil {
+		return nil, err
+	}
+	if ack.msgType() == msgNak {
+		if prefAddress != nil {
+			return nil, ipamapi.ErrIPAlreadyAllocated
+		}
+		return nil, types.ForbiddenErrorf("dhcp server %s refused to lease address %s: %s", p.server, offer.yiaddr, ack.options[optMessage])
+	}
+
+	l := &lease{ip: ack.yiaddr.To4(), clientID: clientID, server: serverID}
+	l.update(ack)
+
+	return l, nil
+}
+
+// renew extends the lease before it expires. The request is sent the way
+// a client rebooting does, with the address in the requested address option
+// rather than in ciaddr: the server would otherwise send its reply to the
+// address of the endpoint instead of the host.
+func (a *allocator) renew(poolID string, p *pool, l *lease) {
+	key := l.ip.String()
+
+	a.Lock()
+	if p.leases[key] != l {
+		a.Unlock()
+		return
+	}
+	a.Unlock()
+
+	req := request(msgRequest, l.clientID)
+	req.setIP(optRequestedIP, l.ip)
+	rsp, err := a.client.exchange(p.server, req, reply(req, msgAck, msgNak))
+
+	a.Lock()
+	defer a.Unlock()
+
+	if p.leases[key] != l {
+		// Released in the meantime
+		return
+	}
+
+	switch {
+	case err != nil:
+		retry := l.expiry.Sub(time.Now()) / 2
+		if retry < exchangeTimeout {
+			log.Warnf("Lease of address %s of pool %s from dhcp server %s expired: %v", l.ip, poolID, p.server, err)
+			return
+		}
+		log.Warnf("Failed to renew the lease of address %s of pool %s, retrying in %s: %v", l.ip, poolID, retry, err)
+		a.scheduleRenewal(poolID, p, l, retry)
+	case rsp.msgType() == msgNak:
+		log.Warnf("Dhcp server %s refused to renew the lease of address %s of pool %s: %s", p.server, l.ip, poolID, rsp.options[optMessage])
+	default:
+		l.update(rsp)
+		a.scheduleRenewal(poolID, p, l, l.renewal)
+	}
+}
+
+// scheduleRenewal arms the renewal of the lease. Caller must hold the lock.
+func (a *allocator) scheduleRenewal(poolID string, p *pool, l *lease, after time.Duration) {
+	if after <= 0 {
+		// Infinite lease
+		return
+	}
+	l.timer = time.AfterFunc(after, func() { a.renew(poolID, p, l) })
+}
+
+// release sends a DHCPRELEASE for the lease
+func (a *allocator) release(p *pool, l *lease) error {
+	req := request(msgRelease, l.clientID)
+	req.flags = 0
+	req.ciaddr = l.ip
+	delete(req.options, optParamRequest)
+	if l.server != nil {
+		req.setIP(optServerID, l.server)
+	}
+	return a.client.send(p.server, req)
+}
+
+// router returns the router the dhcp server of the pool advertises
+func (a *allocator) router(p *pool) (net.IP, error) {
+	disc := request(msgDiscover, []byte("gateway/"+p.nw.String()))
+	offer, err := a.client.exchange(p.server, disc, reply(disc, msgOffer))
+	if err != nil {
+		return nil, err
+	}
+
+	ip := offer.ip(optRouter)
+	if ip == nil {
+		return nil, types.NotFoundErrorf("dhcp server %s does not advertise a router for pool %s", p.server, p.nw)
+	}
+	if !p.nw.Contains(ip) {
+		return nil, types.ForbiddenErrorf("router %s advertised by dhcp server %s is out of pool %s", ip, p.server, p.nw)
+	}
+
+	return ip, nil
+}
+
+// clientID returns the client id the endpoint leases an address with: its
+// id, suffixed for the addresses after the first one. Caller must hold the
+// lock.
+func (p *pool) clientID(eid string) []byte {
+	inUse := make(map[string]bool, len(p.leases))
+	for _, l := range p.leases {
+		inUse[string(l.clientID)] = true
+	}
+
+	id := eid
+	for n := 1; inUse[id]; n++ {
+		id = fmt.Sprintf("%s/%d", eid, n)
+	}
+	return []byte(id)
+}
+
+// update applies the lease time of the server reply. A reply with no
+// lease time grants an infinite lease.
+func (l *lease) update(rsp *packet) {
+	d := rsp.duration(optLeaseTime)
+	l.expiry = time.Now().Add(d)
+	l.renewal = rsp.duration(optRenewalTime)
+	if l.renewal == 0 || l.renewal >= d {
+		l.renewal = d / 2
+	}
+}
+
+// parseServer returns the address of the dhcp server, whose port defaults
+// to the dhcp server port
+func parseServer(s string) (*net.UDPAddr, error) {
+	if s == "" {
+		return &net.UDPAddr{IP: net.IPv4bcast, Port: serverPort}, nil
+	}
+
+	host, port := s, strconv.Itoa(serverPort)
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		host, port = h, p
+	}
+	ip := net.ParseIP(host)
+	n, err := strconv.Atoi(port)
+	if ip == nil || ip.To4() == nil || err != nil || n <= 0 || n > 65535 {
+		return nil, types.BadRequestErrorf("invalid dhcp server address: %s", s)
+	}
+
+	return &net.UDPAddr{IP: ip.To4(), Port: n}, nil
+}
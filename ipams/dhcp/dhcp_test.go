@@ -0,0 +1,338 @@
+package dhcp
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	_ "github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+)
+
+// testServer is a minimal dhcp server leasing the addresses of a /24 to
+// the hardware addresses of the clients
+type testServer struct {
+	conn      *net.UDPConn
+	id        net.IP
+	router    net.IP
+	leaseTime time.Duration
+	bindings  map[string]string // address to hardware address
+	renewals  int
+	releases  int
+	sync.Mutex
+}
+
+func newTestServer(t *testing.T, leaseTime time.Duration) *testServer {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		conn:      conn,
+		id:        net.IPv4(192, 168, 50, 2).To4(),
+		router:    net.IPv4(192, 168, 50, 1).To4(),
+		leaseTime: leaseTime,
+		bindings:  make(map[string]string),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *testServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req, err := parsePacket(buf[:n])
+		if err != nil || req.op != bootRequest {
+			continue
+		}
+		if rsp := s.handle(req); rsp != nil {
+			s.conn.WriteToUDP(rsp.marshal(), from)
+		}
+	}
+}
+
+func (s *testServer) handle(req *packet) *packet {
+	s.Lock()
+	defer s.Unlock()
+
+	hw := req.chaddr.String()
+	switch req.msgType() {
+	case msgDiscover:
+		ip := req.ip(optRequestedIP)
+		if ip == nil || !s.free(ip, hw) {
+			ip = nil
+			for i := 10; i < 255 && ip == nil; i++ {
+				if c := net.IPv4(192, 168, 50, byte(i)); s.free(c, hw) {
+					ip = c
+				}
+			}
+		}
+		if ip == nil {
+			return nil
+		}
+		return s.reply(req, msgOffer, ip)
+	case msgRequest:
+		ip := req.ip(optRequestedIP)
+		if ip == nil || !s.free(ip, hw) {
+			return s.reply(req, msgNak, nil)
+		}
+		if req.ip(optServerID) == nil {
+			s.renewals++
+		}
+		s.bindings[ip.String()] = hw
+		return s.reply(req, msgAck, ip)
+	case msgRelease:
+		if s.bindings[req.ciaddr.String()] == hw {
+			delete(s.bindings, req.ciaddr.String())
+			s.releases++
+		}
+	}
+	return nil
+}
+
+func (s *testServer) free(ip net.IP, hw string) bool {
+	b, ok := s.bindings[ip.String()]
+	return !ok || b == hw
+}
+
+func (s *testServer) reply(req *packet, msgType byte, ip net.IP) *packet {
+	rsp := newPacket(msgType, req.xid, req.chaddr)
+	rsp.op = bootReply
+	rsp.setIP(optServerID, s.id)
+	if ip != nil {
+		rsp.yiaddr = ip
+		rsp.setIP(optSubnetMask, net.IP(net.CIDRMask(24, 32)))
+		rsp.setIP(optRouter, s.router)
+		rsp.setDuration(optLeaseTime, s.leaseTime)
+	}
+	return rsp
+}
+
+func (s *testServer) counts() (int, int, int) {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.bindings), s.renewals, s.releases
+}
+
+func getTestAllocator(t *testing.T, s *testServer) (*allocator, string) {
+	a := newAllocator("127.0.0.1:0")
+	pid, nw, _, err := a.RequestPool(localAddressSpace, "192.168.50.0/24", "", map[string]string{netlabel.IpamDhcpServer: s.addr()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nw.String() != "192.168.50.0/24" {
+		t.Fatalf("Unexpected pool %s", nw)
+	}
+	return a, pid
+}
+
+func TestPacketMarshal(t *testing.T) {
+	p := request(msgRequest, []byte("ep1"))
+	p.ciaddr = net.IPv4(10, 0, 0, 3)
+	p.setIP(optServerID, net.IPv4(10, 0, 0, 1))
+	p.options[optMessage] = make([]byte, 300)
+
+	q, err := parsePacket(p.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.op != bootRequest || q.xid != p.xid || q.flags != flagBroadcast || q.msgType() != msgRequest ||
+		!q.ciaddr.Equal(p.ciaddr) || q.chaddr.String() != p.chaddr.String() ||
+		!q.ip(optServerID).Equal(net.IPv4(10, 0, 0, 1)) || len(q.options[optMessage]) != 300 ||
+		string(q.options[optClientID]) != "\x00ep1" {
+		t.Fatalf("Unexpected packet after marshal: %+v", q)
+	}
+
+	if _, err := parsePacket(p.marshal()[:headerLen]); err == nil {
+		t.Fatal("Expected failure parsing a truncated packet")
+	}
+	if hw := hardwareAddr([]byte("ep1")); hw[0]&0x03 != 0x02 || hw.String() == hardwareAddr([]byte("ep2")).String() {
+		t.Fatalf("Unexpected hardware address %s", hw)
+	}
+}
+
+func TestRequestPool(t *testing.T) {
+	a := newAllocator("127.0.0.1:0")
+
+	for _, tc := range []struct {
+		pool, subPool, server string
+		v6                    bool
+	}{
+		{"", "", "", false},
+		{"192.168.50.0/24", "192.168.50.0/25", "", false},
+		{"192.168.50.0/24", "", "server", false},
+		{"192.168.50.0/24", "", "127.0.0.1:70000", false},
+		{"fd00::/64", "", "", true},
+	} {
+		if _, _, _, err := a.RequestPool(localAddressSpace, tc.pool, tc.subPool, map[string]string{netlabel.IpamDhcpServer: tc.server}, tc.v6); err == nil {
+			t.Fatalf("Expected failure for %+v", tc)
+		}
+	}
+
+	pid, _, _, err := a.RequestPool(localAddressSpace, "192.168.50.0/24", "", map[string]string{netlabel.IpamDhcpServer: "127.0.0.1:6767"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid2, _, _, err := a.RequestPool(localAddressSpace, "192.168.50.0/24", "", map[string]string{netlabel.IpamDhcpServer: "127.0.0.1:6767"}, false); err != nil || pid2 != pid {
+		t.Fatalf("Unexpected pool %s: %v", pid2, err)
+	}
+	if _, _, _, err := a.RequestPool(localAddressSpace, "192.168.50.0/24", "", nil, false); err == nil {
+		t.Fatal("Expected failure requesting the pool from another server")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+	if _, _, _, err := a.RequestPool(localAddressSpace, "192.168.0.0/16", "", nil, false); err != ipamapi.ErrPoolOverlap {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrPoolOverlap, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := a.ReleasePool(pid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.ReleasePool(pid); err != ipamapi.ErrBadPool {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrBadPool, err)
+	}
+}
+
+func TestRequestReleaseAddress(t *testing.T) {
+	s := newTestServer(t, time.Hour)
+	defer s.conn.Close()
+	a, pid := getTestAllocator(t, s)
+
+	ip1, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip2, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip1.String() != "192.168.50.10/24" || ip2.String() != "192.168.50.11/24" {
+		t.Fatalf("Unexpected addresses %s and %s", ip1, ip2)
+	}
+
+	// An endpoint with several addresses leases each with its own client id
+	ip3, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip3.IP.Equal(ip1.IP) {
+		t.Fatalf("Address %s leased twice", ip3)
+	}
+
+	pref := net.IPv4(192, 168, 50, 100)
+	ip, _, err := a.RequestAddress(pid, pref, map[string]string{netlabel.EndpointID: "ep3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.IP.Equal(pref) {
+		t.Fatalf("Expected %s, got %s", pref, ip)
+	}
+	if _, _, err := a.RequestAddress(pid, pref, map[string]string{netlabel.EndpointID: "ep4"}); err != ipamapi.ErrIPAlreadyAllocated {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrIPAlreadyAllocated, err)
+	}
+	if _, _, err := a.RequestAddress(pid, net.IPv4(10, 0, 0, 1), nil); err != ipamapi.ErrIPOutOfRange {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrIPOutOfRange, err)
+	}
+
+	if err := a.ReleaseAddress(pid, ip1.IP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		bound, _, releases := s.counts()
+		return bound == 3 && releases == 1
+	})
+
+	if err := a.ReleasePool(pid); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		bound, _, releases := s.counts()
+		return bound == 0 && releases == 4
+	})
+}
+
+func TestGatewayAddress(t *testing.T) {
+	s := newTestServer(t, time.Hour)
+	defer s.conn.Close()
+	a, pid := getTestAllocator(t, s)
+	defer a.ReleasePool(pid)
+
+	gw, _, err := a.RequestAddress(pid, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gw.String() != "192.168.50.1/24" {
+		t.Fatalf("Unexpected gateway %s", gw)
+	}
+	if _, _, err := a.RequestAddress(pid, gw.IP, nil); err != ipamapi.ErrIPAlreadyAllocated {
+		t.Fatalf("Expected %v, got %v", ipamapi.ErrIPAlreadyAllocated, err)
+	}
+
+	aux := net.IPv4(192, 168, 50, 5)
+	if _, _, err := a.RequestAddress(pid, aux, nil); err != nil {
+		t.Fatal(err)
+	}
+	if bound, _, _ := s.counts(); bound != 0 {
+		t.Fatalf("Expected no lease for reserved addresses, got %d", bound)
+	}
+	if err := a.ReleaseAddress(pid, aux); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.RequestAddress(pid, aux, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	s := newTestServer(t, 2*time.Second)
+	defer s.conn.Close()
+	a, pid := getTestAllocator(t, s)
+	defer a.ReleasePool(pid)
+
+	if _, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		_, renewals, _ := s.counts()
+		return renewals >= 2
+	})
+}
+
+func TestServerTimeout(t *testing.T) {
+	defer func(d time.Duration) { exchangeTimeout = d }(exchangeTimeout)
+	exchangeTimeout = 50 * time.Millisecond
+
+	s := newTestServer(t, time.Hour)
+	a, pid := getTestAllocator(t, s)
+	defer a.ReleasePool(pid)
+	s.conn.Close()
+
+	if _, _, err := a.RequestAddress(pid, nil, map[string]string{netlabel.EndpointID: "ep1"}); err == nil {
+		t.Fatal("Expected failure with no dhcp server")
+	} else if _, ok := err.(types.TimeoutError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the dhcp server")
+}
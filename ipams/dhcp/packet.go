@@ -0,0 +1,196 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// BOOTP operations
+const (
+	bootRequest = 1
+	bootReply   = 2
+)
+
+// DHCP message types (RFC 2132, 9.6)
+const (
+	msgDiscover = 1
+	msgOffer    = 2
+	msgRequest  = 3
+	msgDecline  = 4
+	msgAck      = 5
+	msgNak      = 6
+	msgRelease  = 7
+)
+
+// DHCP options (RFC 2132)
+const (
+	optPad          = 0
+	optSubnetMask   = 1
+	optRouter       = 3
+	optRequestedIP  = 50
+	optLeaseTime    = 51
+	optMessageType  = 53
+	optServerID     = 54
+	optParamRequest = 55
+	optMessage      = 56
+	optRenewalTime  = 58
+	optRebindTime   = 59
+	optClientID     = 61
+	optEnd          = 255
+)
+
+const (
+	headerLen     = 236
+	flagBroadcast = 0x8000
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// packet is a DHCPv4 message (RFC 2131)
+type packet struct {
+	op      byte
+	xid     uint32
+	flags   uint16
+	ciaddr  net.IP
+	yiaddr  net.IP
+	siaddr  net.IP
+	giaddr  net.IP
+	chaddr  net.HardwareAddr
+	options map[byte][]byte
+}
+
+func newPacket(msgType byte, xid uint32, chaddr net.HardwareAddr) *packet {
+	return &packet{
+		op:      bootRequest,
+		xid:     xid,
+		chaddr:  chaddr,
+		options: map[byte][]byte{optMessageType: {msgType}},
+	}
+}
+
+func (p *packet) msgType() byte {
+	if v := p.options[optMessageType]; len(v) == 1 {
+		return v[0]
+	}
+	return 0
+}
+
+func (p *packet) setIP(opt byte, ip net.IP) {
+	p.options[opt] = []byte(ip.To4())
+}
+
+// ip returns the address carried by the option, or nil if there is none
+func (p *packet) ip(opt byte) net.IP {
+	if v := p.options[opt]; len(v) >= net.IPv4len {
+		return net.IP(v[:net.IPv4len])
+	}
+	return nil
+}
+
+// duration returns the time carried by the option, in seconds on the wire
+func (p *packet) duration(opt byte) time.Duration {
+	if v := p.options[opt]; len(v) == 4 {
+		return time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+	}
+	return 0
+}
+
+func (p *packet) setDuration(opt byte, d time.Duration) {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, uint32(d/time.Second))
+	p.options[opt] = v
+}
+
+// mask returns the subnet mask of the reply, if any
+func (p *packet) mask() net.IPMask {
+	if v := p.options[optSubnetMask]; len(v) == 4 {
+		return net.IPMask(v)
+	}
+	return nil
+}
+
+func (p *packet) marshal() []byte {
+	b := make([]byte, headerLen, headerLen+len(magicCookie)+64)
+	b[0] = p.op
+	b[1] = 1 // ethernet
+	b[2] = byte(len(p.chaddr))
+	binary.BigEndian.PutUint32(b[4:], p.xid)
+	binary.BigEndian.PutUint16(b[10:], p.flags)
+	for i, ip := range []net.IP{p.ciaddr, p.yiaddr, p.siaddr, p.giaddr} {
+		if ip != nil {
+			copy(b[12+4*i:], ip.To4())
+		}
+	}
+	copy(b[28:44], p.chaddr)
+
+	b = append(b, magicCookie...)
+	// Message type first, as some servers expect
+	b = append(b, optMessageType, 1, p.msgType())
+	codes := make([]int, 0, len(p.options))
+	for o := range p.options {
+		if o != optMessageType {
+			codes = append(codes, int(o))
+		}
+	}
+	sort.Ints(codes)
+	for _, c := range codes {
+		o, v := byte(c), p.options[byte(c)]
+		for len(v) > 255 {
+			b = append(b, o, 255)
+			b = append(b, v[:255]...)
+			v = v[255:]
+		}
+		b = append(b, o, byte(len(v)))
+		b = append(b, v...)
+	}
+	return append(b, optEnd)
+}
+
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < headerLen+len(magicCookie) {
+		return nil, fmt.Errorf("dhcp packet too short: %d bytes", len(b))
+	}
+	if string(b[headerLen:headerLen+len(magicCookie)]) != string(magicCookie) {
+		return nil, fmt.Errorf("invalid dhcp magic cookie")
+	}
+	hlen := int(b[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid dhcp hardware address length %d", hlen)
+	}
+
+	p := &packet{
+		op:      b[0],
+		xid:     binary.BigEndian.Uint32(b[4:]),
+		flags:   binary.BigEndian.Uint16(b[10:]),
+		ciaddr:  net.IP(append([]byte(nil), b[12:16]...)),
+		yiaddr:  net.IP(append([]byte(nil), b[16:20]...)),
+		siaddr:  net.IP(append([]byte(nil), b[20:24]...)),
+		giaddr:  net.IP(append([]byte(nil), b[24:28]...)),
+		chaddr:  net.HardwareAddr(append([]byte(nil), b[28:28+hlen]...)),
+		options: make(map[byte][]byte),
+	}
+
+	opts := b[headerLen+len(magicCookie):]
+	for i := 0; i < len(opts); {
+		o := opts[i]
+		if o == optEnd {
+			break
+		}
+		if o == optPad {
+			i++
+			continue
+		}
+		if i+1 >= len(opts) || i+2+int(opts[i+1]) > len(opts) {
+			return nil, fmt.Errorf("truncated dhcp option %d", o)
+		}
+		l := int(opts[i+1])
+		// Long options are split in consecutive instances (RFC 3396)
+		p.options[o] = append(p.options[o], opts[i+2:i+2+l]...)
+		i += 2 + l
+	}
+
+	return p, nil
+}
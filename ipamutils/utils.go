@@ -1,7 +1,13 @@
 // Package ipamutils provides utililty functions for ipam management
 package ipamutils
 
-import "net"
+import (
+	"fmt"
+	"net"
+)
+
+// maxSplitNetworks is the maximum number of networks SplitNetwork returns
+const maxSplitNetworks = 1 << 16
 
 var (
 	// PredefinedBroadNetworks contains a list of 31 IPv4 private networks with host size 16 and 12
@@ -40,3 +46,41 @@ func initGranularPredefinedNetworks() []*net.IPNet {
 	}
 	return pl
 }
+
+// SplitNetwork returns the networks with prefix length size the base
+// network is made of, in address order
+func SplitNetwork(base *net.IPNet, size int) ([]*net.IPNet, error) {
+	ones, bits := base.Mask.Size()
+	if size < ones || size > bits {
+		return nil, fmt.Errorf("invalid size %d to split network %s", size, base)
+	}
+	if size-ones > 16 || 1<<uint(size-ones) > maxSplitNetworks {
+		return nil, fmt.Errorf("network %s is too large to be split in /%d networks", base, size)
+	}
+
+	ip := base.IP.Mask(base.Mask)
+	if len(ip) != bits/8 {
+		// An IPv4 address in 16 bytes form
+		ip = ip.To4()
+	}
+	mask := net.CIDRMask(size, bits)
+
+	n := 1 << uint(size-ones)
+	pl := make([]*net.IPNet, 0, n)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			// Move on to the next network, adding one at bit size-1
+			inc := byte(1 << uint(7-(size-1)%8))
+			for b := (size - 1) / 8; b >= 0; b-- {
+				ip[b] += inc
+				if ip[b] != 0 {
+					break
+				}
+				inc = 1
+			}
+		}
+		pl = append(pl, &net.IPNet{IP: append(net.IP(nil), ip...), Mask: mask})
+	}
+
+	return pl, nil
+}
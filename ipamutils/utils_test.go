@@ -24,6 +24,46 @@ func TestGranularPredefined(t *testing.T) {
 
 }
 
+func TestSplitNetwork(t *testing.T) {
+	for _, c := range []struct {
+		base string
+		size int
+		exp  []string
+	}{
+		{"100.64.0.0/16", 18, []string{"100.64.0.0/18", "100.64.64.0/18", "100.64.128.0/18", "100.64.192.0/18"}},
+		{"100.64.1.0/24", 24, []string{"100.64.1.0/24"}},
+		{"10.0.255.0/23", 24, []string{"10.0.254.0/24", "10.0.255.0/24"}},
+		{"fd00:0:0:fffe::/63", 64, []string{"fd00:0:0:fffe::/64", "fd00:0:0:ffff::/64"}},
+	} {
+		_, base, err := net.ParseCIDR(c.base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pl, err := SplitNetwork(base, c.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pl) != len(c.exp) {
+			t.Fatalf("Unexpected networks for %s split in /%d: %v", c.base, c.size, pl)
+		}
+		for i, nw := range pl {
+			if nw.String() != c.exp[i] {
+				t.Fatalf("Unexpected networks for %s split in /%d: %v", c.base, c.size, pl)
+			}
+		}
+	}
+
+	_, base, _ := net.ParseCIDR("10.0.0.0/8")
+	if pl, err := SplitNetwork(base, 24); err != nil || len(pl) != 1<<16 {
+		t.Fatalf("Unexpected result splitting %s (%v): %d networks", base, err, len(pl))
+	}
+	for _, size := range []int{7, 25, 33} {
+		if _, err := SplitNetwork(base, size); err == nil {
+			t.Fatalf("Expected failure splitting %s in /%d networks", base, size)
+		}
+	}
+}
+
 func TestNetworkRequest(t *testing.T) {
 	defer testutils.SetupTestOSContext(t)()
 	_, exp, err := net.ParseCIDR("172.17.0.0/16")
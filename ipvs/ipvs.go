@@ -0,0 +1,64 @@
+// Package ipvs provides a minimal netlink client to program IP Virtual
+// Server services and their real servers in the current network namespace.
+package ipvs
+
+import "net"
+
+const (
+	// RoundRobin distributes jobs equally amongst the available
+	// real servers.
+	RoundRobin = "rr"
+
+	// WeightedRoundRobin distributes jobs amongst the real servers
+	// in proportion to their weight.
+	WeightedRoundRobin = "wrr"
+
+	// LeastConnection assigns more jobs to real servers with
+	// fewer active jobs.
+	LeastConnection = "lc"
+
+	// DestinationHashing assigns jobs to servers through looking
+	// up a statically assigned hash table by their destination IP
+	// addresses.
+	DestinationHashing = "dh"
+
+	// SourceHashing assigns jobs to servers through looking up
+	// a statically assigned hash table by their source IP
+	// addresses.
+	SourceHashing = "sh"
+)
+
+const (
+	// ConnectionFlagMasq is used for masquerade (NAT) forwarding.
+	ConnectionFlagMasq = 0x0
+
+	// ConnectionFlagLocalNode is used when the real server is local.
+	ConnectionFlagLocalNode = 0x1
+
+	// ConnectionFlagTunnel is used for IP-IP tunnel forwarding.
+	ConnectionFlagTunnel = 0x2
+
+	// ConnectionFlagDirectRoute is used for direct routing forwarding.
+	ConnectionFlagDirectRoute = 0x3
+)
+
+// Service defines an IPVS virtual service.
+type Service struct {
+	Address       net.IP
+	Protocol      uint16
+	Port          uint16
+	SchedName     string
+	Flags         uint32
+	Timeout       uint32
+	Netmask       uint32
+	AddressFamily uint16
+}
+
+// Destination defines an IPVS real server of a virtual service.
+type Destination struct {
+	Address         net.IP
+	Port            uint16
+	Weight          int
+	ConnectionFlags uint32
+	AddressFamily   uint16
+}
@@ -0,0 +1,27 @@
+package ipvs
+
+// NewService creates a new virtual service.
+func NewService(s *Service) error {
+	return doCmd(s, nil, ipvsCmdNewService)
+}
+
+// DelService deletes the virtual service along with its real servers.
+func DelService(s *Service) error {
+	return doCmd(s, nil, ipvsCmdDelService)
+}
+
+// NewDestination adds a real server to the virtual service.
+func NewDestination(s *Service, d *Destination) error {
+	return doCmd(s, d, ipvsCmdNewDest)
+}
+
+// UpdateDestination updates the weight and forwarding method of the
+// real server of the virtual service.
+func UpdateDestination(s *Service, d *Destination) error {
+	return doCmd(s, d, ipvsCmdSetDest)
+}
+
+// DelDestination removes the real server from the virtual service.
+func DelDestination(s *Service, d *Destination) error {
+	return doCmd(s, d, ipvsCmdDelDest)
+}
@@ -0,0 +1,134 @@
+package ipvs
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/docker/libnetwork/testutils"
+	"github.com/vishvananda/netlink/nl"
+)
+
+func parseNested(t *testing.T, a *nl.RtAttr) map[int][]byte {
+	b := a.Serialize()
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 1 {
+		t.Fatalf("Expected a single nested attribute, got %d", len(attrs))
+	}
+
+	children, err := nl.ParseRouteAttr(attrs[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := make(map[int][]byte)
+	for _, c := range children {
+		m[int(c.Attr.Type)] = c.Value
+	}
+	return m
+}
+
+func TestFillService(t *testing.T) {
+	s := &Service{
+		Address:   net.ParseIP("10.1.1.1"),
+		Protocol:  syscall.IPPROTO_TCP,
+		Port:      80,
+		SchedName: RoundRobin,
+		Netmask:   0xFFFFFFFF,
+	}
+
+	attrs := parseNested(t, fillService(s))
+
+	if af := nl.NativeEndian().Uint16(attrs[ipvsSvcAttrAddressFamily]); af != syscall.AF_INET {
+		t.Fatalf("Unexpected address family %d", af)
+	}
+	if ip := net.IP(attrs[ipvsSvcAttrAddress]); !ip.Equal(s.Address) {
+		t.Fatalf("Unexpected address %v", ip)
+	}
+	if p := attrs[ipvsSvcAttrPort]; p[0] != 0 || p[1] != 80 {
+		t.Fatalf("Port must be in network byte order, got %v", p)
+	}
+	if sched := nl.BytesToString(attrs[ipvsSvcAttrSchedName]); sched != RoundRobin {
+		t.Fatalf("Unexpected scheduler %q", sched)
+	}
+	for _, a := range []int{ipvsSvcAttrFlags, ipvsSvcAttrTimeout, ipvsSvcAttrNetmask} {
+		if _, ok := attrs[a]; !ok {
+			t.Fatalf("Missing mandatory service attribute %d", a)
+		}
+	}
+
+	s.Address = net.ParseIP("fd00::1")
+	attrs = parseNested(t, fillService(s))
+	if af := nl.NativeEndian().Uint16(attrs[ipvsSvcAttrAddressFamily]); af != syscall.AF_INET6 {
+		t.Fatalf("Unexpected address family %d", af)
+	}
+	if len(attrs[ipvsSvcAttrAddress]) != net.IPv6len {
+		t.Fatalf("Unexpected address length %d", len(attrs[ipvsSvcAttrAddress]))
+	}
+}
+
+func TestFillDestination(t *testing.T) {
+	d := &Destination{
+		Address:         net.ParseIP("172.17.0.2"),
+		Port:            8080,
+		Weight:          3,
+		ConnectionFlags: ConnectionFlagDirectRoute,
+	}
+
+	attrs := parseNested(t, fillDestination(d))
+
+	if ip := net.IP(attrs[ipvsDestAttrAddress]); !ip.Equal(d.Address) {
+		t.Fatalf("Unexpected address %v", ip)
+	}
+	if m := nl.NativeEndian().Uint32(attrs[ipvsDestAttrForwardingMethod]); m != ConnectionFlagDirectRoute {
+		t.Fatalf("Unexpected forwarding method %d", m)
+	}
+	if w := nl.NativeEndian().Uint32(attrs[ipvsDestAttrWeight]); w != 3 {
+		t.Fatalf("Unexpected weight %d", w)
+	}
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	if _, err := os.Stat("/proc/net/ip_vs"); err != nil {
+		t.Skip("ip_vs kernel module is not loaded")
+	}
+	defer testutils.SetupTestOSContext(t)()
+
+	s := &Service{
+		Address:   net.ParseIP("10.1.1.1"),
+		Protocol:  syscall.IPPROTO_TCP,
+		Port:      80,
+		SchedName: RoundRobin,
+		Netmask:   0xFFFFFFFF,
+	}
+	d := &Destination{
+		Address:         net.ParseIP("172.17.0.2"),
+		Port:            80,
+		Weight:          1,
+		ConnectionFlags: ConnectionFlagMasq,
+	}
+
+	if err := NewService(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDestination(s, d); err != nil {
+		t.Fatal(err)
+	}
+	d.Weight = 2
+	if err := UpdateDestination(s, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := DelDestination(s, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := DelService(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := DelService(s); err == nil {
+		t.Fatal("Expected failure deleting a non existing service")
+	}
+}
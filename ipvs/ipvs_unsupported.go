@@ -0,0 +1,32 @@
+// +build !linux
+
+package ipvs
+
+import "errors"
+
+var errNotSupported = errors.New("ipvs is not supported on this platform")
+
+// NewService creates a new virtual service.
+func NewService(s *Service) error {
+	return errNotSupported
+}
+
+// DelService deletes the virtual service.
+func DelService(s *Service) error {
+	return errNotSupported
+}
+
+// NewDestination adds a real server to the virtual service.
+func NewDestination(s *Service, d *Destination) error {
+	return errNotSupported
+}
+
+// UpdateDestination updates the real server of the virtual service.
+func UpdateDestination(s *Service, d *Destination) error {
+	return errNotSupported
+}
+
+// DelDestination removes the real server from the virtual service.
+func DelDestination(s *Service, d *Destination) error {
+	return errNotSupported
+}
@@ -0,0 +1,150 @@
+package ipvs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+var (
+	ipvsFamily     int
+	ipvsFamilyLock sync.Mutex
+)
+
+type genlMsgHdr struct {
+	cmd      uint8
+	version  uint8
+	reserved uint16
+}
+
+const sizeofGenlMsgHdr = 4
+
+func (hdr *genlMsgHdr) Serialize() []byte {
+	return (*(*[sizeofGenlMsgHdr]byte)(unsafe.Pointer(hdr)))[:]
+}
+
+func (hdr *genlMsgHdr) Len() int {
+	return sizeofGenlMsgHdr
+}
+
+func newGenlRequest(familyID int, cmd uint8) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(familyID, syscall.NLM_F_ACK)
+	req.AddData(&genlMsgHdr{cmd: cmd, version: ipvsGenlVersion})
+	return req
+}
+
+// getIPVSFamily resolves, and caches, the generic netlink family id
+// the kernel assigned to IPVS. Family ids are global to the host.
+func getIPVSFamily() (int, error) {
+	ipvsFamilyLock.Lock()
+	defer ipvsFamilyLock.Unlock()
+
+	if ipvsFamily != 0 {
+		return ipvsFamily, nil
+	}
+
+	req := newGenlRequest(genlCtrlID, genlCtrlCmdGetFamily)
+	req.AddData(nl.NewRtAttr(genlCtrlAttrFamilyName, nl.ZeroTerminated(ipvsGenlName)))
+
+	msgs, err := req.Execute(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve the %s generic netlink family (is the ip_vs module loaded?): %v", ipvsGenlName, err)
+	}
+
+	for _, m := range msgs {
+		if len(m) < sizeofGenlMsgHdr {
+			continue
+		}
+		attrs, err := nl.ParseRouteAttr(m[sizeofGenlMsgHdr:])
+		if err != nil {
+			return 0, err
+		}
+		for _, a := range attrs {
+			if int(a.Attr.Type) == genlCtrlAttrFamilyID && len(a.Value) >= 2 {
+				ipvsFamily = int(nl.NativeEndian().Uint16(a.Value[0:2]))
+				return ipvsFamily, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no family id found for the %s generic netlink family", ipvsGenlName)
+}
+
+func rawIPData(ip net.IP) []byte {
+	family := nl.GetIPFamily(ip)
+	if family == nl.FAMILY_V4 {
+		return ip.To4()
+	}
+	return ip.To16()
+}
+
+func portData(port uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, port)
+	return b
+}
+
+func addressFamily(ip net.IP, af uint16) uint16 {
+	if af != 0 {
+		return af
+	}
+	if ip.To4() != nil {
+		return syscall.AF_INET
+	}
+	return syscall.AF_INET6
+}
+
+func fillService(s *Service) *nl.RtAttr {
+	cmdAttr := nl.NewRtAttr(ipvsCmdAttrService, nil)
+
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrAddressFamily, nl.Uint16Attr(addressFamily(s.Address, s.AddressFamily)))
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrProtocol, nl.Uint16Attr(s.Protocol))
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrAddress, rawIPData(s.Address))
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrPort, portData(s.Port))
+
+	// The kernel parses the full service definition only if all the
+	// following attributes are present, even for delete requests.
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrSchedName, nl.ZeroTerminated(s.SchedName))
+	flags := make([]byte, 8)
+	nl.NativeEndian().PutUint32(flags[0:4], s.Flags)
+	nl.NativeEndian().PutUint32(flags[4:8], 0xFFFFFFFF)
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrFlags, flags)
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrTimeout, nl.Uint32Attr(s.Timeout))
+	nl.NewRtAttrChild(cmdAttr, ipvsSvcAttrNetmask, nl.Uint32Attr(s.Netmask))
+
+	return cmdAttr
+}
+
+func fillDestination(d *Destination) *nl.RtAttr {
+	cmdAttr := nl.NewRtAttr(ipvsCmdAttrDest, nil)
+
+	nl.NewRtAttrChild(cmdAttr, ipvsDestAttrAddress, rawIPData(d.Address))
+	nl.NewRtAttrChild(cmdAttr, ipvsDestAttrPort, portData(d.Port))
+	nl.NewRtAttrChild(cmdAttr, ipvsDestAttrForwardingMethod, nl.Uint32Attr(d.ConnectionFlags&0x7))
+	nl.NewRtAttrChild(cmdAttr, ipvsDestAttrWeight, nl.Uint32Attr(uint32(d.Weight)))
+	nl.NewRtAttrChild(cmdAttr, ipvsDestAttrUpperThreshold, nl.Uint32Attr(0))
+	nl.NewRtAttrChild(cmdAttr, ipvsDestAttrLowerThreshold, nl.Uint32Attr(0))
+
+	return cmdAttr
+}
+
+func doCmd(s *Service, d *Destination, cmd uint8) error {
+	family, err := getIPVSFamily()
+	if err != nil {
+		return err
+	}
+
+	req := newGenlRequest(family, cmd)
+	req.AddData(fillService(s))
+	if d != nil {
+		req.AddData(fillDestination(d))
+	}
+
+	_, err = req.Execute(syscall.NETLINK_GENERIC, 0)
+	return err
+}
@@ -3,9 +3,12 @@ package libnetwork
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"strings"
 	"testing"
 
+	"github.com/docker/libnetwork/config"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/ipamapi"
@@ -186,10 +189,13 @@ func TestEndpointMarshalling(t *testing.T) {
 	nw6.IP = ip
 
 	e := &endpoint{
-		name:      "Bau",
-		id:        "efghijklmno",
-		sandboxID: "ambarabaciccicocco",
-		anonymous: true,
+		name:        "Bau",
+		id:          "efghijklmno",
+		sandboxID:   "ambarabaciccicocco",
+		anonymous:   true,
+		aliases:     []string{"web", "www"},
+		joinAliases: []string{"api"},
+		generic:     map[string]interface{}{netlabel.MacAddress: net.HardwareAddr{2, 66, 10, 0, 1, 23}},
 		iface: &endpointInterface{
 			mac: []byte{11, 12, 13, 14, 15, 16},
 			addr: &net.IPNet{
@@ -201,6 +207,11 @@ func TestEndpointMarshalling(t *testing.T) {
 			dstPrefix: "eth",
 			v4PoolID:  "poolpool",
 			v6PoolID:  "poolv6",
+			vlanID:    100,
+			extraAddrs: []*extraAddress{
+				{addr: &net.IPNet{IP: net.IP{10, 0, 1, 24}, Mask: net.IPMask{255, 255, 255, 0}}, poolID: "poolpool"},
+				{addr: &net.IPNet{IP: net.IP{10, 0, 2, 2}, Mask: net.IPMask{255, 255, 255, 0}}, poolID: "poolpool2"},
+			},
 		},
 	}
 
@@ -215,9 +226,312 @@ func TestEndpointMarshalling(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if e.name != ee.name || e.id != ee.id || e.sandboxID != ee.sandboxID || !compareEndpointInterface(e.iface, ee.iface) || e.anonymous != ee.anonymous {
+	if e.name != ee.name || e.id != ee.id || e.sandboxID != ee.sandboxID || !compareEndpointInterface(e.iface, ee.iface) || e.anonymous != ee.anonymous || !sameAliases(e, ee) {
 		t.Fatalf("JSON marsh/unmarsh failed.\nOriginal:\n%#v\nDecoded:\n%#v\nOriginal iface: %#v\nDecodediface:\n%#v", e, ee, e.iface, ee.iface)
 	}
+	if mac, ok := ee.generic[netlabel.MacAddress].(net.HardwareAddr); !ok || mac.String() != "02:42:0a:00:01:17" {
+		t.Fatalf("Unexpected mac address in decoded generic data: %#v", ee.generic[netlabel.MacAddress])
+	}
+
+	// The state of an endpoint stored before extra addresses were added must still decode
+	e.iface.extraAddrs = nil
+	b, err = json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "extraAddrs") {
+		t.Fatalf("Unexpected extra addresses in the marshalled endpoint: %s", b)
+	}
+
+	ee = &endpoint{}
+	if err := json.Unmarshal(b, ee); err != nil {
+		t.Fatal(err)
+	}
+	if !compareEndpointInterface(e.iface, ee.iface) {
+		t.Fatalf("Unexpected decoded interface of old endpoint state.\nOriginal:\n%#v\nDecoded:\n%#v", e.iface, ee.iface)
+	}
+}
+
+func TestEndpointAliases(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nw, err := c.NewNetwork("bridge", "aliasnet",
+		NetworkOptionGeneric(map[string]interface{}{
+			netlabel.GenericData: map[string]string{"BridgeName": "aliasnet"},
+		}),
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{&IpamConf{PreferredPool: "10.37.0.0/24"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := nw.(*network)
+
+	ep1, err := nw.CreateEndpoint("web1", CreateOptionAlias("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep2, err := nw.CreateEndpoint("web2", CreateOptionAlias("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep3, err := nw.CreateEndpoint("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip1 := ep1.Info().Iface().Address().IP
+	ip2 := ep2.Info().Iface().Address().IP
+
+	var sbs []Sandbox
+	for i, ep := range []Endpoint{ep1, ep2, ep3} {
+		sb, err := c.NewSandbox(fmt.Sprintf("alias-container-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sb.Delete()
+		sbs = append(sbs, sb)
+
+		var opts []EndpointOption
+		if ep == ep2 {
+			opts = append(opts, JoinOptionAlias("api"))
+		}
+		if err := ep.Join(sb, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkName := func(name string, expected ...net.IP) {
+		ips, _ := n.resolveName(name, 4)
+		if len(ips) != len(expected) {
+			t.Fatalf("Expected %v for %s, got %v", expected, name, ips)
+		}
+		for _, e := range expected {
+			found := false
+			for _, ip := range ips {
+				found = found || ip.Equal(e)
+			}
+			if !found {
+				t.Fatalf("Expected %v for %s, got %v", expected, name, ips)
+			}
+		}
+	}
+	hostsPath := sbs[2].(*sandbox).config.hostsPath
+	checkHosts := func(rec string, expected bool) {
+		content, err := ioutil.ReadFile(hostsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(content), rec) != expected {
+			t.Fatalf("Unexpected presence %t of %q in hosts file:\n%s", !expected, rec, content)
+		}
+	}
+
+	checkName("web", ip1, ip2)
+	checkName("web.aliasnet", ip1, ip2)
+	checkName("web1", ip1)
+	checkName("api", ip2)
+	checkHosts(ip1.String()+"\tweb\n", true)
+	checkHosts(ip2.String()+"\tweb\n", true)
+	checkHosts(ip2.String()+"\tapi.aliasnet\n", true)
+
+	sep, err := n.getEndpointFromStore(ep2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameAliases(sep, &endpoint{name: "web2", aliases: []string{"web"}, joinAliases: []string{"api"}}) {
+		t.Fatalf("Unexpected aliases in store: %v", sep.svcNames())
+	}
+
+	// The join aliases go away on leave, the create ones stay
+	if err := ep2.Leave(sbs[1]); err != nil {
+		t.Fatal(err)
+	}
+	checkName("api")
+	checkName("web", ip1, ip2)
+	checkHosts(ip2.String()+"\tapi\n", false)
+	checkHosts(ip2.String()+"\tweb\n", true)
+
+	if err := ep2.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	checkName("web", ip1)
+	checkHosts(ip2.String()+"\tweb\n", false)
+	checkHosts(ip1.String()+"\tweb\n", true)
+}
+
+func TestEndpointAdditionalAddresses(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nw, err := c.NewNetwork("bridge", "addrnet",
+		NetworkOptionGeneric(map[string]interface{}{
+			netlabel.GenericData: map[string]string{"BridgeName": "addrnet", netlabel.EnableIPv6: "true"},
+		}),
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "",
+			[]*IpamConf{&IpamConf{PreferredPool: "10.38.0.0/24"}},
+			[]*IpamConf{&IpamConf{PreferredPool: "fd38::/64"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nw.Delete()
+
+	for _, opt := range []EndpointOption{
+		CreateOptionAdditionalAddress("", "10.38"),
+		CreateOptionAdditionalAddress("10.38.2.0/24", ""),
+		CreateOptionAdditionalAddress("fd38::/64", "10.38.0.100"),
+	} {
+		if _, err := nw.CreateEndpoint("bad", opt); err == nil {
+			t.Fatal("Expected failure on an invalid additional address request")
+		} else if _, ok := err.(types.BadRequestError); !ok {
+			t.Fatalf("Unexpected error type: %v", err)
+		}
+	}
+
+	ep, err := nw.CreateEndpoint("multi",
+		CreateOptionAdditionalAddress("", "10.38.0.100"),
+		CreateOptionAdditionalAddress("fd38::/64", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := ep.Info().Iface().AdditionalAddresses()
+	if len(addrs) != 2 || addrs[0].String() != "10.38.0.100/24" || !addrs[1].IP.Mask(addrs[1].Mask).Equal(net.ParseIP("fd38::")) {
+		t.Fatalf("Unexpected additional addresses: %v", addrs)
+	}
+
+	// The addresses are allocated to the endpoint
+	if _, err := nw.CreateEndpoint("dup", CreateOptionAdditionalAddress("", "10.38.0.100")); err == nil {
+		t.Fatal("Expected failure on an address already allocated")
+	}
+
+	sb, err := c.NewSandbox("addr-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Delete()
+
+	if err := ep.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range sb.(*sandbox).osSbox.Info().Interfaces() {
+		if !types.CompareIPNet(i.Address(), ep.Info().Iface().Address()) || len(i.AdditionalAddresses()) != 2 {
+			t.Fatalf("Unexpected sandbox interface addresses: %v %v", i.Address(), i.AdditionalAddresses())
+		}
+	}
+
+	if err := ep.Leave(sb); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The addresses are released with the endpoint
+	ep, err = nw.CreateEndpoint("again", CreateOptionAdditionalAddress("", "10.38.0.100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndpointStaticAddress(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nw, err := c.NewNetwork("bridge", "staticnet",
+		NetworkOptionGeneric(map[string]interface{}{
+			netlabel.GenericData: map[string]string{"BridgeName": "staticnet", netlabel.EnableIPv6: "true"},
+		}),
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "",
+			[]*IpamConf{&IpamConf{PreferredPool: "10.39.0.0/24"}},
+			[]*IpamConf{&IpamConf{PreferredPool: "fd39::/64"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nw.Delete()
+
+	mac := net.HardwareAddr{0x02, 0x42, 0x0a, 0x27, 0x00, 0x20}
+	ep, err := nw.CreateEndpoint("static",
+		CreateOptionIpam(net.ParseIP("10.39.0.20"), net.ParseIP("fd39::20")),
+		CreateOptionMacAddress(mac))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Delete()
+
+	iface := ep.Info().Iface()
+	if iface.Address().String() != "10.39.0.20/24" || iface.AddressIPv6().String() != "fd39::20/64" || iface.MacAddress().String() != mac.String() {
+		t.Fatalf("Unexpected endpoint interface: %s %s %s", iface.Address(), iface.AddressIPv6(), iface.MacAddress())
+	}
+
+	for _, tc := range []struct {
+		ipV4, ipV6 string
+		forbidden  bool
+	}{
+		{ipV4: "10.39.0.20", forbidden: true},
+		{ipV6: "fd39::20", forbidden: true},
+		{ipV4: "10.39.1.20"},
+		{ipV6: "fd40::20"},
+	} {
+		_, err := nw.CreateEndpoint("conflict", CreateOptionIpam(net.ParseIP(tc.ipV4), net.ParseIP(tc.ipV6)))
+		if err == nil {
+			t.Fatalf("Expected failure on the request of %s %s", tc.ipV4, tc.ipV6)
+		}
+		if _, ok := err.(types.ForbiddenError); ok != tc.forbidden {
+			t.Fatalf("Unexpected error on the request of %s %s: %v", tc.ipV4, tc.ipV6, err)
+		}
+		if _, ok := err.(types.BadRequestError); ok == tc.forbidden {
+			t.Fatalf("Unexpected error on the request of %s %s: %v", tc.ipV4, tc.ipV6, err)
+		}
+	}
+
+	// The failed requests did not leak any address
+	d, err := c.(*controller).getIpamDriver(ipamapi.DefaultIPAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := unwrapIpam(d).(addressLister).AllocatedAddresses(nw.(*network).ipamV4Info[0].PoolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.ParseIP("10.39.0.1")) || !ips[1].Equal(net.ParseIP("10.39.0.20")) {
+		t.Fatalf("Unexpected allocated addresses: %v", ips)
+	}
 }
 
 func compareEndpointInterface(a, b *endpointInterface) bool {
@@ -227,8 +541,20 @@ func compareEndpointInterface(a, b *endpointInterface) bool {
 	if a == nil || b == nil {
 		return false
 	}
-	return a.srcName == b.srcName && a.dstPrefix == b.dstPrefix && a.v4PoolID == b.v4PoolID && a.v6PoolID == b.v6PoolID &&
-		types.CompareIPNet(a.addr, b.addr) && types.CompareIPNet(a.addrv6, b.addrv6)
+	return a.srcName == b.srcName && a.dstPrefix == b.dstPrefix && a.v4PoolID == b.v4PoolID && a.v6PoolID == b.v6PoolID && a.vlanID == b.vlanID &&
+		types.CompareIPNet(a.addr, b.addr) && types.CompareIPNet(a.addrv6, b.addrv6) && compareExtraAddresses(a.extraAddrs, b.extraAddrs)
+}
+
+func compareExtraAddresses(a, b []*extraAddress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].poolID != b[i].poolID || !types.CompareIPNet(a[i].addr, b[i].addr) {
+			return false
+		}
+	}
+	return true
 }
 
 func compareIpamConfList(listA, listB []*IpamConf) bool {
@@ -393,6 +719,37 @@ func TestIpamReleaseOnNetDriverFailures(t *testing.T) {
 	}
 }
 
+func TestDefaultAddressPools(t *testing.T) {
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := append(cfgOptions, config.OptionDefaultAddressPools("LocalDefault", []*config.AddressPoolCfg{{Base: "100.64.0.0", Size: 24}}))
+	if _, err := New(bad...); err == nil {
+		t.Fatal("Expected failure for an invalid default address pool base")
+	}
+
+	cfgOptions = append(cfgOptions, config.OptionDefaultAddressPools("LocalDefault", []*config.AddressPoolCfg{{Base: "100.64.0.0/23", Size: 24}}))
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	ipam, err := c.(*controller).getIpamDriver(ipamapi.DefaultIPAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, nw, _, err := ipam.RequestPool("LocalDefault", "", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nw.String() != "100.64.0.0/24" {
+		t.Fatalf("Unexpected default pool %s", nw)
+	}
+}
+
 var badDriverName = "bad network driver"
 
 type badDriver struct {
@@ -408,6 +765,9 @@ func (b *badDriver) CreateNetwork(nid string, options map[string]interface{}, ip
 func (b *badDriver) DeleteNetwork(nid string) error {
 	return nil
 }
+func (b *badDriver) UpdateNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	return nil
+}
 func (b *badDriver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, options map[string]interface{}) error {
 	return fmt.Errorf("I will not create any endpoint")
 }
@@ -423,6 +783,9 @@ func (b *badDriver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinIn
 func (b *badDriver) Leave(nid, eid string) error {
 	return nil
 }
+func (b *badDriver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	return nil
+}
 func (b *badDriver) DiscoverNew(dType driverapi.DiscoveryType, data interface{}) error {
 	return nil
 }
@@ -432,3 +795,166 @@ func (b *badDriver) DiscoverDelete(dType driverapi.DiscoveryType, data interface
 func (b *badDriver) Type() string {
 	return badDriverName
 }
+
+func TestNetworkAutoExpand(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	cc := c.(*controller)
+	ed := &expandDriver{}
+	cc.drivers[expandDriverName] = &driverData{driver: &meteredDriver{Driver: ed, name: expandDriverName}, capability: driverapi.Capability{DataScope: datastore.LocalScope, PoolExpansion: true}}
+
+	// A /30 pool has a single address left once the gateway is allocated
+	ipamOpt := NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{&IpamConf{PreferredPool: "10.46.0.0/30"}}, nil)
+
+	if _, err := c.NewNetwork(expandDriverName, "expnet", ipamOpt, NetworkOptionLabels(map[string]string{netlabel.IpamAutoExpand: "sometimes"})); err == nil {
+		t.Fatal("Expected failure for an invalid auto expand label")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	// The bridge driver cannot take additional pools
+	if _, err := c.NewNetwork("bridge", "brexpnet", ipamOpt, NetworkOptionLabels(map[string]string{netlabel.IpamAutoExpand: "true"})); err == nil {
+		t.Fatal("Expected failure for the auto expand label on a bridge network")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	n, err := c.NewNetwork(expandDriverName, "expnet", ipamOpt, NetworkOptionLabels(map[string]string{netlabel.IpamAutoExpand: "true"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Delete()
+
+	ep1, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep1.Delete()
+	if ip := ep1.Info().Iface().Address().IP; !ip.Equal(net.ParseIP("10.46.0.2")) {
+		t.Fatalf("Unexpected address %v", ip)
+	}
+
+	ep2, err := n.CreateEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ep2.Info().Iface().Address()
+
+	nw, err := cc.getNetworkFromStore(n.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := nw.getIPInfo(4)
+	if len(info) != 2 || info[0].Expansion || !info[1].Expansion || !info[1].Pool.Contains(addr.IP) {
+		t.Fatalf("Unexpected pools after expansion for address %v: %v", addr, info)
+	}
+	if len(ed.v4Data) != 1 || len(ed.v4Data[0]) != 2 {
+		t.Fatalf("The driver was not notified of the expansion: %v", ed.v4Data)
+	}
+	poolID := info[1].PoolID
+
+	// The added pool is released once empty
+	if err := ep2.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if nw, err = cc.getNetworkFromStore(n.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if info = nw.getIPInfo(4); len(info) != 1 || info[0].Expansion {
+		t.Fatalf("Unexpected pools after shrinking: %v", info)
+	}
+	if len(ed.v4Data) != 2 || len(ed.v4Data[1]) != 1 {
+		t.Fatalf("The driver was not notified of the shrinking: %v", ed.v4Data)
+	}
+	insp, err := c.IpamInspector(ipamapi.DefaultIPAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := insp.Pool(poolID); err == nil {
+		t.Fatalf("Pool %s was not released", poolID)
+	}
+
+	// Without the label, endpoint creation fails
+	n2, err := c.NewNetwork(expandDriverName, "noexpnet", NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{&IpamConf{PreferredPool: "10.47.0.0/30"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n2.Delete()
+	ep3, err := n2.CreateEndpoint("ep3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep3.Delete()
+	if _, err := n2.CreateEndpoint("ep4"); err == nil {
+		t.Fatal("Expected failure on a full network which does not auto expand")
+	}
+}
+
+var expandDriverName = "expand network driver"
+
+// expandDriver records the ip-addressing data of the networks it is
+// notified of
+func TestEndpointEUI64Address(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	cc := c.(*controller)
+	cc.drivers[expandDriverName] = &driverData{driver: &meteredDriver{Driver: &expandDriver{}, name: expandDriverName}, capability: driverapi.Capability{DataScope: datastore.LocalScope}}
+
+	ipamV4 := []*IpamConf{&IpamConf{PreferredPool: "10.47.0.0/24"}}
+	ipamV6 := []*IpamConf{&IpamConf{PreferredPool: "fd00:48::/64", Options: map[string]string{netlabel.IpamIPv6AddressMode: ipamapi.IPv6EUI64}}}
+	n, err := c.NewNetwork(expandDriverName, "eui64net", NetworkOptionIpam(ipamapi.DefaultIPAM, "", ipamV4, ipamV6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Delete()
+
+	mac, _ := net.ParseMAC("02:42:0a:2f:00:05")
+	ep, err := n.CreateEndpoint("ep1", CreateOptionMacAddress(mac))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ep.Delete()
+	if ip := ep.Info().Iface().AddressIPv6().IP; !ip.Equal(net.ParseIP("fd00:48::42:aff:fe2f:5")) {
+		t.Fatalf("Unexpected address %v", ip)
+	}
+}
+
+type expandDriver struct {
+	badDriver
+	v4Data [][]driverapi.IPAMData
+}
+
+func (e *expandDriver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, options map[string]interface{}) error {
+	return nil
+}
+func (e *expandDriver) UpdateNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	e.v4Data = append(e.v4Data, ipV4Data)
+	return nil
+}
+func (e *expandDriver) ReleaseIP(id, ip string) error {
+	return nil
+}
+func (e *expandDriver) Type() string {
+	return expandDriverName
+}
@@ -11,7 +11,9 @@ import (
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,6 +27,7 @@ import (
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/driverapi"
 	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/metrics"
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/options"
 	"github.com/docker/libnetwork/osl"
@@ -430,6 +433,184 @@ func TestNetworkName(t *testing.T) {
 	}
 }
 
+func TestNetworkUpdate(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	n, err := controller.NewNetwork(bridgeNetType, "testupdate",
+		libnetwork.NetworkOptionGeneric(options.Generic{
+			netlabel.GenericData: options.Generic{
+				"BridgeName": "testupdate",
+			},
+		}),
+		libnetwork.NetworkOptionLabels(map[string]string{"tier": "frontend"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := n.Update(libnetwork.NetworkOptionLabels(map[string]string{"tier": "backend"})); err != nil {
+		t.Fatal(err)
+	}
+
+	nw, err := controller.NetworkByName("testupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nw.Info().Labels()["tier"] != "backend" {
+		t.Fatalf("Expected updated labels, got %v", nw.Info().Labels())
+	}
+
+	if err := n.Update(libnetwork.NetworkOptionPersist(false)); err == nil {
+		t.Fatal("Expected failure when changing the network persistence")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Fatalf("Unexpected error type: %v", err)
+	}
+
+	// The bridge driver supports a single subnet per network, the
+	// additional pool must be released on failure.
+	_, v4, _ := nw.Info().IpamConfig()
+	pool := &libnetwork.IpamConf{PreferredPool: "192.168.212.0/24"}
+	if err := n.Update(libnetwork.NetworkOptionIpam(ipamapi.DefaultIPAM, "", append(v4, pool), nil)); err == nil {
+		t.Fatal("Expected failure when adding a subnet to a bridge network")
+	}
+
+	n2, err := createTestNetwork(bridgeNetType, "testupdate2", options.Generic{}, []*libnetwork.IpamConf{pool}, nil)
+	if err != nil {
+		t.Fatalf("Expected the pool to be released after the failed update: %v", err)
+	}
+	if err := n2.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventSubscribe(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	all, cancelAll := controller.Subscribe(libnetwork.EventFilter{})
+	defer cancelAll()
+
+	n, err := createTestNetwork(bridgeNetType, "testevents", options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "testevents",
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	epOnly, cancelEp := controller.Subscribe(libnetwork.EventFilter{
+		Types:     []libnetwork.EventType{libnetwork.EventEndpointCreate, libnetwork.EventEndpointDelete},
+		NetworkID: n.ID(),
+	})
+
+	ep, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []libnetwork.EventType{
+		libnetwork.EventNetworkCreate,
+		libnetwork.EventIPAMAllocate,
+		libnetwork.EventEndpointCreate,
+		libnetwork.EventIPAMRelease,
+		libnetwork.EventEndpointDelete,
+		libnetwork.EventNetworkDelete,
+	}
+	for _, et := range expected {
+		ev := <-all
+		if ev.Type != et || ev.NetworkID != n.ID() || ev.Time.IsZero() {
+			t.Fatalf("Expected %s event on network %s, got %+v", et, n.ID(), ev)
+		}
+		if ev.Type == libnetwork.EventIPAMAllocate && ev.Address == "" {
+			t.Fatalf("Expected the allocated address in %+v", ev)
+		}
+	}
+
+	for _, et := range []libnetwork.EventType{libnetwork.EventEndpointCreate, libnetwork.EventEndpointDelete} {
+		if ev := <-epOnly; ev.Type != et || ev.EndpointID != ep.ID() {
+			t.Fatalf("Expected %s event for endpoint %s, got %+v", et, ep.ID(), ev)
+		}
+	}
+
+	cancelEp()
+	if _, ok := <-epOnly; ok {
+		t.Fatal("Expected the channel to be closed after cancelling the subscription")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	n, err := createTestNetwork(bridgeNetType, "testmetrics", options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "testmetrics",
+		},
+	}, []*libnetwork.IpamConf{{PreferredPool: "192.168.120.0/24"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := n.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ep, err := n.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ep.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if _, err := n.CreateEndpoint("ep1"); err == nil {
+		t.Fatal("Expected failure creating a duplicate endpoint")
+	}
+
+	var b bytes.Buffer
+	metrics.DefaultRegistry.WriteText(&b)
+	out := b.String()
+
+	for _, s := range []string{
+		`libnetwork_operation_duration_seconds_count{operation="network_create",driver="bridge"}`,
+		`libnetwork_operation_errors_total{operation="endpoint_create",driver="bridge"}`,
+		`libnetwork_driver_call_duration_seconds_count{call="CreateEndpoint",driver="bridge"}`,
+		`libnetwork_driver_call_duration_seconds_count{call="RequestAddress",driver="default"}`,
+		`libnetwork_ipam_pool_size{driver="default",address_space="LocalDefault",pool="192.168.120.0/24"} 256`,
+		// network, broadcast, gateway and endpoint addresses are taken
+		`libnetwork_ipam_pool_available{driver="default",address_space="LocalDefault",pool="192.168.120.0/24"} 252`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("Expected %s in the metrics:\n%s", s, out)
+		}
+	}
+
+	if !regexp.MustCompile(`libnetwork_networks\{driver="bridge"\} [1-9]`).MatchString(out) {
+		t.Fatalf("Expected bridge networks gauge in the metrics:\n%s", out)
+	}
+	if !regexp.MustCompile(`libnetwork_endpoints\{driver="bridge"\} [1-9]`).MatchString(out) {
+		t.Fatalf("Expected bridge endpoints gauge in the metrics:\n%s", out)
+	}
+}
+
 func TestNetworkType(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
@@ -523,6 +704,82 @@ func TestDeleteNetworkWithActiveEndpoints(t *testing.T) {
 	}
 }
 
+func TestForceDeleteNetwork(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	option := options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "testnetwork",
+		},
+	}
+	ipamV4ConfList := []*libnetwork.IpamConf{&libnetwork.IpamConf{PreferredPool: "192.168.40.0/24"}}
+
+	network, err := createTestNetwork(bridgeNetType, "testnetwork", option, ipamV4ConfList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep1, err := network.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := network.CreateEndpoint("ep2"); err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := controller.NewSandbox(containerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := sb.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := ep1.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := network.Dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(deps.Endpoints)
+	if len(deps.Endpoints) != 2 || deps.Endpoints[0] != "ep1" || deps.Endpoints[1] != "ep2" {
+		t.Fatalf("Unexpected dependent endpoints: %v", deps.Endpoints)
+	}
+	if len(deps.Sandboxes) != 1 || deps.Sandboxes[0] != sb.ID() {
+		t.Fatalf("Unexpected dependent sandboxes: %v", deps.Sandboxes)
+	}
+	if len(deps.Pools) != 1 || deps.Pools[0] != "192.168.40.0/24" {
+		t.Fatalf("Unexpected dependent pools: %v", deps.Pools)
+	}
+
+	if err := network.Delete(); err == nil {
+		t.Fatal("Expected to fail. But instead succeeded")
+	}
+
+	if err := network.Delete(libnetwork.NetworkDeleteOptionForce()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := controller.NetworkByID(network.ID()); err == nil {
+		t.Fatal("Network still exists after forced delete")
+	}
+
+	// The pool was released with the network
+	network, err = createTestNetwork(bridgeNetType, "testnetwork", option, ipamV4ConfList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := network.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestUnknownNetwork(t *testing.T) {
 	if !testutils.IsRunningInContainer() {
 		defer testutils.SetupTestOSContext(t)()
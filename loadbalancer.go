@@ -0,0 +1,301 @@
+package libnetwork
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/ipvs"
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
+)
+
+const (
+	// LBMethodDirectRoute forwards the traffic to the backends
+	// unmodified. The backends answer the clients directly from
+	// the virtual ips bound to their loopback device.
+	LBMethodDirectRoute = "dr"
+
+	// LBMethodNAT forwards the traffic to the backends after
+	// rewriting the destination address. The reply traffic must
+	// be routed back through the load balancer.
+	LBMethodNAT = "nat"
+)
+
+// LoadBalancer holds the configuration of the IPVS virtual services
+// which balance the traffic sent to the virtual ips and exposed ports
+// of a service across the backends attached to it.
+type LoadBalancer struct {
+	// Scheduler is the IPVS scheduling algorithm, eg. "rr" or "lc".
+	Scheduler string `json:"scheduler"`
+	// Method is the forwarding method, either "dr" or "nat".
+	Method string `json:"method"`
+	// SandboxID is the sandbox the virtual services are programmed
+	// in. The virtual services are programmed in the host when empty.
+	SandboxID string `json:"sandbox_id,omitempty"`
+}
+
+func (lb *LoadBalancer) validate() error {
+	switch lb.Method {
+	case "":
+		lb.Method = LBMethodDirectRoute
+	case LBMethodDirectRoute, LBMethodNAT:
+	default:
+		return types.BadRequestErrorf("unsupported load balancing method %q", lb.Method)
+	}
+
+	if lb.Scheduler == "" {
+		lb.Scheduler = ipvs.RoundRobin
+	}
+
+	return nil
+}
+
+func (lb *LoadBalancer) connectionFlags() uint32 {
+	if lb.Method == LBMethodNAT {
+		return ipvs.ConnectionFlagMasq
+	}
+	return ipvs.ConnectionFlagDirectRoute
+}
+
+// CreateOptionLoadBalancer function returns an option setter for load
+// balancing the traffic to the endpoint virtual ips and exposed ports
+// across the backends attached to the services sharing them
+func CreateOptionLoadBalancer(lb *LoadBalancer) EndpointOption {
+	return func(ep *endpoint) {
+		if lb == nil {
+			ep.lb = nil
+			return
+		}
+		cp := *lb
+		ep.lb = &cp
+	}
+}
+
+// lbService is a virtual service programmed in IPVS along with the
+// endpoints which are currently its backends.
+type lbService struct {
+	sandboxID string
+	svc       *ipvs.Service
+	backends  map[string]*ipvs.Destination
+}
+
+func lbServiceKey(sandboxID string, vip net.IP, port types.TransportPort) string {
+	return fmt.Sprintf("%s/%s/%s", sandboxID, vip, port.String())
+}
+
+// validateLoadBalancer checks the load balancer configuration of the
+// endpoint, if any, against its virtual ips and exposed ports.
+func (ep *endpoint) validateLoadBalancer() error {
+	ep.Lock()
+	defer ep.Unlock()
+
+	if ep.lb == nil {
+		return nil
+	}
+
+	if err := ep.lb.validate(); err != nil {
+		return err
+	}
+
+	if len(ep.vips) == 0 {
+		return types.BadRequestErrorf("load balancing requires at least one virtual ip")
+	}
+
+	if len(ep.exposedPorts) == 0 {
+		return types.BadRequestErrorf("load balancing requires at least one exposed port")
+	}
+
+	for _, vip := range ep.vips {
+		if _, _, err := net.ParseCIDR(vip); err != nil {
+			return types.BadRequestErrorf("invalid virtual ip %s: %v", vip, err)
+		}
+	}
+
+	return nil
+}
+
+// bindsVirtualIPs returns whether the virtual ips must be bound to the
+// loopback device of the sandbox the endpoint joins. It is the case
+// unless the traffic reaches the backend through NAT.
+func (ep *endpoint) bindsVirtualIPs() bool {
+	ep.Lock()
+	defer ep.Unlock()
+
+	return ep.lb == nil || ep.lb.Method != LBMethodNAT
+}
+
+// lbInvoke runs f in the network namespace the load balancer of the
+// service is programmed in.
+func (c *controller) lbInvoke(sandboxID string, f func() error) error {
+	if sandboxID == "" {
+		defer osl.InitOSContext()()
+		return f()
+	}
+
+	s, err := c.SandboxByID(sandboxID)
+	if err != nil {
+		return err
+	}
+
+	sb := s.(*sandbox)
+	sb.Lock()
+	osSbox := sb.osSbox
+	sb.Unlock()
+
+	if osSbox == nil {
+		return types.BadRequestErrorf("load balancer sandbox %s has no network namespace", sandboxID)
+	}
+
+	var ferr error
+	if err := osSbox.InvokeFunc(func() { ferr = f() }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// addServiceBackend programs the endpoint, which just joined a sandbox,
+// as a real server of the virtual services matching its virtual ips and
+// exposed ports, creating the virtual services if needed.
+func (c *controller) addServiceBackend(ep *endpoint) error {
+	return c.setServiceBackend(ep, true)
+}
+
+// restoreServiceBackend records the endpoint of a restored sandbox as a
+// real server of its virtual services. IPVS is not programmed since its
+// state survived the daemon restart.
+func (c *controller) restoreServiceBackend(ep *endpoint) error {
+	return c.setServiceBackend(ep, false)
+}
+
+func (c *controller) setServiceBackend(ep *endpoint, program bool) (err error) {
+	ep.Lock()
+	lb := ep.lb
+	vips := append([]string(nil), ep.vips...)
+	ports := append([]types.TransportPort(nil), ep.exposedPorts...)
+	epid := ep.id
+	var addr, addrv6 net.IP
+	if ep.iface != nil {
+		if ep.iface.addr != nil {
+			addr = ep.iface.addr.IP
+		}
+		if ep.iface.addrv6 != nil {
+			addrv6 = ep.iface.addrv6.IP
+		}
+	}
+	ep.Unlock()
+
+	if lb == nil {
+		return nil
+	}
+
+	defer func() {
+		if err != nil {
+			c.rmServiceBackend(ep)
+		}
+	}()
+
+	c.lbLock.Lock()
+	defer c.lbLock.Unlock()
+
+	for _, vip := range vips {
+		ip, ipNet, err := net.ParseCIDR(vip)
+		if err != nil {
+			return types.BadRequestErrorf("invalid virtual ip %s: %v", vip, err)
+		}
+
+		backend := addr
+		if ip.To4() == nil {
+			backend = addrv6
+		}
+		if backend == nil {
+			log.Debugf("endpoint %s has no address of the same family as virtual ip %s, skipping", epid, vip)
+			continue
+		}
+
+		ones, bits := ipNet.Mask.Size()
+		netmask := uint32(0xFFFFFFFF)
+		if bits == 128 {
+			netmask = uint32(ones)
+		}
+
+		for _, port := range ports {
+			key := lbServiceKey(lb.SandboxID, ip, port)
+			s, ok := c.lbServices[key]
+			if !ok {
+				s = &lbService{
+					sandboxID: lb.SandboxID,
+					svc: &ipvs.Service{
+						Address:   ip,
+						Protocol:  uint16(port.Proto),
+						Port:      port.Port,
+						SchedName: lb.Scheduler,
+						Netmask:   netmask,
+					},
+					backends: make(map[string]*ipvs.Destination),
+				}
+				if program {
+					if err := c.lbInvoke(s.sandboxID, func() error { return ipvs.NewService(s.svc) }); err != nil {
+						return fmt.Errorf("failed to create virtual service %s: %v", key, err)
+					}
+				}
+				c.lbServices[key] = s
+			}
+
+			if _, ok := s.backends[epid]; ok {
+				continue
+			}
+
+			d := &ipvs.Destination{
+				Address:         backend,
+				Port:            port.Port,
+				Weight:          1,
+				ConnectionFlags: lb.connectionFlags(),
+			}
+			if program {
+				if err := c.lbInvoke(s.sandboxID, func() error { return ipvs.NewDestination(s.svc, d) }); err != nil {
+					if len(s.backends) == 0 {
+						c.deleteLBService(key, s)
+					}
+					return fmt.Errorf("failed to add backend %s to virtual service %s: %v", backend, key, err)
+				}
+			}
+			s.backends[epid] = d
+		}
+	}
+
+	return nil
+}
+
+// rmServiceBackend removes the endpoint from the virtual services it
+// is a real server of, deleting the virtual services left without any.
+func (c *controller) rmServiceBackend(ep *endpoint) {
+	epid := ep.ID()
+
+	c.lbLock.Lock()
+	defer c.lbLock.Unlock()
+
+	for key, s := range c.lbServices {
+		d, ok := s.backends[epid]
+		if !ok {
+			continue
+		}
+
+		if err := c.lbInvoke(s.sandboxID, func() error { return ipvs.DelDestination(s.svc, d) }); err != nil {
+			log.Warnf("Failed to remove backend %s from virtual service %s: %v", d.Address, key, err)
+		}
+		delete(s.backends, epid)
+
+		if len(s.backends) == 0 {
+			c.deleteLBService(key, s)
+		}
+	}
+}
+
+// deleteLBService must be called with the lbLock held.
+func (c *controller) deleteLBService(key string, s *lbService) {
+	if err := c.lbInvoke(s.sandboxID, func() error { return ipvs.DelService(s.svc) }); err != nil {
+		log.Warnf("Failed to delete virtual service %s: %v", key, err)
+	}
+	delete(c.lbServices, key)
+}
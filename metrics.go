@@ -0,0 +1,263 @@
+package libnetwork
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/driverapi"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/metrics"
+)
+
+var (
+	opLatency = metrics.NewHistogramVec("libnetwork_operation_duration_seconds",
+		"Latency of the network controller operations", metrics.DefBuckets, "operation", "driver")
+	opErrors = metrics.NewCounterVec("libnetwork_operation_errors_total",
+		"Number of network controller operations which failed", "operation", "driver")
+	driverLatency = metrics.NewHistogramVec("libnetwork_driver_call_duration_seconds",
+		"Latency of the calls to the network and ipam drivers", metrics.DefBuckets, "call", "driver")
+	driverErrors = metrics.NewCounterVec("libnetwork_driver_call_errors_total",
+		"Number of calls to the network and ipam drivers which failed", "call", "driver")
+)
+
+// liveControllers are the controllers the gauges are computed from.
+var liveControllers = struct {
+	m map[*controller]struct{}
+	sync.Mutex
+}{m: make(map[*controller]struct{})}
+
+func init() {
+	metrics.MustRegister(
+		opLatency, opErrors, driverLatency, driverErrors,
+		metrics.NewGaugeFunc("libnetwork_networks", "Number of networks",
+			[]string{"driver"}, collectNetworks),
+		metrics.NewGaugeFunc("libnetwork_endpoints", "Number of endpoints",
+			[]string{"driver"}, collectEndpoints),
+		metrics.NewGaugeFunc("libnetwork_sandboxes", "Number of sandboxes",
+			nil, collectSandboxes),
+		metrics.NewGaugeFunc("libnetwork_ipam_pool_size", "Number of addresses in the ipam pools",
+			[]string{"driver", "address_space", "pool"}, func(report func(float64, ...string)) {
+				collectPools(func(driver string, p ipamapi.PoolInfo) {
+					report(float64(p.Total), driver, p.AddressSpace, p.Pool)
+				})
+			}),
+		metrics.NewGaugeFunc("libnetwork_ipam_pool_available", "Number of addresses available for allocation in the ipam pools",
+			[]string{"driver", "address_space", "pool"}, func(report func(float64, ...string)) {
+				collectPools(func(driver string, p ipamapi.PoolInfo) {
+					report(float64(p.Free), driver, p.AddressSpace, p.Pool)
+				})
+			}),
+	)
+}
+
+func (c *controller) trackMetrics() {
+	liveControllers.Lock()
+	liveControllers.m[c] = struct{}{}
+	liveControllers.Unlock()
+}
+
+func (c *controller) untrackMetrics() {
+	liveControllers.Lock()
+	delete(liveControllers.m, c)
+	liveControllers.Unlock()
+}
+
+func walkLiveControllers(f func(c *controller)) {
+	liveControllers.Lock()
+	cl := make([]*controller, 0, len(liveControllers.m))
+	for c := range liveControllers.m {
+		cl = append(cl, c)
+	}
+	liveControllers.Unlock()
+
+	for _, c := range cl {
+		f(c)
+	}
+}
+
+func collectNetworks(report func(float64, ...string)) {
+	walkLiveControllers(func(c *controller) {
+		for _, n := range c.Networks() {
+			report(1, n.Type())
+		}
+	})
+}
+
+func collectEndpoints(report func(float64, ...string)) {
+	walkLiveControllers(func(c *controller) {
+		for _, n := range c.Networks() {
+			report(float64(len(n.Endpoints())), n.Type())
+		}
+	})
+}
+
+func collectSandboxes(report func(float64, ...string)) {
+	walkLiveControllers(func(c *controller) {
+		report(float64(len(c.Sandboxes())))
+	})
+}
+
+// collectPools reports the pools of the ipam drivers which implement
+// ipamapi.Inspector. The sub pools are skipped, as they share the
+// addresses of their master pool.
+func collectPools(report func(driver string, p ipamapi.PoolInfo)) {
+	walkLiveControllers(func(c *controller) {
+		c.Lock()
+		drivers := make(map[string]ipamapi.Ipam, len(c.ipamDrivers))
+		for name, id := range c.ipamDrivers {
+			drivers[name] = id.driver
+		}
+		c.Unlock()
+
+		for name, d := range drivers {
+			ins, ok := unwrapIpam(d).(ipamapi.Inspector)
+			if !ok {
+				continue
+			}
+			asl, err := ins.AddressSpaces()
+			if err != nil {
+				log.Warnf("Failed to get the pools of ipam driver %s: %v", name, err)
+				continue
+			}
+			for _, as := range asl {
+				for _, p := range as.Pools {
+					if p.SubPool == "" {
+						report(name, p)
+					}
+				}
+			}
+		}
+	})
+}
+
+// observeOp records the latency and the outcome of a controller operation.
+func observeOp(op, driver string, start time.Time, err error) {
+	opLatency.Observe(time.Since(start).Seconds(), op, driver)
+	if err != nil {
+		opErrors.Inc(op, driver)
+	}
+}
+
+// observeCall records the latency and the outcome of a driver call.
+func observeCall(call, driver string, start time.Time, err error) {
+	driverLatency.Observe(time.Since(start).Seconds(), call, driver)
+	if err != nil {
+		driverErrors.Inc(call, driver)
+	}
+}
+
+// meteredDriver instruments the calls the controller makes to a network driver.
+type meteredDriver struct {
+	driverapi.Driver
+	name string
+}
+
+func (d *meteredDriver) CreateNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	start := time.Now()
+	err := d.Driver.CreateNetwork(nid, options, ipV4Data, ipV6Data)
+	observeCall("CreateNetwork", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) DeleteNetwork(nid string) error {
+	start := time.Now()
+	err := d.Driver.DeleteNetwork(nid)
+	observeCall("DeleteNetwork", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) UpdateNetwork(nid string, options map[string]interface{}, ipV4Data, ipV6Data []driverapi.IPAMData) error {
+	start := time.Now()
+	err := d.Driver.UpdateNetwork(nid, options, ipV4Data, ipV6Data)
+	observeCall("UpdateNetwork", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) CreateEndpoint(nid, eid string, ifInfo driverapi.InterfaceInfo, options map[string]interface{}) error {
+	start := time.Now()
+	err := d.Driver.CreateEndpoint(nid, eid, ifInfo, options)
+	observeCall("CreateEndpoint", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) DeleteEndpoint(nid, eid string) error {
+	start := time.Now()
+	err := d.Driver.DeleteEndpoint(nid, eid)
+	observeCall("DeleteEndpoint", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) Join(nid, eid string, sboxKey string, jinfo driverapi.JoinInfo, options map[string]interface{}) error {
+	start := time.Now()
+	err := d.Driver.Join(nid, eid, sboxKey, jinfo, options)
+	observeCall("Join", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) Leave(nid, eid string) error {
+	start := time.Now()
+	err := d.Driver.Leave(nid, eid)
+	observeCall("Leave", d.name, start, err)
+	return err
+}
+
+func (d *meteredDriver) RestoreEndpoint(nid, eid string, sboxKey string, ifInfo driverapi.InterfaceInfo, srcName string, options map[string]interface{}) error {
+	start := time.Now()
+	err := d.Driver.RestoreEndpoint(nid, eid, sboxKey, ifInfo, srcName, options)
+	observeCall("RestoreEndpoint", d.name, start, err)
+	return err
+}
+
+// meteredIpam instruments the calls the controller makes to an ipam driver.
+type meteredIpam struct {
+	ipamapi.Ipam
+	name string
+}
+
+// unwrapDriver returns the network driver the passed one instruments, if
+// any, for its optional interfaces to be looked up.
+func unwrapDriver(d driverapi.Driver) driverapi.Driver {
+	if m, ok := d.(*meteredDriver); ok {
+		return m.Driver
+	}
+	return d
+}
+
+// unwrapIpam returns the ipam driver the passed one instruments, if any,
+// for its optional interfaces to be looked up.
+func unwrapIpam(i ipamapi.Ipam) ipamapi.Ipam {
+	if m, ok := i.(*meteredIpam); ok {
+		return m.Ipam
+	}
+	return i
+}
+
+func (i *meteredIpam) RequestPool(addressSpace, pool, subPool string, options map[string]string, v6 bool) (string, *net.IPNet, map[string]string, error) {
+	start := time.Now()
+	poolID, nw, data, err := i.Ipam.RequestPool(addressSpace, pool, subPool, options, v6)
+	observeCall("RequestPool", i.name, start, err)
+	return poolID, nw, data, err
+}
+
+func (i *meteredIpam) ReleasePool(poolID string) error {
+	start := time.Now()
+	err := i.Ipam.ReleasePool(poolID)
+	observeCall("ReleasePool", i.name, start, err)
+	return err
+}
+
+func (i *meteredIpam) RequestAddress(poolID string, ip net.IP, options map[string]string) (*net.IPNet, map[string]string, error) {
+	start := time.Now()
+	addr, data, err := i.Ipam.RequestAddress(poolID, ip, options)
+	observeCall("RequestAddress", i.name, start, err)
+	return addr, data, err
+}
+
+func (i *meteredIpam) ReleaseAddress(poolID string, ip net.IP) error {
+	start := time.Now()
+	err := i.Ipam.ReleaseAddress(poolID, ip)
+	observeCall("ReleaseAddress", i.name, start, err)
+	return err
+}
@@ -0,0 +1,362 @@
+// Package metrics provides minimal counters, histograms and gauges
+// and serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suited to
+// the latency of the network operations.
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// labelSep separates the label values in the key of a series. It can
+// not appear in a valid utf-8 label value.
+const labelSep = "\xff"
+
+// Collector is a metric family which can be registered in a Registry.
+type Collector interface {
+	desc() *desc
+	collect(w io.Writer)
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, labelSep)
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// writeSample writes a sample of the series identified by the label
+// values, optionally followed by an extra label, eg. a histogram bucket.
+func (d *desc) writeSample(w io.Writer, suffix string, labelValues []string, extraName, extraValue string, v float64) {
+	var b bytes.Buffer
+	for i, l := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", l, escapeLabel(labelValues[i]))
+	}
+	if extraName != "" {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	if b.Len() > 0 {
+		fmt.Fprintf(w, "%s%s{%s} %s\n", d.name, suffix, b.String(), formatFloat(v))
+		return
+	}
+	fmt.Fprintf(w, "%s%s %s\n", d.name, suffix, formatFloat(v))
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	d      *desc
+	values map[string]float64
+	labels map[string][]string
+	sync.Mutex
+}
+
+// NewCounterVec returns a counter family with the passed label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		d:      &desc{name: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+}
+
+// Inc increments the counter identified by the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter identified
+// by the label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s can not decrease", c.d.name))
+	}
+	k := c.d.key(labelValues)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.labels[k]; !ok {
+		c.labels[k] = append([]string(nil), labelValues...)
+	}
+	c.values[k] += v
+}
+
+// Value returns the current value of the counter identified by the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	k := c.d.key(labelValues)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.values[k]
+}
+
+func (c *CounterVec) desc() *desc {
+	return c.d
+}
+
+func (c *CounterVec) collect(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, k := range sortedKeys(c.labels) {
+		c.d.writeSample(w, "", c.labels[k], "", "", c.values[k])
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	d       *desc
+	buckets []float64
+	values  map[string]*histogram
+	labels  map[string][]string
+	sync.Mutex
+}
+
+// NewHistogramVec returns a histogram family with the passed upper
+// bucket bounds, in increasing order, and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s must be in increasing order", name))
+	}
+	return &HistogramVec{
+		d:       &desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+		labels:  make(map[string][]string),
+	}
+}
+
+// Observe adds the value to the histogram identified by the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	k := h.d.key(labelValues)
+
+	h.Lock()
+	defer h.Unlock()
+
+	hv, ok := h.values[k]
+	if !ok {
+		hv = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hv
+		h.labels[k] = append([]string(nil), labelValues...)
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count returns the number of values observed by the histogram
+// identified by the label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	k := h.d.key(labelValues)
+
+	h.Lock()
+	defer h.Unlock()
+
+	if hv, ok := h.values[k]; ok {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) desc() *desc {
+	return h.d
+}
+
+func (h *HistogramVec) collect(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, k := range sortedKeys(h.labels) {
+		hv := h.values[k]
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += hv.counts[i]
+			h.d.writeSample(w, "_bucket", h.labels[k], "le", formatFloat(b), float64(cumulative))
+		}
+		h.d.writeSample(w, "_bucket", h.labels[k], "le", "+Inf", float64(hv.count))
+		h.d.writeSample(w, "_sum", h.labels[k], "", "", hv.sum)
+		h.d.writeSample(w, "_count", h.labels[k], "", "", float64(hv.count))
+	}
+}
+
+// GaugeFunc is a family of gauges whose values are computed when the
+// metrics are collected. The function reports the value of each gauge
+// through the passed callback.
+type GaugeFunc struct {
+	d *desc
+	f func(report func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc returns a gauge family with the passed label names
+// computed by f.
+func NewGaugeFunc(name, help string, labels []string, f func(report func(v float64, labelValues ...string))) *GaugeFunc {
+	return &GaugeFunc{
+		d: &desc{name: name, help: help, kind: "gauge", labels: labels},
+		f: f,
+	}
+}
+
+func (g *GaugeFunc) desc() *desc {
+	return g.d
+}
+
+func (g *GaugeFunc) collect(w io.Writer) {
+	values := make(map[string]float64)
+	labels := make(map[string][]string)
+	g.f(func(v float64, labelValues ...string) {
+		k := g.d.key(labelValues)
+		if _, ok := labels[k]; !ok {
+			labels[k] = append([]string(nil), labelValues...)
+		}
+		values[k] += v
+	})
+
+	for _, k := range sortedKeys(labels) {
+		g.d.writeSample(w, "", labels[k], "", "", values[k])
+	}
+}
+
+// Registry holds the registered metric families and serves them over HTTP.
+type Registry struct {
+	collectors map[string]Collector
+	sync.Mutex
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry is the registry the libnetwork metrics are registered in.
+var DefaultRegistry = NewRegistry()
+
+// Register adds the collectors to the registry. It fails if a metric
+// family with the same name is already registered.
+func (r *Registry) Register(cs ...Collector) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, c := range cs {
+		if _, ok := r.collectors[c.desc().name]; ok {
+			return fmt.Errorf("metric %s is already registered", c.desc().name)
+		}
+	}
+	for _, c := range cs {
+		r.collectors[c.desc().name] = c
+	}
+
+	return nil
+}
+
+// MustRegister registers the collectors in the default registry and
+// panics on failure.
+func MustRegister(cs ...Collector) {
+	if err := DefaultRegistry.Register(cs...); err != nil {
+		panic(err)
+	}
+}
+
+// WriteText writes the registered metric families to w in the text
+// exposition format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for n := range r.collectors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	cs := make([]Collector, 0, len(names))
+	for _, n := range names {
+		cs = append(cs, r.collectors[n])
+	}
+	r.Unlock()
+
+	for _, c := range cs {
+		c.desc().writeHeader(w)
+		c.collect(w)
+	}
+}
+
+// ServeHTTP serves the registered metric families.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var b bytes.Buffer
+	r.WriteText(&b)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+// Handler returns the HTTP handler serving the default registry.
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
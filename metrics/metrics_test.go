@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+
+	c := NewCounterVec("test_errors_total", "Number of\nerrors", "op")
+	h := NewHistogramVec("test_duration_seconds", "Latency", []float64{0.1, 1}, "op", "driver")
+	g := NewGaugeFunc("test_things", "Things", nil, func(report func(float64, ...string)) {
+		report(3)
+	})
+	if err := r.Register(c, h, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(NewCounterVec("test_errors_total", "", "op")); err == nil {
+		t.Fatal("Expected failure registering a duplicate metric")
+	}
+
+	c.Inc(`a"b`)
+	c.Add(2, `a"b`)
+	h.Observe(0.05, "create", "bridge")
+	h.Observe(0.5, "create", "bridge")
+	h.Observe(5, "create", "bridge")
+
+	if c.Value(`a"b`) != 3 {
+		t.Fatalf("Unexpected counter value %v", c.Value(`a"b`))
+	}
+	if h.Count("create", "bridge") != 3 {
+		t.Fatalf("Unexpected histogram count %d", h.Count("create", "bridge"))
+	}
+
+	var b bytes.Buffer
+	r.WriteText(&b)
+	expected := `# HELP test_duration_seconds Latency
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="create",driver="bridge",le="0.1"} 1
+test_duration_seconds_bucket{op="create",driver="bridge",le="1"} 2
+test_duration_seconds_bucket{op="create",driver="bridge",le="+Inf"} 3
+test_duration_seconds_sum{op="create",driver="bridge"} 5.55
+test_duration_seconds_count{op="create",driver="bridge"} 3
+# HELP test_errors_total Number of\nerrors
+# TYPE test_errors_total counter
+test_errors_total{op="a\"b"} 3
+# HELP test_things Things
+# TYPE test_things gauge
+test_things 3
+`
+	if b.String() != expected {
+		t.Fatalf("Unexpected exposition:\n%s", b.String())
+	}
+
+	rsp := httptest.NewRecorder()
+	r.ServeHTTP(rsp, &http.Request{})
+	if !strings.HasPrefix(rsp.Header().Get("Content-Type"), "text/plain") || rsp.Body.String() != expected {
+		t.Fatalf("Unexpected response %v: %s", rsp.Header(), rsp.Body.String())
+	}
+}
+
+func TestLabelCardinality(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic on label values mismatch")
+		}
+	}()
+	NewCounterVec("test_total", "", "a", "b").Inc("x")
+}
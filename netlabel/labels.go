@@ -39,6 +39,32 @@ const (
 	// ContainerID constant represents the container's id
 	ContainerID = Prefix + ".endpoint.containerid"
 
+	// EndpointID constant represents the endpoint's id
+	EndpointID = Prefix + ".endpoint.id"
+
+	// IpamLeaseTTL constant represents the duration of the address leases
+	IpamLeaseTTL = Prefix + ".ipam.lease_ttl"
+
+	// IpamAllocationPolicy constant represents the policy by which the
+	// addresses of an ipam pool are handed out
+	IpamAllocationPolicy = Prefix + ".ipam.allocation_policy"
+
+	// IpamQuarantine constant represents the time a released address is
+	// kept out of allocation
+	IpamQuarantine = Prefix + ".ipam.quarantine"
+
+	// IpamAutoExpand constant represents whether a network gets additional
+	// address pools when it runs out of addresses
+	IpamAutoExpand = Prefix + ".ipam.auto_expand"
+
+	// IpamIPv6AddressMode constant represents the way the interface
+	// identifiers of the addresses of an IPv6 ipam pool are chosen
+	IpamIPv6AddressMode = Prefix + ".ipam.ipv6_address_mode"
+
+	// IpamDhcpServer constant represents the address of the dhcp server
+	// the addresses of a dhcp ipam pool are requested from
+	IpamDhcpServer = Prefix + ".ipam.dhcp_server"
+
 	//EnableIPv6 constant represents enabling IPV6 at network level
 	EnableIPv6 = Prefix + ".enable_ipv6"
 
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/stringid"
@@ -36,8 +38,18 @@ type Network interface {
 	// specified unique name. The options parameter carry driver specific options.
 	CreateEndpoint(name string, options ...EndpointOption) (Endpoint, error)
 
-	// Delete the network.
-	Delete() error
+	// Delete the network. Unless forced with NetworkDeleteOptionForce, the
+	// deletion fails while the network has endpoints.
+	Delete(options ...NetworkDeleteOption) error
+
+	// Dependencies returns the endpoints, sandboxes and ipam pools a forced
+	// delete of the network affects.
+	Dependencies() (*NetworkDependencies, error)
+
+	// Update applies the options to the network. Only the labels, the driver
+	// options the driver allows modifying and additional ipam pools, appended
+	// after the existing ones, can be changed on a network.
+	Update(options ...NetworkOption) error
 
 	// Endpoints returns the list of Endpoint(s) in this network.
 	Endpoints() []Endpoint
@@ -59,6 +71,7 @@ type Network interface {
 type NetworkInfo interface {
 	IpamConfig() (string, []*IpamConf, []*IpamConf)
 	DriverOptions() map[string]string
+	Labels() map[string]string
 	Scope() string
 }
 
@@ -66,7 +79,35 @@ type NetworkInfo interface {
 // When the function returns true, the walk will stop.
 type EndpointWalker func(ep Endpoint) bool
 
-type svcMap map[string]net.IP
+// svcInfo holds the service records of a network: the addresses of the
+// names and aliases of the endpoints, the reverse mapping used for the PTR
+// lookups and the SRV records of the ports the endpoints expose
+type svcInfo struct {
+	svcMap     map[string][]net.IP
+	svcIPv6Map map[string][]net.IP
+	ipMap      map[string]string
+	srvMap     map[string]srvRecord
+}
+
+// srvRecord is the host and port a SRV record points to
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+func newSvcInfo() *svcInfo {
+	return &svcInfo{
+		svcMap:     make(map[string][]net.IP),
+		svcIPv6Map: make(map[string][]net.IP),
+		ipMap:      make(map[string]string),
+		srvMap:     make(map[string]srvRecord),
+	}
+}
+
+// srvName returns the SRV record name of port p exposed by host
+func srvName(p types.TransportPort, host string) string {
+	return fmt.Sprintf("_%d._%s.%s", p.Port, p.Proto.String(), host)
+}
 
 // IpamConf contains all the ipam related configurations for a network
 type IpamConf struct {
@@ -96,6 +137,9 @@ func (c *IpamConf) Validate() error {
 type IpamInfo struct {
 	PoolID string
 	Meta   map[string]string
+	// Expansion tells the pool was added when the network ran out of
+	// addresses, and is released once no endpoint uses it
+	Expansion bool
 	driverapi.IPAMData
 }
 
@@ -113,6 +157,9 @@ func (i *IpamInfo) MarshalJSON() ([]byte, error) {
 	if i.Meta != nil {
 		m["Meta"] = i.Meta
 	}
+	if i.Expansion {
+		m["Expansion"] = true
+	}
 	return json.Marshal(m)
 }
 
@@ -126,6 +173,9 @@ func (i *IpamInfo) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	i.PoolID = m["PoolID"].(string)
+	if v, ok := m["Expansion"]; ok {
+		i.Expansion = v.(bool)
+	}
 	if v, ok := m["Meta"]; ok {
 		b, _ := json.Marshal(v)
 		if err = json.Unmarshal(b, &i.Meta); err != nil {
@@ -155,8 +205,8 @@ type network struct {
 	postIPv6     bool
 	epCnt        *endpointCnt
 	generic      options.Generic
+	labels       map[string]string
 	dbIndex      uint64
-	svcRecords   svcMap
 	dbExists     bool
 	persist      bool
 	stopWatchCh  chan struct{}
@@ -267,6 +317,7 @@ func (c *IpamConf) CopyTo(dstC *IpamConf) error {
 // CopyTo deep copies to the destination IpamInfo
 func (i *IpamInfo) CopyTo(dstI *IpamInfo) error {
 	dstI.PoolID = i.PoolID
+	dstI.Expansion = i.Expansion
 	if i.Meta != nil {
 		dstI.Meta = make(map[string]string)
 		for k, v := range i.Meta {
@@ -297,6 +348,7 @@ func (n *network) CopyTo(o datastore.KVObject) error {
 	dstN.id = n.id
 	dstN.networkType = n.networkType
 	dstN.ipamType = n.ipamType
+	dstN.addrSpace = n.addrSpace
 	dstN.enableIPv6 = n.enableIPv6
 	dstN.persist = n.persist
 	dstN.postIPv6 = n.postIPv6
@@ -333,6 +385,13 @@ func (n *network) CopyTo(o datastore.KVObject) error {
 		dstN.generic[k] = v
 	}
 
+	if n.labels != nil {
+		dstN.labels = make(map[string]string, len(n.labels))
+		for k, v := range n.labels {
+			dstN.labels[k] = v
+		}
+	}
+
 	return nil
 }
 
@@ -359,6 +418,9 @@ func (n *network) MarshalJSON() ([]byte, error) {
 	if n.generic != nil {
 		netMap["generic"] = n.generic
 	}
+	if len(n.labels) > 0 {
+		netMap["labels"] = n.labels
+	}
 	netMap["persist"] = n.persist
 	netMap["postIPv6"] = n.postIPv6
 	if len(n.ipamV4Config) > 0 {
@@ -418,6 +480,12 @@ func (n *network) UnmarshalJSON(b []byte) (err error) {
 			n.generic[netlabel.GenericData] = lmap
 		}
 	}
+	if v, ok := netMap["labels"]; ok {
+		n.labels = make(map[string]string)
+		for k, l := range v.(map[string]interface{}) {
+			n.labels[k] = l.(string)
+		}
+	}
 	if v, ok := netMap["persist"]; ok {
 		n.persist = v.(bool)
 	}
@@ -511,6 +579,18 @@ func NetworkOptionDriverOpts(opts map[string]string) NetworkOption {
 	}
 }
 
+// NetworkOptionLabels function returns an option setter for the user defined
+// labels of the network. The labels are not interpreted by libnetwork nor
+// passed to the driver.
+func NetworkOptionLabels(labels map[string]string) NetworkOption {
+	return func(n *network) {
+		n.labels = make(map[string]string, len(labels))
+		for k, v := range labels {
+			n.labels[k] = v
+		}
+	}
+}
+
 // NetworkOptionDeferIPv6Alloc instructs the network to defer the IPV6 address allocation until after the endpoint has been created
 // It is being provided to support the specific docker daemon flags where user can deterministically assign an IPv6 address
 // to a container as combination of fixed-cidr-v6 + mac-address
@@ -521,6 +601,33 @@ func NetworkOptionDeferIPv6Alloc(enable bool) NetworkOption {
 	}
 }
 
+// NetworkDeleteOption is an option setter function type used to pass
+// options to the network Delete method
+type NetworkDeleteOption func(p *networkDeleteParams)
+
+type networkDeleteParams struct {
+	force bool
+}
+
+// NetworkDeleteOptionForce returns an option setter to delete a network
+// together with its endpoints. The endpoints are first removed from the
+// sandboxes they are joined to, then deleted, releasing their addresses.
+func NetworkDeleteOptionForce() NetworkDeleteOption {
+	return func(p *networkDeleteParams) {
+		p.force = true
+	}
+}
+
+// NetworkDependencies lists the objects a forced delete of a network affects
+type NetworkDependencies struct {
+	// Endpoints are the names of the endpoints deleted with the network
+	Endpoints []string `json:"endpoints"`
+	// Sandboxes are the ids of the sandboxes the endpoints are removed from
+	Sandboxes []string `json:"sandboxes"`
+	// Pools are the ipam pools released with the network
+	Pools []string `json:"pools"`
+}
+
 func (n *network) processOptions(options ...NetworkOption) {
 	for _, opt := range options {
 		if opt != nil {
@@ -530,6 +637,12 @@ func (n *network) processOptions(options ...NetworkOption) {
 }
 
 func (n *network) driverScope() string {
+	return n.driverCapability().DataScope
+}
+
+// driverCapability returns the capability of the driver of the network,
+// which is empty if the driver cannot be loaded
+func (n *network) driverCapability() driverapi.Capability {
 	c := n.getController()
 
 	c.Lock()
@@ -541,12 +654,11 @@ func (n *network) driverScope() string {
 		var err error
 		dd, err = c.loadDriver(n.networkType)
 		if err != nil {
-			// If driver could not be resolved simply return an empty string
-			return ""
+			return driverapi.Capability{}
 		}
 	}
 
-	return dd.capability.DataScope
+	return dd.capability
 }
 
 func (n *network) driver() (driverapi.Driver, error) {
@@ -568,7 +680,21 @@ func (n *network) driver() (driverapi.Driver, error) {
 	return dd.driver, nil
 }
 
-func (n *network) Delete() error {
+func (n *network) Delete(options ...NetworkDeleteOption) error {
+	var p networkDeleteParams
+	for _, opt := range options {
+		if opt != nil {
+			opt(&p)
+		}
+	}
+
+	start := time.Now()
+	err := n.delete(p.force)
+	observeOp("network_delete", n.Type(), start, err)
+	return err
+}
+
+func (n *network) delete(force bool) error {
 	n.Lock()
 	c := n.ctrlr
 	name := n.name
@@ -582,7 +708,12 @@ func (n *network) Delete() error {
 
 	numEps := n.getEpCnt().EndpointCnt()
 	if numEps != 0 {
-		return &ActiveEndpointsError{name: n.name, id: n.id}
+		if !force {
+			return &ActiveEndpointsError{name: n.name, id: n.id}
+		}
+		if err = n.deleteEndpoints(); err != nil {
+			return err
+		}
 	}
 
 	if err = n.deleteNetwork(); err != nil {
@@ -609,9 +740,60 @@ func (n *network) Delete() error {
 
 	n.ipamRelease()
 
+	c.publish(Event{Type: EventNetworkDelete, NetworkID: n.ID()})
+
+	return nil
+}
+
+// deleteEndpoints removes the endpoints of the network from their
+// sandboxes and deletes them
+func (n *network) deleteEndpoints() error {
+	for _, e := range n.Endpoints() {
+		ep := e.(*endpoint)
+		if sb, ok := ep.getSandbox(); ok {
+			if err := ep.Leave(sb); err != nil {
+				return fmt.Errorf("failed to remove endpoint %s from sandbox %s: %v", ep.Name(), sb.ID(), err)
+			}
+		}
+		if err := ep.Delete(); err != nil {
+			return fmt.Errorf("failed to delete endpoint %s: %v", ep.Name(), err)
+		}
+	}
+
 	return nil
 }
 
+func (n *network) Dependencies() (*NetworkDependencies, error) {
+	n.Lock()
+	c := n.ctrlr
+	name := n.name
+	id := n.id
+	n.Unlock()
+
+	n, err := c.getNetworkFromStore(id)
+	if err != nil {
+		return nil, &UnknownNetworkError{name: name, id: id}
+	}
+
+	deps := &NetworkDependencies{Endpoints: []string{}, Sandboxes: []string{}, Pools: []string{}}
+	seen := make(map[string]bool)
+	for _, e := range n.Endpoints() {
+		ep := e.(*endpoint)
+		deps.Endpoints = append(deps.Endpoints, ep.Name())
+		if sb, ok := ep.getSandbox(); ok && !seen[sb.ID()] {
+			seen[sb.ID()] = true
+			deps.Sandboxes = append(deps.Sandboxes, sb.ID())
+		}
+	}
+	for _, ipVer := range []int{4, 6} {
+		for _, d := range n.getIPInfo(ipVer) {
+			deps.Pools = append(deps.Pools, d.Pool.String())
+		}
+	}
+
+	return deps, nil
+}
+
 func (n *network) deleteNetwork() error {
 	d, err := n.driver()
 	if err != nil {
@@ -632,6 +814,217 @@ func (n *network) deleteNetwork() error {
 	return nil
 }
 
+func (n *network) Update(options ...NetworkOption) error {
+	start := time.Now()
+	err := n.update(options...)
+	observeOp("network_update", n.Type(), start, err)
+	return err
+}
+
+func (n *network) update(options ...NetworkOption) error {
+	n.Lock()
+	c := n.ctrlr
+	name := n.name
+	id := n.id
+	n.Unlock()
+
+	n, err := c.getNetworkFromStore(id)
+	if err != nil {
+		return &UnknownNetworkError{name: name, id: id}
+	}
+
+	upd := n.New().(*network)
+	if err = n.CopyTo(upd); err != nil {
+		return err
+	}
+	upd.processOptions(options...)
+
+	if err = n.validateUpdate(upd); err != nil {
+		return err
+	}
+
+	newPools, err := upd.ipamAllocateUpdate(n)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && newPools > 0 {
+			upd.ipamReleaseUpdate(n)
+		}
+	}()
+
+	if newPools > 0 || n.driverOptionsChanged(upd) {
+		var d driverapi.Driver
+		if d, err = n.driver(); err != nil {
+			return err
+		}
+
+		if err = d.UpdateNetwork(id, upd.generic, upd.getIPData(4), upd.getIPData(6)); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				if e := d.UpdateNetwork(id, n.generic, n.getIPData(4), n.getIPData(6)); e != nil {
+					log.Warnf("failed to rollback update of network %s: %v", name, e)
+				}
+			}
+		}()
+	}
+
+	if err = c.updateToStore(upd); err != nil {
+		if err == datastore.ErrKeyModified {
+			return types.ForbiddenErrorf("network %s was modified concurrently, retry the update", name)
+		}
+		return err
+	}
+
+	c.publish(Event{Type: EventNetworkUpdate, NetworkID: id})
+
+	return nil
+}
+
+// validateUpdate checks that the updated network upd does not modify any
+// property which cannot be changed once the network is created.
+func (n *network) validateUpdate(upd *network) error {
+	if upd.addrSpace == "" {
+		upd.addrSpace = n.addrSpace
+	}
+
+	var changed string
+	switch {
+	case upd.name != n.name:
+		changed = "name"
+	case upd.networkType != n.networkType:
+		changed = "type"
+	case upd.ipamType != n.ipamType:
+		changed = "ipam driver"
+	case upd.addrSpace != n.addrSpace:
+		changed = "address space"
+	case upd.enableIPv6 != n.enableIPv6:
+		changed = "ipv6 enablement"
+	case upd.persist != n.persist:
+		changed = "persistence"
+	case upd.postIPv6 != n.postIPv6:
+		changed = "ipv6 allocation policy"
+	}
+	if changed != "" {
+		return types.ForbiddenErrorf("the %s of network %s cannot be changed", changed, n.name)
+	}
+
+	for _, v := range []struct {
+		old, new []*IpamConf
+	}{
+		{n.ipamV4Config, upd.ipamV4Config},
+		{n.ipamV6Config, upd.ipamV6Config},
+	} {
+		if len(v.new) < len(v.old) {
+			return types.ForbiddenErrorf("ipam pools cannot be removed from network %s", n.name)
+		}
+		for i, c := range v.old {
+			o := v.new[i]
+			if o.PreferredPool != c.PreferredPool || o.SubPool != c.SubPool || o.Gateway != c.Gateway {
+				return types.ForbiddenErrorf("ipam pool %s of network %s cannot be changed", c.PreferredPool, n.name)
+			}
+		}
+	}
+
+	if _, err := upd.leaseTTL(); err != nil {
+		return err
+	}
+	return upd.validateAutoExpand()
+}
+
+// leaseTTL returns the ttl of the address leases of the network endpoints,
+// set with the netlabel.IpamLeaseTTL label. Zero means they never expire.
+func (n *network) leaseTTL() (time.Duration, error) {
+	n.Lock()
+	v, ok := n.labels[netlabel.IpamLeaseTTL]
+	n.Unlock()
+	if !ok {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl < 0 {
+		return 0, types.BadRequestErrorf("invalid %s label value %q on network %s", netlabel.IpamLeaseTTL, v, n.Name())
+	}
+	return ttl, nil
+}
+
+func (n *network) driverOptionsChanged(upd *network) bool {
+	if len(n.generic) == 0 && len(upd.generic) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(n.generic, upd.generic)
+}
+
+// ipamAllocateUpdate allocates the ipam pools appended to the configuration
+// of the network n was updated from. It returns the number of new pools.
+func (n *network) ipamAllocateUpdate(old *network) (int, error) {
+	newV4 := n.ipamV4Config[len(old.ipamV4Config):]
+	newV6 := n.ipamV6Config[len(old.ipamV6Config):]
+	if len(newV4) == 0 && len(newV6) == 0 {
+		return 0, nil
+	}
+
+	// For now exclude host, null and ovs
+	if n.Type() == "host" || n.Type() == "null" || n.Type() == "ovs" {
+		return 0, types.ForbiddenErrorf("ipam pools cannot be added to network %s of type %s", n.Name(), n.Type())
+	}
+
+	ipam, err := n.getController().getIpamDriver(n.ipamType)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt := 0
+	for _, v := range []struct {
+		ipVer    int
+		cfgList  []*IpamConf
+		infoList *[]*IpamInfo
+	}{
+		{4, newV4, &n.ipamV4Info},
+		{6, newV6, &n.ipamV6Info},
+	} {
+		for _, cfg := range v.cfgList {
+			d, err := n.ipamAllocatePool(ipam, cfg, v.ipVer)
+			if err != nil {
+				n.ipamReleaseUpdate(old)
+				return 0, err
+			}
+			*v.infoList = append(*v.infoList, d)
+			cnt++
+		}
+	}
+
+	return cnt, nil
+}
+
+// ipamReleaseUpdate releases the ipam pools allocated by ipamAllocateUpdate
+// on top of the ones of the network n was updated from.
+func (n *network) ipamReleaseUpdate(old *network) {
+	ipam, err := n.getController().getIpamDriver(n.ipamType)
+	if err != nil {
+		log.Warnf("Failed to retrieve ipam driver to release address pool(s) of network %s (%s): %v", n.Name(), n.ID(), err)
+		return
+	}
+
+	for _, v := range []struct {
+		infoList *[]*IpamInfo
+		keep     int
+	}{
+		{&n.ipamV4Info, len(old.ipamV4Info)},
+		{&n.ipamV6Info, len(old.ipamV6Info)},
+	} {
+		for _, d := range (*v.infoList)[v.keep:] {
+			if err := ipam.ReleasePool(d.PoolID); err != nil {
+				log.Warnf("Failed to release address pool %s after failure to update network %s (%s)", d.PoolID, n.Name(), n.ID())
+			}
+		}
+		*v.infoList = (*v.infoList)[:v.keep]
+	}
+}
+
 func (n *network) addEndpoint(ep *endpoint) error {
 	d, err := n.driver()
 	if err != nil {
@@ -648,6 +1041,13 @@ func (n *network) addEndpoint(ep *endpoint) error {
 }
 
 func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoint, error) {
+	start := time.Now()
+	ep, err := n.createEndpoint(name, options...)
+	observeOp("endpoint_create", n.Type(), start, err)
+	return ep, err
+}
+
+func (n *network) createEndpoint(name string, options ...EndpointOption) (Endpoint, error) {
 	var err error
 	if !config.IsValidName(name) {
 		return nil, ErrInvalidName(name)
@@ -671,6 +1071,19 @@ func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoi
 
 	ep.processOptions(options...)
 
+	if err = ep.validateLoadBalancer(); err != nil {
+		return nil, err
+	}
+
+	if err = ep.validateHealthCheck(); err != nil {
+		return nil, err
+	}
+
+	// The pools the endpoint gets its addresses from must not be released
+	// before it is stored
+	n.getController().ipamResize.RLock()
+	defer n.getController().ipamResize.RUnlock()
+
 	if err = ep.assignAddress(true, !n.postIPv6); err != nil {
 		return nil, err
 	}
@@ -695,6 +1108,10 @@ func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoi
 		return nil, err
 	}
 
+	if err = ep.assignAdditionalAddresses(); err != nil {
+		return nil, err
+	}
+
 	if err = n.getController().updateToStore(ep); err != nil {
 		return nil, err
 	}
@@ -719,6 +1136,8 @@ func (n *network) CreateEndpoint(name string, options ...EndpointOption) (Endpoi
 		return nil, err
 	}
 
+	n.getController().publish(Event{Type: EventEndpointCreate, NetworkID: n.ID(), EndpointID: ep.ID()})
+
 	return ep, nil
 }
 
@@ -782,45 +1201,95 @@ func (n *network) EndpointByID(id string) (Endpoint, error) {
 }
 
 func (n *network) updateSvcRecord(ep *endpoint, localEps []*endpoint, isAdd bool) {
-	if ep.isAnonymous() {
+	n.updateSvcNames(ep, ep.svcNames(), localEps, isAdd)
+}
+
+// updateSvcNames adds or removes the records of the passed names of the
+// endpoint, and propagates the change to the hosts file of the containers
+// attached to the local endpoints
+func (n *network) updateSvcNames(ep *endpoint, names []string, localEps []*endpoint, isAdd bool) {
+	iface := ep.Iface()
+	if len(names) == 0 || iface.Address() == nil {
 		return
 	}
 
 	c := n.getController()
+	n.Lock()
+	netName := n.name
+	n.Unlock()
+
+	ep.Lock()
+	ports := append([]types.TransportPort(nil), ep.exposedPorts...)
+	anonymous := ep.anonymous
+	ep.Unlock()
+
+	var (
+		recs []etchosts.Record
+		ip   = iface.Address().IP
+		ip6  net.IP
+		name = ep.Name() + "." + netName
+	)
+	if iface.AddressIPv6() != nil {
+		ip6 = iface.AddressIPv6().IP
+	}
+
+	c.Lock()
 	sr, ok := c.svcDb[n.ID()]
 	if !ok {
-		c.svcDb[n.ID()] = svcMap{}
-		sr = c.svcDb[n.ID()]
+		sr = newSvcInfo()
+		c.svcDb[n.ID()] = sr
 	}
 
-	n.Lock()
-	var recs []etchosts.Record
-	if iface := ep.Iface(); iface.Address() != nil {
-		if isAdd {
-			// If we already have this endpoint in service db just return
-			if _, ok := sr[ep.Name()]; ok {
-				n.Unlock()
-				return
+	for _, h := range names {
+		for _, host := range []string{h, h + "." + netName} {
+			if isAdd {
+				// Skip the records the service db already has
+				if !addSvcIP(sr.svcMap, host, ip) {
+					continue
+				}
+				if ip6 != nil {
+					addSvcIP(sr.svcIPv6Map, host, ip6)
+				}
+			} else {
+				if !deleteSvcIP(sr.svcMap, host, ip) {
+					continue
+				}
+				if ip6 != nil {
+					deleteSvcIP(sr.svcIPv6Map, host, ip6)
+				}
 			}
 
-			sr[ep.Name()] = iface.Address().IP
-			sr[ep.Name()+"."+n.name] = iface.Address().IP
-		} else {
-			delete(sr, ep.Name())
-			delete(sr, ep.Name()+"."+n.name)
+			recs = append(recs, etchosts.Record{
+				Hosts: host,
+				IP:    ip.String(),
+			})
 		}
 
-		recs = append(recs, etchosts.Record{
-			Hosts: ep.Name(),
-			IP:    iface.Address().IP.String(),
-		})
-
-		recs = append(recs, etchosts.Record{
-			Hosts: ep.Name() + "." + n.name,
-			IP:    iface.Address().IP.String(),
-		})
+		// Reverse lookups and SRV records resolve to the endpoint name
+		if anonymous || h != ep.Name() {
+			continue
+		}
+		for _, p := range ports {
+			if isAdd {
+				sr.srvMap[srvName(p, h)] = srvRecord{target: name, port: p.Port}
+				sr.srvMap[srvName(p, name)] = srvRecord{target: name, port: p.Port}
+			} else {
+				delete(sr.srvMap, srvName(p, h))
+				delete(sr.srvMap, srvName(p, name))
+			}
+		}
+		for _, a := range []net.IP{ip, ip6} {
+			if a == nil {
+				continue
+			}
+			if isAdd {
+				sr.ipMap[a.String()] = name
+			} else if sr.ipMap[a.String()] == name {
+				delete(sr.ipMap, a.String())
+			}
+		}
 	}
-	n.Unlock()
+	c.Unlock()
 
 	// If there are no records to add or delete then simply return here
 	if len(recs) == 0 {
@@ -833,7 +1302,9 @@ func (n *network) updateSvcRecord(ep *endpoint, localEps []*endpoint, isAdd bool
 			continue
 		}
 
-		if sb, hasSandbox := lEp.getSandbox(); hasSandbox {
+		// Containers using the embedded DNS server resolve the
+		// service records through it
+		if sb, hasSandbox := lEp.getSandbox(); hasSandbox && !sb.config.useEmbeddedDNS {
 			sbList = append(sbList, sb)
 		}
 	}
@@ -847,27 +1318,153 @@ func (n *network) updateSvcRecord(ep *endpoint, localEps []*endpoint, isAdd bool
 	}
 }
 
+// addSvcIP adds ip to the addresses of host. It returns false if host
+// already had it.
+func addSvcIP(svcMap map[string][]net.IP, host string, ip net.IP) bool {
+	for _, i := range svcMap[host] {
+		if i.Equal(ip) {
+			return false
+		}
+	}
+	svcMap[host] = append(svcMap[host], ip)
+	return true
+}
+
+// deleteSvcIP removes ip from the addresses of host. It returns false if
+// host did not have it.
+func deleteSvcIP(svcMap map[string][]net.IP, host string, ip net.IP) bool {
+	ips := svcMap[host]
+	for i, a := range ips {
+		if !a.Equal(ip) {
+			continue
+		}
+		if len(ips) == 1 {
+			delete(svcMap, host)
+		} else {
+			svcMap[host] = append(ips[:i:i], ips[i+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
 func (n *network) getSvcRecords(ep *endpoint) []etchosts.Record {
-	n.Lock()
-	defer n.Unlock()
+	var epIP net.IP
+	if ep != nil {
+		if iface := ep.Iface(); iface.Address() != nil {
+			epIP = iface.Address().IP
+		}
+	}
+
+	c := n.getController()
+	c.Lock()
+	defer c.Unlock()
 
 	var recs []etchosts.Record
-	sr, _ := n.ctrlr.svcDb[n.id]
+	sr, ok := c.svcDb[n.ID()]
+	if !ok {
+		return nil
+	}
 
-	for h, ip := range sr {
-		if ep != nil && strings.Split(h, ".")[0] == ep.Name() {
-			continue
-		}
+	for h, ips := range sr.svcMap {
+		for _, ip := range ips {
+			// The container hosts file already has its own names
+			if ip.Equal(epIP) {
+				continue
+			}
 
-		recs = append(recs, etchosts.Record{
-			Hosts: h,
-			IP:    ip.String(),
-		})
+			recs = append(recs, etchosts.Record{
+				Hosts: h,
+				IP:    ip.String(),
+			})
+		}
 	}
 
 	return recs
 }
 
+// resolveName returns the addresses of IP version ipVer the endpoint named
+// name is reachable at on this network. The second return value tells
+// whether the name is known at all.
+func (n *network) resolveName(name string, ipVer int) ([]net.IP, bool) {
+	c := n.getController()
+	c.Lock()
+	defer c.Unlock()
+
+	sr, ok := c.svcDb[n.ID()]
+	if !ok {
+		return nil, false
+	}
+
+	_, known := lookupSvcName(sr.svcMap, name)
+	svcMap := sr.svcMap
+	if ipVer == 6 {
+		svcMap = sr.svcIPv6Map
+	}
+
+	ips, ok := lookupSvcName(svcMap, name)
+	if !ok {
+		return nil, known
+	}
+
+	return append([]net.IP(nil), ips...), true
+}
+
+// resolveIP returns the name of the endpoint owning the address ip on
+// this network
+func (n *network) resolveIP(ip net.IP) (string, bool) {
+	c := n.getController()
+	c.Lock()
+	defer c.Unlock()
+
+	sr, ok := c.svcDb[n.ID()]
+	if !ok {
+		return "", false
+	}
+
+	name, ok := sr.ipMap[ip.String()]
+	return name, ok
+}
+
+// resolveSRV returns the SRV record named name on this network
+func (n *network) resolveSRV(name string) (srvRecord, bool) {
+	c := n.getController()
+	c.Lock()
+	defer c.Unlock()
+
+	sr, ok := c.svcDb[n.ID()]
+	if !ok {
+		return srvRecord{}, false
+	}
+
+	if srv, ok := sr.srvMap[name]; ok {
+		return srv, true
+	}
+
+	for h, srv := range sr.srvMap {
+		if strings.EqualFold(h, name) {
+			return srv, true
+		}
+	}
+
+	return srvRecord{}, false
+}
+
+// lookupSvcName looks name up in svcMap. Names are case insensitive.
+func lookupSvcName(svcMap map[string][]net.IP, name string) ([]net.IP, bool) {
+	if ips, ok := svcMap[name]; ok {
+		return ips, true
+	}
+
+	for h, ips := range svcMap {
+		if strings.EqualFold(h, name) {
+			return ips, true
+		}
+	}
+
+	return nil, false
+}
+
 func (n *network) getController() *controller {
 	n.Lock()
 	defer n.Unlock()
@@ -935,17 +1532,13 @@ func (n *network) ipamAllocateVersion(ipVer int, ipam ipamapi.Ipam) error {
 	log.Debugf("Allocating IPv%d pools for network %s (%s)", ipVer, n.Name(), n.ID())
 
 	for i, cfg := range *cfgList {
-		if err = cfg.Validate(); err != nil {
+		var d *IpamInfo
+		if d, err = n.ipamAllocatePool(ipam, cfg, ipVer); err != nil {
+			*infoList = (*infoList)[:i]
 			return err
 		}
-		d := &IpamInfo{}
 		(*infoList)[i] = d
 
-		d.PoolID, d.Pool, d.Meta, err = ipam.RequestPool(n.addrSpace, cfg.PreferredPool, cfg.SubPool, cfg.Options, ipVer == 6)
-		if err != nil {
-			return err
-		}
-
 		defer func() {
 			if err != nil {
 				if err := ipam.ReleasePool(d.PoolID); err != nil {
@@ -953,43 +1546,69 @@ func (n *network) ipamAllocateVersion(ipVer int, ipam ipamapi.Ipam) error {
 				}
 			}
 		}()
+	}
+
+	return nil
+}
+
+// ipamAllocatePool requests the address pool described by cfg to the ipam
+// driver along with the gateway and the auxiliary addresses of the pool.
+func (n *network) ipamAllocatePool(ipam ipamapi.Ipam, cfg *IpamConf, ipVer int) (d *IpamInfo, err error) {
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
 
-		if gws, ok := d.Meta[netlabel.Gateway]; ok {
-			if d.Gateway, err = types.ParseCIDR(gws); err != nil {
-				return types.BadRequestErrorf("failed to parse gateway address (%v) returned by ipam driver: %v", gws, err)
+	d = &IpamInfo{}
+	d.PoolID, d.Pool, d.Meta, err = ipam.RequestPool(n.addrSpace, cfg.PreferredPool, cfg.SubPool, cfg.Options, ipVer == 6)
+	if err != nil {
+		return nil, err
+	}
+
+	poolID := d.PoolID
+	defer func() {
+		if err != nil {
+			if err := ipam.ReleasePool(poolID); err != nil {
+				log.Warnf("Failed to release address pool %s after failure to allocate it for network %s (%s)", poolID, n.Name(), n.ID())
 			}
 		}
+	}()
 
-		// If user requested a specific gateway, libnetwork will allocate it
-		// irrespective of whether ipam driver returned a gateway already.
-		// If none of the above is true, libnetwork will allocate one.
-		if cfg.Gateway != "" || d.Gateway == nil {
-			if d.Gateway, _, err = ipam.RequestAddress(d.PoolID, net.ParseIP(cfg.Gateway), nil); err != nil {
-				return types.InternalErrorf("failed to allocate gateway (%v): %v", cfg.Gateway, err)
-			}
+	if gws, ok := d.Meta[netlabel.Gateway]; ok {
+		if d.Gateway, err = types.ParseCIDR(gws); err != nil {
+			return nil, types.BadRequestErrorf("failed to parse gateway address (%v) returned by ipam driver: %v", gws, err)
 		}
+	}
 
-		// Auxiliary addresses must be part of the master address pool
-		// If they fall into the container addressable pool, libnetwork will reserve them
-		if cfg.AuxAddresses != nil {
-			var ip net.IP
-			d.IPAMData.AuxAddresses = make(map[string]*net.IPNet, len(cfg.AuxAddresses))
-			for k, v := range cfg.AuxAddresses {
-				if ip = net.ParseIP(v); ip == nil {
-					return types.BadRequestErrorf("non parsable secondary ip address (%s:%s) passed for network %s", k, v, n.Name())
-				}
-				if !d.Pool.Contains(ip) {
-					return types.ForbiddenErrorf("auxilairy address: (%s:%s) must belong to the master pool: %s", k, v, d.Pool)
-				}
-				// Attempt reservation in the container addressable pool, silent the error if address does not belong to that pool
-				if d.IPAMData.AuxAddresses[k], _, err = ipam.RequestAddress(d.PoolID, ip, nil); err != nil && err != ipamapi.ErrIPOutOfRange {
-					return types.InternalErrorf("failed to allocate secondary ip address (%s:%s): %v", k, v, err)
-				}
+	// If user requested a specific gateway, libnetwork will allocate it
+	// irrespective of whether ipam driver returned a gateway already.
+	// If none of the above is true, libnetwork will allocate one.
+	if cfg.Gateway != "" || d.Gateway == nil {
+		if d.Gateway, _, err = ipam.RequestAddress(d.PoolID, net.ParseIP(cfg.Gateway), nil); err != nil {
+			return nil, types.InternalErrorf("failed to allocate gateway (%v): %v", cfg.Gateway, err)
+		}
+	}
+
+	// Auxiliary addresses must be part of the master address pool
+	// If they fall into the container addressable pool, libnetwork will reserve them
+	if cfg.AuxAddresses != nil {
+		var ip net.IP
+		d.IPAMData.AuxAddresses = make(map[string]*net.IPNet, len(cfg.AuxAddresses))
+		for k, v := range cfg.AuxAddresses {
+			if ip = net.ParseIP(v); ip == nil {
+				return nil, types.BadRequestErrorf("non parsable secondary ip address (%s:%s) passed for network %s", k, v, n.Name())
+			}
+			if !d.Pool.Contains(ip) {
+				return nil, types.ForbiddenErrorf("auxilairy address: (%s:%s) must belong to the master pool: %s", k, v, d.Pool)
+			}
+			// Attempt reservation in the container addressable pool, silent the error if address does not belong to that pool
+			if d.IPAMData.AuxAddresses[k], _, err = ipam.RequestAddress(d.PoolID, ip, nil); err != nil && err != ipamapi.ErrIPOutOfRange {
+				return nil, types.InternalErrorf("failed to allocate secondary ip address (%s:%s): %v", k, v, err)
 			}
 		}
+		err = nil
 	}
 
-	return nil
+	return d, nil
 }
 
 func (n *network) ipamRelease() {
@@ -1113,6 +1732,17 @@ func (n *network) DriverOptions() map[string]string {
 	return map[string]string{}
 }
 
+func (n *network) Labels() map[string]string {
+	n.Lock()
+	defer n.Unlock()
+
+	labels := make(map[string]string, len(n.labels))
+	for k, v := range n.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
 func (n *network) Scope() string {
 	return n.driverScope()
 }
@@ -2,10 +2,12 @@ package osl
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os/exec"
 	"regexp"
 	"sync"
+	"syscall"
 
 	"github.com/docker/libnetwork/types"
 	"github.com/vishvananda/netlink"
@@ -21,6 +23,7 @@ type nwIface struct {
 	dstMaster   string
 	address     *net.IPNet
 	addressIPv6 *net.IPNet
+	additional  []*net.IPNet
 	routes      []*net.IPNet
 	bridge      bool
 	ns          *networkNamespace
@@ -76,6 +79,18 @@ func (i *nwIface) AddressIPv6() *net.IPNet {
 	return types.GetIPNetCopy(i.addressIPv6)
 }
 
+func (i *nwIface) AdditionalAddresses() []*net.IPNet {
+	i.Lock()
+	defer i.Unlock()
+
+	addrs := make([]*net.IPNet, len(i.additional))
+	for index, addr := range i.additional {
+		addrs[index] = types.GetIPNetCopy(addr)
+	}
+
+	return addrs
+}
+
 func (i *nwIface) Routes() []*net.IPNet {
 	i.Lock()
 	defer i.Unlock()
@@ -201,55 +216,86 @@ func (n *networkNamespace) findDst(srcName string, isBridge bool) string {
 }
 
 func (n *networkNamespace) BindVirtualIP(vip string) error {
+	addr, err := virtualIPAddr(vip)
+	if err != nil {
+		return err
+	}
+
 	n.Lock()
 	path := n.path
 	n.Unlock()
 
-	return nsInvoke(path, func(nsFD int) error {
-		// Do nothing before namespace switchs happen
-		return nil
-	}, func(callerFD int) error {
+	return nsInvoke(path, func(nsFD int) error { return nil }, func(callerFD int) error {
 		// Find the loopback interface
 		lo, err := netlink.LinkByName("lo")
 		if err != nil {
 			return fmt.Errorf("failed to get loopback device: %v", err)
 		}
 
-		// Down the interface before configuring
-		if err := netlink.LinkSetDown(lo); err != nil {
-			return fmt.Errorf("failed to set loopback device down: %v", err)
+		if addr.IP.To4() == nil {
+			if err := configureNdp(); err != nil {
+				return fmt.Errorf("failed to configure ndp: %v", err)
+			}
+		} else if err := configureArp(); err != nil {
+			return fmt.Errorf("failed to configure arp: %v", err)
 		}
 
-		ip, ipn, err := net.ParseCIDR(vip)
-		if err != nil {
-			return fmt.Errorf("vip %s must in CIDR notation", vip)
-		}
-		addr := &netlink.Addr{
-			IPNet: &net.IPNet{
-				IP:   ip,
-				Mask: ipn.Mask,
-			},
+		// Add virtual ip to loopback device
+		if err := netlink.AddrAdd(lo, addr); err != nil && err != syscall.EEXIST {
+			return fmt.Errorf("failed to bind virtual ip %s to loopback device: %v", vip, err)
 		}
 
-		// Add virtual ip to loopback device
-		err = netlink.AddrAdd(lo, addr)
-		if err != nil {
-			return fmt.Errorf("faild to bind virtual ip to loopback device: %v", err)
+		// Make sure the interface is up
+		if err := netlink.LinkSetUp(lo); err != nil {
+			return fmt.Errorf("failed to set link up: %v", err)
 		}
 
-		if err := configureArp(); err != nil {
-			return fmt.Errorf("failed to configure arp: %v", err)
+		return nil
+	})
+}
+
+func (n *networkNamespace) UnbindVirtualIP(vip string) error {
+	addr, err := virtualIPAddr(vip)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	path := n.path
+	n.Unlock()
+
+	return nsInvoke(path, func(nsFD int) error { return nil }, func(callerFD int) error {
+		lo, err := netlink.LinkByName("lo")
+		if err != nil {
+			return fmt.Errorf("failed to get loopback device: %v", err)
 		}
 
-		// Up the interface
-		if err := netlink.LinkSetUp(lo); err != nil {
-			return fmt.Errorf("failed to set link up: %v", err)
+		if err := netlink.AddrDel(lo, addr); err != nil && err != syscall.EADDRNOTAVAIL {
+			return fmt.Errorf("failed to unbind virtual ip %s from loopback device: %v", vip, err)
 		}
 
 		return nil
 	})
 }
 
+// virtualIPAddr converts the virtual ip in CIDR notation to the
+// address to be programmed on the loopback device. IPv6 addresses
+// skip duplicate address detection, the virtual ip is shared with
+// the load balancer and the real servers by design.
+func virtualIPAddr(vip string) (*netlink.Addr, error) {
+	ip, ipn, err := net.ParseCIDR(vip)
+	if err != nil {
+		return nil, fmt.Errorf("vip %s must be in CIDR notation", vip)
+	}
+
+	addr := &netlink.Addr{IPNet: &net.IPNet{IP: ip, Mask: ipn.Mask}}
+	if ip.To4() == nil {
+		addr.Flags = syscall.IFA_F_NODAD
+	}
+
+	return addr, nil
+}
+
 func (n *networkNamespace) AddInterface(srcName, dstPrefix string, options ...IfaceOption) error {
 	i := &nwIface{srcName: srcName, dstName: dstPrefix, ns: n}
 	i.processInterfaceOptions(options...)
@@ -334,26 +380,27 @@ func (n *networkNamespace) AddInterface(srcName, dstPrefix string, options ...If
 	})
 }
 
+// configureArp makes sure the sandbox neither answers arp requests nor
+// uses as source address in its own requests the virtual ips bound to
+// the loopback device, so that the load balancer keeps owning them.
 func configureArp() error {
-	if err := setupArpIgnore(); err != nil {
-		return err
-	}
-	if err := setupArpAnnounce(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func setupArpIgnore() error {
-	if _, err := exec.Command("echo", "1", ">>", arpIgnoreFile).Output(); err != nil {
-		return fmt.Errorf("failed to setup arp_ignore: %v", err)
+	for _, s := range arpSettings {
+		if err := ioutil.WriteFile(s.path, []byte(s.value), 0644); err != nil {
+			return fmt.Errorf("failed to setup %s: %v", s.path, err)
+		}
 	}
 	return nil
 }
 
-func setupArpAnnounce() error {
-	if _, err := exec.Command("echo", "2", ">>", arpAnnounceFile).Output(); err != nil {
-		return fmt.Errorf("failed to setup arp_announce: %v", err)
+// configureNdp enables IPv6 on the loopback device and turns off ndp
+// proxying. Neighbor solicitations are only answered for the addresses
+// configured on the receiving interface, hence the virtual ips bound to
+// the loopback device are never advertised once proxying is disabled.
+func configureNdp() error {
+	for _, s := range ndpSettings {
+		if err := ioutil.WriteFile(s.path, []byte(s.value), 0644); err != nil {
+			return fmt.Errorf("failed to setup %s: %v", s.path, err)
+		}
 	}
 	return nil
 }
@@ -388,12 +435,21 @@ func setInterfaceMaster(iface netlink.Link, i *nwIface) error {
 }
 
 func setInterfaceIP(iface netlink.Link, i *nwIface) error {
-	if i.Address() == nil {
-		return nil
+	if i.Address() != nil {
+		ipAddr := &netlink.Addr{IPNet: i.Address(), Label: ""}
+		if err := netlink.AddrAdd(iface, ipAddr); err != nil {
+			return err
+		}
 	}
 
-	ipAddr := &netlink.Addr{IPNet: i.Address(), Label: ""}
-	return netlink.AddrAdd(iface, ipAddr)
+	for _, addr := range i.AdditionalAddresses() {
+		ipAddr := &netlink.Addr{IPNet: addr, Label: ""}
+		if err := netlink.AddrAdd(iface, ipAddr); err != nil {
+			return fmt.Errorf("failed to add address %s: %v", addr, err)
+		}
+	}
+
+	return nil
 }
 
 func setInterfaceIPv6(iface netlink.Link, i *nwIface) error {
@@ -426,10 +482,26 @@ func setInterfaceRoutes(iface netlink.Link, i *nwIface) error {
 // we cannot gather the statistics from /sys/class/net/<dev>/statistics/<counter> files. Per-netns stats
 // are naturally found in /proc/net/dev in kernels which support netns (ifconfig relies on that).
 const (
-	netStatsFile    = "/proc/net/dev"
-	base            = "[ ]*%s:([ ]+[0-9]+){16}"
-	arpIgnoreFile   = "/proc/sys/net/ipv4/conf/lo/arg_ignore"
-	arpAnnounceFile = "/proc/sys/net/ipv4/conf/lo/arg_announce"
+	netStatsFile = "/proc/net/dev"
+	base         = "[ ]*%s:([ ]+[0-9]+){16}"
+)
+
+type sysctlSetting struct {
+	path  string
+	value string
+}
+
+var (
+	arpSettings = []sysctlSetting{
+		{"/proc/sys/net/ipv4/conf/all/arp_ignore", "1"},
+		{"/proc/sys/net/ipv4/conf/lo/arp_ignore", "1"},
+		{"/proc/sys/net/ipv4/conf/all/arp_announce", "2"},
+		{"/proc/sys/net/ipv4/conf/lo/arp_announce", "2"},
+	}
+	ndpSettings = []sysctlSetting{
+		{"/proc/sys/net/ipv6/conf/lo/disable_ipv6", "0"},
+		{"/proc/sys/net/ipv6/conf/all/proxy_ndp", "0"},
+	}
 )
 
 func scanInterfaceStats(data, ifName string, i *types.InterfaceStatistics) error {
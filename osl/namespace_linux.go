@@ -6,9 +6,12 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/reexec"
@@ -20,6 +23,12 @@ import (
 
 const prefix = "/var/run/docker/netns"
 
+// File system types of a mounted network namespace file
+const (
+	nsfsMagic = 0x6e736673
+	procMagic = 0x9fa0
+)
+
 var (
 	once             sync.Once
 	garbagePathMap   = make(map[string]bool)
@@ -149,6 +158,98 @@ func NewSandbox(key string, osCreate bool) (Sandbox, error) {
 	return &networkNamespace{path: key}, nil
 }
 
+// RestoreSandbox returns the sandbox instance for the network namespace
+// still mounted at the key, eg. by a previous instance of the daemon. It
+// returns a types.NotFoundError if the namespace is gone.
+func RestoreSandbox(key string) (Sandbox, error) {
+	once.Do(createBasePath)
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(key, &st); err != nil {
+		if os.IsNotExist(err) {
+			return nil, types.NotFoundErrorf("namespace %s does not exist", key)
+		}
+		return nil, fmt.Errorf("failed to stat namespace %s: %v", key, err)
+	}
+
+	// A mounted namespace file belongs to nsfs, or to proc before linux 3.19
+	if int64(st.Type) != nsfsMagic && int64(st.Type) != procMagic {
+		return nil, types.NotFoundErrorf("namespace %s is not mounted", key)
+	}
+
+	return &networkNamespace{path: key}, nil
+}
+
+func (n *networkNamespace) Restore(ifsopt map[string][]IfaceOption, routes []*types.StaticRoute, gw net.IP, gw6 net.IP) error {
+	ifaces := make([]*nwIface, 0, len(ifsopt))
+	for srcName, options := range ifsopt {
+		i := &nwIface{srcName: srcName, ns: n}
+		i.processInterfaceOptions(options...)
+		ifaces = append(ifaces, i)
+	}
+
+	err := nsInvoke(n.nsPath(), func(nsFD int) error { return nil }, func(callerFD int) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("failed to list the links: %v", err)
+		}
+
+		for _, i := range ifaces {
+			for _, link := range links {
+				if linkHasAddress(link, i.address) || linkHasAddress(link, i.addressIPv6) {
+					i.dstName = link.Attrs().Name
+					break
+				}
+			}
+			if i.dstName == "" {
+				return fmt.Errorf("could not find interface %s in namespace %s", i.srcName, n.path)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	for _, i := range ifaces {
+		n.iFaces = append(n.iFaces, i)
+
+		// Resume the generation of the interface names past the restored ones
+		prefix := strings.TrimRightFunc(i.dstName, unicode.IsDigit)
+		if index, err := strconv.Atoi(i.dstName[len(prefix):]); err == nil && index >= n.nextIfIndex {
+			n.nextIfIndex = index + 1
+		}
+	}
+	n.staticRoutes = append(n.staticRoutes, routes...)
+	n.gw = gw
+	n.gwv6 = gw6
+
+	return nil
+}
+
+func linkHasAddress(link netlink.Link, addr *net.IPNet) bool {
+	if addr == nil {
+		return false
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range addrs {
+		if a.IP.Equal(addr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (n *networkNamespace) InterfaceOptions() IfaceOptionSetter {
 	return n
 }
@@ -19,6 +19,12 @@ func NewSandbox(key string, osCreate bool) (Sandbox, error) {
 	return nil, nil
 }
 
+// RestoreSandbox returns the sandbox instance for the existing namespace
+// identified by the key
+func RestoreSandbox(key string) (Sandbox, error) {
+	return nil, nil
+}
+
 func GetSandboxForExternalKey(path string, key string) (Sandbox, error) {
 	return nil, nil
 }
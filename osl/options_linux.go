@@ -54,6 +54,12 @@ func (n *networkNamespace) AddressIPv6(addr *net.IPNet) IfaceOption {
 	}
 }
 
+func (n *networkNamespace) AdditionalAddresses(addrs []*net.IPNet) IfaceOption {
+	return func(i *nwIface) {
+		i.additional = addrs
+	}
+}
+
 func (n *networkNamespace) Routes(routes []*net.IPNet) IfaceOption {
 	return func(i *nwIface) {
 		i.routes = routes
@@ -56,11 +56,20 @@ type Sandbox interface {
 	// Returns an interface with methods to get sandbox state.
 	Info() Info
 
+	// Restore rebuilds the state of a sandbox obtained from RestoreSandbox
+	// from the interfaces, routes and gateways already programmed in it.
+	// The interfaces are keyed by their SrcName and found in the sandbox
+	// through the addresses set by their options.
+	Restore(ifsopt map[string][]IfaceOption, routes []*types.StaticRoute, gw net.IP, gw6 net.IP) error
+
 	// Destroy the sandbox
 	Destroy() error
 
 	// Bind virtual ip to loopback device
 	BindVirtualIP(vip string) error
+
+	// Unbind virtual ip from loopback device
+	UnbindVirtualIP(vip string) error
 }
 
 // NeighborOptionSetter interfaces defines the option setter methods for interface options
@@ -85,6 +94,10 @@ type IfaceOptionSetter interface {
 	// Address returns an option setter to set IPv6 address.
 	AddressIPv6(*net.IPNet) IfaceOption
 
+	// AdditionalAddresses returns an option setter to set the IPv4 and
+	// IPv6 addresses the interface holds besides its primary ones.
+	AdditionalAddresses([]*net.IPNet) IfaceOption
+
 	// Master returns an option setter to set the master interface if any for this
 	// interface. The master interface name should refer to the srcname of a
 	// previously added interface of type bridge.
@@ -138,6 +151,9 @@ type Interface interface {
 	// IPv6 address for the interface.
 	AddressIPv6() *net.IPNet
 
+	// Additional IPv4 and IPv6 addresses for the interface.
+	AdditionalAddresses() []*net.IPNet
+
 	// IP routes for the interface.
 	Routes() []*net.IPNet
 
@@ -19,6 +19,12 @@ func NewSandbox(key string, osCreate bool) (Sandbox, error) {
 	return nil, nil
 }
 
+// RestoreSandbox returns the sandbox instance for the existing namespace
+// identified by the key
+func RestoreSandbox(key string) (Sandbox, error) {
+	return nil, nil
+}
+
 // GC triggers garbage collection of namespace path right away
 // and waits for it.
 func GC() {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/testutils"
 	"github.com/docker/libnetwork/types"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
@@ -62,6 +63,13 @@ func newInfo(t *testing.T) (Sandbox, error) {
 	intf1.address = addr
 	intf1.address.IP = ip4
 
+	ip4, addr, err = net.ParseCIDR("192.168.1.101/24")
+	if err != nil {
+		return nil, err
+	}
+	addr.IP = ip4
+	intf1.additional = []*net.IPNet{addr}
+
 	// ip6, addrv6, err := net.ParseCIDR("2001:DB8::ABCD/48")
 	ip6, addrv6, err := net.ParseCIDR("fe80::2/64")
 	if err != nil {
@@ -179,3 +187,106 @@ func TestScanStatistics(t *testing.T) {
 		t.Fatalf("Error scanning the statistics")
 	}
 }
+
+func loAddrs(t *testing.T, s Sandbox) []netlink.Addr {
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatalf("Could not get the current netns: %v", err)
+	}
+	defer origns.Close()
+
+	f, err := os.OpenFile(s.Key(), os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed top open network namespace path %q: %v", s.Key(), err)
+	}
+	defer f.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err = netns.Set(netns.NsHandle(f.Fd())); err != nil {
+		t.Fatalf("Setting to the namespace pointed to by the sandbox %s failed: %v", s.Key(), err)
+	}
+	defer netns.Set(origns)
+
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := netlink.AddrList(lo, netlink.FAMILY_ALL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addrs
+}
+
+func hasLoAddr(addrs []netlink.Addr, vip string) bool {
+	ip, _, _ := net.ParseCIDR(vip)
+	for _, a := range addrs {
+		if a.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBindUnbindVirtualIP(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	key, err := newKey(t)
+	if err != nil {
+		t.Fatalf("Failed to obtain a key: %v", err)
+	}
+
+	s, err := NewSandbox(key, true)
+	if err != nil {
+		t.Fatalf("Failed to create a new sandbox: %v", err)
+	}
+	runtime.LockOSThread()
+	defer s.Destroy()
+
+	if err := s.BindVirtualIP("10.10.10.10"); err == nil {
+		t.Fatalf("Expected failure for virtual ip not in CIDR notation")
+	}
+
+	vips := []string{"10.10.10.10/32", "fd00::10/128"}
+	for _, vip := range vips {
+		if err := s.BindVirtualIP(vip); err != nil {
+			t.Fatal(err)
+		}
+		runtime.LockOSThread()
+
+		// Binding twice must be a no-op
+		if err := s.BindVirtualIP(vip); err != nil {
+			t.Fatal(err)
+		}
+		runtime.LockOSThread()
+	}
+
+	addrs := loAddrs(t, s)
+	for _, vip := range vips {
+		if !hasLoAddr(addrs, vip) {
+			t.Fatalf("Virtual ip %s not found on loopback device: %v", vip, addrs)
+		}
+	}
+
+	for _, vip := range vips {
+		if err := s.UnbindVirtualIP(vip); err != nil {
+			t.Fatal(err)
+		}
+		runtime.LockOSThread()
+	}
+
+	addrs = loAddrs(t, s)
+	for _, vip := range vips {
+		if hasLoAddr(addrs, vip) {
+			t.Fatalf("Virtual ip %s still bound to loopback device: %v", vip, addrs)
+		}
+	}
+
+	// Unbinding a virtual ip which is not bound must not fail
+	if err := s.UnbindVirtualIP(vips[0]); err != nil {
+		t.Fatal(err)
+	}
+}
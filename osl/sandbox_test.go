@@ -7,6 +7,7 @@ import (
 
 	"github.com/docker/docker/pkg/reexec"
 	"github.com/docker/libnetwork/testutils"
+	"github.com/vishvananda/netlink"
 )
 
 func TestMain(m *testing.M) {
@@ -43,7 +44,8 @@ func TestSandboxCreate(t *testing.T) {
 		err = s.AddInterface(i.SrcName(), i.DstName(),
 			tbox.InterfaceOptions().Bridge(i.Bridge()),
 			tbox.InterfaceOptions().Address(i.Address()),
-			tbox.InterfaceOptions().AddressIPv6(i.AddressIPv6()))
+			tbox.InterfaceOptions().AddressIPv6(i.AddressIPv6()),
+			tbox.InterfaceOptions().AdditionalAddresses(i.AdditionalAddresses()))
 		if err != nil {
 			t.Fatalf("Failed to add interfaces to sandbox: %v", err)
 		}
@@ -188,3 +190,84 @@ func TestAddRemoveInterface(t *testing.T) {
 	GC()
 	verifyCleanup(t, s, false)
 }
+
+func TestRestoreSandbox(t *testing.T) {
+	defer testutils.SetupTestOSContext(t)()
+
+	key, err := newKey(t)
+	if err != nil {
+		t.Fatalf("Failed to obtain a key: %v", err)
+	}
+
+	if _, err := RestoreSandbox(key); err == nil {
+		t.Fatal("Expected failure restoring a sandbox whose namespace is not mounted")
+	}
+
+	s, err := NewSandbox(key, true)
+	if err != nil {
+		t.Fatalf("Failed to create a new sandbox: %v", err)
+	}
+	runtime.LockOSThread()
+
+	tbox, err := newInfo(t)
+	if err != nil {
+		t.Fatalf("Failed to generate new sandbox info: %v", err)
+	}
+
+	i := tbox.Info().Interfaces()[0]
+	if err := s.AddInterface(i.SrcName(), i.DstName(),
+		tbox.InterfaceOptions().Address(i.Address()),
+		tbox.InterfaceOptions().AddressIPv6(i.AddressIPv6())); err != nil {
+		t.Fatalf("Failed to add interfaces to sandbox: %v", err)
+	}
+	runtime.LockOSThread()
+
+	rs, err := RestoreSandbox(key)
+	if err != nil {
+		t.Fatalf("Failed to restore the sandbox: %v", err)
+	}
+
+	ifsopt := map[string][]IfaceOption{
+		i.SrcName(): {rs.InterfaceOptions().Address(i.Address())},
+	}
+	if err := rs.Restore(ifsopt, nil, tbox.Info().Gateway(), nil); err != nil {
+		t.Fatalf("Failed to restore the sandbox state: %v", err)
+	}
+	runtime.LockOSThread()
+
+	ifaces := rs.Info().Interfaces()
+	if len(ifaces) != 1 || ifaces[0].SrcName() != i.SrcName() || ifaces[0].DstName() != sboxIfaceName+"0" {
+		t.Fatalf("Unexpected restored interfaces: %v", ifaces)
+	}
+	if !rs.Info().Gateway().Equal(tbox.Info().Gateway()) {
+		t.Fatalf("Unexpected restored gateway: %v", rs.Info().Gateway())
+	}
+
+	// Interfaces added after the restore must not clash with the restored ones
+	if err := rs.AddInterface(vethName4, sboxIfaceName); err != nil {
+		t.Fatalf("Failed to add interfaces to restored sandbox: %v", err)
+	}
+	runtime.LockOSThread()
+
+	verifySandbox(t, rs, []string{"0", "1"})
+	runtime.LockOSThread()
+
+	if err := ifaces[0].Remove(); err != nil {
+		t.Fatalf("Failed to remove restored interface from sandbox: %v", err)
+	}
+	runtime.LockOSThread()
+
+	verifySandbox(t, rs, []string{"1"})
+	runtime.LockOSThread()
+
+	if _, err := netlink.LinkByName(i.SrcName()); err != nil {
+		t.Fatalf("Restored interface was not moved back with its original name: %v", err)
+	}
+
+	if err := rs.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	GC()
+	verifyCleanup(t, rs, false)
+}
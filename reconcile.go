@@ -0,0 +1,422 @@
+package libnetwork
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/datastore"
+	"github.com/docker/libnetwork/ipamapi"
+)
+
+// InconsistencyType identifies the kind of inconsistency found by Reconcile.
+type InconsistencyType string
+
+const (
+	// InconsistencyEndpointCount is reported when the endpoint count of a
+	// network does not match the number of its endpoints in store
+	InconsistencyEndpointCount InconsistencyType = "endpoint_count"
+	// InconsistencyOrphanEndpoint is reported when an endpoint is attached
+	// to a sandbox which does not exist anymore
+	InconsistencyOrphanEndpoint InconsistencyType = "orphan_endpoint"
+	// InconsistencyStaleSandbox is reported when the store holds the state
+	// of a sandbox the controller does not know about
+	InconsistencyStaleSandbox InconsistencyType = "stale_sandbox"
+	// InconsistencyMissingEndpoint is reported when the state of a sandbox
+	// references an endpoint which does not exist anymore
+	InconsistencyMissingEndpoint InconsistencyType = "missing_endpoint"
+	// InconsistencyUnallocatedAddress is reported when an address in use by
+	// a network or an endpoint is not allocated in its ipam pool
+	InconsistencyUnallocatedAddress InconsistencyType = "unallocated_address"
+	// InconsistencyLeakedAddress is reported when an address allocated in
+	// an ipam pool is not in use by any network or endpoint
+	InconsistencyLeakedAddress InconsistencyType = "leaked_address"
+	// InconsistencyExpiredLease is reported when the lease of an address in
+	// use by a network or an endpoint expired
+	InconsistencyExpiredLease InconsistencyType = "expired_lease"
+)
+
+// Inconsistency describes a mismatch between the networks, endpoints,
+// sandboxes and ipam state found by Reconcile. Only the ids relevant
+// to the inconsistency type are set.
+type Inconsistency struct {
+	Type       InconsistencyType `json:"type"`
+	NetworkID  string            `json:"network_id,omitempty"`
+	EndpointID string            `json:"endpoint_id,omitempty"`
+	SandboxID  string            `json:"sandbox_id,omitempty"`
+	Address    string            `json:"address,omitempty"`
+	Detail     string            `json:"detail"`
+	// Repaired tells whether the inconsistency was fixed
+	Repaired bool `json:"repaired"`
+	// Error is the reason the repair failed, if it was attempted
+	Error string `json:"error,omitempty"`
+}
+
+// addressLister is implemented by the ipam drivers which can report the
+// addresses allocated in their pools.
+type addressLister interface {
+	AllocatedAddresses(poolID string) ([]net.IP, error)
+}
+
+// addressUser records who uses an address of an ipam pool
+type addressUser struct {
+	poolID     string
+	networkID  string
+	endpointID string
+	ip         net.IP
+}
+
+// poolAddresses collects the addresses in use in the pools of the same
+// address space and subnet, which share their allocation bitmask.
+type poolAddresses struct {
+	ipam    ipamapi.Ipam
+	poolIDs []string
+	users   map[string]*addressUser
+}
+
+type reconciler struct {
+	c      *controller
+	repair bool
+	found  []Inconsistency
+}
+
+// Reconcile cross-checks the networks, endpoints, endpoint counts, sandbox
+// states and ipam allocations in store and returns the inconsistencies it
+// finds. When repair is set, it also attempts to fix them. It is meant to
+// be run while no other network operation is in progress.
+func (c *controller) Reconcile(repair bool) ([]Inconsistency, error) {
+	nl, err := c.getNetworksFromStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get networks for reconciliation: %v", err)
+	}
+
+	r := &reconciler{c: c, repair: repair}
+
+	epMap := make(map[string][]*endpoint, len(nl))
+	for _, n := range nl {
+		epl, err := n.getEndpointsFromStore()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get endpoints of network %s for reconciliation: %v", n.Name(), err)
+		}
+		epl = r.checkEndpoints(n, epl)
+		r.checkEndpointCount(n, epl)
+		epMap[n.ID()] = epl
+	}
+
+	r.checkSandboxStates(epMap)
+	r.checkAddresses(nl, epMap)
+
+	return r.found, nil
+}
+
+func (r *reconciler) report(inc Inconsistency, fix func() error) {
+	if r.repair && fix != nil {
+		if err := fix(); err != nil {
+			inc.Error = err.Error()
+		} else {
+			inc.Repaired = true
+		}
+	}
+
+	log.Warnf("Reconciliation found %s inconsistency: %s (repaired: %t)", inc.Type, inc.Detail, inc.Repaired)
+	r.found = append(r.found, inc)
+}
+
+// checkEndpoints reports the local endpoints attached to a sandbox which
+// does not exist, and returns the endpoints left in the network.
+func (r *reconciler) checkEndpoints(n *network, epl []*endpoint) []*endpoint {
+	// The sandboxes of the global endpoints may live on other hosts
+	if n.DataScope() != datastore.LocalScope {
+		return epl
+	}
+
+	var keep []*endpoint
+	for _, ep := range epl {
+		sid := ep.sandboxID
+		if sid == "" {
+			keep = append(keep, ep)
+			continue
+		}
+
+		r.c.Lock()
+		_, ok := r.c.sandboxes[sid]
+		r.c.Unlock()
+		if ok {
+			keep = append(keep, ep)
+			continue
+		}
+
+		var deleted bool
+		r.report(Inconsistency{
+			Type:       InconsistencyOrphanEndpoint,
+			NetworkID:  n.ID(),
+			EndpointID: ep.ID(),
+			SandboxID:  sid,
+			Detail:     fmt.Sprintf("endpoint %s of network %s is attached to missing sandbox %s", ep.Name(), n.Name(), sid),
+		}, func() error {
+			if err := ep.Delete(); err != nil {
+				return err
+			}
+			deleted = true
+			return nil
+		})
+		if !deleted {
+			keep = append(keep, ep)
+		}
+	}
+
+	return keep
+}
+
+func (r *reconciler) checkEndpointCount(n *network, epl []*endpoint) {
+	ec := n.getEpCnt()
+
+	// The count may have been changed by the removal of orphan endpoints
+	if store := r.c.getStore(ec.DataScope()); store != nil {
+		if err := store.GetObject(datastore.Key(ec.Key()...), ec); err != nil {
+			log.Warnf("Could not refresh endpoint count of network %s during reconciliation: %v", n.Name(), err)
+		}
+	}
+
+	cnt := uint64(len(epl))
+	if ec.EndpointCnt() == cnt {
+		return
+	}
+
+	r.report(Inconsistency{
+		Type:      InconsistencyEndpointCount,
+		NetworkID: n.ID(),
+		Detail:    fmt.Sprintf("network %s has %d endpoints but its endpoint count is %d", n.Name(), cnt, ec.EndpointCnt()),
+	}, func() error {
+		return ec.setEndpointCnt(cnt)
+	})
+}
+
+func (r *reconciler) checkSandboxStates(epMap map[string][]*endpoint) {
+	known := make(map[string]bool)
+	for _, epl := range epMap {
+		for _, ep := range epl {
+			known[ep.ID()] = true
+		}
+	}
+
+	for _, sbs := range r.c.getSandboxStates() {
+		sbs := sbs
+
+		r.c.Lock()
+		_, ok := r.c.sandboxes[sbs.ID]
+		r.c.Unlock()
+		if !ok {
+			r.report(Inconsistency{
+				Type:      InconsistencyStaleSandbox,
+				SandboxID: sbs.ID,
+				Detail:    fmt.Sprintf("state of unknown sandbox %s for container %s is in store", sbs.ID, sbs.Cid),
+			}, func() error {
+				return r.c.deleteFromStore(sbs)
+			})
+			continue
+		}
+
+		var keep, missing []epState
+		for _, eps := range sbs.Eps {
+			if known[eps.Eid] {
+				keep = append(keep, eps)
+			} else {
+				missing = append(missing, eps)
+			}
+		}
+
+		// All the references are dropped with a single state update
+		var (
+			updated bool
+			uerr    error
+		)
+		fix := func() error {
+			if !updated {
+				updated = true
+				sbs.Eps = keep
+				uerr = r.c.updateToStore(sbs)
+			}
+			return uerr
+		}
+
+		for _, eps := range missing {
+			r.report(Inconsistency{
+				Type:       InconsistencyMissingEndpoint,
+				NetworkID:  eps.Nid,
+				EndpointID: eps.Eid,
+				SandboxID:  sbs.ID,
+				Detail:     fmt.Sprintf("state of sandbox %s references missing endpoint %s", sbs.ID, eps.Eid),
+			}, fix)
+		}
+	}
+}
+
+func (r *reconciler) checkAddresses(nl []*network, epMap map[string][]*endpoint) {
+	pools := make(map[string]*poolAddresses)
+	byID := make(map[string]*poolAddresses)
+
+	use := func(poolID string, u *addressUser) {
+		if pa, ok := byID[poolID]; ok && u.ip != nil {
+			u.poolID = poolID
+			pa.users[u.ip.String()] = u
+		}
+	}
+
+	for _, n := range nl {
+		if n.Type() == "host" || n.Type() == "null" || n.Type() == "ovs" {
+			continue
+		}
+
+		ipam, err := r.c.getIpamDriver(n.ipamType)
+		if err != nil {
+			log.Warnf("Could not find ipam driver %s of network %s during reconciliation: %v", n.ipamType, n.Name(), err)
+			continue
+		}
+
+		for _, d := range append(n.getIPInfo(4), n.getIPInfo(6)...) {
+			key := n.ipamType + "/" + n.addrSpace + "/" + d.Pool.String()
+			pa, ok := pools[key]
+			if !ok {
+				pa = &poolAddresses{ipam: ipam, users: make(map[string]*addressUser)}
+				pools[key] = pa
+			}
+			pa.poolIDs = append(pa.poolIDs, d.PoolID)
+			byID[d.PoolID] = pa
+
+			if d.Gateway != nil {
+				use(d.PoolID, &addressUser{networkID: n.ID(), ip: d.Gateway.IP})
+			}
+			for _, aux := range d.AuxAddresses {
+				if aux != nil && d.Pool.Contains(aux.IP) {
+					use(d.PoolID, &addressUser{networkID: n.ID(), ip: aux.IP})
+				}
+			}
+		}
+
+		for _, ep := range epMap[n.ID()] {
+			if ep.iface.addr != nil && ep.iface.v4PoolID != "" {
+				use(ep.iface.v4PoolID, &addressUser{networkID: n.ID(), endpointID: ep.ID(), ip: ep.iface.addr.IP})
+			}
+			if ep.iface.addrv6 != nil && ep.iface.v6PoolID != "" {
+				use(ep.iface.v6PoolID, &addressUser{networkID: n.ID(), endpointID: ep.ID(), ip: ep.iface.addrv6.IP})
+			}
+		}
+	}
+
+	for _, pa := range pools {
+		r.checkPoolAddresses(pa)
+	}
+}
+
+func (r *reconciler) checkPoolAddresses(pa *poolAddresses) {
+	d := unwrapIpam(pa.ipam)
+	al, ok := d.(addressLister)
+	if !ok {
+		return
+	}
+
+	poolID := pa.poolIDs[0]
+	ips, err := al.AllocatedAddresses(poolID)
+	if err != nil {
+		log.Warnf("Could not get allocated addresses of pool %s during reconciliation: %v", poolID, err)
+		return
+	}
+
+	leaser, _ := d.(ipamapi.Leaser)
+	leases := make(map[string]ipamapi.Lease)
+	if leaser != nil {
+		for _, id := range pa.poolIDs {
+			ll, err := leaser.Leases(id)
+			if err != nil {
+				log.Warnf("Could not get address leases of pool %s during reconciliation: %v", id, err)
+				continue
+			}
+			for _, l := range ll {
+				leases[l.Address.String()] = l
+			}
+		}
+	}
+	now := time.Now()
+
+	allocated := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		ip := ip
+		allocated[ip.String()] = true
+		if _, ok := pa.users[ip.String()]; ok {
+			continue
+		}
+
+		l, leased := leases[ip.String()]
+		if !leased || l.TTL == 0 {
+			r.report(Inconsistency{
+				Type:    InconsistencyLeakedAddress,
+				Address: ip.String(),
+				Detail:  fmt.Sprintf("address %s is allocated in pool %s but not in use%s", ip, poolID, leaseOwner(l)),
+			}, func() error {
+				return pa.ipam.ReleaseAddress(poolID, ip)
+			})
+			continue
+		}
+
+		// The address of an endpoint being created is allocated before the
+		// endpoint is stored: only the addresses whose lease expired are
+		// reclaimed, and only if the lease was not renewed in the meantime.
+		if !l.Expired(now) {
+			continue
+		}
+		r.report(Inconsistency{
+			Type:    InconsistencyLeakedAddress,
+			Address: ip.String(),
+			Detail:  fmt.Sprintf("address %s is allocated in pool %s but not in use and its lease expired%s", ip, l.PoolID, leaseOwner(l)),
+		}, func() error {
+			return leaser.ReleaseExpiredLease(l.PoolID, ip)
+		})
+	}
+
+	for addr, u := range pa.users {
+		if allocated[addr] {
+			continue
+		}
+		u := u
+		r.report(Inconsistency{
+			Type:       InconsistencyUnallocatedAddress,
+			NetworkID:  u.networkID,
+			EndpointID: u.endpointID,
+			Address:    addr,
+			Detail:     fmt.Sprintf("address %s is in use but not allocated in pool %s", addr, u.poolID),
+		}, func() error {
+			_, _, err := pa.ipam.RequestAddress(u.poolID, u.ip, nil)
+			return err
+		})
+	}
+
+	for addr, u := range pa.users {
+		l, ok := leases[addr]
+		if !ok || !allocated[addr] || !l.Expired(now) {
+			continue
+		}
+		r.report(Inconsistency{
+			Type:       InconsistencyExpiredLease,
+			NetworkID:  u.networkID,
+			EndpointID: u.endpointID,
+			Address:    addr,
+			Detail:     fmt.Sprintf("lease of address %s in use in pool %s expired%s", addr, l.PoolID, leaseOwner(l)),
+		}, func() error {
+			_, err := leaser.RenewLease(l.PoolID, l.Address, nil)
+			return err
+		})
+	}
+}
+
+// leaseOwner describes the owner recorded in the lease, if any
+func leaseOwner(l ipamapi.Lease) string {
+	switch {
+	case l.ContainerID != "":
+		return fmt.Sprintf(" (leased to endpoint %s of container %s on %s)", l.EndpointID, l.ContainerID, l.Renewed.Format(time.RFC3339))
+	case l.EndpointID != "":
+		return fmt.Sprintf(" (leased to endpoint %s on %s)", l.EndpointID, l.Renewed.Format(time.RFC3339))
+	}
+	return ""
+}
@@ -0,0 +1,283 @@
+package libnetwork
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/testutils"
+)
+
+func TestReconcile(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	cc := c.(*controller)
+
+	nw, err := c.NewNetwork("bridge", "reconcilenet",
+		NetworkOptionGeneric(options.Generic{
+			netlabel.GenericData: options.Generic{"BridgeName": "reconcilenet"},
+		}),
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{&IpamConf{PreferredPool: "10.35.0.0/24"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := nw.(*network)
+	poolID := n.getIPInfo(4)[0].PoolID
+
+	il, err := c.Reconcile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(il) != 0 {
+		t.Fatalf("Unexpected inconsistencies on a consistent state: %+v", il)
+	}
+
+	ep1, err := nw.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep2, err := nw.CreateEndpoint("ep2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err := c.NewSandbox("reconcile-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the state in all the ways the reconciler knows about
+	if err := n.getEpCnt().setEndpointCnt(5); err != nil {
+		t.Fatal(err)
+	}
+
+	orphan, err := n.getEndpointFromStore(ep2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan.sandboxID = "deadsandbox"
+	if err := cc.updateToStore(orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	ipam, err := cc.getIpamDriver(ipamapi.DefaultIPAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ipam.RequestAddress(poolID, net.ParseIP("10.35.0.100"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.ReleaseAddress(poolID, ep1.Info().Iface().Address().IP); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cc.updateToStore(&sbState{c: cc, ID: "stalesandbox", Cid: "gone-container"}); err != nil {
+		t.Fatal(err)
+	}
+	sbs := &sbState{c: cc, ID: sb.ID(), Cid: sb.ContainerID(), Eps: []epState{{Nid: n.ID(), Eid: "missingendpoint"}}}
+	if err := cc.updateToStore(sbs); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[InconsistencyType]bool{
+		InconsistencyOrphanEndpoint:     true,
+		InconsistencyEndpointCount:      true,
+		InconsistencyStaleSandbox:       true,
+		InconsistencyMissingEndpoint:    true,
+		InconsistencyLeakedAddress:      true,
+		InconsistencyUnallocatedAddress: true,
+	}
+	check := func(il []Inconsistency, repaired bool) {
+		if len(il) != len(expected) {
+			t.Fatalf("Expected %d inconsistencies, got: %+v", len(expected), il)
+		}
+		for _, inc := range il {
+			if !expected[inc.Type] || inc.Repaired != repaired || inc.Error != "" {
+				t.Fatalf("Unexpected inconsistency: %+v", inc)
+			}
+		}
+	}
+
+	// A check only run reports without touching the state
+	for i := 0; i < 2; i++ {
+		il, err = c.Reconcile(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(il, false)
+	}
+
+	il, err = c.Reconcile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(il, true)
+
+	il, err = c.Reconcile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(il) != 0 {
+		t.Fatalf("Unexpected inconsistencies after repair: %+v", il)
+	}
+
+	if _, err := n.getEndpointFromStore(ep2.ID()); err == nil {
+		t.Fatal("Orphan endpoint was not removed")
+	}
+	if _, _, err := ipam.RequestAddress(poolID, ep1.Info().Iface().Address().IP, nil); err == nil {
+		t.Fatal("Endpoint address was not allocated back")
+	}
+
+	if err := sb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep1.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconcileLeases(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	cc := c.(*controller)
+
+	generic := NetworkOptionGeneric(options.Generic{
+		netlabel.GenericData: options.Generic{"BridgeName": "leasenet"},
+	})
+	ipamConf := NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{&IpamConf{PreferredPool: "10.42.0.0/24"}}, nil)
+
+	if _, err := c.NewNetwork("bridge", "leasenet", generic, ipamConf,
+		NetworkOptionLabels(map[string]string{netlabel.IpamLeaseTTL: "forever"})); err == nil {
+		t.Fatal("Expected failure for an invalid lease ttl")
+	}
+
+	nw, err := c.NewNetwork("bridge", "leasenet", generic, ipamConf,
+		NetworkOptionLabels(map[string]string{netlabel.IpamLeaseTTL: "1h"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolID := nw.(*network).getIPInfo(4)[0].PoolID
+
+	ep, err := nw.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err := c.NewSandbox("lease-container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Join(sb); err != nil {
+		t.Fatal(err)
+	}
+	epIP := ep.Info().Iface().Address().IP
+
+	ipam, err := cc.getIpamDriver(ipamapi.DefaultIPAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaser := unwrapIpam(ipam).(ipamapi.Leaser)
+
+	lease := func(ip net.IP) *ipamapi.Lease {
+		ll, err := leaser.Leases(poolID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range ll {
+			if l.Address.Equal(ip) {
+				return &l
+			}
+		}
+		return nil
+	}
+
+	l := lease(epIP)
+	if l == nil || l.EndpointID != ep.ID() || l.ContainerID != "lease-container" || l.TTL != time.Hour {
+		t.Fatalf("Unexpected lease of the endpoint address: %+v", l)
+	}
+
+	// Addresses allocated by endpoint creations which did not complete
+	pending, expired := net.ParseIP("10.42.0.100"), net.ParseIP("10.42.0.101")
+	if _, _, err := ipam.RequestAddress(poolID, pending, map[string]string{netlabel.EndpointID: "pending", netlabel.IpamLeaseTTL: "1h"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ipam.RequestAddress(poolID, expired, map[string]string{netlabel.EndpointID: "lost", netlabel.IpamLeaseTTL: "1ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaser.RenewLease(poolID, epIP, map[string]string{netlabel.IpamLeaseTTL: "1ms"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	il, err := c.Reconcile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(il) != 2 {
+		t.Fatalf("Expected 2 inconsistencies, got: %+v", il)
+	}
+	for _, inc := range il {
+		switch {
+		case inc.Type == InconsistencyLeakedAddress && inc.Address == expired.String() && inc.Repaired:
+		case inc.Type == InconsistencyExpiredLease && inc.Address == epIP.String() && inc.EndpointID == ep.ID() && inc.Repaired:
+		default:
+			t.Fatalf("Unexpected inconsistency: %+v", inc)
+		}
+	}
+
+	if lease(expired) != nil {
+		t.Fatal("Expired lease was not reclaimed")
+	}
+	if lease(pending) == nil {
+		t.Fatal("Pending lease was reclaimed")
+	}
+	if nl := lease(epIP); nl == nil || !nl.Renewed.After(l.Renewed) {
+		t.Fatalf("Lease of the endpoint address was not renewed: %+v", nl)
+	}
+
+	if err := ep.Leave(sb); err != nil {
+		t.Fatal(err)
+	}
+	if l := lease(epIP); l == nil || l.ContainerID != "" || l.TTL != time.Hour {
+		t.Fatalf("Unexpected lease of the endpoint address after leave: %+v", l)
+	}
+
+	if err := ipam.ReleaseAddress(poolID, pending); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,422 @@
+package libnetwork
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/libnetwork/dnsmsg"
+	"github.com/docker/libnetwork/osl"
+)
+
+const (
+	// resolverIP is the address the embedded DNS server listens on
+	// inside the sandbox
+	resolverIP = "127.0.0.11"
+	dnsPort    = "53"
+	// respTTL is the TTL of the records the resolver answers with
+	respTTL = 600
+	// maxExtDNS is the number of external servers a query is relayed to
+	// before giving up
+	maxExtDNS = 3
+	// extIOTimeout bounds the exchange with an external server
+	extIOTimeout = 4 * time.Second
+	// tcpIdleTimeout bounds the time a client TCP connection is kept
+	// open waiting for a query
+	tcpIdleTimeout = 10 * time.Second
+	maxDNSMsgSize  = 65535
+)
+
+// resolver is the DNS server embedded in a sandbox. It answers the queries
+// for the endpoints on the networks the sandbox is connected to and relays
+// the others to the external name servers of the sandbox.
+type resolver struct {
+	sb        *sandbox
+	osSbox    osl.Sandbox
+	udpConn   *net.UDPConn
+	tcpListen *net.TCPListener
+	wg        sync.WaitGroup
+}
+
+func newResolver(sb *sandbox, osSbox osl.Sandbox) *resolver {
+	return &resolver{sb: sb, osSbox: osSbox}
+}
+
+// start opens the resolver sockets in the sandbox namespace and serves
+// the queries in the background
+func (r *resolver) start() error {
+	var err error
+	if ierr := r.osSbox.InvokeFunc(func() {
+		err = r.listen()
+	}); ierr != nil {
+		return ierr
+	}
+	if err != nil {
+		return err
+	}
+
+	r.wg.Add(2)
+	go r.serveUDP()
+	go r.serveTCP()
+
+	return nil
+}
+
+func (r *resolver) listen() error {
+	addr := net.JoinHostPort(resolverIP, dnsPort)
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	if r.udpConn, err = net.ListenUDP("udp", udpAddr); err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %v", addr, err)
+	}
+
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		r.udpConn.Close()
+		return err
+	}
+	if r.tcpListen, err = net.ListenTCP("tcp", tcpAddr); err != nil {
+		r.udpConn.Close()
+		return fmt.Errorf("failed to listen on tcp %s: %v", addr, err)
+	}
+
+	return nil
+}
+
+// stop closes the resolver sockets and waits for the serving loops to
+// return
+func (r *resolver) stop() {
+	r.udpConn.Close()
+	r.tcpListen.Close()
+	r.wg.Wait()
+}
+
+func (r *resolver) serveUDP() {
+	defer r.wg.Done()
+
+	buf := make([]byte, maxDNSMsgSize)
+	for {
+		n, addr, err := r.udpConn.ReadFromUDP(buf)
+		if err != nil {
+			if isClosedConnError(err) {
+				return
+			}
+			log.Debugf("Embedded DNS server of sandbox %s failed reading udp query: %v", r.sb.ID(), err)
+			continue
+		}
+
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := r.handleQuery(query, "udp"); resp != nil {
+				if _, err := r.udpConn.WriteToUDP(resp, addr); err != nil {
+					log.Debugf("Embedded DNS server of sandbox %s failed writing udp response: %v", r.sb.ID(), err)
+				}
+			}
+		}()
+	}
+}
+
+func (r *resolver) serveTCP() {
+	defer r.wg.Done()
+
+	for {
+		conn, err := r.tcpListen.AcceptTCP()
+		if err != nil {
+			if isClosedConnError(err) {
+				return
+			}
+			log.Debugf("Embedded DNS server of sandbox %s failed accepting tcp connection: %v", r.sb.ID(), err)
+			continue
+		}
+
+		go r.serveTCPConn(conn)
+	}
+}
+
+func (r *resolver) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		query, err := readTCPMsg(conn)
+		if err != nil {
+			return
+		}
+
+		resp := r.handleQuery(query, "tcp")
+		if resp == nil {
+			return
+		}
+		if err := writeTCPMsg(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// handleQuery returns the wire format response to the query, or nil if
+// the query must be dropped
+func (r *resolver) handleQuery(b []byte, proto string) []byte {
+	var query dnsmsg.Msg
+	if err := query.Unpack(b); err != nil {
+		return nil
+	}
+
+	var resp *dnsmsg.Msg
+	switch {
+	case query.Response:
+		return nil
+	case query.Opcode != dnsmsg.OpcodeQuery || len(query.Questions) != 1:
+		resp = query.Reply(dnsmsg.RcodeNotImplemented)
+	default:
+		q := query.Questions[0]
+		name := strings.TrimSuffix(q.Name, ".")
+		switch q.Type {
+		case dnsmsg.TypeA:
+			resp = r.handleIPQuery(&query, name, 4)
+		case dnsmsg.TypeAAAA:
+			resp = r.handleIPQuery(&query, name, 6)
+		case dnsmsg.TypePTR:
+			resp = r.handlePTRQuery(&query, q.Name)
+		case dnsmsg.TypeSRV:
+			resp = r.handleSRVQuery(&query, name)
+		}
+	}
+
+	if resp == nil {
+		if ext := r.forwardQuery(b, proto); ext != nil {
+			return ext
+		}
+		resp = query.Reply(dnsmsg.RcodeServerFailure)
+	}
+
+	out, err := resp.Pack()
+	if err != nil {
+		log.Debugf("Embedded DNS server of sandbox %s failed packing response: %v", r.sb.ID(), err)
+		return nil
+	}
+
+	return out
+}
+
+// handleIPQuery answers A and AAAA queries for the endpoints on the
+// networks of the sandbox. A known name without an address of the
+// requested version gets an empty answer, so that the client does not
+// ask the external servers for it.
+func (r *resolver) handleIPQuery(query *dnsmsg.Msg, name string, ipVer int) *dnsmsg.Msg {
+	for _, ep := range r.sb.getConnectedEndpoints() {
+		ips, known := ep.getNetwork().resolveName(name, ipVer)
+		if !known {
+			continue
+		}
+
+		resp := query.Reply(dnsmsg.RcodeSuccess)
+		resp.Authoritative = true
+		for _, ip := range ips {
+			if ipVer == 6 {
+				resp.Answers = append(resp.Answers, dnsmsg.NewAAAA(query.Questions[0].Name, ip, respTTL))
+			} else {
+				resp.Answers = append(resp.Answers, dnsmsg.NewA(query.Questions[0].Name, ip, respTTL))
+			}
+		}
+		return resp
+	}
+
+	return nil
+}
+
+// handlePTRQuery answers reverse lookups for the addresses of the
+// endpoints on the networks of the sandbox
+func (r *resolver) handlePTRQuery(query *dnsmsg.Msg, name string) *dnsmsg.Msg {
+	ip := dnsmsg.ParseReverseAddr(name)
+	if ip == nil {
+		return nil
+	}
+
+	for _, ep := range r.sb.getConnectedEndpoints() {
+		host, ok := ep.getNetwork().resolveIP(ip)
+		if !ok {
+			continue
+		}
+
+		rr, err := dnsmsg.NewPTR(name, host+".", respTTL)
+		if err != nil {
+			log.Debugf("Embedded DNS server of sandbox %s failed building PTR record for %s: %v", r.sb.ID(), host, err)
+			return nil
+		}
+		resp := query.Reply(dnsmsg.RcodeSuccess)
+		resp.Authoritative = true
+		resp.Answers = append(resp.Answers, rr)
+		return resp
+	}
+
+	return nil
+}
+
+// handleSRVQuery answers the SRV queries for the ports exposed by the
+// endpoints on the networks of the sandbox. The records are named
+// _port._proto.name[.network].
+func (r *resolver) handleSRVQuery(query *dnsmsg.Msg, name string) *dnsmsg.Msg {
+	for _, ep := range r.sb.getConnectedEndpoints() {
+		srv, ok := ep.getNetwork().resolveSRV(name)
+		if !ok {
+			continue
+		}
+
+		rr, err := dnsmsg.NewSRV(query.Questions[0].Name, 0, 0, srv.port, srv.target+".", respTTL)
+		if err != nil {
+			log.Debugf("Embedded DNS server of sandbox %s failed building SRV record for %s: %v", r.sb.ID(), name, err)
+			return nil
+		}
+		resp := query.Reply(dnsmsg.RcodeSuccess)
+		resp.Authoritative = true
+		resp.Answers = append(resp.Answers, rr)
+		return resp
+	}
+
+	return nil
+}
+
+// forwardQuery relays the query to the external name servers of the
+// sandbox in turn and returns the first response received
+func (r *resolver) forwardQuery(query []byte, proto string) []byte {
+	r.sb.Lock()
+	extDNS := r.sb.config.extDNS
+	r.sb.Unlock()
+
+	for i, ns := range extDNS {
+		if i == maxExtDNS {
+			break
+		}
+
+		resp, err := r.exchange(proto, net.JoinHostPort(ns, dnsPort), query)
+		if err != nil {
+			log.Debugf("Embedded DNS server of sandbox %s failed forwarding query to %s: %v", r.sb.ID(), ns, err)
+			continue
+		}
+		return resp
+	}
+
+	return nil
+}
+
+// exchange sends the query to the server at addr from the sandbox
+// namespace and returns the response
+func (r *resolver) exchange(proto, addr string, query []byte) ([]byte, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if ierr := r.osSbox.InvokeFunc(func() {
+		conn, err = net.DialTimeout(proto, addr, extIOTimeout)
+	}); ierr != nil {
+		return nil, ierr
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(extIOTimeout))
+
+	if proto == "tcp" {
+		if err := writeTCPMsg(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMsg(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxDNSMsgSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// readTCPMsg reads a length prefixed DNS message from conn
+func readTCPMsg(conn net.Conn) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// writeTCPMsg writes the DNS message b to conn, prefixed by its length
+func writeTCPMsg(conn net.Conn, b []byte) error {
+	msg := make([]byte, 2, 2+len(b))
+	binary.BigEndian.PutUint16(msg, uint16(len(b)))
+	_, err := conn.Write(append(msg, b...))
+	return err
+}
+
+func isClosedConnError(err error) bool {
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// startResolver starts the embedded DNS server of the sandbox if it is
+// not running yet
+func (sb *sandbox) startResolver() error {
+	sb.Lock()
+	if sb.resolver != nil || sb.osSbox == nil {
+		sb.Unlock()
+		return nil
+	}
+	r := newResolver(sb, sb.osSbox)
+	sb.resolver = r
+	sb.Unlock()
+
+	if err := r.start(); err != nil {
+		sb.Lock()
+		sb.resolver = nil
+		sb.Unlock()
+		return fmt.Errorf("failed to start the embedded DNS server of sandbox %s: %v", sb.ID(), err)
+	}
+
+	return nil
+}
+
+// stopResolver stops the embedded DNS server of the sandbox, if any
+func (sb *sandbox) stopResolver() {
+	sb.Lock()
+	r := sb.resolver
+	sb.resolver = nil
+	sb.Unlock()
+
+	if r != nil {
+		r.stop()
+	}
+}
+
+// stopResolvers stops the embedded DNS servers of all the sandboxes. They
+// are started again when the sandboxes are restored.
+func (c *controller) stopResolvers() {
+	c.Lock()
+	sbs := make([]*sandbox, 0, len(c.sandboxes))
+	for _, sb := range c.sandboxes {
+		sbs = append(sbs, sb)
+	}
+	c.Unlock()
+
+	for _, sb := range sbs {
+		sb.stopResolver()
+	}
+}
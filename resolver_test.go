@@ -0,0 +1,203 @@
+package libnetwork
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/dnsmsg"
+	"github.com/docker/libnetwork/ipamapi"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/options"
+	"github.com/docker/libnetwork/testutils"
+	"github.com/docker/libnetwork/types"
+)
+
+func queryResolver(t *testing.T, sb *sandbox, proto, name string, qtype uint16) *dnsmsg.Msg {
+	query := &dnsmsg.Msg{
+		Header:    dnsmsg.Header{ID: 0x1234, RecursionDesired: true},
+		Questions: []dnsmsg.Question{{Name: name, Type: qtype, Class: dnsmsg.ClassINET}},
+	}
+	b, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conn net.Conn
+	if ierr := sb.osSbox.InvokeFunc(func() {
+		conn, err = net.Dial(proto, net.JoinHostPort(resolverIP, dnsPort))
+	}); ierr != nil {
+		t.Fatal(ierr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if proto == "tcp" {
+		if err := writeTCPMsg(conn, b); err != nil {
+			t.Fatal(err)
+		}
+		if b, err = readTCPMsg(conn); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, maxDNSMsgSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = buf[:n]
+	}
+
+	var resp dnsmsg.Msg
+	if err := resp.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != query.ID || !resp.Response {
+		t.Fatalf("Unexpected response header for %s: %+v", name, resp.Header)
+	}
+
+	return &resp
+}
+
+func TestEmbeddedDNS(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	nw, err := c.NewNetwork("bridge", "dnsnet",
+		NetworkOptionGeneric(options.Generic{
+			netlabel.GenericData: options.Generic{"BridgeName": "dnsnet"},
+		}),
+		NetworkOptionIpam(ipamapi.DefaultIPAM, "", []*IpamConf{&IpamConf{PreferredPool: "10.36.0.0/24"}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep1, err := nw.CreateEndpoint("web", CreateOptionExposedPorts([]types.TransportPort{{Proto: types.TCP, Port: 80}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep2, err := nw.CreateEndpoint("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb1, err := c.NewSandbox("dns-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolvConfPath := "/tmp/libnetwork_test/dns/resolv.conf"
+	defer os.RemoveAll("/tmp/libnetwork_test/dns")
+	sb2, err := c.NewSandbox("dns-client", OptionResolvConfPath(resolvConfPath), OptionDNS("192.0.2.53"), OptionUseEmbeddedDNS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(resolvConfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "nameserver "+resolverIP) || strings.Contains(string(content), "192.0.2.53") {
+		t.Fatalf("Unexpected resolv.conf content:\n%s", content)
+	}
+
+	if err := ep1.Join(sb1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep2.Join(sb2); err != nil {
+		t.Fatal(err)
+	}
+
+	sb := sb2.(*sandbox)
+	webIP := ep1.Info().Iface().Address().IP
+
+	for _, proto := range []string{"udp", "tcp"} {
+		for _, name := range []string{"web.", "WEB.dnsnet."} {
+			resp := queryResolver(t, sb, proto, name, dnsmsg.TypeA)
+			if resp.Rcode != dnsmsg.RcodeSuccess || len(resp.Answers) != 1 || !net.IP(resp.Answers[0].Data).Equal(webIP) {
+				t.Fatalf("Unexpected %s response for %s: %+v", proto, name, resp)
+			}
+		}
+	}
+
+	// The endpoint has no IPv6 address: the name exists with no data
+	resp := queryResolver(t, sb, "udp", "web.", dnsmsg.TypeAAAA)
+	if resp.Rcode != dnsmsg.RcodeSuccess || len(resp.Answers) != 0 {
+		t.Fatalf("Unexpected AAAA response: %+v", resp)
+	}
+
+	resp = queryResolver(t, sb, "udp", dnsmsg.ReverseAddr(webIP), dnsmsg.TypePTR)
+	if resp.Rcode != dnsmsg.RcodeSuccess || len(resp.Answers) != 1 || resp.Answers[0].Type != dnsmsg.TypePTR {
+		t.Fatalf("Unexpected PTR response: %+v", resp)
+	}
+	if ptr, err := dnsmsg.NewPTR(resp.Answers[0].Name, "web.dnsnet.", respTTL); err != nil || string(ptr.Data) != string(resp.Answers[0].Data) {
+		t.Fatalf("Unexpected PTR record: %+v", resp.Answers[0])
+	}
+
+	for _, name := range []string{"_80._tcp.web.", "_80._tcp.web.dnsnet."} {
+		resp = queryResolver(t, sb, "udp", name, dnsmsg.TypeSRV)
+		if resp.Rcode != dnsmsg.RcodeSuccess || len(resp.Answers) != 1 || resp.Answers[0].Type != dnsmsg.TypeSRV {
+			t.Fatalf("Unexpected SRV response for %s: %+v", name, resp)
+		}
+		if srv, err := dnsmsg.NewSRV(name, 0, 0, 80, "web.dnsnet.", respTTL); err != nil || string(srv.Data) != string(resp.Answers[0].Data) {
+			t.Fatalf("Unexpected SRV record: %+v", resp.Answers[0])
+		}
+	}
+
+	// Names the resolver does not know fail when there is no external
+	// server to relay them to
+	sb.Lock()
+	sb.config.extDNS = nil
+	sb.Unlock()
+	resp = queryResolver(t, sb, "udp", "example.com.", dnsmsg.TypeA)
+	if resp.Rcode != dnsmsg.RcodeServerFailure {
+		t.Fatalf("Unexpected response for an external name: %+v", resp)
+	}
+
+	if err := ep1.Leave(sb1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep1.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	resp = queryResolver(t, sb, "udp", "web.", dnsmsg.TypeA)
+	if resp.Rcode != dnsmsg.RcodeServerFailure {
+		t.Fatalf("Unexpected response for a departed endpoint: %+v", resp)
+	}
+	resp = queryResolver(t, sb, "udp", "_80._tcp.web.", dnsmsg.TypeSRV)
+	if resp.Rcode != dnsmsg.RcodeServerFailure {
+		t.Fatalf("Unexpected SRV response for a departed endpoint: %+v", resp)
+	}
+
+	if err := sb2.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if sb.resolver != nil {
+		t.Fatal("Embedded DNS server still running after sandbox delete")
+	}
+	if err := sb1.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/etchosts"
@@ -70,6 +72,7 @@ type sandbox struct {
 	dbExists      bool
 	isStub        bool
 	inDelete      bool
+	resolver      *resolver
 	sync.Mutex
 }
 
@@ -102,6 +105,7 @@ type resolvConfPathConfig struct {
 	dnsList              []string
 	dnsSearchList        []string
 	dnsOptionsList       []string
+	extDNS               []string
 }
 
 type containerConfig struct {
@@ -110,6 +114,7 @@ type containerConfig struct {
 	generic           map[string]interface{}
 	useDefaultSandBox bool
 	useExternalKey    bool
+	useEmbeddedDNS    bool
 	prio              int // higher the value, more the priority
 }
 
@@ -150,6 +155,13 @@ func (sb *sandbox) Statistics() (map[string]*types.InterfaceStatistics, error) {
 }
 
 func (sb *sandbox) Delete() error {
+	start := time.Now()
+	err := sb.delete()
+	observeOp("sandbox_delete", "", start, err)
+	return err
+}
+
+func (sb *sandbox) delete() error {
 	sb.Lock()
 	if sb.inDelete {
 		sb.Unlock()
@@ -203,6 +215,8 @@ func (sb *sandbox) Delete() error {
 	// likely not required any more. Drop it.
 	etchosts.Drop(sb.config.hostsPath)
 
+	sb.stopResolver()
+
 	if sb.osSbox != nil && !sb.config.useDefaultSandBox {
 		sb.osSbox.Destroy()
 	}
@@ -215,6 +229,8 @@ func (sb *sandbox) Delete() error {
 	delete(c.sandboxes, sb.ID())
 	c.Unlock()
 
+	c.publish(Event{Type: EventSandboxDelete, SandboxID: sb.ID()})
+
 	return nil
 }
 
@@ -257,6 +273,10 @@ func (sb *sandbox) Refresh(options ...SandboxOption) error {
 	sb.config = containerConfig{}
 	sb.processOptions(options...)
 
+	if !sb.config.useEmbeddedDNS {
+		sb.stopResolver()
+	}
+
 	// Setup discovery files
 	if err := sb.setupResolutionFiles(); err != nil {
 		return err
@@ -413,6 +433,15 @@ func releaseOSSboxResources(osSbox osl.Sandbox, ep *endpoint) {
 		}
 	}
 
+	// Unbind virtual ips from the loopback device.
+	if ep.bindsVirtualIPs() {
+		for _, vip := range ep.VirtualIPs() {
+			if err := osSbox.UnbindVirtualIP(vip); err != nil {
+				log.Debugf("Unbind virtual ip failed: %v", err)
+			}
+		}
+	}
+
 	ep.Lock()
 	joinInfo := ep.joinInfo
 	ep.Unlock()
@@ -439,6 +468,8 @@ func (sb *sandbox) releaseOSSbox() {
 		return
 	}
 
+	sb.stopResolver()
+
 	for _, ep := range sb.getConnectedEndpoints() {
 		releaseOSSboxResources(osSbox, ep)
 	}
@@ -467,6 +498,9 @@ func (sb *sandbox) populateNetworkResources(ep *endpoint) error {
 		if i.addrv6 != nil && i.addrv6.IP.To16() != nil {
 			ifaceOptions = append(ifaceOptions, sb.osSbox.InterfaceOptions().AddressIPv6(i.addrv6))
 		}
+		if addrs := i.AdditionalAddresses(); len(addrs) > 0 {
+			ifaceOptions = append(ifaceOptions, sb.osSbox.InterfaceOptions().AdditionalAddresses(addrs))
+		}
 
 		if err := sb.osSbox.AddInterface(i.srcName, i.dstPrefix, ifaceOptions...); err != nil {
 			return fmt.Errorf("failed to add interface %s to sandbox: %v", i.srcName, err)
@@ -482,10 +516,12 @@ func (sb *sandbox) populateNetworkResources(ep *endpoint) error {
 		}
 	}
 
-	// Bind Virtual IP to Loopback device for LVS DR
-	if ep.vip != "" {
-		if err := sb.osSbox.BindVirtualIP(ep.vip); err != nil {
-			return fmt.Errorf("failed to bind virtual ip %s to lo: %v", ep.vip, err)
+	// Bind Virtual IPs to Loopback device for LVS DR
+	if ep.bindsVirtualIPs() {
+		for _, vip := range ep.VirtualIPs() {
+			if err := sb.osSbox.BindVirtualIP(vip); err != nil {
+				return fmt.Errorf("failed to bind virtual ip %s to lo: %v", vip, err)
+			}
 		}
 	}
 
@@ -500,6 +536,12 @@ func (sb *sandbox) populateNetworkResources(ep *endpoint) error {
 		}
 	}
 
+	if sb.config.useEmbeddedDNS && !sb.config.useDefaultSandBox {
+		if err := sb.startResolver(); err != nil {
+			return err
+		}
+	}
+
 	// Only update the store if we did not come here as part of
 	// sandbox delete. If we came here as part of delete then do
 	// not bother updating the store. The sandbox object will be
@@ -511,6 +553,55 @@ func (sb *sandbox) populateNetworkResources(ep *endpoint) error {
 	return nil
 }
 
+// restoreOSSbox rebuilds the state of the osl sandbox from the resources
+// the connected endpoints programmed in it before the daemon restarted.
+func (sb *sandbox) restoreOSSbox() error {
+	sb.Lock()
+	osSbox := sb.osSbox
+	sb.Unlock()
+
+	var (
+		routes []*types.StaticRoute
+		gwep   *endpoint
+	)
+	ifsopt := make(map[string][]osl.IfaceOption)
+	for _, ep := range sb.getConnectedEndpoints() {
+		ep.Lock()
+		i := ep.iface
+		joinInfo := ep.joinInfo
+		ep.Unlock()
+
+		if i != nil && i.srcName != "" {
+			ifaceOptions := []osl.IfaceOption{osSbox.InterfaceOptions().Address(i.addr), osSbox.InterfaceOptions().Routes(i.routes)}
+			if i.addrv6 != nil && i.addrv6.IP.To16() != nil {
+				ifaceOptions = append(ifaceOptions, osSbox.InterfaceOptions().AddressIPv6(i.addrv6))
+			}
+			if addrs := i.AdditionalAddresses(); len(addrs) > 0 {
+				ifaceOptions = append(ifaceOptions, osSbox.InterfaceOptions().AdditionalAddresses(addrs))
+			}
+			ifsopt[i.srcName] = ifaceOptions
+		}
+
+		if joinInfo != nil {
+			routes = append(routes, joinInfo.StaticRoutes...)
+		}
+
+		// As in populateNetworkResources, the first endpoint with a
+		// gateway provides the sandbox default gateway
+		if gwep == nil && len(ep.Gateway()) > 0 {
+			gwep = ep
+		}
+	}
+
+	var gw, gw6 net.IP
+	if gwep != nil {
+		gw = gwep.Gateway()
+		gw6 = gwep.GatewayIPv6()
+	}
+
+	return osSbox.Restore(ifsopt, routes, gw, gw6)
+}
+
 func (sb *sandbox) clearNetworkResources(origEp *endpoint) error {
 	ep := sb.getEndpoint(origEp.id)
 	if ep == nil {
@@ -642,6 +733,12 @@ func (sb *sandbox) updateHostsFile(ifaceIP string, svcRecords []etchosts.Record)
 		return err
 	}
 
+	// Containers using the embedded DNS server resolve the service
+	// records through it
+	if sb.config.useEmbeddedDNS {
+		return nil
+	}
+
 	extraContent = extraContent[:0]
 	for _, svc := range svcRecords {
 		extraContent = append(extraContent, svc)
@@ -706,7 +803,34 @@ func (sb *sandbox) setupDNS() error {
 		return err
 	}
 
-	if len(sb.config.dnsList) > 0 || len(sb.config.dnsSearchList) > 0 || len(sb.config.dnsOptionsList) > 0 {
+	if sb.config.useEmbeddedDNS {
+		// Point the container to the embedded DNS server, which
+		// relays the queries it cannot answer to the servers
+		// the container would have used otherwise
+		filteredRC, err := resolvconf.FilterResolvDNS(currRC.Content, true)
+		if err != nil {
+			return err
+		}
+		var (
+			dnsList        = resolvconf.GetNameservers(filteredRC.Content)
+			dnsSearchList  = resolvconf.GetSearchDomains(currRC.Content)
+			dnsOptionsList = resolvconf.GetOptions(currRC.Content)
+		)
+		if len(sb.config.dnsList) > 0 {
+			dnsList = sb.config.dnsList
+		}
+		if len(sb.config.dnsSearchList) > 0 {
+			dnsSearchList = sb.config.dnsSearchList
+		}
+		if len(sb.config.dnsOptionsList) > 0 {
+			dnsOptionsList = sb.config.dnsOptionsList
+		}
+		sb.config.extDNS = dnsList
+		newRC, err = resolvconf.Build(sb.config.resolvConfPath, []string{resolverIP}, dnsSearchList, dnsOptionsList)
+		if err != nil {
+			return err
+		}
+	} else if len(sb.config.dnsList) > 0 || len(sb.config.dnsSearchList) > 0 || len(sb.config.dnsOptionsList) > 0 {
 		var (
 			err            error
 			dnsList        = resolvconf.GetNameservers(currRC.Content)
@@ -751,7 +875,7 @@ func (sb *sandbox) updateDNS(ipv6Enabled bool) error {
 		hashFile = sb.config.resolvConfHashFile
 	)
 
-	if len(sb.config.dnsList) > 0 || len(sb.config.dnsSearchList) > 0 || len(sb.config.dnsOptionsList) > 0 {
+	if sb.config.useEmbeddedDNS || len(sb.config.dnsList) > 0 || len(sb.config.dnsSearchList) > 0 || len(sb.config.dnsOptionsList) > 0 {
 		return nil
 	}
 
@@ -951,6 +1075,15 @@ func OptionUseExternalKey() SandboxOption {
 	}
 }
 
+// OptionUseEmbeddedDNS function returns an option setter for pointing the
+// container to the DNS server embedded in its sandbox, which resolves the
+// names of the containers on the same networks.
+func OptionUseEmbeddedDNS() SandboxOption {
+	return func(sb *sandbox) {
+		sb.config.useEmbeddedDNS = true
+	}
+}
+
 // OptionGeneric function returns an option setter for Generic configuration
 // that is not managed by libNetwork but can be used by the Drivers during the call to
 // net container creation method. Container Labels are a good example.
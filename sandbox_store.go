@@ -3,11 +3,14 @@ package libnetwork
 import (
 	"container/heap"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/libnetwork/datastore"
 	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
 )
 
 const (
@@ -19,6 +22,26 @@ type epState struct {
 	Nid string
 }
 
+// sbConfig is the container configuration a sandbox is rebuilt with on
+// live restore
+type sbConfig struct {
+	HostName             string
+	DomainName           string
+	HostsPath            string
+	OriginHostsPath      string
+	ExtraHosts           []string
+	ResolvConfPath       string
+	OriginResolvConfPath string
+	ResolvConfHashFile   string
+	DNS                  []string
+	DNSSearch            []string
+	DNSOptions           []string
+	ExtDNS               []string
+	UseDefaultSandbox    bool
+	UseExternalKey       bool
+	UseEmbeddedDNS       bool
+}
+
 type sbState struct {
 	ID       string
 	Cid      string
@@ -26,6 +49,7 @@ type sbState struct {
 	dbIndex  uint64
 	dbExists bool
 	Eps      []epState
+	Config   sbConfig
 }
 
 func (sbs *sbState) Key() []string {
@@ -106,6 +130,7 @@ func (sbs *sbState) CopyTo(o datastore.KVObject) error {
 	dstSbs.Cid = sbs.Cid
 	dstSbs.dbIndex = sbs.dbIndex
 	dstSbs.dbExists = sbs.dbExists
+	dstSbs.Config = sbs.Config
 
 	for _, eps := range sbs.Eps {
 		dstSbs.Eps = append(dstSbs.Eps, eps)
@@ -120,9 +145,10 @@ func (sbs *sbState) DataScope() string {
 
 func (sb *sandbox) storeUpdate() error {
 	sbs := &sbState{
-		c:   sb.controller,
-		ID:  sb.id,
-		Cid: sb.containerID,
+		c:      sb.controller,
+		ID:     sb.id,
+		Cid:    sb.containerID,
+		Config: sb.stateConfig(),
 	}
 
 retry:
@@ -166,68 +192,233 @@ func (sb *sandbox) storeDelete() error {
 	return sb.controller.deleteFromStore(sbs)
 }
 
-func (c *controller) sandboxCleanup() {
+func (sb *sandbox) stateConfig() sbConfig {
+	sb.Lock()
+	defer sb.Unlock()
+
+	cfg := sbConfig{
+		HostName:             sb.config.hostName,
+		DomainName:           sb.config.domainName,
+		HostsPath:            sb.config.hostsPath,
+		OriginHostsPath:      sb.config.originHostsPath,
+		ResolvConfPath:       sb.config.resolvConfPath,
+		OriginResolvConfPath: sb.config.originResolvConfPath,
+		ResolvConfHashFile:   sb.config.resolvConfHashFile,
+		DNS:                  sb.config.dnsList,
+		DNSSearch:            sb.config.dnsSearchList,
+		DNSOptions:           sb.config.dnsOptionsList,
+		ExtDNS:               sb.config.extDNS,
+		UseDefaultSandbox:    sb.config.useDefaultSandBox,
+		UseExternalKey:       sb.config.useExternalKey,
+		UseEmbeddedDNS:       sb.config.useEmbeddedDNS,
+	}
+	for _, eh := range sb.config.extraHosts {
+		cfg.ExtraHosts = append(cfg.ExtraHosts, eh.name+":"+eh.IP)
+	}
+
+	return cfg
+}
+
+func (cfg *sbConfig) containerConfig() containerConfig {
+	c := containerConfig{
+		useDefaultSandBox: cfg.UseDefaultSandbox,
+		useExternalKey:    cfg.UseExternalKey,
+		useEmbeddedDNS:    cfg.UseEmbeddedDNS,
+	}
+	c.hostName = cfg.HostName
+	c.domainName = cfg.DomainName
+	c.hostsPath = cfg.HostsPath
+	c.originHostsPath = cfg.OriginHostsPath
+	c.resolvConfPath = cfg.ResolvConfPath
+	c.originResolvConfPath = cfg.OriginResolvConfPath
+	c.resolvConfHashFile = cfg.ResolvConfHashFile
+	c.dnsList = cfg.DNS
+	c.dnsSearchList = cfg.DNSSearch
+	c.dnsOptionsList = cfg.DNSOptions
+	c.extDNS = cfg.ExtDNS
+	for _, eh := range cfg.ExtraHosts {
+		if parts := strings.SplitN(eh, ":", 2); len(parts) == 2 {
+			c.extraHosts = append(c.extraHosts, extraHost{name: parts[0], IP: parts[1]})
+		}
+	}
+
+	return c
+}
+
+func (c *controller) getSandboxStates() []*sbState {
 	store := c.getStore(datastore.LocalScope)
 	if store == nil {
-		logrus.Errorf("Could not find local scope store while trying to cleanup sandboxes")
-		return
+		logrus.Errorf("Could not find local scope store while trying to load sandboxes")
+		return nil
 	}
 
 	kvol, err := store.List(datastore.Key(sandboxPrefix), &sbState{c: c})
 	if err != nil && err != datastore.ErrKeyNotFound {
 		logrus.Errorf("failed to get sandboxes for scope %s: %v", store.Scope(), err)
-		return
+		return nil
 	}
 
 	// It's normal for no sandboxes to be found. Just bail out.
 	if err == datastore.ErrKeyNotFound {
-		return
+		return nil
 	}
 
+	sbsl := make([]*sbState, 0, len(kvol))
 	for _, kvo := range kvol {
-		sbs := kvo.(*sbState)
-
-		sb := &sandbox{
-			id:          sbs.ID,
-			controller:  sbs.c,
-			containerID: sbs.Cid,
-			endpoints:   epHeap{},
-			epPriority:  map[string]int{},
-			dbIndex:     sbs.dbIndex,
-			isStub:      true,
-			dbExists:    true,
+		sbsl = append(sbsl, kvo.(*sbState))
+	}
+
+	return sbsl
+}
+
+func (c *controller) sandboxCleanup() {
+	for _, sbs := range c.getSandboxStates() {
+		c.cleanupSandbox(sbs)
+	}
+}
+
+func (c *controller) cleanupSandbox(sbs *sbState) {
+	var err error
+
+	sb := &sandbox{
+		id:          sbs.ID,
+		controller:  sbs.c,
+		containerID: sbs.Cid,
+		endpoints:   epHeap{},
+		epPriority:  map[string]int{},
+		dbIndex:     sbs.dbIndex,
+		isStub:      true,
+		dbExists:    true,
+	}
+
+	sb.osSbox, err = osl.NewSandbox(sb.Key(), true)
+	if err != nil {
+		logrus.Errorf("failed to create new osl sandbox while trying to build sandbox for cleanup: %v", err)
+		return
+	}
+
+	c.Lock()
+	c.sandboxes[sb.id] = sb
+	c.Unlock()
+
+	for _, eps := range sbs.Eps {
+		n, err := c.getNetworkFromStore(eps.Nid)
+		var ep *endpoint
+		if err != nil {
+			logrus.Errorf("getNetworkFromStore for nid %s failed while trying to build sandbox for cleanup: %v", eps.Nid, err)
+			n = &network{id: eps.Nid, ctrlr: c, drvOnce: &sync.Once{}}
+			ep = &endpoint{id: eps.Eid, network: n, sandboxID: sbs.ID}
+		} else {
+			ep, err = n.getEndpointFromStore(eps.Eid)
+			if err != nil {
+				logrus.Errorf("getEndpointFromStore for eid %s failed while trying to build sandbox for cleanup: %v", eps.Eid, err)
+				ep = &endpoint{id: eps.Eid, network: n, sandboxID: sbs.ID}
+			}
+		}
+
+		heap.Push(&sb.endpoints, ep)
+	}
+
+	if err := sb.Delete(); err != nil {
+		logrus.Errorf("failed to delete sandbox %s while trying to cleanup: %v", sb.id, err)
+	}
+}
+
+// sandboxRestore rebuilds the sandboxes left by a previous instance of
+// the daemon, re-adopting their namespaces and the endpoints joined to
+// them. The sandboxes whose namespace is gone are cleaned up, while the
+// ones which fail to restore otherwise keep their state.
+func (c *controller) sandboxRestore() {
+	for _, sbs := range c.getSandboxStates() {
+		err := c.restoreSandbox(sbs)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(types.NotFoundError); ok {
+			logrus.Warnf("Namespace of sandbox %s is gone, cleaning it up: %v", sbs.ID, err)
+			c.cleanupSandbox(sbs)
+			continue
+		}
+		logrus.Errorf("Failed to restore sandbox %s: %v", sbs.ID, err)
+	}
+}
+
+func (c *controller) restoreSandbox(sbs *sbState) error {
+	var err error
+
+	sb := &sandbox{
+		id:          sbs.ID,
+		containerID: sbs.Cid,
+		config:      sbs.Config.containerConfig(),
+		controller:  c,
+		endpoints:   epHeap{},
+		epPriority:  map[string]int{},
+		dbIndex:     sbs.dbIndex,
+		dbExists:    true,
+	}
+	heap.Init(&sb.endpoints)
+
+	if sb.config.useDefaultSandBox {
+		c.sboxOnce.Do(func() {
+			c.defOsSbox, err = osl.NewSandbox(sb.Key(), false)
+		})
+
+		if err != nil {
+			c.sboxOnce = sync.Once{}
+			return fmt.Errorf("failed to create default sandbox: %v", err)
 		}
 
-		sb.osSbox, err = osl.NewSandbox(sb.Key(), true)
+		sb.osSbox = c.defOsSbox
+	} else if sb.osSbox, err = osl.RestoreSandbox(sb.Key()); err != nil {
+		return err
+	}
+
+	var eps []*endpoint
+	for _, es := range sbs.Eps {
+		n, err := c.getNetworkFromStore(es.Nid)
 		if err != nil {
-			logrus.Errorf("failed to create new osl sandbox while trying to build sandbox for cleanup: %v", err)
+			logrus.Errorf("Failed to get network %s of sandbox %s from store: %v", es.Nid, sb.id, err)
 			continue
 		}
 
-		c.Lock()
-		c.sandboxes[sb.id] = sb
-		c.Unlock()
+		ep, err := n.getEndpointFromStore(es.Eid)
+		if err != nil {
+			logrus.Errorf("Failed to get endpoint %s of sandbox %s from store: %v", es.Eid, sb.id, err)
+			continue
+		}
 
-		for _, eps := range sbs.Eps {
-			n, err := c.getNetworkFromStore(eps.Nid)
-			var ep *endpoint
-			if err != nil {
-				logrus.Errorf("getNetworkFromStore for nid %s failed while trying to build sandbox for cleanup: %v", eps.Nid, err)
-				n = &network{id: eps.Nid, ctrlr: c, drvOnce: &sync.Once{}}
-				ep = &endpoint{id: eps.Eid, network: n, sandboxID: sbs.ID}
-			} else {
-				ep, err = n.getEndpointFromStore(eps.Eid)
-				if err != nil {
-					logrus.Errorf("getEndpointFromStore for eid %s failed while trying to build sandbox for cleanup: %v", eps.Eid, err)
-					ep = &endpoint{id: eps.Eid, network: n, sandboxID: sbs.ID}
-				}
-			}
+		if err := ep.sbRestore(sb); err != nil {
+			logrus.Errorf("Skipping endpoint of sandbox %s: %v", sb.id, err)
+			continue
+		}
+		eps = append(eps, ep)
+	}
 
-			heap.Push(&sb.endpoints, ep)
+	if sb.osSbox != nil && !sb.config.useDefaultSandBox {
+		if err := sb.restoreOSSbox(); err != nil {
+			logrus.Errorf("Failed to restore osl sandbox %s: %v", sb.id, err)
 		}
 
-		if err := sb.Delete(); err != nil {
-			logrus.Errorf("failed to delete sandbox %s while trying to cleanup: %v", sb.id, err)
+		if sb.config.useEmbeddedDNS {
+			if err := sb.startResolver(); err != nil {
+				logrus.Errorf("Failed to start the resolver of sandbox %s: %v", sb.id, err)
+			}
 		}
 	}
+
+	c.Lock()
+	c.sandboxes[sb.id] = sb
+	c.Unlock()
+
+	for _, ep := range eps {
+		c.watchSvcRecord(ep)
+		if err := c.restoreServiceBackend(ep); err != nil {
+			logrus.Warnf("Failed to restore load balancing to endpoint %s: %v", ep.Name(), err)
+		}
+		c.startHealthCheck(ep)
+	}
+
+	logrus.Infof("Restored sandbox %s of container %s", sb.id, sb.containerID)
+
+	return nil
 }
@@ -211,3 +211,110 @@ func TestSandboxAddSamePrio(t *testing.T) {
 
 	osl.GC()
 }
+
+func TestSandboxLiveRestore(t *testing.T) {
+	if !testutils.IsRunningInContainer() {
+		defer testutils.SetupTestOSContext(t)()
+	}
+
+	cfgOptions, err := OptionBoltdbWithRandomDBFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genericOption := map[string]interface{}{
+		netlabel.GenericData: options.Generic{"EnableIPForwarding": true},
+	}
+	cfgOptions = append(cfgOptions, config.OptionLiveRestore(true), config.OptionDriverConfig("bridge", genericOption))
+
+	c, err := New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	netOption := options.Generic{
+		netlabel.GenericData: options.Generic{
+			"BridgeName": "restore_nw",
+		},
+	}
+	nw, err := c.NewNetwork("bridge", "restore_nw", NetworkOptionGeneric(netOption))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := nw.CreateEndpoint("ep1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbx, err := c.NewSandbox("container1", OptionHostname("c1"), OptionExtraHost("web", "10.0.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ep.Join(sbx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace of this sandbox will be gone on restart
+	gone, err := c.NewSandbox("container2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gone.(*sandbox).osSbox.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart the controller
+	c.Stop()
+	c, err = New(cfgOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	if _, err := c.SandboxByID(gone.ID()); err == nil {
+		t.Fatal("Expected the sandbox whose namespace is gone to be cleaned up")
+	}
+
+	s, err := c.SandboxByID(sbx.ID())
+	if err != nil {
+		t.Fatalf("Sandbox was not restored: %v", err)
+	}
+	sb := s.(*sandbox)
+
+	if sb.ContainerID() != "container1" || sb.config.hostName != "c1" ||
+		len(sb.config.extraHosts) != 1 || sb.config.extraHosts[0].IP != "10.0.0.2" {
+		t.Fatalf("Unexpected restored sandbox config %+v", sb.config)
+	}
+
+	eps := sb.getConnectedEndpoints()
+	if len(eps) != 1 || eps[0].ID() != ep.ID() {
+		t.Fatalf("Unexpected restored sandbox endpoints %v", eps)
+	}
+
+	ifaces := sb.osSbox.Info().Interfaces()
+	if len(ifaces) != 1 || ifaces[0].DstName() != "eth0" {
+		t.Fatalf("Unexpected restored sandbox interfaces %v", ifaces)
+	}
+	if !sb.osSbox.Info().Gateway().Equal(eps[0].Gateway()) {
+		t.Fatalf("Unexpected restored sandbox gateway %v", sb.osSbox.Info().Gateway())
+	}
+
+	nw, err = c.NetworkByID(nw.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nw.EndpointByID(ep.ID()); err != nil {
+		t.Fatalf("Endpoint of the restored sandbox was cleaned up: %v", err)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nw.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	osl.GC()
+}
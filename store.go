@@ -247,6 +247,33 @@ func (c *controller) unWatchSvcRecord(ep *endpoint) {
 	c.unWatchCh <- ep
 }
 
+// deleteSvcNames removes the records of the passed names of the endpoint
+// from the service db of its network, except for the names the endpoint
+// is still resolved by
+func (c *controller) deleteSvcNames(ep *endpoint, names []string) {
+	n := ep.getNetwork()
+	if n == nil || len(names) == 0 {
+		return
+	}
+
+	c.Lock()
+	nw, ok := c.nmap[n.ID()]
+	c.Unlock()
+	if !ok {
+		return
+	}
+
+	current := ep.svcNames()
+	var stale []string
+	for _, name := range names {
+		if !hasAlias(current, name) {
+			stale = append(stale, name)
+		}
+	}
+
+	n.updateSvcNames(ep, stale, c.getLocalEps(nw), false)
+}
+
 func (c *controller) networkWatchLoop(nw *netWatch, ep *endpoint, ecCh <-chan datastore.KVObject) {
 	for {
 		select {
@@ -280,8 +307,9 @@ func (c *controller) networkWatchLoop(nw *netWatch, ep *endpoint, ecCh <-chan da
 					// records should reflect the change.
 					// Keep old EP entry in the delEpMap and add
 					// EP from the store (which has the new name)
-					// into the new list
-					if lEp.name == ep.name {
+					// into the new list. Same goes for a change
+					// of the aliases.
+					if lEp.name == ep.name && sameAliases(lEp, ep) {
 						delete(delEpMap, lEp.ID())
 						continue
 					}